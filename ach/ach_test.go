@@ -0,0 +1,163 @@
+package ach
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+func sampleFile() *File {
+	created_at := time.Date(2026, 10, 18, 18, 30, 0, 0, time.UTC)
+
+	return &File{
+		ImmediateDestination:     "091000019",
+		ImmediateOrigin:          "091000019",
+		ImmediateDestinationName: "Federal Reserve",
+		ImmediateOriginName:      "Welloff Bank",
+		CreatedAt:                created_at,
+		FileIdModifier:           "A",
+		ODFI:                     "09100001",
+		Batches: []Batch{
+			{
+				SECCode:          SECConsumer,
+				CompanyName:      "Welloff Bank",
+				CompanyId:        "1234567890",
+				EntryDescription: "Withdrawal",
+				EffectiveDate:    created_at.AddDate(0, 0, 1),
+				Entries: []Entry{
+					{TransactionCode: CheckingCredit, RoutingNumber: "021000021", AccountNumber: "123456789", Amount: decimal.RequireFromString("250.50"), IdentificationNumber: "0192a3b4c5d67e8f", Name: "Jane Doe", TraceNumber: "091000010000001"},
+					{TransactionCode: SavingsCredit, RoutingNumber: "011000015", AccountNumber: "0000987654", Amount: decimal.RequireFromString("10"), IdentificationNumber: "0192a3b4c5d67e90", Name: "John Roe with a name longer than the field", TraceNumber: "091000010000002"},
+				},
+			},
+			{
+				SECCode:          SECCorporate,
+				CompanyName:      "Welloff Bank",
+				CompanyId:        "1234567890",
+				EntryDescription: "Withdrawal",
+				EffectiveDate:    created_at.AddDate(0, 0, 1),
+				Entries: []Entry{
+					{TransactionCode: CheckingCredit, RoutingNumber: "121000358", AccountNumber: "4455667788", Amount: decimal.RequireFromString("99999.99"), IdentificationNumber: "0192a3b4c5d67e91", Name: "Acme Corp", TraceNumber: "091000010000003"},
+				},
+			},
+		},
+	}
+}
+
+func TestValidRoutingNumber(t *testing.T) {
+	cases := map[string]bool{
+		"021000021":  true,
+		"011000015":  true,
+		"091000019":  true,
+		"021000022":  false,
+		"02100002":   false,
+		"0210000210": false,
+		"02100002a":  false,
+	}
+
+	for routing_number, expected := range cases {
+		if ValidRoutingNumber(routing_number) != expected {
+			t.Errorf("ValidRoutingNumber(%q) should be %v", routing_number, expected)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	var output bytes.Buffer
+	err := WriteFile(&output, sampleFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines)%BlockingFactor != 0 {
+		t.Fatalf("file has %d records, not a multiple of %d", len(lines), BlockingFactor)
+	}
+
+	for i, line := range lines {
+		if len(line) != RecordLength {
+			t.Errorf("record %d is %d characters long", i+1, len(line))
+		}
+	}
+
+	// file header, two batches of headers, entries and controls, then the file control
+	file_control := lines[8]
+	if file_control[0] != '9' {
+		t.Fatalf("expected the file control as the 9th record, got %q", file_control)
+	}
+	// 021000021 + 011000015 + 121000358 without their check digits
+	if hash := field(file_control, 22, 31); hash != "0015300038" {
+		t.Errorf("unexpected entry hash %s", hash)
+	}
+	if credit := field(file_control, 44, 55); credit != "000010026049" {
+		t.Errorf("unexpected total credit %s", credit)
+	}
+
+	path := filepath.Join("testdata", "credits.ach")
+	if *update {
+		err = os.WriteFile(path, output.Bytes(), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(output.Bytes(), expected) {
+		t.Errorf("output differs from %s, run the tests with -update if the change is intended\n--- got ---\n%s\n--- expected ---\n%s", path, output.Bytes(), expected)
+	}
+}
+
+func TestWriteFileRejectsInvalidRoutingNumber(t *testing.T) {
+	file := sampleFile()
+	file.Batches[0].Entries[0].RoutingNumber = "021000022"
+
+	err := WriteFile(&bytes.Buffer{}, file)
+	if err == nil {
+		t.Fatal("expected an error for an invalid routing number")
+	}
+}
+
+func TestReadReturns(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "returns.ach"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	returns, err := ReadReturns(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(returns) != 2 {
+		t.Fatalf("expected 2 returns, got %d", len(returns))
+	}
+
+	first := returns[0]
+	if first.ReturnCode != "R03" || first.OriginalTraceNumber != "091000010000001" || !first.Amount.Equal(decimal.RequireFromString("250.50")) || first.AddendaInformation != "NO ACCOUNT" {
+		t.Errorf("unexpected first return %+v", first)
+	}
+
+	second := returns[1]
+	if second.ReturnCode != "R02" || second.OriginalTraceNumber != "091000010000002" || second.TransactionCode != 31 || second.AccountNumber != "0000987654" {
+		t.Errorf("unexpected second return %+v", second)
+	}
+}
+
+func TestReadReturnsRejectsShortRecords(t *testing.T) {
+	_, err := ReadReturns(strings.NewReader("101 091000019\n"))
+	if err == nil {
+		t.Fatal("expected an error for a short record")
+	}
+}
@@ -0,0 +1,270 @@
+package ach
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	RecordLength   = 94
+	BlockingFactor = 10
+)
+
+// Service class codes of a batch
+const (
+	ServiceClassMixed   = 200
+	ServiceClassCredits = 220
+	ServiceClassDebits  = 225
+)
+
+// Standard entry class codes, PPD for consumer accounts and CCD for corporate ones
+const (
+	SECConsumer  = "PPD"
+	SECCorporate = "CCD"
+)
+
+// Transaction codes of the entries
+const (
+	CheckingCredit = 22
+	CheckingDebit  = 27
+	SavingsCredit  = 32
+	SavingsDebit   = 37
+)
+
+var ErrInvalidRoutingNumber = errors.New("invalid routing number")
+
+type Entry struct {
+	TransactionCode int
+	// 9 digits ABA routing number of the receiving bank
+	RoutingNumber string
+	AccountNumber string
+	Amount        decimal.Decimal
+	// individual id for PPD, identification number for CCD
+	IdentificationNumber string
+	// individual name for PPD, receiving company name for CCD
+	Name        string
+	TraceNumber string
+}
+
+type Batch struct {
+	SECCode          string
+	CompanyName      string
+	CompanyId        string
+	EntryDescription string
+	EffectiveDate    time.Time
+	Entries          []Entry
+}
+
+type File struct {
+	// routing number of the bank receiving the file
+	ImmediateDestination     string
+	ImmediateOrigin          string
+	ImmediateDestinationName string
+	ImmediateOriginName      string
+	CreatedAt                time.Time
+	// A-Z, tells apart the files created on the same day
+	FileIdModifier string
+	// first 8 digits of the routing number of the originating bank
+	ODFI    string
+	Batches []Batch
+}
+
+// ValidRoutingNumber checks the length and the check digit of an ABA routing number
+func ValidRoutingNumber(routing_number string) bool {
+	if len(routing_number) != 9 {
+		return false
+	}
+
+	weights := []int{3, 7, 1, 3, 7, 1, 3, 7, 1}
+	sum := 0
+	for i, r := range routing_number {
+		if r < '0' || r > '9' {
+			return false
+		}
+		sum += int(r-'0') * weights[i]
+	}
+
+	return sum%10 == 0
+}
+
+// IsCredit tells whether the transaction code moves money into the receiving account
+func IsCredit(transaction_code int) bool {
+	return transaction_code%10 < 5
+}
+
+// alpha fits text in a left justified, space padded field of an upper case record
+func alpha(text string, length int) string {
+	var builder strings.Builder
+	for _, r := range strings.ToUpper(text) {
+		if builder.Len() == length {
+			break
+		}
+		if r < ' ' || r > '~' {
+			r = ' '
+		}
+		builder.WriteRune(r)
+	}
+
+	return builder.String() + strings.Repeat(" ", length-builder.Len())
+}
+
+// numeric fits a number in a right justified, zero padded field, keeping the lowest digits
+func numeric(number int64, length int) string {
+	text := fmt.Sprintf("%0*d", length, number)
+	return text[len(text)-length:]
+}
+
+// cents returns the amount in cents, the only unit ACH amounts are expressed in
+func cents(amount decimal.Decimal) int64 {
+	return amount.Shift(2).IntPart()
+}
+
+// entryHash sums the first 8 digits of the receiving banks' routing numbers, keeping the lowest 10 digits
+func entryHash(entries []Entry) int64 {
+	var hash int64
+	for _, entry := range entries {
+		var routing int64
+		fmt.Sscanf(entry.RoutingNumber[:8], "%d", &routing)
+		hash += routing
+	}
+
+	return hash % 10_000_000_000
+}
+
+func totals(entries []Entry) (int64, int64) {
+	var debit, credit int64
+	for _, entry := range entries {
+		if IsCredit(entry.TransactionCode) {
+			credit += cents(entry.Amount)
+		} else {
+			debit += cents(entry.Amount)
+		}
+	}
+
+	return debit, credit
+}
+
+func serviceClass(entries []Entry) int {
+	debit, credit := totals(entries)
+	switch {
+	case debit == 0:
+		return ServiceClassCredits
+	case credit == 0:
+		return ServiceClassDebits
+	}
+
+	return ServiceClassMixed
+}
+
+// WriteFile writes the file in the NACHA format, with its header, one batch header, entries and control per batch,
+// the file control and the "9" records padding the file to a multiple of 10 records
+func WriteFile(w io.Writer, file *File) error {
+	records := []string{
+		"1" +
+			"01" +
+			" " + alpha(file.ImmediateDestination, 9) +
+			" " + alpha(file.ImmediateOrigin, 9) +
+			file.CreatedAt.Format("060102") +
+			file.CreatedAt.Format("1504") +
+			alpha(file.FileIdModifier, 1) +
+			"094" +
+			numeric(BlockingFactor, 2) +
+			"1" +
+			alpha(file.ImmediateDestinationName, 23) +
+			alpha(file.ImmediateOriginName, 23) +
+			alpha("", 8),
+	}
+
+	all_entries := []Entry{}
+	for i, batch := range file.Batches {
+		for _, entry := range batch.Entries {
+			if !ValidRoutingNumber(entry.RoutingNumber) {
+				return fmt.Errorf("%w: %s", ErrInvalidRoutingNumber, entry.RoutingNumber)
+			}
+		}
+
+		service_class := serviceClass(batch.Entries)
+		batch_number := int64(i + 1)
+
+		records = append(records, "5"+
+			numeric(int64(service_class), 3)+
+			alpha(batch.CompanyName, 16)+
+			alpha("", 20)+
+			alpha(batch.CompanyId, 10)+
+			alpha(batch.SECCode, 3)+
+			alpha(batch.EntryDescription, 10)+
+			alpha("", 6)+
+			batch.EffectiveDate.Format("060102")+
+			alpha("", 3)+
+			"1"+
+			alpha(file.ODFI, 8)+
+			numeric(batch_number, 7),
+		)
+
+		for _, entry := range batch.Entries {
+			records = append(records, "6"+
+				numeric(int64(entry.TransactionCode), 2)+
+				entry.RoutingNumber+
+				alpha(entry.AccountNumber, 17)+
+				numeric(cents(entry.Amount), 10)+
+				alpha(entry.IdentificationNumber, 15)+
+				alpha(entry.Name, 22)+
+				alpha("", 2)+
+				"0"+
+				alpha(entry.TraceNumber, 15),
+			)
+		}
+
+		debit, credit := totals(batch.Entries)
+		records = append(records, "8"+
+			numeric(int64(service_class), 3)+
+			numeric(int64(len(batch.Entries)), 6)+
+			numeric(entryHash(batch.Entries), 10)+
+			numeric(debit, 12)+
+			numeric(credit, 12)+
+			alpha(batch.CompanyId, 10)+
+			alpha("", 19)+
+			alpha("", 6)+
+			alpha(file.ODFI, 8)+
+			numeric(batch_number, 7),
+		)
+
+		all_entries = append(all_entries, batch.Entries...)
+	}
+
+	// the file control is counted in the blocks too
+	blocks := (len(records) + 1 + BlockingFactor - 1) / BlockingFactor
+
+	debit, credit := totals(all_entries)
+	records = append(records, "9"+
+		numeric(int64(len(file.Batches)), 6)+
+		numeric(int64(blocks), 6)+
+		numeric(int64(len(all_entries)), 8)+
+		numeric(entryHash(all_entries), 10)+
+		numeric(debit, 12)+
+		numeric(credit, 12)+
+		alpha("", 39),
+	)
+
+	for len(records)%BlockingFactor != 0 {
+		records = append(records, strings.Repeat("9", RecordLength))
+	}
+
+	for _, record := range records {
+		if len(record) != RecordLength {
+			return fmt.Errorf("record is %d characters long instead of %d: %q", len(record), RecordLength, record)
+		}
+
+		_, err := io.WriteString(w, record+"\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
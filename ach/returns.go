@@ -0,0 +1,115 @@
+package ach
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// addenda type code of the addenda carrying the return of an entry
+const returnAddendaType = "99"
+
+var ErrInvalidRecord = errors.New("invalid ACH record")
+
+// ReturnReasons are the descriptions of the most common return reason codes
+var ReturnReasons = map[string]string{
+	"R01": "Insufficient funds",
+	"R02": "Account closed",
+	"R03": "No account or unable to locate account",
+	"R04": "Invalid account number",
+	"R06": "Returned per ODFI's request",
+	"R07": "Authorization revoked by customer",
+	"R08": "Payment stopped",
+	"R10": "Customer advises not authorized",
+	"R14": "Representative payee deceased",
+	"R15": "Beneficiary or account holder deceased",
+	"R16": "Account frozen",
+	"R17": "File record edit criteria",
+	"R20": "Non-transaction account",
+	"R23": "Credit entry refused by receiver",
+	"R24": "Duplicate entry",
+	"R29": "Corporate customer advises not authorized",
+}
+
+type Return struct {
+	// transaction code of the return entry, like 21 for a returned checking credit
+	TransactionCode int
+	RoutingNumber   string
+	AccountNumber   string
+	Amount          decimal.Decimal
+	ReturnCode      string
+	// trace number of the entry being returned, as it was sent in the original file
+	OriginalTraceNumber string
+	AddendaInformation  string
+}
+
+func field(record string, start int, end int) string {
+	return strings.TrimSpace(record[start-1 : end])
+}
+
+// ReadReturns reads the return entries of an ACH file, the entries with a "99" addenda.
+// Positions in the records are 1 based as in the NACHA rules.
+func ReadReturns(r io.Reader) ([]Return, error) {
+	returns := []Return{}
+	var entry *Return
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		record := strings.TrimRight(scanner.Text(), "\r")
+		if record == "" {
+			continue
+		}
+
+		if len(record) != RecordLength {
+			return nil, fmt.Errorf("%w: line %d is %d characters long", ErrInvalidRecord, line, len(record))
+		}
+
+		switch record[0] {
+		case '6':
+			transaction_code, err := strconv.Atoi(field(record, 2, 3))
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d has an invalid transaction code", ErrInvalidRecord, line)
+			}
+
+			amount, err := strconv.ParseInt(field(record, 30, 39), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: line %d has an invalid amount", ErrInvalidRecord, line)
+			}
+
+			entry = &Return{
+				TransactionCode: transaction_code,
+				RoutingNumber:   field(record, 4, 12),
+				AccountNumber:   field(record, 13, 29),
+				Amount:          decimal.New(amount, -2),
+			}
+		case '7':
+			if field(record, 2, 3) != returnAddendaType {
+				continue
+			}
+
+			if entry == nil {
+				return nil, fmt.Errorf("%w: line %d is a return addenda without an entry", ErrInvalidRecord, line)
+			}
+
+			entry.ReturnCode = field(record, 4, 6)
+			entry.OriginalTraceNumber = field(record, 7, 21)
+			entry.AddendaInformation = field(record, 36, 79)
+			returns = append(returns, *entry)
+			entry = nil
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return returns, nil
+}
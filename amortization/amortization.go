@@ -0,0 +1,162 @@
+package amortization
+
+import (
+	"errors"
+	"time"
+	"welloff-bank/schedule"
+
+	"github.com/shopspring/decimal"
+)
+
+// Amortization methods
+const (
+	// French table, every installment pays the same
+	Price = "price"
+	// Sistema de Amortização Constante, every installment repays the same principal
+	SAC = "sac"
+)
+
+// longest term a loan can have, in months
+const MaxTermMonths = 480
+
+var ErrInvalidMethod = errors.New("method must be price or sac")
+var ErrInvalidPrincipal = errors.New("principal must be positive")
+var ErrInvalidRate = errors.New("annual rate must be a fraction between 0 and 1")
+var ErrInvalidTerm = errors.New("term must be between 1 and 480 months")
+var ErrPrincipalTooSmall = errors.New("principal is too small to be repaid over the term")
+
+type Installment struct {
+	// counting from 1
+	Number    int
+	DueDate   time.Time
+	Principal decimal.Decimal
+	Interest  decimal.Decimal
+	// principal plus interest
+	Amount decimal.Decimal
+	// principal left after the installment is paid
+	Balance decimal.Decimal
+}
+
+// MonthlyRate is the nominal annual rate spread evenly over the months
+func MonthlyRate(annual_rate decimal.Decimal) decimal.Decimal {
+	return annual_rate.Div(decimal.NewFromInt(12))
+}
+
+// DueDate is the due date of the nth installment, counting from 1, months after the first one on the same day
+// or on the last day of shorter months
+func DueDate(first_due_date time.Time, n int) time.Time {
+	recurrence := schedule.Recurrence{Frequency: schedule.Monthly, StartDate: first_due_date, Adjustment: schedule.NoAdjustment}
+	date, _ := recurrence.Occurrence(n - 1)
+
+	return date
+}
+
+// Schedule amortizes the principal over the months at a fixed rate. Every amount is rounded half up to the
+// minor unit of the currency, the rounding drift is pushed into the final installment, which repays exactly
+// the principal left.
+func Schedule(principal decimal.Decimal, annual_rate decimal.Decimal, months int, first_due_date time.Time, method string, minor_units int32) ([]Installment, error) {
+	if !principal.IsPositive() {
+		return nil, ErrInvalidPrincipal
+	}
+
+	if annual_rate.IsNegative() || annual_rate.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return nil, ErrInvalidRate
+	}
+
+	if months < 1 || months > MaxTermMonths {
+		return nil, ErrInvalidTerm
+	}
+
+	rate := MonthlyRate(annual_rate)
+	n := decimal.NewFromInt(int64(months))
+
+	// what every installment pays with Price, or repays of the principal with SAC
+	var level decimal.Decimal
+	switch method {
+	case Price:
+		if rate.IsZero() {
+			level = principal.Div(n).Round(minor_units)
+		} else {
+			// principal * i / (1 - (1 + i)^-n)
+			discount := decimal.NewFromInt(1).Add(rate).Pow(n.Neg())
+			level = principal.Mul(rate).Div(decimal.NewFromInt(1).Sub(discount)).Round(minor_units)
+		}
+	case SAC:
+		level = principal.Div(n).Round(minor_units)
+	default:
+		return nil, ErrInvalidMethod
+	}
+
+	if !level.IsPositive() {
+		return nil, ErrPrincipalTooSmall
+	}
+
+	installments := []Installment{}
+	balance := principal
+	for i := 1; i <= months; i++ {
+		interest := balance.Mul(rate).Round(minor_units)
+
+		var repaid decimal.Decimal
+		if method == Price {
+			repaid = level.Sub(interest)
+		} else {
+			repaid = level
+		}
+
+		if i == months || repaid.GreaterThan(balance) {
+			repaid = balance
+		}
+
+		balance = balance.Sub(repaid)
+		installments = append(installments, Installment{
+			Number:    i,
+			DueDate:   DueDate(first_due_date, i),
+			Principal: repaid,
+			Interest:  interest,
+			Amount:    repaid.Add(interest),
+			Balance:   balance,
+		})
+	}
+
+	return installments, nil
+}
+
+type Quote struct {
+	// principal not repaid yet
+	Principal decimal.Decimal `json:"principal"`
+	// interest of the overdue installments plus the interest accrued since the last due date
+	Interest decimal.Decimal `json:"interest"`
+	LateFees decimal.Decimal `json:"late_fees"`
+	Total    decimal.Decimal `json:"total"`
+}
+
+// Payoff quotes what repays the loan on the as_of day: the principal not repaid yet, the interest and late fees
+// of the overdue installments, and the interest the rest of the principal accrued over the days elapsed of the
+// current period, from period_start, the previous due date, to period_end, the next one
+func Payoff(outstanding decimal.Decimal, annual_rate decimal.Decimal, overdue []Installment, late_fees decimal.Decimal, period_start time.Time, period_end time.Time, as_of time.Time, minor_units int32) Quote {
+	quote := Quote{Principal: outstanding, Interest: decimal.Zero, LateFees: late_fees}
+
+	accruing := outstanding
+	for _, installment := range overdue {
+		quote.Interest = quote.Interest.Add(installment.Interest)
+		accruing = accruing.Sub(installment.Principal)
+	}
+
+	period_days := schedule.Date(period_end).Sub(schedule.Date(period_start)).Hours() / 24
+	elapsed_days := schedule.Date(as_of).Sub(schedule.Date(period_start)).Hours() / 24
+	if elapsed_days > period_days {
+		elapsed_days = period_days
+	}
+
+	if period_days > 0 && elapsed_days > 0 && accruing.IsPositive() {
+		accrued := accruing.Mul(MonthlyRate(annual_rate)).
+			Mul(decimal.NewFromFloat(elapsed_days)).
+			Div(decimal.NewFromFloat(period_days)).
+			Round(minor_units)
+		quote.Interest = quote.Interest.Add(accrued)
+	}
+
+	quote.Total = quote.Principal.Add(quote.Interest).Add(quote.LateFees)
+
+	return quote
+}
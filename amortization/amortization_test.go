@@ -0,0 +1,141 @@
+package amortization
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func day(text string) time.Time {
+	date, err := time.Parse("2006-01-02", text)
+	if err != nil {
+		panic(err)
+	}
+
+	return date
+}
+
+func assertAmount(t *testing.T, name string, got decimal.Decimal, expected string) {
+	t.Helper()
+
+	if !got.Equal(decimal.RequireFromString(expected)) {
+		t.Errorf("%s: expected %s, got %s", name, expected, got)
+	}
+}
+
+func assertRepaysPrincipal(t *testing.T, installments []Installment, principal string) {
+	t.Helper()
+
+	repaid := decimal.Zero
+	for _, installment := range installments {
+		repaid = repaid.Add(installment.Principal)
+
+		if !installment.Amount.Equal(installment.Principal.Add(installment.Interest)) {
+			t.Errorf("installment %d: amount is not principal plus interest", installment.Number)
+		}
+
+		if !installment.Amount.Equal(installment.Amount.Round(2)) {
+			t.Errorf("installment %d: %s is not exact to the cent", installment.Number, installment.Amount)
+		}
+	}
+
+	assertAmount(t, "repaid principal", repaid, principal)
+	assertAmount(t, "final balance", installments[len(installments)-1].Balance, "0")
+}
+
+func TestPrice(t *testing.T) {
+	installments, err := Schedule(decimal.NewFromInt(10000), decimal.RequireFromString("0.12"), 12, day("2026-11-30"), Price, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRepaysPrincipal(t, installments, "10000")
+
+	// 10000 * 0.01 / (1 - 1.01^-12) = 888.4878...
+	for _, installment := range installments[:11] {
+		assertAmount(t, "level payment", installment.Amount, "888.49")
+	}
+
+	assertAmount(t, "first interest", installments[0].Interest, "100")
+	assertAmount(t, "first principal", installments[0].Principal, "788.49")
+	// the drift of rounding the level payment up is taken off the last one
+	assertAmount(t, "final payment", installments[11].Amount, "888.47")
+	assertAmount(t, "final interest", installments[11].Interest, "8.80")
+}
+
+func TestSAC(t *testing.T) {
+	installments, err := Schedule(decimal.NewFromInt(10000), decimal.RequireFromString("0.12"), 12, day("2026-11-30"), SAC, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRepaysPrincipal(t, installments, "10000")
+
+	assertAmount(t, "first payment", installments[0].Amount, "933.33")
+	assertAmount(t, "second interest", installments[1].Interest, "91.67")
+	// 833.33 * 11 leaves 833.37 for the last one
+	assertAmount(t, "final principal", installments[11].Principal, "833.37")
+	assertAmount(t, "final interest", installments[11].Interest, "8.33")
+}
+
+func TestZeroRate(t *testing.T) {
+	installments, err := Schedule(decimal.NewFromInt(100), decimal.Zero, 3, day("2026-11-30"), Price, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertRepaysPrincipal(t, installments, "100")
+	assertAmount(t, "final payment", installments[2].Amount, "33.34")
+}
+
+func TestDueDatesKeepTheDay(t *testing.T) {
+	installments, err := Schedule(decimal.NewFromInt(300), decimal.RequireFromString("0.1"), 3, day("2026-12-31"), SAC, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"2026-12-31", "2027-01-31", "2027-02-28"}
+	for i, installment := range installments {
+		if installment.DueDate.Format("2006-01-02") != expected[i] {
+			t.Errorf("installment %d: expected %s, got %s", installment.Number, expected[i], installment.DueDate.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	cases := map[string]error{
+		"sac":    ErrPrincipalTooSmall,
+		"price":  ErrPrincipalTooSmall,
+		"bullet": ErrInvalidMethod,
+	}
+
+	for method, expected := range cases {
+		_, err := Schedule(decimal.RequireFromString("0.01"), decimal.RequireFromString("0.1"), 12, day("2026-11-30"), method, 2)
+		if err != expected {
+			t.Errorf("%s: expected %v, got %v", method, expected, err)
+		}
+	}
+
+	_, err := Schedule(decimal.NewFromInt(100), decimal.NewFromInt(1), 12, day("2026-11-30"), Price, 2)
+	if err != ErrInvalidRate {
+		t.Errorf("expected %v, got %v", ErrInvalidRate, err)
+	}
+}
+
+func TestPayoff(t *testing.T) {
+	installments, err := Schedule(decimal.NewFromInt(10000), decimal.RequireFromString("0.12"), 12, day("2026-11-30"), SAC, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// first installment paid, the second is overdue and charged a late fee, 15 of the 31 days of the third period elapsed
+	outstanding := installments[0].Balance
+	quote := Payoff(outstanding, decimal.RequireFromString("0.12"), installments[1:2], decimal.NewFromInt(25), day("2026-12-31"), day("2027-01-31"), day("2027-01-15"), 2)
+
+	assertAmount(t, "principal", quote.Principal, "9166.67")
+	// 91.67 overdue plus 8333.34 * 0.01 * 15 / 31
+	assertAmount(t, "interest", quote.Interest, "131.99")
+	assertAmount(t, "late fees", quote.LateFees, "25")
+	assertAmount(t, "total", quote.Total, "9323.66")
+}
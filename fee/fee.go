@@ -0,0 +1,83 @@
+package fee
+
+import (
+	"errors"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	Transfer    = "transfer"
+	Withdrawal  = "withdrawal"
+	Maintenance = "maintenance"
+	FxSpread    = "fx_spread"
+)
+
+var ErrInvalidKind = errors.New("kind must be transfer, withdrawal, maintenance or fx_spread")
+var ErrNegative = errors.New("flat, percentage and amounts must not be negative")
+var ErrInvalidPercentage = errors.New("percentage must be below 1")
+var ErrMinAboveMax = errors.New("min_amount is above max_amount")
+var ErrTooPrecise = errors.New("amounts have more decimal places than the currency allows")
+
+func Validate(rule *model.FeeRule) error {
+	switch rule.Kind {
+	case Transfer, Withdrawal, Maintenance, FxSpread:
+	default:
+		return ErrInvalidKind
+	}
+
+	amounts := []*decimal.Decimal{&rule.Flat, rule.MinAmount, rule.MaxAmount, rule.WaiveAboveBalance}
+	for _, amount := range amounts {
+		if amount == nil {
+			continue
+		}
+
+		if amount.IsNegative() {
+			return ErrNegative
+		}
+
+		if !model.IsValidAmount(*amount, rule.Currency) {
+			return ErrTooPrecise
+		}
+	}
+
+	if rule.Percentage.IsNegative() {
+		return ErrNegative
+	}
+
+	if rule.Percentage.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return ErrInvalidPercentage
+	}
+
+	if rule.MinAmount != nil && rule.MaxAmount != nil && rule.MinAmount.GreaterThan(*rule.MaxAmount) {
+		return ErrMinAboveMax
+	}
+
+	return nil
+}
+
+// TransactionFee is the flat fee plus the percentage of the amount, kept within the min and max amounts
+// and rounded half up to the minor unit of the currency
+func TransactionFee(rule *model.FeeRule, amount decimal.Decimal) decimal.Decimal {
+	fee := rule.Flat.Add(amount.Mul(rule.Percentage))
+
+	if rule.MinAmount != nil && fee.LessThan(*rule.MinAmount) {
+		fee = *rule.MinAmount
+	}
+
+	if rule.MaxAmount != nil && fee.GreaterThan(*rule.MaxAmount) {
+		fee = *rule.MaxAmount
+	}
+
+	return fee.Round(model.CurrencyMinorUnits[rule.Currency])
+}
+
+// MaintenanceFee is the monthly fee of an account that ended the month with the balance, nothing when waived
+func MaintenanceFee(rule *model.FeeRule, balance decimal.Decimal) decimal.Decimal {
+	if rule.WaiveAboveBalance != nil && balance.GreaterThanOrEqual(*rule.WaiveAboveBalance) {
+		return decimal.Zero
+	}
+
+	return rule.Flat
+}
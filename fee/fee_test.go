@@ -0,0 +1,86 @@
+package fee
+
+import (
+	"testing"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+func amount(text string) *decimal.Decimal {
+	d := decimal.RequireFromString(text)
+	return &d
+}
+
+func TestTransactionFee(t *testing.T) {
+	rule := model.FeeRule{
+		Currency:   "USD",
+		Kind:       Transfer,
+		Flat:       decimal.RequireFromString("0.25"),
+		Percentage: decimal.RequireFromString("0.015"),
+		MinAmount:  amount("1"),
+		MaxAmount:  amount("20"),
+	}
+
+	cases := map[string]string{
+		// 0.25 + 0.15 is below the minimum
+		"10": "1",
+		// 0.25 + 1.5
+		"100": "1.75",
+		// 0.25 + 0.0150015 rounds half up to the cent
+		"1.0001": "1",
+		"333.33": "5.25",
+		// 0.25 + 30 is above the maximum
+		"2000": "20",
+	}
+
+	for transaction_amount, expected := range cases {
+		got := TransactionFee(&rule, decimal.RequireFromString(transaction_amount))
+		if !got.Equal(decimal.RequireFromString(expected)) {
+			t.Errorf("%s: expected %s, got %s", transaction_amount, expected, got)
+		}
+	}
+}
+
+func TestTransactionFeeRoundsToTheCurrency(t *testing.T) {
+	rule := model.FeeRule{Currency: "JPY", Kind: Withdrawal, Percentage: decimal.RequireFromString("0.003")}
+
+	got := TransactionFee(&rule, decimal.NewFromInt(12345))
+	if !got.Equal(decimal.NewFromInt(37)) {
+		t.Fatalf("expected 37, got %s", got)
+	}
+}
+
+func TestMaintenanceFeeIsWaivedAboveTheBalance(t *testing.T) {
+	rule := model.FeeRule{Currency: "USD", Kind: Maintenance, Flat: decimal.RequireFromString("5"), WaiveAboveBalance: amount("1500")}
+
+	if got := MaintenanceFee(&rule, decimal.RequireFromString("1499.99")); !got.Equal(decimal.NewFromInt(5)) {
+		t.Errorf("expected 5, got %s", got)
+	}
+
+	if got := MaintenanceFee(&rule, decimal.RequireFromString("1500")); !got.IsZero() {
+		t.Errorf("expected the fee to be waived, got %s", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	invalid := []model.FeeRule{
+		{Currency: "USD", Kind: "deposit"},
+		{Currency: "USD", Kind: Transfer, Flat: decimal.RequireFromString("-1")},
+		{Currency: "USD", Kind: Transfer, Flat: decimal.RequireFromString("0.001")},
+		{Currency: "USD", Kind: Transfer, Percentage: decimal.NewFromInt(1)},
+		{Currency: "USD", Kind: Transfer, MinAmount: amount("5"), MaxAmount: amount("1")},
+	}
+
+	for _, rule := range invalid {
+		if Validate(&rule) == nil {
+			t.Errorf("expected %+v to be invalid", rule)
+		}
+	}
+
+	valid := model.FeeRule{Currency: "USD", Kind: FxSpread, Percentage: decimal.RequireFromString("0.01")}
+	err := Validate(&valid)
+	if err != nil {
+		t.Errorf("expected a valid rule, got %s", err)
+	}
+}
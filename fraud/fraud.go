@@ -0,0 +1,284 @@
+package fraud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Outcomes of a decision, from the least to the most severe
+const (
+	Allow = "allow"
+	// the transaction is made pending until it is reviewed
+	Hold  = "hold"
+	Block = "block"
+)
+
+// Rule types
+const (
+	// more than max_count outbound transactions within window_minutes
+	Velocity = "velocity"
+	// first transfer to an account, above min_amount
+	NewPayee = "new_payee"
+	// above factor times the average amount of the account, from min_history past transactions on
+	AmountAboveAverage = "amount_above_average"
+	// made within window_minutes of one of the security events of the user
+	RecentSecurityEvent = "recent_security_event"
+	// above min_amount, whatever the account did before
+	LargeAmount = "large_amount"
+)
+
+// Security events
+const (
+	SessionCreated  = "session_created"
+	PasswordChanged = "password_changed"
+)
+
+// how far back the history of the account is considered
+const HistoryWindow = 90 * 24 * time.Hour
+
+// transaction kinds the rules apply to when a rule names none
+var OutboundKinds = []string{"withdrawal", "transfer", "exchange", "refund"}
+
+type Rule struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// 'hold' | 'block'
+	Outcome string `json:"outcome"`
+	// transaction kinds it applies to, every outbound kind when empty
+	Kinds []string `json:"kinds"`
+	// accounts of the currency only, every account when empty
+	Currency string `json:"currency"`
+	// only transactions above it match, applies to every type
+	MinAmount decimal.Decimal `json:"min_amount"`
+	// velocity
+	MaxCount int `json:"max_count"`
+	// velocity and recent_security_event
+	WindowMinutes int `json:"window_minutes"`
+	// amount_above_average
+	Factor     decimal.Decimal `json:"factor"`
+	MinHistory int             `json:"min_history"`
+	// recent_security_event, 'session_created' | 'password_changed'
+	Events []string `json:"events"`
+}
+
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+var ErrMissingName = errors.New("rule has no name")
+var ErrDuplicateName = errors.New("rule name is used twice")
+var ErrInvalidType = errors.New("type must be velocity, new_payee, amount_above_average, recent_security_event or large_amount")
+var ErrInvalidOutcome = errors.New("outcome must be hold or block")
+var ErrInvalidKind = errors.New("kinds must be withdrawal, transfer, exchange or refund")
+var ErrInvalidWindow = errors.New("window_minutes must be positive and within 90 days")
+var ErrInvalidMaxCount = errors.New("max_count must not be negative")
+var ErrInvalidFactor = errors.New("factor must be above 1")
+var ErrInvalidEvent = errors.New("events must be session_created or password_changed")
+var ErrInvalidMinAmount = errors.New("min_amount must be positive")
+
+func (rule *Rule) Validate() error {
+	if rule.Name == "" {
+		return ErrMissingName
+	}
+
+	if rule.Outcome != Hold && rule.Outcome != Block {
+		return ErrInvalidOutcome
+	}
+
+	for _, kind := range rule.Kinds {
+		if !slices.Contains(OutboundKinds, kind) {
+			return ErrInvalidKind
+		}
+	}
+
+	switch rule.Type {
+	case Velocity:
+		if rule.MaxCount < 0 {
+			return ErrInvalidMaxCount
+		}
+	case NewPayee:
+	case AmountAboveAverage:
+		if !rule.Factor.GreaterThan(decimal.NewFromInt(1)) {
+			return ErrInvalidFactor
+		}
+	case RecentSecurityEvent:
+		if len(rule.Events) == 0 {
+			return ErrInvalidEvent
+		}
+
+		for _, event := range rule.Events {
+			if event != SessionCreated && event != PasswordChanged {
+				return ErrInvalidEvent
+			}
+		}
+	case LargeAmount:
+		if !rule.MinAmount.IsPositive() {
+			return ErrInvalidMinAmount
+		}
+	default:
+		return ErrInvalidType
+	}
+
+	if rule.Type == Velocity || rule.Type == RecentSecurityEvent {
+		if rule.WindowMinutes <= 0 || time.Duration(rule.WindowMinutes)*time.Minute > HistoryWindow {
+			return ErrInvalidWindow
+		}
+	}
+
+	return nil
+}
+
+// ParseConfig reads the rules from JSON, failing on unknown fields and invalid rules
+func ParseConfig(r io.Reader) (*Config, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	config := Config{}
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+
+		err = rule.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %d: %w", i, ErrDuplicateName)
+		}
+		names[rule.Name] = true
+	}
+
+	return &config, nil
+}
+
+// Movement is a past outbound transaction of the account
+type Movement struct {
+	Amount decimal.Decimal
+	At     time.Time
+}
+
+// Facts are what the rules know of a transaction about to be made
+type Facts struct {
+	Kind     string
+	Currency string
+	Amount   decimal.Decimal
+	// outbound transactions of the account within the history window, this one excluded
+	History []Movement
+	// nil when the transaction pays no account, like withdrawals
+	KnownPayee *bool
+	// when each security event last happened to the user
+	SecurityEvents map[string]time.Time
+	Now            time.Time
+}
+
+type Decision struct {
+	// 'allow' | 'hold' | 'block'
+	Outcome string `json:"outcome"`
+	// names of the rules that matched
+	MatchedRules []string `json:"matched_rules"`
+}
+
+func severity(outcome string) int {
+	switch outcome {
+	case Hold:
+		return 1
+	case Block:
+		return 2
+	}
+
+	return 0
+}
+
+// Matches tells whether the rule flags the transaction
+func (rule *Rule) Matches(facts *Facts) bool {
+	kinds := rule.Kinds
+	if len(kinds) == 0 {
+		kinds = OutboundKinds
+	}
+
+	if !slices.Contains(kinds, facts.Kind) {
+		return false
+	}
+
+	if rule.Currency != "" && rule.Currency != facts.Currency {
+		return false
+	}
+
+	if !facts.Amount.GreaterThan(rule.MinAmount) {
+		return false
+	}
+
+	window := time.Duration(rule.WindowMinutes) * time.Minute
+
+	switch rule.Type {
+	case Velocity:
+		count := 0
+		for _, movement := range facts.History {
+			if movement.At.After(facts.Now.Add(-window)) {
+				count++
+			}
+		}
+
+		// this transaction would be one more
+		return count+1 > rule.MaxCount
+	case NewPayee:
+		return facts.KnownPayee != nil && !*facts.KnownPayee
+	case AmountAboveAverage:
+		if len(facts.History) == 0 || len(facts.History) < rule.MinHistory {
+			return false
+		}
+
+		total := decimal.Zero
+		for _, movement := range facts.History {
+			total = total.Add(movement.Amount)
+		}
+		average := total.Div(decimal.NewFromInt(int64(len(facts.History))))
+
+		return facts.Amount.GreaterThan(average.Mul(rule.Factor))
+	case RecentSecurityEvent:
+		for _, event := range rule.Events {
+			at, ok := facts.SecurityEvents[event]
+			if ok && at.After(facts.Now.Add(-window)) {
+				return true
+			}
+		}
+	case LargeAmount:
+		return true
+	}
+
+	return false
+}
+
+// Evaluate runs every rule against the facts, the decision takes the most severe outcome of the rules matched
+func (config *Config) Evaluate(facts *Facts) Decision {
+	decision := Decision{Outcome: Allow, MatchedRules: []string{}}
+	if config == nil {
+		return decision
+	}
+
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if !rule.Matches(facts) {
+			continue
+		}
+
+		decision.MatchedRules = append(decision.MatchedRules, rule.Name)
+		if severity(rule.Outcome) > severity(decision.Outcome) {
+			decision.Outcome = rule.Outcome
+		}
+	}
+
+	return decision
+}
@@ -0,0 +1,195 @@
+package fraud
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func amount(text string) decimal.Decimal {
+	return decimal.RequireFromString(text)
+}
+
+func history(amounts ...string) []Movement {
+	movements := []Movement{}
+	for i, a := range amounts {
+		movements = append(movements, Movement{Amount: amount(a), At: now.Add(-time.Duration(i+1) * time.Hour)})
+	}
+
+	return movements
+}
+
+func TestSampleConfig(t *testing.T) {
+	file, err := os.Open("rules.sample.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	config, err := ParseConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Rules) != 7 {
+		t.Errorf("expected 7 rules, got %d", len(config.Rules))
+	}
+}
+
+func TestParseConfigRejectsInvalidRules(t *testing.T) {
+	cases := map[string]error{
+		`{"rules": [{"name": "a", "type": "velocity", "outcome": "allow", "window_minutes": 1}]}`:                                    ErrInvalidOutcome,
+		`{"rules": [{"name": "a", "type": "geo", "outcome": "hold"}]}`:                                                               ErrInvalidType,
+		`{"rules": [{"name": "a", "type": "velocity", "outcome": "hold"}]}`:                                                          ErrInvalidWindow,
+		`{"rules": [{"name": "a", "type": "new_payee", "outcome": "hold", "kinds": ["deposit"]}]}`:                                   ErrInvalidKind,
+		`{"rules": [{"name": "a", "type": "amount_above_average", "outcome": "hold", "factor": "1"}]}`:                               ErrInvalidFactor,
+		`{"rules": [{"name": "a", "type": "recent_security_event", "outcome": "hold", "window_minutes": 5}]}`:                        ErrInvalidEvent,
+		`{"rules": [{"name": "a", "type": "large_amount", "outcome": "hold"}]}`:                                                      ErrInvalidMinAmount,
+		`{"rules": [{"name": "a", "type": "new_payee", "outcome": "hold"}, {"name": "a", "type": "new_payee", "outcome": "block"}]}`: ErrDuplicateName,
+	}
+
+	for text, expected := range cases {
+		_, err := ParseConfig(strings.NewReader(text))
+		if !errors.Is(err, expected) {
+			t.Errorf("%s: expected %v, got %v", text, expected, err)
+		}
+	}
+
+	_, err := ParseConfig(strings.NewReader(`{"rules": [{"name": "a", "type": "new_payee", "outcome": "hold", "threshold": "10"}]}`))
+	if err == nil {
+		t.Error("unknown fields: expected an error")
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	rule := Rule{Name: "velocity", Type: Velocity, Outcome: Hold, MaxCount: 3, WindowMinutes: 10}
+	facts := Facts{Kind: "transfer", Amount: amount("10"), Now: now, History: []Movement{
+		{Amount: amount("10"), At: now.Add(-time.Minute)},
+		{Amount: amount("10"), At: now.Add(-5 * time.Minute)},
+		{Amount: amount("10"), At: now.Add(-11 * time.Minute)},
+	}}
+
+	if rule.Matches(&facts) {
+		t.Error("third transfer in 10 minutes: expected no match")
+	}
+
+	facts.History = append(facts.History, Movement{Amount: amount("10"), At: now.Add(-9 * time.Minute)})
+	if !rule.Matches(&facts) {
+		t.Error("fourth transfer in 10 minutes: expected a match")
+	}
+}
+
+func TestNewPayee(t *testing.T) {
+	rule := Rule{Name: "new_payee", Type: NewPayee, Outcome: Hold, MinAmount: amount("1000")}
+	known := true
+	unknown := false
+
+	cases := []struct {
+		amount  string
+		known   *bool
+		kind    string
+		matches bool
+	}{
+		{"1500", &unknown, "transfer", true},
+		{"1000", &unknown, "transfer", false},
+		{"1500", &known, "transfer", false},
+		{"1500", nil, "withdrawal", false},
+	}
+
+	for _, c := range cases {
+		facts := Facts{Kind: c.kind, Amount: amount(c.amount), KnownPayee: c.known, Now: now}
+		if rule.Matches(&facts) != c.matches {
+			t.Errorf("%s %s known=%v: expected match %t", c.kind, c.amount, c.known, c.matches)
+		}
+	}
+}
+
+func TestAmountAboveAverage(t *testing.T) {
+	rule := Rule{Name: "average", Type: AmountAboveAverage, Outcome: Hold, Factor: amount("5"), MinHistory: 3}
+
+	// average 20, five times is 100
+	facts := Facts{Kind: "withdrawal", Amount: amount("100.01"), History: history("10", "20", "30"), Now: now}
+	if !rule.Matches(&facts) {
+		t.Error("above five times the average: expected a match")
+	}
+
+	facts.Amount = amount("100")
+	if rule.Matches(&facts) {
+		t.Error("at five times the average: expected no match")
+	}
+
+	facts = Facts{Kind: "withdrawal", Amount: amount("1000"), History: history("10", "20"), Now: now}
+	if rule.Matches(&facts) {
+		t.Error("too little history: expected no match")
+	}
+}
+
+func TestRecentSecurityEvent(t *testing.T) {
+	rule := Rule{Name: "password", Type: RecentSecurityEvent, Outcome: Block, Events: []string{PasswordChanged}, WindowMinutes: 60}
+	facts := Facts{Kind: "exchange", Amount: amount("1"), Now: now, SecurityEvents: map[string]time.Time{
+		PasswordChanged: now.Add(-30 * time.Minute),
+		SessionCreated:  now.Add(-time.Minute),
+	}}
+
+	if !rule.Matches(&facts) {
+		t.Error("password changed 30 minutes ago: expected a match")
+	}
+
+	facts.SecurityEvents[PasswordChanged] = now.Add(-2 * time.Hour)
+	if rule.Matches(&facts) {
+		t.Error("password changed 2 hours ago: expected no match")
+	}
+}
+
+func TestLargeAmount(t *testing.T) {
+	rule := Rule{Name: "large", Type: LargeAmount, Outcome: Hold, Kinds: []string{"withdrawal"}, MinAmount: amount("10000")}
+
+	cases := []struct {
+		amount  string
+		kind    string
+		matches bool
+	}{
+		{"10000.01", "withdrawal", true},
+		{"10000", "withdrawal", false},
+		{"50000", "transfer", false},
+	}
+
+	for _, c := range cases {
+		facts := Facts{Kind: c.kind, Amount: amount(c.amount), History: history("50000", "50000"), Now: now}
+		if rule.Matches(&facts) != c.matches {
+			t.Errorf("%s %s: expected match %t", c.kind, c.amount, c.matches)
+		}
+	}
+}
+
+func TestEvaluateTakesTheMostSevereOutcome(t *testing.T) {
+	config := Config{Rules: []Rule{
+		{Name: "hold_big", Type: NewPayee, Outcome: Hold, MinAmount: amount("100")},
+		{Name: "block_huge", Type: NewPayee, Outcome: Block, MinAmount: amount("10000")},
+		{Name: "usd_only", Type: NewPayee, Outcome: Block, Currency: "USD"},
+	}}
+	unknown := false
+
+	decision := config.Evaluate(&Facts{Kind: "transfer", Currency: "EUR", Amount: amount("500"), KnownPayee: &unknown, Now: now})
+	if decision.Outcome != Hold || !reflect.DeepEqual(decision.MatchedRules, []string{"hold_big"}) {
+		t.Errorf("expected hold by hold_big, got %+v", decision)
+	}
+
+	decision = config.Evaluate(&Facts{Kind: "transfer", Currency: "USD", Amount: amount("50000"), KnownPayee: &unknown, Now: now})
+	if decision.Outcome != Block || !reflect.DeepEqual(decision.MatchedRules, []string{"hold_big", "block_huge", "usd_only"}) {
+		t.Errorf("expected block by every rule, got %+v", decision)
+	}
+
+	var none *Config
+	decision = none.Evaluate(&Facts{Kind: "transfer", Amount: amount("50000"), Now: now})
+	if decision.Outcome != Allow || len(decision.MatchedRules) != 0 {
+		t.Errorf("no rules: expected allow, got %+v", decision)
+	}
+}
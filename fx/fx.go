@@ -0,0 +1,67 @@
+package fx
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RateProvider returns the mid-market rate, in units of quote bought by one unit of base
+type RateProvider interface {
+	GetRate(base string, quote string) (decimal.Decimal, error)
+}
+
+// ParseRatesCSV reads "base,quote,rate" records, a first record starting with "base" is treated as a header
+func ParseRatesCSV(r io.Reader) ([]model.FxRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	rates := []model.FxRate{}
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+
+		if line == 1 && strings.EqualFold(record[0], "base") {
+			continue
+		}
+
+		base := strings.ToUpper(record[0])
+		quote := strings.ToUpper(record[1])
+		if !model.IsValidCurrency(base) || !model.IsValidCurrency(quote) {
+			return nil, fmt.Errorf("line %d: unsupported currency pair %s/%s", line, base, quote)
+		}
+
+		rate, err := decimal.NewFromString(record[2])
+		if err != nil || !rate.IsPositive() {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[2])
+		}
+
+		rates = append(rates, model.FxRate{Base: base, Quote: quote, Rate: rate})
+	}
+
+	return rates, nil
+}
+
+// Convert applies the spread as a fee in the source currency and converts the rest at the mid rate,
+// the fee is rounded to the source minor units and the converted amount is rounded down to the target ones
+func Convert(amount decimal.Decimal, from_currency string, to_currency string, rate decimal.Decimal, spread decimal.Decimal) (fee decimal.Decimal, to_amount decimal.Decimal) {
+	fee = amount.Mul(spread).Round(model.CurrencyMinorUnits[from_currency])
+	to_amount = amount.Sub(fee).Mul(rate).RoundDown(model.CurrencyMinorUnits[to_currency])
+
+	return fee, to_amount
+}
@@ -0,0 +1,95 @@
+package fx
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		amount             string
+		from_currency      string
+		to_currency        string
+		rate               string
+		spread             string
+		expected_fee       string
+		expected_to_amount string
+	}{
+		{"100", "USD", "EUR", "0.9", "0.005", "0.5", "89.55"},
+		// the converted amount is rounded down to the target minor units
+		{"100", "USD", "JPY", "149.876", "0.01", "1", "14837"},
+		{"1", "EUR", "USD", "1.0869999", "0", "0", "1.08"},
+		// the fee is rounded half up to the source minor units, 0.025
+		{"10", "USD", "BHD", "0.376", "0.0025", "0.03", "3.748"},
+		{"5000", "JPY", "USD", "0.00667", "0.003", "15", "33.24"},
+	}
+
+	for _, c := range cases {
+		fee, to_amount := Convert(decimal.RequireFromString(c.amount), c.from_currency, c.to_currency, decimal.RequireFromString(c.rate), decimal.RequireFromString(c.spread))
+		if !fee.Equal(decimal.RequireFromString(c.expected_fee)) {
+			t.Errorf("%s %s to %s: expected fee %s, got %s", c.amount, c.from_currency, c.to_currency, c.expected_fee, fee)
+		}
+
+		if !to_amount.Equal(decimal.RequireFromString(c.expected_to_amount)) {
+			t.Errorf("%s %s to %s: expected %s, got %s", c.amount, c.from_currency, c.to_currency, c.expected_to_amount, to_amount)
+		}
+	}
+}
+
+func TestParseRatesCSV(t *testing.T) {
+	rates, err := ParseRatesCSV(strings.NewReader("base,quote,rate\nUSD,EUR,0.92\n eur, usd, 1.087\nUSD,JPY,149.876\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		base  string
+		quote string
+		rate  string
+	}{
+		{"USD", "EUR", "0.92"},
+		{"EUR", "USD", "1.087"},
+		{"USD", "JPY", "149.876"},
+	}
+
+	if len(rates) != len(expected) {
+		t.Fatalf("expected %d rates, got %d", len(expected), len(rates))
+	}
+
+	for i, e := range expected {
+		if rates[i].Base != e.base || rates[i].Quote != e.quote || !rates[i].Rate.Equal(decimal.RequireFromString(e.rate)) {
+			t.Errorf("rate %d: expected %s/%s %s, got %s/%s %s", i, e.base, e.quote, e.rate, rates[i].Base, rates[i].Quote, rates[i].Rate)
+		}
+	}
+}
+
+func TestParseRatesCSVWithoutHeader(t *testing.T) {
+	rates, err := ParseRatesCSV(strings.NewReader("GBP,USD,1.27\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 1 || rates[0].Base != "GBP" {
+		t.Fatalf("expected the first record to be read as a rate, got %v", rates)
+	}
+}
+
+func TestParseRatesCSVRejectsInvalidRecords(t *testing.T) {
+	cases := map[string]string{
+		"unsupported currency": "base,quote,rate\nUSD,XYZ,1.5\n",
+		"negative rate":        "USD,EUR,-0.92\n",
+		"zero rate":            "USD,EUR,0\n",
+		"invalid rate":         "USD,EUR,abc\n",
+		"missing field":        "USD,EUR\n",
+		"header after line 1":  "USD,EUR,0.92\nbase,quote,rate\n",
+	}
+
+	for name, text := range cases {
+		_, err := ParseRatesCSV(strings.NewReader(text))
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
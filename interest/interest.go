@@ -0,0 +1,93 @@
+package interest
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// interest accrues over 365 days a year, leap years included
+const DaysInYear = 365
+
+// decimal places kept by the daily accruals, so the monthly credit is rounded only once
+const AccrualPrecision = 10
+
+// decimal places of the daily rate
+const RatePrecision = 16
+
+// Rate is an annual percentage yield, as a fraction, in force from a day on
+type Rate struct {
+	Apy           decimal.Decimal
+	EffectiveFrom time.Time
+}
+
+// DailyRate is the rate that compounded daily over a year yields the APY: (1 + apy)^(1/365) - 1
+func DailyRate(apy decimal.Decimal) decimal.Decimal {
+	if !apy.IsPositive() {
+		return decimal.Zero
+	}
+
+	one := decimal.NewFromInt(1)
+	exponent := one.DivRound(decimal.NewFromInt(DaysInYear), RatePrecision+4)
+
+	factor, err := one.Add(apy).PowWithPrecision(exponent, RatePrecision+4)
+	if err != nil {
+		return decimal.Zero
+	}
+
+	return factor.Sub(one).Round(RatePrecision)
+}
+
+// RateOn returns the rate in force on the date, the last one whose effective day is not after it
+func RateOn(rates []Rate, date time.Time) (Rate, bool) {
+	sorted := make([]Rate, len(rates))
+	copy(sorted, rates)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].EffectiveFrom.Before(sorted[j].EffectiveFrom)
+	})
+
+	var rate Rate
+	found := false
+	for _, r := range sorted {
+		if r.EffectiveFrom.After(date) {
+			break
+		}
+		rate = r
+		found = true
+	}
+
+	return rate, found
+}
+
+// Accrue is the interest earned in a day by an end-of-day balance, nothing for balances that are not positive
+func Accrue(balance decimal.Decimal, daily_rate decimal.Decimal) decimal.Decimal {
+	if !balance.IsPositive() {
+		return decimal.Zero
+	}
+
+	return balance.Mul(daily_rate).Round(AccrualPrecision)
+}
+
+// Credit is the amount paid for the accruals of a period, rounded half up to the minor unit of the currency
+func Credit(accruals []decimal.Decimal, minor_units int32) (decimal.Decimal, decimal.Decimal) {
+	accrued := decimal.Sum(decimal.Zero, accruals...)
+
+	return accrued, accrued.Round(minor_units)
+}
+
+// OverdraftAccrual is the interest owed for a day on a negative end-of-day balance at a simple annual rate,
+// nothing for balances that are not negative
+func OverdraftAccrual(balance decimal.Decimal, annual_rate decimal.Decimal) decimal.Decimal {
+	if !balance.IsNegative() {
+		return decimal.Zero
+	}
+
+	return balance.Neg().Mul(annual_rate).Div(decimal.NewFromInt(DaysInYear)).Round(AccrualPrecision)
+}
+
+// Charge is the whole minor units of what is owed, the carry of previous days plus the accrual of the day,
+// the rest is carried to the next day so no fraction is ever lost nor charged twice
+func Charge(carry decimal.Decimal, accrued decimal.Decimal, minor_units int32) decimal.Decimal {
+	return carry.Add(accrued).Truncate(minor_units)
+}
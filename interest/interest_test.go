@@ -0,0 +1,117 @@
+package interest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func day(text string) time.Time {
+	date, err := time.Parse("2006-01-02", text)
+	if err != nil {
+		panic(err)
+	}
+
+	return date
+}
+
+func TestDailyRateCompoundsToTheApy(t *testing.T) {
+	apy := decimal.RequireFromString("0.045")
+	daily_rate := DailyRate(apy)
+
+	balance := decimal.NewFromInt(1000000)
+	for i := 0; i < DaysInYear; i++ {
+		balance = balance.Add(balance.Mul(daily_rate))
+	}
+
+	earned := balance.Sub(decimal.NewFromInt(1000000)).Round(2)
+	if !earned.Equal(decimal.RequireFromString("45000")) {
+		t.Fatalf("expected 45000 earned in a year, got %s (daily rate %s)", earned, daily_rate)
+	}
+}
+
+func TestDailyRateOfZeroApy(t *testing.T) {
+	if !DailyRate(decimal.Zero).IsZero() {
+		t.Fatal("expected no interest for a zero APY")
+	}
+}
+
+func TestRateOnPicksTheRateInForce(t *testing.T) {
+	rates := []Rate{
+		{Apy: decimal.RequireFromString("0.05"), EffectiveFrom: day("2026-10-15")},
+		{Apy: decimal.RequireFromString("0.04"), EffectiveFrom: day("2026-01-01")},
+	}
+
+	if _, ok := RateOn(rates, day("2025-12-31")); ok {
+		t.Fatal("expected no rate before the first one")
+	}
+
+	cases := map[string]string{
+		"2026-10-14": "0.04",
+		"2026-10-15": "0.05",
+		"2026-10-31": "0.05",
+	}
+	for date, expected := range cases {
+		rate, ok := RateOn(rates, day(date))
+		if !ok || !rate.Apy.Equal(decimal.RequireFromString(expected)) {
+			t.Errorf("%s: expected %s, got %s", date, expected, rate.Apy)
+		}
+	}
+}
+
+func TestAccrueSkipsNegativeBalances(t *testing.T) {
+	daily_rate := DailyRate(decimal.RequireFromString("0.05"))
+
+	if !Accrue(decimal.NewFromInt(-100), daily_rate).IsZero() {
+		t.Fatal("expected no interest on a negative balance")
+	}
+
+	if !Accrue(decimal.NewFromInt(100), daily_rate).IsPositive() {
+		t.Fatal("expected interest on a positive balance")
+	}
+}
+
+func TestCreditRoundsTheSumOnce(t *testing.T) {
+	// thirty days of a third of a cent each make ten cents, rounding daily would make none
+	accruals := []decimal.Decimal{}
+	for i := 0; i < 30; i++ {
+		accruals = append(accruals, decimal.RequireFromString("0.0033333334"))
+	}
+
+	accrued, amount := Credit(accruals, 2)
+	if !accrued.Equal(decimal.RequireFromString("0.100000002")) || !amount.Equal(decimal.RequireFromString("0.1")) {
+		t.Fatalf("unexpected credit %s of %s accrued", amount, accrued)
+	}
+}
+
+func TestOverdraftAccrual(t *testing.T) {
+	rate := decimal.RequireFromString("0.1825")
+
+	if !OverdraftAccrual(decimal.NewFromInt(100), rate).IsZero() {
+		t.Fatal("expected no overdraft interest on a positive balance")
+	}
+
+	// 1000 at 18.25% a year is 0.5 a day
+	got := OverdraftAccrual(decimal.NewFromInt(-1000), rate)
+	if !got.Equal(decimal.RequireFromString("0.5")) {
+		t.Fatalf("expected 0.5, got %s", got)
+	}
+}
+
+func TestChargeCarriesFractions(t *testing.T) {
+	accrued := decimal.RequireFromString("0.004")
+	carry := decimal.Zero
+	charged := decimal.Zero
+
+	for i := 0; i < 5; i++ {
+		amount := Charge(carry, accrued, 2)
+		carry = carry.Add(accrued).Sub(amount)
+		charged = charged.Add(amount)
+	}
+
+	// 0.02 owed over five days, charged as cents on the third and fifth days
+	if !charged.Equal(decimal.RequireFromString("0.02")) || !carry.IsZero() {
+		t.Fatalf("expected 0.02 charged with nothing carried, got %s with %s carried", charged, carry)
+	}
+}
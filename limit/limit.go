@@ -0,0 +1,173 @@
+package limit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	Withdrawal = "withdrawal"
+	Transfer   = "transfer"
+	// withdrawals, transfers and exchanges together
+	Outbound = "outbound"
+)
+
+const (
+	Single  = "single"
+	Daily   = "daily"
+	Monthly = "monthly"
+)
+
+// rolling windows of the daily and monthly limits
+const (
+	DailyWindow   = 24 * time.Hour
+	MonthlyWindow = 30 * 24 * time.Hour
+)
+
+var ErrInvalidKind = errors.New("kind must be withdrawal, transfer or outbound")
+var ErrInvalidPeriod = errors.New("period must be single, daily or monthly")
+var ErrNegative = errors.New("amount must not be negative")
+var ErrTooPrecise = errors.New("amount has more decimal places than the currency allows")
+
+func Validate(limit *model.AccountLimit, currency string) error {
+	switch limit.Kind {
+	case Withdrawal, Transfer, Outbound:
+	default:
+		return ErrInvalidKind
+	}
+
+	switch limit.Period {
+	case Single, Daily, Monthly:
+	default:
+		return ErrInvalidPeriod
+	}
+
+	if limit.Amount.IsNegative() {
+		return ErrNegative
+	}
+
+	if !model.IsValidAmount(limit.Amount, currency) {
+		return ErrTooPrecise
+	}
+
+	return nil
+}
+
+// Kinds lists the limit kinds a transaction of the kind counts against, none when it is not limited
+func Kinds(transaction_kind string) []string {
+	switch transaction_kind {
+	case "withdrawal":
+		return []string{Withdrawal, Outbound}
+	case "transfer", "refund":
+		return []string{Transfer, Outbound}
+	case "exchange":
+		return []string{Outbound}
+	}
+
+	return nil
+}
+
+// TransactionKinds lists the transaction kinds counting against the limit kind
+func TransactionKinds(kind string) []string {
+	switch kind {
+	case Withdrawal:
+		return []string{"withdrawal"}
+	case Transfer:
+		return []string{"transfer", "refund"}
+	case Outbound:
+		return []string{"withdrawal", "transfer", "exchange", "refund"}
+	}
+
+	return nil
+}
+
+// Window is how far back the period sums the transactions, 0 for single limits
+func Window(period string) time.Duration {
+	switch period {
+	case Daily:
+		return DailyWindow
+	case Monthly:
+		return MonthlyWindow
+	}
+
+	return 0
+}
+
+// Effective is the amount the limit allows, raised while a temporary increase is active
+func Effective(limit *model.AccountLimit, now time.Time) decimal.Decimal {
+	if limit.IncreasedAmount != nil && limit.IncreaseExpiresAt != nil && now.Before(*limit.IncreaseExpiresAt) && limit.IncreasedAmount.GreaterThan(limit.Amount) {
+		return *limit.IncreasedAmount
+	}
+
+	return limit.Amount
+}
+
+// Movement is money that left the account and counts against its limits
+type Movement struct {
+	// transaction, or batch, it was made by
+	Id     string
+	Amount decimal.Decimal
+	At     time.Time
+}
+
+// Used sums the movements made within the window ending at now
+func Used(movements []Movement, window time.Duration, now time.Time) decimal.Decimal {
+	used := decimal.Zero
+	since := now.Add(-window)
+	for _, movement := range movements {
+		if movement.At.After(since) && !movement.At.After(now) {
+			used = used.Add(movement.Amount)
+		}
+	}
+
+	return used
+}
+
+type ExceededError struct {
+	Kind   string          `json:"kind"`
+	Period string          `json:"period"`
+	Limit  decimal.Decimal `json:"limit"`
+	// what can still leave the account before the limit is reached
+	Remaining decimal.Decimal `json:"remaining"`
+}
+
+func (e *ExceededError) Error() string {
+	if e.Period == Single {
+		return fmt.Sprintf("single %s limit of %s exceeded", e.Kind, e.Limit)
+	}
+
+	return fmt.Sprintf("%s %s limit of %s exceeded, %s left", e.Period, e.Kind, e.Limit, e.Remaining)
+}
+
+// Check fails with an ExceededError for the first limit of the kinds the amount goes over, movements holding
+// by limit kind what already left the account within the monthly window
+func Check(limits []model.AccountLimit, kinds []string, amount decimal.Decimal, movements map[string][]Movement, now time.Time) error {
+	for i := range limits {
+		limit := &limits[i]
+		if !slices.Contains(kinds, limit.Kind) {
+			continue
+		}
+
+		allowed := Effective(limit, now)
+		used := decimal.Zero
+		if limit.Period != Single {
+			used = Used(movements[limit.Kind], Window(limit.Period), now)
+		}
+
+		if used.Add(amount).GreaterThan(allowed) {
+			return &ExceededError{
+				Kind:      limit.Kind,
+				Period:    limit.Period,
+				Limit:     allowed,
+				Remaining: decimal.Max(allowed.Sub(used), decimal.Zero),
+			}
+		}
+	}
+
+	return nil
+}
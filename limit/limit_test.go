@@ -0,0 +1,118 @@
+package limit
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func amount(text string) decimal.Decimal {
+	return decimal.RequireFromString(text)
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		limit    model.AccountLimit
+		expected error
+	}{
+		{model.AccountLimit{Kind: Transfer, Period: Daily, Amount: amount("1000")}, nil},
+		{model.AccountLimit{Kind: "deposit", Period: Daily, Amount: amount("1000")}, ErrInvalidKind},
+		{model.AccountLimit{Kind: Transfer, Period: "weekly", Amount: amount("1000")}, ErrInvalidPeriod},
+		{model.AccountLimit{Kind: Outbound, Period: Monthly, Amount: amount("-1")}, ErrNegative},
+		{model.AccountLimit{Kind: Withdrawal, Period: Single, Amount: amount("10.001")}, ErrTooPrecise},
+	}
+
+	for _, c := range cases {
+		err := Validate(&c.limit, "USD")
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%s %s %s: expected %v, got %v", c.limit.Period, c.limit.Kind, c.limit.Amount, c.expected, err)
+		}
+	}
+}
+
+func TestUsedRollingWindow(t *testing.T) {
+	movements := []Movement{
+		{Id: "a", Amount: amount("100"), At: now.Add(-time.Hour)},
+		// just inside the day
+		{Id: "b", Amount: amount("50"), At: now.Add(-DailyWindow + time.Second)},
+		// exactly a day ago, out of the daily window
+		{Id: "c", Amount: amount("25"), At: now.Add(-DailyWindow)},
+		{Id: "d", Amount: amount("10"), At: now.AddDate(0, 0, -29)},
+		{Id: "e", Amount: amount("5"), At: now.AddDate(0, 0, -31)},
+	}
+
+	if used := Used(movements, DailyWindow, now); !used.Equal(amount("150")) {
+		t.Errorf("daily: expected 150, got %s", used)
+	}
+
+	if used := Used(movements, MonthlyWindow, now); !used.Equal(amount("185")) {
+		t.Errorf("monthly: expected 185, got %s", used)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	limits := []model.AccountLimit{
+		{Kind: Withdrawal, Period: Single, Amount: amount("500")},
+		{Kind: Transfer, Period: Daily, Amount: amount("1000")},
+		{Kind: Outbound, Period: Monthly, Amount: amount("3000")},
+	}
+	movements := map[string][]Movement{
+		Transfer: {{Id: "a", Amount: amount("800"), At: now.Add(-time.Hour)}},
+		Outbound: {
+			{Id: "a", Amount: amount("800"), At: now.Add(-time.Hour)},
+			{Id: "b", Amount: amount("2000"), At: now.AddDate(0, 0, -10)},
+		},
+	}
+
+	err := Check(limits, Kinds("transfer"), amount("200"), movements, now)
+	if err != nil {
+		t.Fatalf("transfer within the limits: %s", err)
+	}
+
+	var exceeded *ExceededError
+	err = Check(limits, Kinds("transfer"), amount("200.01"), movements, now)
+	if !errors.As(err, &exceeded) || exceeded.Kind != Transfer || exceeded.Period != Daily || !exceeded.Remaining.Equal(amount("200")) {
+		t.Errorf("transfer over the daily limit: got %v", err)
+	}
+
+	// a refund takes the money out of the account it debits like a transfer
+	err = Check(limits, Kinds("refund"), amount("200.01"), movements, now)
+	if !errors.As(err, &exceeded) || exceeded.Kind != Transfer || exceeded.Period != Daily {
+		t.Errorf("refund over the daily transfer limit: got %v", err)
+	}
+
+	err = Check(limits, Kinds("withdrawal"), amount("501"), movements, now)
+	if !errors.As(err, &exceeded) || exceeded.Period != Single {
+		t.Errorf("withdrawal over the single limit: got %v", err)
+	}
+
+	// 800 + 2000 + 250 goes over the monthly outbound limit
+	err = Check(limits, Kinds("exchange"), amount("250"), movements, now)
+	if !errors.As(err, &exceeded) || exceeded.Kind != Outbound || !exceeded.Remaining.Equal(amount("200")) {
+		t.Errorf("exchange over the monthly limit: got %v", err)
+	}
+
+	err = Check(limits, Kinds("deposit"), amount("1000000"), movements, now)
+	if err != nil {
+		t.Errorf("deposits are not limited: got %s", err)
+	}
+}
+
+func TestEffectiveWithIncrease(t *testing.T) {
+	increased := amount("2000")
+	expires_at := now.Add(time.Hour)
+	limit := model.AccountLimit{Kind: Transfer, Period: Daily, Amount: amount("1000"), IncreasedAmount: &increased, IncreaseExpiresAt: &expires_at}
+
+	if allowed := Effective(&limit, now); !allowed.Equal(increased) {
+		t.Errorf("active increase: expected 2000, got %s", allowed)
+	}
+
+	if allowed := Effective(&limit, expires_at); !allowed.Equal(amount("1000")) {
+		t.Errorf("expired increase: expected 1000, got %s", allowed)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,6 +13,8 @@ import (
 	"sync"
 	"testing"
 	"time"
+	"welloff-bank/model"
+	"welloff-bank/repository"
 	"welloff-bank/server"
 	"welloff-bank/utils"
 
@@ -134,7 +137,7 @@ func DepositTransactionRequest(to_account_id string, amount string) error {
 	return nil
 }
 
-func WithdrawalTransactionRequest(from_account_id string, amount string) error {
+func WithdrawalTransactionRequest(from_account_id string, amount string) (int, error) {
 	url := "http://localhost:5001/transaction/withdrawal"
 	payload := []byte(`{
 		"amount": "` + amount + `",
@@ -143,7 +146,7 @@ func WithdrawalTransactionRequest(from_account_id string, amount string) error {
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -152,12 +155,12 @@ func WithdrawalTransactionRequest(from_account_id string, amount string) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	defer resp.Body.Close()
 
-	return nil
+	return resp.StatusCode, nil
 }
 
 func RefundTransactionRequest(transaction_id string) error {
@@ -217,7 +220,7 @@ func TestBalanceCorrectnessAfterMultipleDepositAndWithdrawalTransactions(t *test
 		go func() {
 			defer func() { <-sem }()
 			defer wg.Done()
-			err := WithdrawalTransactionRequest(user_account, "1.00")
+			_, err := WithdrawalTransactionRequest(user_account, "1.00")
 			if err != nil {
 				t.Error(err)
 			}
@@ -355,3 +358,1377 @@ func TestBalanceCorrectnessAfterMultipleTransactionsWithRefund(t *testing.T) {
 		t.Errorf("Transferable Account Balance is not correct. Expected: %s, Actual: %s", expected_transferable_account_balance, new_transferable_account_balance.Balance.String())
 	}
 }
+
+func TestLedgerNetsToZero(t *testing.T) {
+	DepositTransactionRequest(user_account, "10.00")
+	WithdrawalTransactionRequest(user_account, "5.00")
+	TransferTransactionRequest(user_account, transferable_account, "1.00")
+
+	total, err := s.Repositories.TransactionRepository.GetLedgerTotal()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !total.IsZero() {
+		t.Errorf("Ledger does not net to zero. Actual: %s", total.String())
+	}
+}
+
+func TestBalanceNeverNegativeAfterConcurrentWithdrawals(t *testing.T) {
+	DepositTransactionRequest(user_account, "100.00")
+
+	user_account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// the balance covers 200 withdrawals, the other 100 must be rejected
+	requests_num := 300
+	parallelism := 50
+	amount := user_account_balance.Balance.Div(decimal.NewFromInt(200)).RoundDown(2)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan struct{}, parallelism)
+	succeeded := 0
+
+	for i := 0; i < requests_num; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer func() { <-sem }()
+			defer wg.Done()
+			status, err := WithdrawalTransactionRequest(user_account, amount.StringFixed(2))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if status == 200 {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	new_user_account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if new_user_account_balance.Balance.IsNegative() {
+		t.Errorf("User Account Balance is negative. Actual: %s", new_user_account_balance.Balance.String())
+	}
+
+	max_succeeded := int(user_account_balance.Balance.Div(amount).IntPart())
+	if succeeded > max_succeeded {
+		t.Errorf("Too many withdrawals succeeded. Expected at most: %d, Actual: %d", max_succeeded, succeeded)
+	}
+
+	expected_user_account_balance := user_account_balance.Balance.Sub(amount.Mul(decimal.NewFromInt(int64(succeeded)))).String()
+	if expected_user_account_balance != new_user_account_balance.Balance.String() {
+		t.Errorf("User Account Balance is not correct. Expected: %s, Actual: %s", expected_user_account_balance, new_user_account_balance.Balance.String())
+	}
+}
+
+func IdempotentDepositTransactionRequest(to_account_id string, amount string, idempotency_key string) (int, error) {
+	url := "http://localhost:5001/transaction/deposit"
+	payload := []byte(`{
+		"amount": "` + amount + `",
+		"to_account_id": "` + to_account_id + `"
+	}`)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotency_key)
+	req.Header.Set("Cookie", "sessionId="+sessionId+"; Max-Age=86400; Domain=localhost; Path=/; Secure; HttpOnly")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func TestIdempotentDepositIsAppliedOnce(t *testing.T) {
+	idempotency_key := uuid.NewString()
+
+	user_account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		status, err := IdempotentDepositTransactionRequest(user_account, "1.00", idempotency_key)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if status != 200 {
+			t.Errorf("Unexpected status on retry %d. Expected: 200, Actual: %d", i, status)
+		}
+	}
+
+	status, err := IdempotentDepositTransactionRequest(user_account, "2.00", idempotency_key)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if status != 422 {
+		t.Errorf("Reused key with a different payload was not rejected. Expected: 422, Actual: %d", status)
+	}
+
+	new_user_account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected_user_account_balance := user_account_balance.Balance.Add(decimal.NewFromInt(1)).String()
+	if expected_user_account_balance != new_user_account_balance.Balance.String() {
+		t.Errorf("User Account Balance is not correct. Expected: %s, Actual: %s", expected_user_account_balance, new_user_account_balance.Balance.String())
+	}
+}
+
+func createPendingTransfer(t *testing.T, amount decimal.Decimal) string {
+	t.Helper()
+
+	transaction_id, err := uuid.NewV7()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Repositories.TransactionRepository.CreateTransaction(transaction_id, "transfer", &user_account, &transferable_account, amount, nil, "pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return transaction_id.String()
+}
+
+func checkBalance(t *testing.T, step string, expected_balance decimal.Decimal, expected_available_balance decimal.Decimal) {
+	t.Helper()
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !account_balance.Balance.Equal(expected_balance) {
+		t.Errorf("Balance is not correct after %s. Expected: %s, Actual: %s", step, expected_balance.String(), account_balance.Balance.String())
+	}
+
+	if !account_balance.AvailableBalance.Equal(expected_available_balance) {
+		t.Errorf("Available balance is not correct after %s. Expected: %s, Actual: %s", step, expected_available_balance.String(), account_balance.AvailableBalance.String())
+	}
+}
+
+func TestTransactionStatusTransitions(t *testing.T) {
+	DepositTransactionRequest(user_account, "20.00")
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance := account_balance.Balance
+	available_balance := account_balance.AvailableBalance
+	amount := decimal.NewFromInt(5)
+	transactions := s.Repositories.TransactionRepository
+
+	posted_transaction_id := createPendingTransfer(t, amount)
+	checkBalance(t, "a pending debit", balance, available_balance.Sub(amount))
+
+	err = transactions.PostTransaction(posted_transaction_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, "posting", balance.Sub(amount), available_balance.Sub(amount))
+
+	failed_transaction_id := createPendingTransfer(t, amount)
+	checkBalance(t, "a second pending debit", balance.Sub(amount), available_balance.Sub(amount.Mul(decimal.NewFromInt(2))))
+
+	err = transactions.FailTransaction(failed_transaction_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, "failing", balance.Sub(amount), available_balance.Sub(amount))
+
+	err = transactions.ReverseTransaction(posted_transaction_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, "reversing", balance, available_balance)
+
+	for _, transition := range []struct {
+		name           string
+		transaction_id string
+		apply          func(string) error
+	}{
+		{"posting a failed transaction", failed_transaction_id, transactions.PostTransaction},
+		{"reversing a failed transaction", failed_transaction_id, transactions.ReverseTransaction},
+		{"failing a reversed transaction", posted_transaction_id, transactions.FailTransaction},
+		{"reversing a reversed transaction", posted_transaction_id, transactions.ReverseTransaction},
+	} {
+		err = transition.apply(transition.transaction_id)
+		if !errors.Is(err, repository.ErrInvalidTransactionStatus) {
+			t.Errorf("Unexpected error %s. Expected: %s, Actual: %v", transition.name, repository.ErrInvalidTransactionStatus, err)
+		}
+	}
+	checkBalance(t, "the rejected transitions", balance, available_balance)
+}
+
+func JSONRequest(method string, path string, payload string) (int, map[string]interface{}, error) {
+	url := "http://localhost:5001" + path
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer([]byte(payload)))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", "sessionId="+sessionId+"; Max-Age=86400; Domain=localhost; Path=/; Secure; HttpOnly")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	// empty bodies decode to a nil map
+	var payload_resp map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&payload_resp)
+
+	return resp.StatusCode, payload_resp, nil
+}
+
+func createHold(t *testing.T, amount string, expires_at time.Time) string {
+	t.Helper()
+
+	status, payload_resp, err := JSONRequest("POST", "/account/"+user_account+"/hold", `{
+		"amount": "`+amount+`",
+		"merchant": "Test Merchant",
+		"expires_at": "`+expires_at.Format(time.RFC3339)+`"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Fatalf("Failed to create hold. Expected: 200, Actual: %d", status)
+	}
+
+	hold_id, ok := payload_resp["payload"].(map[string]interface{})["hold_id"].(string)
+	if !ok {
+		t.Fatal("Failed to parse hold id")
+	}
+
+	return hold_id
+}
+
+func checkHoldStatus(t *testing.T, hold_id string, expected_status string) {
+	t.Helper()
+
+	hold, err := s.Repositories.HoldRepository.GetHold(hold_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hold.Status != expected_status {
+		t.Errorf("Hold status is not correct. Expected: %s, Actual: %s", expected_status, hold.Status)
+	}
+}
+
+func TestHoldLifecycle(t *testing.T) {
+	DepositTransactionRequest(user_account, "50.00")
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance := account_balance.Balance
+	available_balance := account_balance.AvailableBalance
+
+	hold_id := createHold(t, "10.00", time.Now().Add(time.Hour))
+	checkBalance(t, "a hold", balance, available_balance.Sub(decimal.NewFromInt(10)))
+
+	status, _, err := JSONRequest("POST", "/hold/"+hold_id+"/increment", `{"amount": "5.00"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Errorf("Failed to increment hold. Expected: 200, Actual: %d", status)
+	}
+	checkBalance(t, "incrementing the hold", balance, available_balance.Sub(decimal.NewFromInt(15)))
+
+	status, payload_resp, err := JSONRequest("POST", "/hold/"+hold_id+"/capture", `{"amount": "12.00"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Fatalf("Failed to capture hold. Expected: 200, Actual: %d", status)
+	}
+
+	// the 3.00 left of the hold is released with the capture
+	checkBalance(t, "capturing the hold", balance.Sub(decimal.NewFromInt(12)), available_balance.Sub(decimal.NewFromInt(12)))
+	checkHoldStatus(t, hold_id, "captured")
+
+	hold, err := s.Repositories.HoldRepository.GetHold(hold_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transaction_id := payload_resp["payload"].(map[string]interface{})["transaction_id"]
+	if hold.CaptureTransactionId == nil || hold.CaptureTransactionId.String() != transaction_id {
+		t.Errorf("Capture transaction is not correct. Expected: %v, Actual: %v", transaction_id, hold.CaptureTransactionId)
+	}
+
+	status, _, err = JSONRequest("POST", "/hold/"+hold_id+"/capture", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 400 {
+		t.Errorf("Captured hold was captured again. Expected: 400, Actual: %d", status)
+	}
+
+	balance = balance.Sub(decimal.NewFromInt(12))
+	available_balance = available_balance.Sub(decimal.NewFromInt(12))
+
+	released_hold_id := createHold(t, "5.00", time.Now().Add(time.Hour))
+	status, _, err = JSONRequest("POST", "/hold/"+released_hold_id+"/release", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Errorf("Failed to release hold. Expected: 200, Actual: %d", status)
+	}
+	checkBalance(t, "releasing a hold", balance, available_balance)
+	checkHoldStatus(t, released_hold_id, "released")
+
+	expired_hold_id := createHold(t, "5.00", time.Now().Add(2*time.Second))
+	time.Sleep(3 * time.Second)
+
+	// an expired hold stops reserving balance before the expirer runs
+	checkBalance(t, "a hold expiring", balance, available_balance)
+
+	_, err = s.Repositories.HoldRepository.ExpireHolds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHoldStatus(t, expired_hold_id, "expired")
+
+	status, _, err = JSONRequest("POST", "/hold/"+expired_hold_id+"/capture", `{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 400 {
+		t.Errorf("Expired hold was captured. Expected: 400, Actual: %d", status)
+	}
+}
+
+func createAccount(t *testing.T, currency string) string {
+	t.Helper()
+
+	name := "Test " + currency + " " + uuid.NewString()
+	status, _, err := JSONRequest("POST", "/account", `{
+		"name": "`+name+`",
+		"currency": "`+currency+`"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Fatalf("Failed to create account. Expected: 200, Actual: %d", status)
+	}
+
+	var account_id string
+	err = s.Repositories.AccountRepository.Pg.Get(&account_id, `SELECT acc.id FROM "account" acc WHERE acc.name = $1`, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return account_id
+}
+
+func TestTransferValidatesAmountAndCurrency(t *testing.T) {
+	DepositTransactionRequest(user_account, "10.00")
+
+	eur_account := createAccount(t, "EUR")
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, transfer := range []struct {
+		name          string
+		to_account_id string
+		amount        string
+		status        int
+	}{
+		{"more decimal places than USD allows", transferable_account, "1.001", 422},
+		{"to an account in another currency", eur_account, "1.00", 400},
+	} {
+		status, _, err := JSONRequest("POST", "/transaction/transfer", `{
+			"amount": "`+transfer.amount+`",
+			"from_account_id": "`+user_account+`",
+			"to_account_id": "`+transfer.to_account_id+`"
+		}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != transfer.status {
+			t.Errorf("Unexpected status for a transfer %s. Expected: %d, Actual: %d", transfer.name, transfer.status, status)
+		}
+	}
+
+	checkBalance(t, "the rejected transfers", account_balance.Balance, account_balance.AvailableBalance)
+}
+
+func PartialRefundTransactionRequest(transaction_id string, amount string) (int, error) {
+	url := "http://localhost:5001/transaction/refund/" + transaction_id
+	payload := []byte(`{
+		"amount": "` + amount + `"
+	}`)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", "sessionId="+sessionId+"; Max-Age=86400; Domain=localhost; Path=/; Secure; HttpOnly")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func TestPartialRefundsNeverExceedTheOriginalAmount(t *testing.T) {
+	DepositTransactionRequest(user_account, "10.00")
+
+	user_account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	transaction_id, err := TransferTransactionRequest(user_account, transferable_account, "10.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, refund := range []struct {
+		amount string
+		status int
+	}{{"4.00", 200}, {"6.00", 200}, {"0.01", 400}} {
+		status, err := PartialRefundTransactionRequest(transaction_id, refund.amount)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if status != refund.status {
+			t.Errorf("Unexpected status refunding %s. Expected: %d, Actual: %d", refund.amount, refund.status, status)
+		}
+	}
+
+	refunded_amount, err := s.Repositories.TransactionRepository.GetRefundedAmount(transaction_id)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !refunded_amount.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Refunded amount is not correct. Expected: 10, Actual: %s", refunded_amount.String())
+	}
+
+	new_user_account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if user_account_balance.Balance.String() != new_user_account_balance.Balance.String() {
+		t.Errorf("User Account Balance is not correct. Expected: %s, Actual: %s", user_account_balance.Balance.String(), new_user_account_balance.Balance.String())
+	}
+}
+
+func getAccountHistory(t *testing.T, account_id string, filter repository.TransactionFilter) []model.AccountTransaction {
+	t.Helper()
+
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+
+	transactions, err := s.Repositories.TransactionRepository.GetAccountHistory(account_id, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return *transactions
+}
+
+func checkRunningBalances(t *testing.T, account_id string, history []model.AccountTransaction) {
+	t.Helper()
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(account_id), s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// newest first, each running balance is the previous one plus the movement
+	expected := account_balance.Balance
+	for _, transaction := range history {
+		if transaction.RunningBalance == nil || !transaction.RunningBalance.Equal(expected) {
+			t.Errorf("Running balance of %s is not correct. Expected: %s, Actual: %v", transaction.Id, expected.String(), transaction.RunningBalance)
+		}
+
+		expected = expected.Sub(transaction.SignedAmount)
+	}
+
+	if !expected.IsZero() {
+		t.Errorf("Running balance before the first transaction is not zero: %s", expected.String())
+	}
+}
+
+func TestAccountHistoryFiltersAndRunningBalance(t *testing.T) {
+	account_id := createAccount(t, "USD")
+
+	DepositTransactionRequest(account_id, "100.00")
+	_, err := TransferTransactionRequest(account_id, transferable_account, "10.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = TransferTransactionRequest(account_id, transferable_account, "20.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	DepositTransactionRequest(account_id, "5.00")
+
+	history := getAccountHistory(t, account_id, repository.TransactionFilter{})
+	checkRunningBalances(t, account_id, history)
+
+	running_balances := map[string]string{}
+	for _, transaction := range history {
+		running_balances[transaction.Id.String()] = transaction.RunningBalance.String()
+	}
+
+	// the running balances don't change with the filters
+	kind := "deposit"
+	min_amount := decimal.NewFromInt(15)
+	counterparty := transferable_account
+	for _, c := range []struct {
+		name     string
+		filter   repository.TransactionFilter
+		expected int
+		matches  func(model.AccountTransaction) bool
+	}{
+		{"kind", repository.TransactionFilter{Kind: &kind}, 2, func(tx model.AccountTransaction) bool { return tx.Kind == kind }},
+		{"min amount", repository.TransactionFilter{MinAmount: &min_amount}, 2, func(tx model.AccountTransaction) bool { return !tx.Amount.LessThan(min_amount) }},
+		{"counterparty", repository.TransactionFilter{CounterpartyId: &counterparty}, 2, func(tx model.AccountTransaction) bool {
+			return tx.ToAccountId != nil && tx.ToAccountId.String() == counterparty
+		}},
+	} {
+		filtered := getAccountHistory(t, account_id, c.filter)
+		if len(filtered) != c.expected {
+			t.Errorf("Unexpected number of transactions filtering by %s. Expected: %d, Actual: %d", c.name, c.expected, len(filtered))
+		}
+
+		for _, transaction := range filtered {
+			if !c.matches(transaction) {
+				t.Errorf("Transaction %s does not match the %s filter", transaction.Id, c.name)
+			}
+
+			if transaction.RunningBalance.String() != running_balances[transaction.Id.String()] {
+				t.Errorf("Running balance of %s changed filtering by %s. Expected: %s, Actual: %s", transaction.Id, c.name, running_balances[transaction.Id.String()], transaction.RunningBalance.String())
+			}
+		}
+	}
+
+	// paging with the cursor walks the whole history once
+	paged := []model.AccountTransaction{}
+	var cursor *string
+	for {
+		page := getAccountHistory(t, account_id, repository.TransactionFilter{Cursor: cursor, Limit: 2})
+		if len(page) == 0 {
+			break
+		}
+
+		paged = append(paged, page...)
+		last_id := page[len(page)-1].Id.String()
+		cursor = &last_id
+	}
+
+	if len(paged) != len(history) {
+		t.Fatalf("Unexpected number of transactions paging. Expected: %d, Actual: %d", len(history), len(paged))
+	}
+
+	for i := range history {
+		if paged[i].Id != history[i].Id || paged[i].RunningBalance.String() != history[i].RunningBalance.String() {
+			t.Errorf("Transaction %d is not the same paging. Expected: %s, Actual: %s", i, history[i].Id, paged[i].Id)
+		}
+	}
+
+	// seeded from a snapshot, movements before and after it keep their running balances
+	account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(account_id), s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Repositories.AccountRepository.BulkUpsertBalanceSnapshots(&[]model.AccountBalance{*account_balance})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DepositTransactionRequest(account_id, "1.00")
+	checkRunningBalances(t, account_id, getAccountHistory(t, account_id, repository.TransactionFilter{}))
+}
+
+func TestExternalWithdrawalWithoutAchIsRejected(t *testing.T) {
+	if s.AchConfig != nil {
+		t.Skip("ACH is configured")
+	}
+
+	DepositTransactionRequest(user_account, "10.00")
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), uuid.MustParse(user_account), s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, _, err := JSONRequest("POST", "/transaction/withdrawal", `{
+		"amount": "5.00",
+		"from_account_id": "`+user_account+`",
+		"bank_account": {
+			"routing_number": "021000021",
+			"account_number": "123456789",
+			"name": "Test User"
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 503 {
+		t.Errorf("External withdrawal without ACH was not rejected. Expected: 503, Actual: %d", status)
+	}
+
+	checkBalance(t, "the rejected withdrawal", account_balance.Balance, account_balance.AvailableBalance)
+}
+
+func checkScheduledTransferExecutions(t *testing.T, scheduled_transfer_id string, expected_succeeded int) {
+	t.Helper()
+
+	executions, err := s.Repositories.ScheduledTransferRepository.GetScheduledTransferExecutions(scheduled_transfer_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	succeeded := 0
+	for _, execution := range *executions {
+		if execution.Occurrence == 0 && execution.Status == "succeeded" {
+			succeeded++
+		}
+	}
+
+	if succeeded != expected_succeeded {
+		t.Errorf("Unexpected number of succeeded runs of the first occurrence. Expected: %d, Actual: %d", expected_succeeded, succeeded)
+	}
+}
+
+func TestScheduledTransferOccurrenceIsPaidOnce(t *testing.T) {
+	account_id := createAccount(t, "USD")
+	DepositTransactionRequest(account_id, "100.00")
+
+	status, payload_resp, err := JSONRequest("POST", "/scheduled-transfer", `{
+		"amount": "5.00",
+		"from_account_id": "`+account_id+`",
+		"to_account_id": "`+transferable_account+`",
+		"frequency": "daily",
+		"start_date": "`+time.Now().UTC().Format(time.DateOnly)+`",
+		"business_day_adjustment": "none"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Fatalf("Failed to create scheduled transfer. Expected: 200, Actual: %d", status)
+	}
+
+	scheduled_transfer_id := payload_resp["payload"].(map[string]interface{})["id"].(string)
+
+	// overlapping ticks, or another instance, run the due transfers at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.RunScheduledTransfers()
+		}()
+	}
+	wg.Wait()
+	checkScheduledTransferExecutions(t, scheduled_transfer_id, 1)
+
+	for _, action := range []string{"pause", "resume"} {
+		status, _, err = JSONRequest("POST", "/scheduled-transfer/"+scheduled_transfer_id+"/"+action, `{}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != 200 {
+			t.Fatalf("Failed to %s scheduled transfer. Expected: 200, Actual: %d", action, status)
+		}
+	}
+
+	s.RunScheduledTransfers()
+	checkScheduledTransferExecutions(t, scheduled_transfer_id, 1)
+
+	// a resume that read the scheduled transfer before the run recorded it points back at the paid occurrence
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	err = s.Repositories.ScheduledTransferRepository.UpdateScheduledTransferStatus(scheduled_transfer_id, []string{"active"}, "active", 0, &today)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RunScheduledTransfers()
+	checkScheduledTransferExecutions(t, scheduled_transfer_id, 1)
+
+	scheduled_transfer, err := s.Repositories.ScheduledTransferRepository.GetScheduledTransfer(scheduled_transfer_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scheduled_transfer.Occurrence != 1 {
+		t.Errorf("Scheduled transfer did not move past the paid occurrence. Expected: 1, Actual: %d", scheduled_transfer.Occurrence)
+	}
+}
+
+func checkNoBatch(t *testing.T, account_id string) {
+	t.Helper()
+
+	var batches int
+	err := s.Repositories.AccountRepository.Pg.Get(&batches, `SELECT COUNT(*) FROM "transaction_batch" tb WHERE tb.from_account_id = $1`, account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if batches != 0 {
+		t.Errorf("Failed batch left batches behind. Expected: 0, Actual: %d", batches)
+	}
+
+	var legs int
+	err = s.Repositories.AccountRepository.Pg.Get(&legs, `SELECT COUNT(*) FROM "transaction" tx WHERE tx.from_account_id = $1 AND tx.kind = 'transfer'`, account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if legs != 0 {
+		t.Errorf("Failed batch left legs behind. Expected: 0, Actual: %d", legs)
+	}
+}
+
+func TestFailingBatchLegLeavesNothingBehind(t *testing.T) {
+	account_id := createAccount(t, "USD")
+	DepositTransactionRequest(account_id, "10.00")
+
+	status, _, err := JSONRequest("POST", "/transaction/batch", `{
+		"from_account_id": "`+account_id+`",
+		"legs": [
+			{"amount": "6.00", "to_account_id": "`+transferable_account+`"},
+			{"amount": "6.00", "to_account_id": "`+transferable_account+`"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 400 {
+		t.Errorf("Batch over the balance was not rejected. Expected: 400, Actual: %d", status)
+	}
+
+	checkNoBatch(t, account_id)
+
+	// the second leg reuses the id of the first, so it fails after the batch and the first leg are written
+	batch_id := uuid.Must(uuid.NewV7())
+	transaction_id := uuid.Must(uuid.NewV7())
+	account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amount := decimal.NewFromInt(1)
+	err = s.Repositories.TransactionBatchRepository.CreateTransactionBatch(&model.TransactionBatch{
+		Id:            batch_id,
+		UserId:        account.UserId,
+		FromAccountId: account.Id,
+		TotalAmount:   amount.Mul(decimal.NewFromInt(2)),
+	}, []model.TransactionBatchLeg{
+		{TransactionId: transaction_id, ToAccountId: uuid.MustParse(transferable_account), Amount: amount},
+		{TransactionId: transaction_id, ToAccountId: uuid.MustParse(transferable_account), Amount: amount},
+	}, "posted")
+	if err == nil {
+		t.Fatal("Batch with a failing leg was created")
+	}
+
+	checkNoBatch(t, account_id)
+
+	status, _, err = JSONRequest("GET", "/transaction/batch/"+batch_id.String(), ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 404 {
+		t.Errorf("Failed batch was found. Expected: 404, Actual: %d", status)
+	}
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !account_balance.Balance.Equal(decimal.NewFromInt(10)) || !account_balance.AvailableBalance.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Failed batches moved money. Expected: 10, Actual: %s (available %s)", account_balance.Balance.String(), account_balance.AvailableBalance.String())
+	}
+}
+
+func TestBatchChargesTransferFeePerLeg(t *testing.T) {
+	// fee rules apply to every account of the type and currency, GBP accounts are only used here
+	account_id := createAccount(t, "GBP")
+	to_account_id := createAccount(t, "GBP")
+	DepositTransactionRequest(account_id, "10.00")
+
+	account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Repositories.FeeRepository.SetFeeRule(&model.FeeRule{
+		AccountType: account.Type,
+		Currency:    account.Currency,
+		Kind:        "transfer",
+		Flat:        decimal.RequireFromString("0.50"),
+		UpdatedBy:   account.UserId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		rule, err := s.Repositories.FeeRepository.GetFeeRule(account.Type, account.Currency, "transfer")
+		if err == nil {
+			s.Repositories.FeeRepository.DeleteFeeRule(rule.Id.String())
+		}
+	})
+
+	// the legs alone fit in the balance, the legs and their fees do not
+	status, _, err := JSONRequest("POST", "/transaction/batch", `{
+		"from_account_id": "`+account_id+`",
+		"legs": [
+			{"amount": "5.00", "to_account_id": "`+to_account_id+`"},
+			{"amount": "4.50", "to_account_id": "`+to_account_id+`"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 400 {
+		t.Errorf("Batch not covering its fees was not rejected. Expected: 400, Actual: %d", status)
+	}
+
+	status, payload_resp, err := JSONRequest("POST", "/transaction/batch", `{
+		"from_account_id": "`+account_id+`",
+		"legs": [
+			{"amount": "4.00", "to_account_id": "`+to_account_id+`"},
+			{"amount": "4.00", "to_account_id": "`+to_account_id+`"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Fatalf("Failed to create batch. Expected: 200, Actual: %d", status)
+	}
+
+	for _, transaction_id := range payload_resp["payload"].(map[string]interface{})["transaction_ids"].([]interface{}) {
+		fees, err := s.Repositories.TransactionRepository.GetFees(transaction_id.(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(*fees) != 1 || !(*fees)[0].Amount.Equal(decimal.RequireFromString("0.50")) {
+			t.Errorf("Leg %s was not charged its transfer fee", transaction_id)
+		}
+	}
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !account_balance.Balance.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("Batch did not debit its legs and fees. Expected: 1, Actual: %s", account_balance.Balance.String())
+	}
+}
+
+func setTransferFee(t *testing.T, account *model.Account, flat string) {
+	t.Helper()
+
+	err := s.Repositories.FeeRepository.SetFeeRule(&model.FeeRule{
+		AccountType: account.Type,
+		Currency:    account.Currency,
+		Kind:        "transfer",
+		Flat:        decimal.RequireFromString(flat),
+		UpdatedBy:   account.UserId,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		rule, err := s.Repositories.FeeRepository.GetFeeRule(account.Type, account.Currency, "transfer")
+		if err == nil {
+			s.Repositories.FeeRepository.DeleteFeeRule(rule.Id.String())
+		}
+	})
+}
+
+func checkTransactionStatus(t *testing.T, transaction_id string, expected_status string, expected_fee_status string) {
+	t.Helper()
+
+	status, payload_resp, err := JSONRequest("GET", "/transaction/"+transaction_id, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Fatalf("Failed to get transaction. Expected: 200, Actual: %d", status)
+	}
+
+	transaction := payload_resp["payload"].(map[string]interface{})
+	if transaction["status"] != expected_status {
+		t.Errorf("Unexpected status of transaction %s. Expected: %s, Actual: %v", transaction_id, expected_status, transaction["status"])
+	}
+
+	fees := transaction["fees"].([]interface{})
+	if len(fees) != 1 || fees[0].(map[string]interface{})["status"] != expected_fee_status {
+		t.Errorf("Unexpected fees of transaction %s. Expected: 1 %s fee, Actual: %v", transaction_id, expected_fee_status, fees)
+	}
+}
+
+func checkReviewStatus(t *testing.T, transaction_id string, expected_status string) {
+	t.Helper()
+
+	_, payload_resp, err := JSONRequest("GET", "/transaction/"+transaction_id, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	review, ok := payload_resp["payload"].(map[string]interface{})["review"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Transaction %s has no review", transaction_id)
+	}
+
+	if review["status"] != expected_status {
+		t.Errorf("Unexpected review status of transaction %s. Expected: %s, Actual: %v", transaction_id, expected_status, review["status"])
+	}
+}
+
+func TestReviewDecisionsSettleHeldTransactions(t *testing.T) {
+	account_id := createAccount(t, "GBP")
+	to_account_id := createAccount(t, "GBP")
+	DepositTransactionRequest(account_id, "20.00")
+
+	account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setTransferFee(t, account, "0.50")
+
+	// every transfer over the limit is held for review
+	err = s.Repositories.LimitRepository.SetAccountLimit(account_id, "transfer", "single", decimal.NewFromInt(1), account.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, payload_resp, err := JSONRequest("POST", "/transaction/transfer", `{
+		"amount": "5.00",
+		"from_account_id": "`+account_id+`",
+		"to_account_id": "`+to_account_id+`"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 202 {
+		t.Fatalf("Transfer over the limit was not held. Expected: 202, Actual: %d", status)
+	}
+
+	transaction_id := payload_resp["payload"].(map[string]interface{})["transaction_id"].(string)
+
+	status, payload_resp, err = JSONRequest("POST", "/transaction/batch", `{
+		"from_account_id": "`+account_id+`",
+		"legs": [
+			{"amount": "3.00", "to_account_id": "`+to_account_id+`"},
+			{"amount": "3.00", "to_account_id": "`+to_account_id+`"}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 202 {
+		t.Fatalf("Batch over the limit was not held. Expected: 202, Actual: %d", status)
+	}
+
+	leg_ids := []string{}
+	for _, leg_id := range payload_resp["payload"].(map[string]interface{})["transaction_ids"].([]interface{}) {
+		leg_ids = append(leg_ids, leg_id.(string))
+	}
+
+	checkTransactionStatus(t, transaction_id, "pending", "posted")
+	checkReviewStatus(t, leg_ids[0], "pending")
+
+	reviews, err := s.Repositories.ReviewRepository.GetTransactionReviewsByAccount(account_id, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*reviews) != 2 {
+		t.Fatalf("Unexpected number of reviews. Expected: 2, Actual: %d", len(*reviews))
+	}
+
+	for _, review := range *reviews {
+		if review.TransactionId != nil {
+			_, err = s.Repositories.ReviewRepository.ApproveTransactionReview(review.Id.String(), "Known payee", account.UserId)
+		} else {
+			_, err = s.Repositories.ReviewRepository.RejectTransactionReview(review.Id.String(), "Unknown payees", account.UserId)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkTransactionStatus(t, transaction_id, "posted", "posted")
+	checkReviewStatus(t, transaction_id, "approved")
+	for _, leg_id := range leg_ids {
+		checkTransactionStatus(t, leg_id, "failed", "reversed")
+		checkReviewStatus(t, leg_id, "rejected")
+	}
+
+	// only the approved transfer and its fee are left
+	account_balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected_balance := decimal.RequireFromString("14.50")
+	if !account_balance.Balance.Equal(expected_balance) || !account_balance.AvailableBalance.Equal(expected_balance) {
+		t.Errorf("Unexpected balance after the reviews. Expected: %s, Actual: %s (available %s)", expected_balance.String(), account_balance.Balance.String(), account_balance.AvailableBalance.String())
+	}
+}
+
+func TestRefundOverTheLimitOfTheDebitedAccountIsHeld(t *testing.T) {
+	account_id := createAccount(t, "GBP")
+	to_account_id := createAccount(t, "GBP")
+	DepositTransactionRequest(account_id, "20.00")
+
+	account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setTransferFee(t, account, "0.50")
+
+	transaction_id, err := TransferTransactionRequest(account_id, to_account_id, "5.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the refund debits the destination account of the transfer, its limits apply
+	err = s.Repositories.LimitRepository.SetAccountLimit(to_account_id, "transfer", "single", decimal.NewFromInt(1), account.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, payload_resp, err := JSONRequest("POST", "/transaction/refund/"+transaction_id, ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 202 {
+		t.Fatalf("Refund over the limit was not held. Expected: 202, Actual: %d", status)
+	}
+
+	refund_transaction_id := payload_resp["payload"].(map[string]interface{})["transaction_id"].(string)
+
+	// the fee of the transfer is only given back once the refund is posted
+	checkTransactionStatus(t, transaction_id, "posted", "posted")
+	checkReviewStatus(t, refund_transaction_id, "pending")
+
+	review, err := s.Repositories.ReviewRepository.GetTransactionReviewByTransaction(refund_transaction_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Repositories.ReviewRepository.ApproveTransactionReview(review.Id.String(), "Refund requested by the payer", account.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refund, err := s.Repositories.TransactionRepository.GetTransaction(refund_transaction_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refund.Status != "posted" {
+		t.Errorf("Unexpected status of the approved refund. Expected: posted, Actual: %s", refund.Status)
+	}
+
+	checkTransactionStatus(t, transaction_id, "posted", "reversed")
+
+	account_balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !account_balance.Balance.Equal(decimal.NewFromInt(20)) {
+		t.Errorf("Unexpected balance after the refund. Expected: 20, Actual: %s", account_balance.Balance.String())
+	}
+}
+
+func TestHeldScheduledTransferOccurrenceFailsWhenRejected(t *testing.T) {
+	account_id := createAccount(t, "USD")
+	DepositTransactionRequest(account_id, "100.00")
+
+	account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Repositories.LimitRepository.SetAccountLimit(account_id, "transfer", "single", decimal.NewFromInt(1), account.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, payload_resp, err := JSONRequest("POST", "/scheduled-transfer", `{
+		"amount": "5.00",
+		"from_account_id": "`+account_id+`",
+		"to_account_id": "`+transferable_account+`",
+		"frequency": "daily",
+		"start_date": "`+time.Now().UTC().Format(time.DateOnly)+`",
+		"business_day_adjustment": "none"
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status != 200 {
+		t.Fatalf("Failed to create scheduled transfer. Expected: 200, Actual: %d", status)
+	}
+
+	scheduled_transfer_id := payload_resp["payload"].(map[string]interface{})["id"].(string)
+
+	s.RunScheduledTransfers()
+
+	executions, err := s.Repositories.ScheduledTransferRepository.GetScheduledTransferExecutions(scheduled_transfer_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*executions) != 1 || (*executions)[0].Status != "held" || (*executions)[0].TransactionId == nil {
+		t.Fatalf("Occurrence over the limit was not recorded as held. Actual: %v", *executions)
+	}
+
+	review, err := s.Repositories.ReviewRepository.GetTransactionReviewByTransaction((*executions)[0].TransactionId.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Repositories.ReviewRepository.RejectTransactionReview(review.Id.String(), "Unknown payee", account.UserId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executions, err = s.Repositories.ScheduledTransferRepository.GetScheduledTransferExecutions(scheduled_transfer_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (*executions)[0].Status != "failed" {
+		t.Errorf("Unexpected status of the rejected occurrence. Expected: failed, Actual: %s", (*executions)[0].Status)
+	}
+
+	notifications, err := s.Repositories.NotificationRepository.GetNotifications(account.UserId.String(), true, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notified := false
+	for _, notification := range *notifications {
+		if notification.Kind == "scheduled_transfer_failed" && strings.Contains(notification.Message, "Rejected in review") {
+			notified = true
+		}
+	}
+
+	if !notified {
+		t.Error("User was not notified of the rejected occurrence")
+	}
+}
+
+func TestAbandonedIdempotencyKeyIsTakenOverAfterItsLease(t *testing.T) {
+	idempotency_key := uuid.NewString()
+
+	account, err := s.Repositories.AccountRepository.GetAccount(user_account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a reservation left by a request that died before storing its response
+	reserved, err := s.Repositories.IdempotencyKeyRepository.ReserveIdempotencyKey(account.UserId.String(), idempotency_key, "abandoned", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reserved {
+		t.Fatal("Failed to reserve the idempotency key")
+	}
+
+	status, err := IdempotentDepositTransactionRequest(user_account, "1.00", idempotency_key)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if status != 200 {
+		t.Errorf("Abandoned key was not taken over. Expected: 200, Actual: %d", status)
+	}
+}
+
+func TestRenewedIdempotencyKeyIsNotTakenOver(t *testing.T) {
+	idempotency_key := uuid.NewString()
+	idempotency_keys := s.Repositories.IdempotencyKeyRepository
+
+	account, err := s.Repositories.AccountRepository.GetAccount(user_account)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a reservation whose lease ran out while its request is still running and renewing it
+	reserved, err := idempotency_keys.ReserveIdempotencyKey(account.UserId.String(), idempotency_key, "running", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reserved {
+		t.Fatal("Failed to reserve the idempotency key")
+	}
+
+	err = idempotency_keys.RenewIdempotencyKey(account.UserId.String(), idempotency_key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := IdempotentDepositTransactionRequest(user_account, "1.00", idempotency_key)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// a takeover would run the deposit, the reservation still held answers it instead
+	if status != 422 {
+		t.Errorf("Renewed key was taken over. Expected: 422, Actual: %d", status)
+	}
+}
+
+func IdempotentJSONRequest(method string, path string, payload string, idempotency_key string) (int, map[string]interface{}, error) {
+	url := "http://localhost:5001" + path
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer([]byte(payload)))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotency_key)
+	req.Header.Set("Cookie", "sessionId="+sessionId+"; Max-Age=86400; Domain=localhost; Path=/; Secure; HttpOnly")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var payload_resp map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&payload_resp)
+
+	return resp.StatusCode, payload_resp, nil
+}
+
+func TestRetriedScheduledTransferIsCreatedOnce(t *testing.T) {
+	account_id := createAccount(t, "USD")
+	idempotency_key := uuid.NewString()
+	payload := `{
+		"amount": "5.00",
+		"from_account_id": "` + account_id + `",
+		"to_account_id": "` + transferable_account + `",
+		"frequency": "monthly",
+		"start_date": "` + time.Now().UTC().AddDate(0, 1, 0).Format(time.DateOnly) + `",
+		"business_day_adjustment": "none"
+	}`
+
+	scheduled_transfer_ids := []string{}
+	for i := 0; i < 2; i++ {
+		status, payload_resp, err := IdempotentJSONRequest("POST", "/scheduled-transfer", payload, idempotency_key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != 200 {
+			t.Fatalf("Failed to create scheduled transfer. Expected: 200, Actual: %d", status)
+		}
+
+		scheduled_transfer_ids = append(scheduled_transfer_ids, payload_resp["payload"].(map[string]interface{})["id"].(string))
+	}
+
+	if scheduled_transfer_ids[0] != scheduled_transfer_ids[1] {
+		t.Errorf("Retry created another scheduled transfer. Expected: %s, Actual: %s", scheduled_transfer_ids[0], scheduled_transfer_ids[1])
+	}
+
+	var scheduled_transfers int
+	err := s.Repositories.AccountRepository.Pg.Get(&scheduled_transfers, `SELECT COUNT(*) FROM "scheduled_transfer" st WHERE st.from_account_id = $1`, account_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scheduled_transfers != 1 {
+		t.Errorf("Unexpected number of scheduled transfers. Expected: 1, Actual: %d", scheduled_transfers)
+	}
+}
@@ -0,0 +1,67 @@
+-- Add migration script here
+-- System accounts are owned by a user that cannot log in (its password is not a bcrypt hash)
+INSERT INTO "user" (id, email, password) VALUES ('00000000-0000-7000-8000-000000000000', 'system@welloff.bank', '!');
+
+INSERT INTO "account" (id, user_id, name, status) VALUES
+  ('00000000-0000-7000-8000-000000000001', '00000000-0000-7000-8000-000000000000', 'Cash In', 'active'),
+  ('00000000-0000-7000-8000-000000000002', '00000000-0000-7000-8000-000000000000', 'Cash Out', 'active');
+
+CREATE TYPE entry_direction AS ENUM ('debit', 'credit');
+
+CREATE TABLE "journal_entry" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  transaction_id UUID NOT NULL,
+  account_id UUID NOT NULL,
+  direction entry_direction NOT NULL,
+  amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id)
+);
+
+CREATE INDEX journal_entry_account_id_created_at_idx ON "journal_entry" (account_id, created_at);
+CREATE INDEX journal_entry_transaction_id_idx ON "journal_entry" (transaction_id);
+
+-- Every transaction must have debits equal to credits once its database transaction commits
+CREATE FUNCTION check_journal_entry_balanced() RETURNS TRIGGER AS $$
+BEGIN
+  IF (
+    SELECT SUM(CASE WHEN je.direction = 'debit' THEN je.amount ELSE -je.amount END)
+    FROM "journal_entry" je
+    WHERE je.transaction_id = NEW.transaction_id
+  ) <> 0 THEN
+    RAISE EXCEPTION 'journal entries of transaction % are not balanced', NEW.transaction_id;
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER journal_entry_balanced
+  AFTER INSERT OR UPDATE ON "journal_entry"
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Backfill the journal from the single-record transactions
+INSERT INTO "journal_entry" (transaction_id, account_id, direction, amount, created_at)
+SELECT tx.id,
+  CASE tx.kind
+    WHEN 'deposit' THEN '00000000-0000-7000-8000-000000000001'
+    WHEN 'withdrawal' THEN tx.from_account_id
+    WHEN 'transfer' THEN tx.from_account_id
+    WHEN 'refund' THEN tx.to_account_id
+  END,
+  'debit', tx.amount, tx.date_issued
+FROM "transaction" tx;
+
+INSERT INTO "journal_entry" (transaction_id, account_id, direction, amount, created_at)
+SELECT tx.id,
+  CASE tx.kind
+    WHEN 'deposit' THEN tx.to_account_id
+    WHEN 'withdrawal' THEN '00000000-0000-7000-8000-000000000002'
+    WHEN 'transfer' THEN tx.to_account_id
+    WHEN 'refund' THEN tx.from_account_id
+  END,
+  'credit', tx.amount, tx.date_issued
+FROM "transaction" tx;
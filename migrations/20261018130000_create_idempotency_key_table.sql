@@ -0,0 +1,14 @@
+-- Add migration script here
+CREATE TABLE "idempotency_key" (
+  key VARCHAR(255) NOT NULL,
+  user_id UUID NOT NULL,
+  fingerprint CHAR(64) NOT NULL,
+  response_status INTEGER, -- null while the original request is still being processed
+  response_content_type VARCHAR(255),
+  response_body BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, key),
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id)
+);
@@ -0,0 +1,18 @@
+-- Add migration script here
+CREATE TYPE transaction_status AS ENUM ('pending', 'posted', 'failed', 'reversed');
+
+ALTER TABLE "transaction"
+  ADD COLUMN status transaction_status NOT NULL DEFAULT 'posted',
+  ADD COLUMN posted_at TIMESTAMPTZ,
+  ADD COLUMN failed_at TIMESTAMPTZ,
+  ADD COLUMN reversed_at TIMESTAMPTZ;
+
+UPDATE "transaction" SET posted_at = date_issued;
+
+-- entries of a pending transaction only affect the ledger balance once they are posted
+ALTER TABLE "journal_entry" ADD COLUMN posted_at TIMESTAMPTZ;
+
+UPDATE "journal_entry" SET posted_at = created_at;
+
+DROP INDEX journal_entry_account_id_created_at_idx;
+CREATE INDEX journal_entry_account_id_posted_at_idx ON "journal_entry" (account_id, posted_at);
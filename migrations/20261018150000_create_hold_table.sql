@@ -0,0 +1,23 @@
+-- Add migration script here
+ALTER TYPE transaction_kind ADD VALUE 'capture';
+
+CREATE TYPE hold_status AS ENUM ('active', 'captured', 'released', 'expired');
+
+CREATE TABLE "hold" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_id UUID NOT NULL,
+  amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+  captured_amount DECIMAL(15, 2) NOT NULL DEFAULT 0,
+  merchant VARCHAR(255) NOT NULL,
+  purpose VARCHAR(255) NOT NULL DEFAULT '',
+  status hold_status NOT NULL DEFAULT 'active',
+  expires_at TIMESTAMPTZ NOT NULL,
+  capture_transaction_id UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_capture_transaction FOREIGN KEY(capture_transaction_id) REFERENCES "transaction"(id)
+);
+
+CREATE INDEX hold_account_id_status_idx ON "hold" (account_id, status);
@@ -0,0 +1,40 @@
+-- Add migration script here
+-- amounts keep up to 3 decimal places so currencies such as BHD fit, the minor units of
+-- each currency are enforced by the application
+ALTER TABLE "transaction" ALTER COLUMN amount TYPE DECIMAL(18, 3);
+ALTER TABLE "journal_entry" ALTER COLUMN amount TYPE DECIMAL(18, 3);
+ALTER TABLE "hold" ALTER COLUMN amount TYPE DECIMAL(18, 3), ALTER COLUMN captured_amount TYPE DECIMAL(18, 3);
+ALTER TABLE "balance_snapshot" ALTER COLUMN balance TYPE DECIMAL(18, 3);
+
+-- ISO 4217 code, system accounts hold every currency and use 'XXX' (no currency)
+ALTER TABLE "account" ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+UPDATE "account" SET currency = 'XXX' WHERE user_id = '00000000-0000-7000-8000-000000000000';
+ALTER TABLE "account" ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE "transaction" ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE "transaction" ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE "journal_entry" ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE "journal_entry" ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE "balance_snapshot" ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE "balance_snapshot" ALTER COLUMN currency DROP DEFAULT;
+ALTER TABLE "balance_snapshot" DROP CONSTRAINT balance_snapshot_account_id_key;
+ALTER TABLE "balance_snapshot" ADD CONSTRAINT balance_snapshot_account_id_currency_key UNIQUE (account_id, currency);
+
+-- debits must equal credits in each currency of a transaction
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS TRIGGER AS $$
+BEGIN
+  IF EXISTS (
+    SELECT 1
+    FROM "journal_entry" je
+    WHERE je.transaction_id = NEW.transaction_id
+    GROUP BY je.currency
+    HAVING SUM(CASE WHEN je.direction = 'debit' THEN je.amount ELSE -je.amount END) <> 0
+  ) THEN
+    RAISE EXCEPTION 'journal entries of transaction % are not balanced', NEW.transaction_id;
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
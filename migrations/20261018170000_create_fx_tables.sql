@@ -0,0 +1,30 @@
+-- Add migration script here
+ALTER TYPE transaction_kind ADD VALUE 'exchange';
+
+INSERT INTO "account" (id, user_id, name, status, currency) VALUES
+  ('00000000-0000-7000-8000-000000000003', '00000000-0000-7000-8000-000000000000', 'FX Position', 'active', 'XXX'),
+  ('00000000-0000-7000-8000-000000000004', '00000000-0000-7000-8000-000000000000', 'Fee Income', 'active', 'XXX');
+
+-- units of the quote currency bought by one unit of the base currency
+CREATE TABLE "fx_rate" (
+  base CHAR(3) NOT NULL,
+  quote CHAR(3) NOT NULL,
+  rate DECIMAL(24, 12) NOT NULL CHECK (rate > 0),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (base, quote)
+);
+
+CREATE TABLE "fx_conversion" (
+  transaction_id UUID PRIMARY KEY,
+  from_currency CHAR(3) NOT NULL,
+  to_currency CHAR(3) NOT NULL,
+  from_amount DECIMAL(18, 3) NOT NULL,
+  to_amount DECIMAL(18, 3) NOT NULL,
+  rate DECIMAL(24, 12) NOT NULL,
+  spread DECIMAL(9, 6) NOT NULL,
+  fee DECIMAL(18, 3) NOT NULL, -- charged in from_currency
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id)
+);
@@ -0,0 +1,2 @@
+-- Add migration script here
+CREATE INDEX transaction_related_transaction_id_idx ON "transaction" (related_transaction_id);
@@ -0,0 +1,38 @@
+-- Add migration script here
+CREATE TYPE ach_account_type AS ENUM ('checking', 'savings');
+CREATE TYPE ach_entry_status AS ENUM ('queued', 'batched', 'returned');
+
+CREATE TABLE "ach_file" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  file_name VARCHAR(255) NOT NULL UNIQUE,
+  file_id_modifier CHAR(1) NOT NULL,
+  entry_count INTEGER NOT NULL,
+  total_credit DECIMAL(15, 2) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- the last 7 digits of the trace numbers, unique for the originating bank
+CREATE SEQUENCE ach_trace_number_seq;
+
+CREATE TABLE "ach_entry" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  transaction_id UUID NOT NULL UNIQUE,
+  routing_number CHAR(9) NOT NULL,
+  account_number VARCHAR(17) NOT NULL,
+  account_type ach_account_type NOT NULL,
+  name VARCHAR(22) NOT NULL,
+  sec_code CHAR(3) NOT NULL CHECK (sec_code IN ('PPD', 'CCD')),
+  amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+  status ach_entry_status NOT NULL DEFAULT 'queued',
+  trace_number CHAR(15) UNIQUE,
+  file_id UUID,
+  return_code CHAR(3),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  batched_at TIMESTAMPTZ,
+  returned_at TIMESTAMPTZ,
+
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  CONSTRAINT fk_file FOREIGN KEY(file_id) REFERENCES "ach_file"(id)
+);
+
+CREATE INDEX ach_entry_status_idx ON "ach_entry" (status);
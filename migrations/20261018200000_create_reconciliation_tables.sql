@@ -0,0 +1,70 @@
+-- Add migration script here
+ALTER TYPE transaction_kind ADD VALUE 'adjustment';
+
+-- admins run back office work like reconciliation, they are promoted by hand:
+-- UPDATE "user" SET is_admin = true WHERE email = '...';
+ALTER TABLE "user" ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- other side of the adjustments of differences found when reconciling, until they are explained
+INSERT INTO "account" (id, user_id, name, status, currency) VALUES
+  ('00000000-0000-7000-8000-000000000005', '00000000-0000-7000-8000-000000000000', 'Reconciliation Suspense', 'active', 'XXX');
+
+CREATE TABLE "reconciliation_import" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL,
+  file_name VARCHAR(255) NOT NULL,
+  currency CHAR(3) NOT NULL,
+  date_from DATE NOT NULL,
+  date_to DATE NOT NULL,
+  line_count INTEGER NOT NULL,
+  matched_count INTEGER NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id)
+);
+
+CREATE TYPE statement_line_status AS ENUM ('matched', 'unmatched', 'adjusted', 'dismissed');
+
+CREATE TABLE "statement_line" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  import_id UUID NOT NULL,
+  line_number INTEGER NOT NULL,
+  booked_on DATE NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL, -- signed, credits to the partner bank account are positive
+  currency CHAR(3) NOT NULL,
+  reference VARCHAR(255) NOT NULL DEFAULT '',
+  description TEXT NOT NULL DEFAULT '',
+  status statement_line_status NOT NULL,
+  transaction_id UUID UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_import FOREIGN KEY(import_id) REFERENCES "reconciliation_import"(id),
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id)
+);
+
+CREATE INDEX statement_line_import_id_idx ON "statement_line" (import_id);
+
+CREATE TYPE reconciliation_item_status AS ENUM ('open', 'matched', 'adjusted', 'dismissed');
+
+-- the reconciliation queue, a statement line or a transaction that was not matched on import
+CREATE TABLE "reconciliation_item" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  import_id UUID NOT NULL,
+  statement_line_id UUID UNIQUE,
+  transaction_id UUID UNIQUE,
+  status reconciliation_item_status NOT NULL DEFAULT 'open',
+  adjustment_transaction_id UUID,
+  note TEXT NOT NULL DEFAULT '',
+  resolved_by UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  resolved_at TIMESTAMPTZ,
+
+  CONSTRAINT fk_import FOREIGN KEY(import_id) REFERENCES "reconciliation_import"(id),
+  CONSTRAINT fk_statement_line FOREIGN KEY(statement_line_id) REFERENCES "statement_line"(id),
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  CONSTRAINT fk_adjustment_transaction FOREIGN KEY(adjustment_transaction_id) REFERENCES "transaction"(id),
+  CONSTRAINT fk_resolved_by FOREIGN KEY(resolved_by) REFERENCES "user"(id),
+  CONSTRAINT one_side CHECK ((statement_line_id IS NULL) <> (transaction_id IS NULL))
+);
+
+CREATE INDEX reconciliation_item_status_idx ON "reconciliation_item" (status);
@@ -0,0 +1,68 @@
+-- Add migration script here
+CREATE TYPE scheduled_transfer_frequency AS ENUM ('once', 'daily', 'weekly', 'monthly');
+CREATE TYPE business_day_adjustment AS ENUM ('none', 'following', 'preceding', 'modified_following');
+CREATE TYPE scheduled_transfer_status AS ENUM ('active', 'paused', 'cancelled', 'completed');
+
+CREATE TABLE "scheduled_transfer" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL,
+  from_account_id UUID NOT NULL,
+  to_account_id UUID NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL CHECK (amount > 0),
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  frequency scheduled_transfer_frequency NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE,
+  max_executions INTEGER CHECK (max_executions > 0),
+  business_day_adjustment business_day_adjustment NOT NULL DEFAULT 'following',
+  status scheduled_transfer_status NOT NULL DEFAULT 'active',
+  -- index of the next occurrence, counting from 0
+  occurrence INTEGER NOT NULL DEFAULT 0,
+  -- business day adjusted date of the next occurrence, NULL once there is none left
+  next_run_on DATE,
+  -- attempts of the current occurrence that failed for insufficient funds
+  retry_count INTEGER NOT NULL DEFAULT 0,
+  retry_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id),
+  CONSTRAINT fk_from_account FOREIGN KEY(from_account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_to_account FOREIGN KEY(to_account_id) REFERENCES "account"(id)
+);
+
+CREATE INDEX scheduled_transfer_user_id_idx ON "scheduled_transfer" (user_id);
+CREATE INDEX scheduled_transfer_status_next_run_on_idx ON "scheduled_transfer" (status, next_run_on);
+
+-- an occurrence is claimed with a running execution before its transfer is made, so it is never paid twice
+CREATE TYPE scheduled_transfer_execution_status AS ENUM ('running', 'succeeded', 'retrying', 'failed');
+
+-- every attempt at running an occurrence
+CREATE TABLE "scheduled_transfer_execution" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  scheduled_transfer_id UUID NOT NULL,
+  occurrence INTEGER NOT NULL,
+  scheduled_for DATE NOT NULL,
+  attempt INTEGER NOT NULL,
+  status scheduled_transfer_execution_status NOT NULL,
+  transaction_id UUID,
+  error VARCHAR(255) NOT NULL DEFAULT '',
+  executed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_scheduled_transfer FOREIGN KEY(scheduled_transfer_id) REFERENCES "scheduled_transfer"(id),
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  UNIQUE (scheduled_transfer_id, occurrence, attempt)
+);
+
+CREATE TABLE "notification" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL,
+  kind VARCHAR(64) NOT NULL,
+  message TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  read_at TIMESTAMPTZ,
+
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id)
+);
+
+CREATE INDEX notification_user_id_idx ON "notification" (user_id);
@@ -0,0 +1,20 @@
+-- Add migration script here
+CREATE TABLE "transaction_batch" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL,
+  from_account_id UUID NOT NULL,
+  currency CHAR(3) NOT NULL,
+  total_amount DECIMAL(18, 3) NOT NULL CHECK (total_amount > 0),
+  leg_count INTEGER NOT NULL CHECK (leg_count > 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id),
+  CONSTRAINT fk_from_account FOREIGN KEY(from_account_id) REFERENCES "account"(id)
+);
+
+CREATE INDEX transaction_batch_user_id_idx ON "transaction_batch" (user_id);
+
+-- the batch the transaction is a leg of
+ALTER TABLE "transaction" ADD COLUMN batch_id UUID REFERENCES "transaction_batch"(id);
+
+CREATE INDEX transaction_batch_id_idx ON "transaction" (batch_id);
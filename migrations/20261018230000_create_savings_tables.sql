@@ -0,0 +1,60 @@
+-- Add migration script here
+CREATE TYPE account_type AS ENUM ('checking', 'savings');
+
+ALTER TABLE "account" ADD COLUMN type account_type NOT NULL DEFAULT 'checking';
+
+ALTER TYPE transaction_kind ADD VALUE 'interest';
+
+-- other side of the interest paid on savings accounts
+INSERT INTO "account" (id, user_id, name, status, currency) VALUES
+  ('00000000-0000-7000-8000-000000000006', '00000000-0000-7000-8000-000000000000', 'Interest Expense', 'active', 'XXX');
+
+-- annual percentage yield paid on the savings accounts of a currency from a day on
+CREATE TABLE "savings_rate" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  currency CHAR(3) NOT NULL,
+  apy DECIMAL(9, 6) NOT NULL CHECK (apy >= 0),
+  effective_from DATE NOT NULL,
+  created_by UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_created_by FOREIGN KEY(created_by) REFERENCES "user"(id),
+  UNIQUE (currency, effective_from)
+);
+
+-- monthly payment of the interest accrued by an account
+CREATE TABLE "interest_credit" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_id UUID NOT NULL,
+  period_start DATE NOT NULL,
+  period_end DATE NOT NULL,
+  -- sum of the daily accruals, before rounding
+  accrued DECIMAL(30, 10) NOT NULL,
+  -- accrued rounded to the minor unit of the currency
+  amount DECIMAL(18, 3) NOT NULL,
+  -- NULL when the amount rounds to nothing
+  transaction_id UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  UNIQUE (account_id, period_start)
+);
+
+-- interest earned by a savings account each day, one row per account and day
+CREATE TABLE "interest_accrual" (
+  account_id UUID NOT NULL,
+  accrual_date DATE NOT NULL,
+  -- end-of-day ledger balance
+  balance DECIMAL(18, 3) NOT NULL,
+  apy DECIMAL(9, 6) NOT NULL,
+  daily_rate DECIMAL(20, 16) NOT NULL,
+  amount DECIMAL(30, 10) NOT NULL,
+  -- NULL until the month is credited
+  credit_id UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (account_id, accrual_date),
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_credit FOREIGN KEY(credit_id) REFERENCES "interest_credit"(id)
+);
@@ -0,0 +1,40 @@
+-- Add migration script here
+ALTER TYPE transaction_kind ADD VALUE 'fee';
+
+CREATE TYPE fee_kind AS ENUM ('transfer', 'withdrawal', 'maintenance', 'fx_spread');
+
+-- fee schedule, one rule per account type, currency and kind of fee
+CREATE TABLE "fee_rule" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_type account_type NOT NULL,
+  currency CHAR(3) NOT NULL,
+  kind fee_kind NOT NULL,
+  flat DECIMAL(18, 3) NOT NULL DEFAULT 0 CHECK (flat >= 0),
+  percentage DECIMAL(9, 6) NOT NULL DEFAULT 0 CHECK (percentage >= 0 AND percentage < 1),
+  min_amount DECIMAL(18, 3) CHECK (min_amount >= 0),
+  max_amount DECIMAL(18, 3) CHECK (max_amount >= 0),
+  waive_above_balance DECIMAL(18, 3),
+  updated_by UUID NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_updated_by FOREIGN KEY(updated_by) REFERENCES "user"(id),
+  UNIQUE (account_type, currency, kind)
+);
+
+CREATE TYPE maintenance_fee_status AS ENUM ('charged', 'waived', 'unpaid');
+
+-- monthly maintenance fee of an account, charged once per month
+CREATE TABLE "maintenance_fee_charge" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_id UUID NOT NULL,
+  period_start DATE NOT NULL,
+  balance DECIMAL(18, 3) NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL,
+  status maintenance_fee_status NOT NULL,
+  transaction_id UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  UNIQUE (account_id, period_start)
+);
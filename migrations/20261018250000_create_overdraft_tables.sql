@@ -0,0 +1,40 @@
+-- Add migration script here
+ALTER TYPE transaction_kind ADD VALUE 'overdraft_interest';
+
+-- other side of the interest charged on overdrawn accounts
+INSERT INTO "account" (id, user_id, name, status, currency) VALUES
+  ('00000000-0000-7000-8000-000000000007', '00000000-0000-7000-8000-000000000000', 'Interest Income', 'active', 'XXX');
+
+-- overdraft granted to an account, its available balance can go down to minus the limit
+CREATE TABLE "overdraft_facility" (
+  account_id UUID PRIMARY KEY,
+  overdraft_limit DECIMAL(18, 3) NOT NULL CHECK (overdraft_limit >= 0),
+  -- annual rate charged daily on the negative end-of-day balance, as a fraction
+  annual_rate DECIMAL(9, 6) NOT NULL CHECK (annual_rate >= 0 AND annual_rate < 1),
+  granted_by UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_granted_by FOREIGN KEY(granted_by) REFERENCES "user"(id)
+);
+
+-- overdraft interest of an account each day, one row per account and day
+CREATE TABLE "overdraft_interest" (
+  account_id UUID NOT NULL,
+  charge_date DATE NOT NULL,
+  -- end-of-day ledger balance
+  balance DECIMAL(18, 3) NOT NULL,
+  annual_rate DECIMAL(9, 6) NOT NULL,
+  -- interest of the day before rounding
+  accrued DECIMAL(30, 10) NOT NULL,
+  -- charged to the account, the fractions of the minor unit left are carried to the next days
+  amount DECIMAL(18, 3) NOT NULL,
+  -- NULL when nothing was charged
+  transaction_id UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (account_id, charge_date),
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id)
+);
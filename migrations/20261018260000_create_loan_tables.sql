@@ -0,0 +1,66 @@
+-- Add migration script here
+ALTER TYPE transaction_kind ADD VALUE 'loan_disbursement';
+ALTER TYPE transaction_kind ADD VALUE 'loan_payment';
+
+-- principal lent to the borrowers and not repaid yet
+INSERT INTO "account" (id, user_id, name, status, currency) VALUES
+  ('00000000-0000-7000-8000-000000000008', '00000000-0000-7000-8000-000000000000', 'Loans Receivable', 'active', 'XXX');
+
+CREATE TYPE amortization_method AS ENUM ('price', 'sac');
+CREATE TYPE loan_status AS ENUM ('active', 'paid_off');
+
+CREATE TABLE "loan" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL,
+  -- receives the principal
+  account_id UUID NOT NULL,
+  -- the installments are debited from it
+  repayment_account_id UUID NOT NULL,
+  currency CHAR(3) NOT NULL,
+  principal DECIMAL(18, 3) NOT NULL CHECK (principal > 0),
+  annual_rate DECIMAL(9, 6) NOT NULL CHECK (annual_rate >= 0 AND annual_rate < 1),
+  term_months INTEGER NOT NULL CHECK (term_months > 0),
+  method amortization_method NOT NULL,
+  first_due_date DATE NOT NULL,
+  -- charged once on every installment not paid on its due date
+  late_fee DECIMAL(18, 3) NOT NULL DEFAULT 0 CHECK (late_fee >= 0),
+  outstanding_principal DECIMAL(18, 3) NOT NULL,
+  status loan_status NOT NULL DEFAULT 'active',
+  disbursement_transaction_id UUID NOT NULL,
+  originated_by UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  paid_off_at TIMESTAMPTZ,
+
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id),
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_repayment_account FOREIGN KEY(repayment_account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_disbursement_transaction FOREIGN KEY(disbursement_transaction_id) REFERENCES "transaction"(id),
+  CONSTRAINT fk_originated_by FOREIGN KEY(originated_by) REFERENCES "user"(id)
+);
+
+CREATE INDEX loan_user_id_idx ON "loan" (user_id);
+
+-- 'late' installments are past their due date and were charged the late fee, 'prepaid' ones were settled by a payoff
+CREATE TYPE loan_installment_status AS ENUM ('scheduled', 'late', 'paid', 'prepaid');
+
+CREATE TABLE "loan_installment" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  loan_id UUID NOT NULL,
+  number INTEGER NOT NULL,
+  due_date DATE NOT NULL,
+  principal DECIMAL(18, 3) NOT NULL,
+  interest DECIMAL(18, 3) NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL,
+  late_fee DECIMAL(18, 3) NOT NULL DEFAULT 0,
+  status loan_installment_status NOT NULL DEFAULT 'scheduled',
+  -- the collector skips the installment until then after failing to debit it
+  next_attempt_at TIMESTAMPTZ,
+  transaction_id UUID,
+  paid_at TIMESTAMPTZ,
+
+  CONSTRAINT fk_loan FOREIGN KEY(loan_id) REFERENCES "loan"(id),
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  UNIQUE (loan_id, number)
+);
+
+CREATE INDEX loan_installment_status_due_date_idx ON "loan_installment" (status, due_date);
@@ -0,0 +1,37 @@
+-- Add migration script here
+-- 'outbound' counts withdrawals, transfers and exchanges together
+CREATE TYPE limit_kind AS ENUM ('withdrawal', 'transfer', 'outbound');
+-- 'single' caps every transaction, 'daily' and 'monthly' the total over the last 24 hours and 30 days
+CREATE TYPE limit_period AS ENUM ('single', 'daily', 'monthly');
+
+CREATE TABLE "account_limit" (
+  account_id UUID NOT NULL,
+  kind limit_kind NOT NULL,
+  period limit_period NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL CHECK (amount >= 0),
+  updated_by UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (account_id, kind, period),
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_updated_by FOREIGN KEY(updated_by) REFERENCES "user"(id)
+);
+
+-- temporary raises of a limit requested by the owner of the account
+CREATE TABLE "limit_increase" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  account_id UUID NOT NULL,
+  kind limit_kind NOT NULL,
+  period limit_period NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL,
+  reason VARCHAR(255) NOT NULL DEFAULT '',
+  requested_by UUID NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL,
+
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_requested_by FOREIGN KEY(requested_by) REFERENCES "user"(id)
+);
+
+CREATE INDEX limit_increase_account_id_idx ON "limit_increase" (account_id, kind, period, created_at);
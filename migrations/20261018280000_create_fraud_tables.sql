@@ -0,0 +1,36 @@
+-- Add migration script here
+CREATE TYPE security_event_kind AS ENUM ('session_created', 'password_changed');
+
+CREATE TABLE "security_event" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL,
+  kind security_event_kind NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id)
+);
+
+CREATE INDEX security_event_user_id_idx ON "security_event" (user_id, kind, created_at);
+
+CREATE TYPE fraud_outcome AS ENUM ('allow', 'hold', 'block');
+
+-- outcome of the fraud rules for every outbound transaction about to be made
+CREATE TABLE "fraud_decision" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  user_id UUID NOT NULL,
+  account_id UUID NOT NULL,
+  transaction_kind transaction_kind NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL,
+  currency CHAR(3) NOT NULL,
+  -- the id given to the transaction, or to the batch, it may not exist when making it failed afterwards. NULL when blocked.
+  transaction_id UUID,
+  outcome fraud_outcome NOT NULL,
+  matched_rules TEXT[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id),
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id)
+);
+
+CREATE INDEX fraud_decision_account_id_idx ON "fraud_decision" (account_id, created_at);
+CREATE INDEX fraud_decision_transaction_id_idx ON "fraud_decision" (transaction_id);
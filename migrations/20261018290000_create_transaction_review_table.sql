@@ -0,0 +1,32 @@
+-- Add migration script here
+CREATE TYPE review_status AS ENUM ('pending', 'approved', 'rejected');
+
+-- the manual review queue, a transaction or every leg of a batch held pending because it went over a limit of the
+-- account or matched a hold fraud rule, until an admin approves or rejects it
+CREATE TABLE "transaction_review" (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v7(),
+  transaction_id UUID UNIQUE,
+  batch_id UUID UNIQUE,
+  user_id UUID NOT NULL,
+  account_id UUID NOT NULL,
+  transaction_kind transaction_kind NOT NULL,
+  amount DECIMAL(18, 3) NOT NULL,
+  currency CHAR(3) NOT NULL,
+  -- why it was held, the limits it went over and the fraud rules it matched
+  reasons TEXT[] NOT NULL DEFAULT '{}',
+  status review_status NOT NULL DEFAULT 'pending',
+  decision_reason TEXT NOT NULL DEFAULT '',
+  decided_by UUID,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  decided_at TIMESTAMPTZ,
+
+  CONSTRAINT fk_transaction FOREIGN KEY(transaction_id) REFERENCES "transaction"(id),
+  CONSTRAINT fk_batch FOREIGN KEY(batch_id) REFERENCES "transaction_batch"(id),
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id),
+  CONSTRAINT fk_account FOREIGN KEY(account_id) REFERENCES "account"(id),
+  CONSTRAINT fk_decided_by FOREIGN KEY(decided_by) REFERENCES "user"(id),
+  CONSTRAINT one_subject CHECK ((transaction_id IS NULL) <> (batch_id IS NULL))
+);
+
+CREATE INDEX transaction_review_status_idx ON "transaction_review" (status, created_at);
+CREATE INDEX transaction_review_account_id_idx ON "transaction_review" (account_id, created_at);
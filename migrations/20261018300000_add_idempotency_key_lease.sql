@@ -0,0 +1,3 @@
+-- Add migration script here
+-- a reservation left by a request that never finished can be taken over once its lease expires
+ALTER TABLE "idempotency_key" ADD COLUMN locked_until TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,11 @@
+-- Add migration script here
+-- the message id of every imported pain.001 file, a file is imported at most once per user
+CREATE TABLE "pain001_message" (
+  user_id UUID NOT NULL,
+  msg_id TEXT NOT NULL,
+  status_msg_id VARCHAR(35) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+  PRIMARY KEY (user_id, msg_id),
+  CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES "user"(id)
+);
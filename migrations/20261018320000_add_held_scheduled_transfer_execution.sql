@@ -0,0 +1,3 @@
+-- Add migration script here
+-- an occurrence whose transfer is held for review, it succeeds or fails with the review
+ALTER TYPE scheduled_transfer_execution_status ADD VALUE 'held';
@@ -11,6 +11,10 @@ type Account struct {
 	Id     uuid.UUID `db:"id" json:"id"`
 	UserId uuid.UUID `db:"user_id" json:"user_id"`
 	Name   string    `db:"name" json:"name"`
+	// ISO 4217 code
+	Currency string `db:"currency" json:"currency"`
+	// 'checking' | 'savings'
+	Type string `db:"type" json:"type"`
 	// 'active' | 'inactive'
 	Status    string    `db:"status" json:"status"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
@@ -18,7 +22,41 @@ type Account struct {
 }
 
 type AccountBalance struct {
-	AccountId uuid.UUID       `db:"account_id" json:"account_id"`
-	Balance   decimal.Decimal `db:"balance" json:"balance"`
-	Date      time.Time       `db:"updated_at" json:"updated_at"`
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	Currency  string    `db:"currency" json:"currency"`
+	// posted transactions only
+	Balance decimal.Decimal `db:"balance" json:"balance"`
+	// posted transactions minus pending debits and active holds
+	AvailableBalance decimal.Decimal `db:"-" json:"available_balance"`
+	Date             time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// System accounts are the other side of money entering and leaving the bank,
+// they are created by the journal migration and owned by SystemUserId.
+var (
+	SystemUserId             = uuid.MustParse("00000000-0000-7000-8000-000000000000")
+	CashInAccountId          = uuid.MustParse("00000000-0000-7000-8000-000000000001")
+	CashOutAccountId         = uuid.MustParse("00000000-0000-7000-8000-000000000002")
+	FxPositionAccountId      = uuid.MustParse("00000000-0000-7000-8000-000000000003")
+	FeeIncomeAccountId       = uuid.MustParse("00000000-0000-7000-8000-000000000004")
+	SuspenseAccountId        = uuid.MustParse("00000000-0000-7000-8000-000000000005")
+	InterestExpenseAccountId = uuid.MustParse("00000000-0000-7000-8000-000000000006")
+	InterestIncomeAccountId  = uuid.MustParse("00000000-0000-7000-8000-000000000007")
+	LoansReceivableAccountId = uuid.MustParse("00000000-0000-7000-8000-000000000008")
+)
+
+var SystemAccountIds = []uuid.UUID{CashInAccountId, CashOutAccountId, FxPositionAccountId, FeeIncomeAccountId, SuspenseAccountId, InterestExpenseAccountId, InterestIncomeAccountId, LoansReceivableAccountId}
+
+func IsValidAccountType(account_type string) bool {
+	return account_type == "checking" || account_type == "savings"
+}
+
+func IsSystemAccount(account_id uuid.UUID) bool {
+	for _, id := range SystemAccountIds {
+		if id == account_id {
+			return true
+		}
+	}
+
+	return false
 }
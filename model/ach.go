@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// AchEntry is a withdrawal paid out to an external bank account through an ACH file
+type AchEntry struct {
+	Id            uuid.UUID `db:"id" json:"id"`
+	TransactionId uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	RoutingNumber string    `db:"routing_number" json:"routing_number"`
+	AccountNumber string    `db:"account_number" json:"account_number"`
+	// 'checking' | 'savings'
+	AccountType string `db:"account_type" json:"account_type"`
+	Name        string `db:"name" json:"name"`
+	// 'PPD' | 'CCD'
+	SECCode string          `db:"sec_code" json:"sec_code"`
+	Amount  decimal.Decimal `db:"amount" json:"amount"`
+	// 'queued' | 'batched' | 'returned'
+	Status      string     `db:"status" json:"status"`
+	TraceNumber *string    `db:"trace_number" json:"trace_number"`
+	FileId      *uuid.UUID `db:"file_id" json:"file_id"`
+	ReturnCode  *string    `db:"return_code" json:"return_code"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	BatchedAt   *time.Time `db:"batched_at" json:"batched_at"`
+	ReturnedAt  *time.Time `db:"returned_at" json:"returned_at"`
+}
+
+type AchFile struct {
+	Id             uuid.UUID       `db:"id" json:"id"`
+	FileName       string          `db:"file_name" json:"file_name"`
+	FileIdModifier string          `db:"file_id_modifier" json:"file_id_modifier"`
+	EntryCount     int             `db:"entry_count" json:"entry_count"`
+	TotalCredit    decimal.Decimal `db:"total_credit" json:"total_credit"`
+	CreatedAt      time.Time       `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,70 @@
+package model
+
+import "github.com/shopspring/decimal"
+
+// SystemCurrency is the ISO 4217 code for "no currency", used by system accounts that hold every currency
+const SystemCurrency = "XXX"
+
+// CurrencyMinorUnits maps the supported ISO 4217 codes to the number of decimal places of their minor unit
+var CurrencyMinorUnits = map[string]int32{
+	"ARS": 2,
+	"AUD": 2,
+	"BHD": 3,
+	"BRL": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CLP": 0,
+	"CNY": 2,
+	"COP": 2,
+	"CZK": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"HUF": 2,
+	"IDR": 2,
+	"ILS": 2,
+	"INR": 2,
+	"IQD": 3,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"LYD": 3,
+	"MXN": 2,
+	"NOK": 2,
+	"NZD": 2,
+	"OMR": 3,
+	"PEN": 2,
+	"PHP": 2,
+	"PLN": 2,
+	"PYG": 0,
+	"SEK": 2,
+	"SGD": 2,
+	"THB": 2,
+	"TND": 3,
+	"TRY": 2,
+	"UGX": 0,
+	"USD": 2,
+	"UYU": 2,
+	"VND": 0,
+	"XAF": 0,
+	"XOF": 0,
+	"ZAR": 2,
+}
+
+func IsValidCurrency(currency string) bool {
+	_, ok := CurrencyMinorUnits[currency]
+	return ok
+}
+
+// IsValidAmount reports whether the amount has no more decimal places than the currency's minor unit
+func IsValidAmount(amount decimal.Decimal, currency string) bool {
+	minor_units, ok := CurrencyMinorUnits[currency]
+	if !ok {
+		return false
+	}
+
+	return amount.Equal(amount.Truncate(minor_units))
+}
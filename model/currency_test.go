@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestIsValidAmount(t *testing.T) {
+	cases := []struct {
+		amount   string
+		currency string
+		expected bool
+	}{
+		{"10", "USD", true},
+		{"10.5", "USD", true},
+		{"10.50", "USD", true},
+		{"10.505", "USD", false},
+		{"0.01", "EUR", true},
+		{"0.001", "EUR", false},
+		// trailing zeros past the minor unit don't change the amount
+		{"10.500", "USD", true},
+		{"1500", "JPY", true},
+		{"1500.5", "JPY", false},
+		{"1.234", "BHD", true},
+		{"1.2345", "KWD", false},
+		{"-3.25", "USD", true},
+		{"10", "XYZ", false},
+		{"10", SystemCurrency, false},
+	}
+
+	for _, c := range cases {
+		got := IsValidAmount(decimal.RequireFromString(c.amount), c.currency)
+		if got != c.expected {
+			t.Errorf("%s %s: expected %t, got %t", c.amount, c.currency, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type Entry struct {
+	Id            uuid.UUID `db:"id" json:"id"`
+	TransactionId uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	AccountId     uuid.UUID `db:"account_id" json:"account_id"`
+	// 'debit' | 'credit'
+	Direction string          `db:"direction" json:"direction"`
+	Amount    decimal.Decimal `db:"amount" json:"amount"`
+	Currency  string          `db:"currency" json:"currency"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	// nil while the transaction is pending
+	PostedAt *time.Time `db:"posted_at" json:"posted_at"`
+}
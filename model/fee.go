@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// FeeRule is what accounts of a type and currency pay for a kind of fee
+type FeeRule struct {
+	Id uuid.UUID `db:"id" json:"id"`
+	// 'checking' | 'savings'
+	AccountType string `db:"account_type" json:"account_type"`
+	Currency    string `db:"currency" json:"currency"`
+	// 'transfer' | 'withdrawal' | 'maintenance' | 'fx_spread'
+	Kind string `db:"kind" json:"kind"`
+	// charged on every transaction, or every month for maintenance fees
+	Flat decimal.Decimal `db:"flat" json:"flat"`
+	// fraction of the amount, the spread for fx_spread
+	Percentage decimal.Decimal  `db:"percentage" json:"percentage"`
+	MinAmount  *decimal.Decimal `db:"min_amount" json:"min_amount"`
+	MaxAmount  *decimal.Decimal `db:"max_amount" json:"max_amount"`
+	// maintenance fees are waived when the balance at the end of the month is at least this
+	WaiveAboveBalance *decimal.Decimal `db:"waive_above_balance" json:"waive_above_balance"`
+	UpdatedBy         uuid.UUID        `db:"updated_by" json:"updated_by"`
+	UpdatedAt         time.Time        `db:"updated_at" json:"updated_at"`
+}
+
+// Fee is charged along a transaction as a separate 'fee' transaction related to it
+type Fee struct {
+	TransactionId uuid.UUID
+	Amount        decimal.Decimal
+}
+
+// MaintenanceFeeCharge is the monthly maintenance fee of an account
+type MaintenanceFeeCharge struct {
+	Id          uuid.UUID `db:"id" json:"id"`
+	AccountId   uuid.UUID `db:"account_id" json:"account_id"`
+	PeriodStart time.Time `db:"period_start" json:"period_start"`
+	// ledger balance at the end of the month
+	Balance decimal.Decimal `db:"balance" json:"balance"`
+	Amount  decimal.Decimal `db:"amount" json:"amount"`
+	// 'charged' | 'waived' | 'unpaid'
+	Status        string     `db:"status" json:"status"`
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// FraudDecision is what the fraud rules decided for an outbound transaction about to be made
+type FraudDecision struct {
+	Id              uuid.UUID       `db:"id" json:"id"`
+	UserId          uuid.UUID       `db:"user_id" json:"user_id"`
+	AccountId       uuid.UUID       `db:"account_id" json:"account_id"`
+	TransactionKind string          `db:"transaction_kind" json:"transaction_kind"`
+	Amount          decimal.Decimal `db:"amount" json:"amount"`
+	Currency        string          `db:"currency" json:"currency"`
+	// the transaction, or the batch, nil when blocked
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	// 'allow' | 'hold' | 'block'
+	Outcome      string         `db:"outcome" json:"outcome"`
+	MatchedRules pq.StringArray `db:"matched_rules" json:"matched_rules"`
+	CreatedAt    time.Time      `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type FxRate struct {
+	Base  string `db:"base" json:"base"`
+	Quote string `db:"quote" json:"quote"`
+	// units of Quote bought by one unit of Base
+	Rate      decimal.Decimal `db:"rate" json:"rate"`
+	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+type FxQuote struct {
+	Id            uuid.UUID       `json:"id"`
+	UserId        uuid.UUID       `json:"user_id"`
+	FromAccountId uuid.UUID       `json:"from_account_id"`
+	ToAccountId   uuid.UUID       `json:"to_account_id"`
+	FromCurrency  string          `json:"from_currency"`
+	ToCurrency    string          `json:"to_currency"`
+	FromAmount    decimal.Decimal `json:"from_amount"`
+	ToAmount      decimal.Decimal `json:"to_amount"`
+	Rate          decimal.Decimal `json:"rate"`
+	Spread        decimal.Decimal `json:"spread"`
+	Fee           decimal.Decimal `json:"fee"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+}
+
+type FxConversion struct {
+	TransactionId uuid.UUID       `db:"transaction_id" json:"transaction_id"`
+	FromCurrency  string          `db:"from_currency" json:"from_currency"`
+	ToCurrency    string          `db:"to_currency" json:"to_currency"`
+	FromAmount    decimal.Decimal `db:"from_amount" json:"from_amount"`
+	ToAmount      decimal.Decimal `db:"to_amount" json:"to_amount"`
+	Rate          decimal.Decimal `db:"rate" json:"rate"`
+	Spread        decimal.Decimal `db:"spread" json:"spread"`
+	// charged in FromCurrency
+	Fee       decimal.Decimal `db:"fee" json:"fee"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type Hold struct {
+	Id             uuid.UUID       `db:"id" json:"id"`
+	AccountId      uuid.UUID       `db:"account_id" json:"account_id"`
+	Amount         decimal.Decimal `db:"amount" json:"amount"`
+	CapturedAmount decimal.Decimal `db:"captured_amount" json:"captured_amount"`
+	Merchant       string          `db:"merchant" json:"merchant"`
+	Purpose        string          `db:"purpose" json:"purpose"`
+	// 'active' | 'captured' | 'released' | 'expired'
+	Status               string     `db:"status" json:"status"`
+	ExpiresAt            time.Time  `db:"expires_at" json:"expires_at"`
+	CaptureTransactionId *uuid.UUID `db:"capture_transaction_id" json:"capture_transaction_id"`
+	CreatedAt            time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt            time.Time  `db:"updated_at" json:"updated_at"`
+}
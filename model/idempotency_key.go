@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type IdempotencyKey struct {
+	Key         string    `db:"key" json:"key"`
+	UserId      uuid.UUID `db:"user_id" json:"user_id"`
+	Fingerprint string    `db:"fingerprint" json:"fingerprint"`
+	// nil while the original request is still being processed
+	ResponseStatus      *int    `db:"response_status" json:"response_status"`
+	ResponseContentType *string `db:"response_content_type" json:"response_content_type"`
+	ResponseBody        []byte  `db:"response_body" json:"response_body"`
+	// until when the request holding the reservation is assumed to be alive
+	LockedUntil time.Time `db:"locked_until" json:"locked_until"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
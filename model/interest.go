@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// SavingsRate is the annual percentage yield paid on the savings accounts of a currency from a day on
+type SavingsRate struct {
+	Id       uuid.UUID `db:"id" json:"id"`
+	Currency string    `db:"currency" json:"currency"`
+	// as a fraction, 0.045 is 4.5%
+	Apy           decimal.Decimal `db:"apy" json:"apy"`
+	EffectiveFrom time.Time       `db:"effective_from" json:"effective_from"`
+	CreatedBy     uuid.UUID       `db:"created_by" json:"created_by"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+}
+
+// InterestAccrual is the interest earned by a savings account in a day
+type InterestAccrual struct {
+	AccountId   uuid.UUID `db:"account_id" json:"account_id"`
+	AccrualDate time.Time `db:"accrual_date" json:"accrual_date"`
+	// end-of-day ledger balance
+	Balance   decimal.Decimal `db:"balance" json:"balance"`
+	Apy       decimal.Decimal `db:"apy" json:"apy"`
+	DailyRate decimal.Decimal `db:"daily_rate" json:"daily_rate"`
+	Amount    decimal.Decimal `db:"amount" json:"amount"`
+	// nil until the month is credited
+	CreditId  *uuid.UUID `db:"credit_id" json:"credit_id"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// InterestCredit is the monthly payment of the interest accrued by a savings account
+type InterestCredit struct {
+	Id          uuid.UUID `db:"id" json:"id"`
+	AccountId   uuid.UUID `db:"account_id" json:"account_id"`
+	PeriodStart time.Time `db:"period_start" json:"period_start"`
+	PeriodEnd   time.Time `db:"period_end" json:"period_end"`
+	// sum of the daily accruals before rounding
+	Accrued decimal.Decimal `db:"accrued" json:"accrued"`
+	Amount  decimal.Decimal `db:"amount" json:"amount"`
+	// nil when the amount rounds to nothing
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
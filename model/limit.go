@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// AccountLimit caps how much can leave an account
+type AccountLimit struct {
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	// 'withdrawal' | 'transfer' | 'outbound'
+	Kind string `db:"kind" json:"kind"`
+	// 'single' | 'daily' | 'monthly'
+	Period    string          `db:"period" json:"period"`
+	Amount    decimal.Decimal `db:"amount" json:"amount"`
+	UpdatedBy uuid.UUID       `db:"updated_by" json:"updated_by"`
+	CreatedAt time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+	// the limit while a temporary increase is active, nil when there is none
+	IncreasedAmount   *decimal.Decimal `db:"increased_amount" json:"increased_amount"`
+	IncreaseExpiresAt *time.Time       `db:"increase_expires_at" json:"increase_expires_at"`
+}
+
+// LimitIncrease raises a limit of an account for a while
+type LimitIncrease struct {
+	Id          uuid.UUID       `db:"id" json:"id"`
+	AccountId   uuid.UUID       `db:"account_id" json:"account_id"`
+	Kind        string          `db:"kind" json:"kind"`
+	Period      string          `db:"period" json:"period"`
+	Amount      decimal.Decimal `db:"amount" json:"amount"`
+	Reason      string          `db:"reason" json:"reason"`
+	RequestedBy uuid.UUID       `db:"requested_by" json:"requested_by"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	ExpiresAt   time.Time       `db:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type Loan struct {
+	Id     uuid.UUID `db:"id" json:"id"`
+	UserId uuid.UUID `db:"user_id" json:"user_id"`
+	// receives the principal
+	AccountId uuid.UUID `db:"account_id" json:"account_id"`
+	// the installments are debited from it
+	RepaymentAccountId uuid.UUID       `db:"repayment_account_id" json:"repayment_account_id"`
+	Currency           string          `db:"currency" json:"currency"`
+	Principal          decimal.Decimal `db:"principal" json:"principal"`
+	// fixed nominal rate, as a fraction
+	AnnualRate decimal.Decimal `db:"annual_rate" json:"annual_rate"`
+	TermMonths int             `db:"term_months" json:"term_months"`
+	// 'price' | 'sac'
+	Method       string    `db:"method" json:"method"`
+	FirstDueDate time.Time `db:"first_due_date" json:"first_due_date"`
+	// charged once on every installment not paid on its due date
+	LateFee              decimal.Decimal `db:"late_fee" json:"late_fee"`
+	OutstandingPrincipal decimal.Decimal `db:"outstanding_principal" json:"outstanding_principal"`
+	// 'active' | 'paid_off'
+	Status                    string     `db:"status" json:"status"`
+	DisbursementTransactionId uuid.UUID  `db:"disbursement_transaction_id" json:"disbursement_transaction_id"`
+	OriginatedBy              uuid.UUID  `db:"originated_by" json:"originated_by"`
+	CreatedAt                 time.Time  `db:"created_at" json:"created_at"`
+	PaidOffAt                 *time.Time `db:"paid_off_at" json:"paid_off_at"`
+}
+
+type LoanInstallment struct {
+	Id        uuid.UUID       `db:"id" json:"id"`
+	LoanId    uuid.UUID       `db:"loan_id" json:"loan_id"`
+	Number    int             `db:"number" json:"number"`
+	DueDate   time.Time       `db:"due_date" json:"due_date"`
+	Principal decimal.Decimal `db:"principal" json:"principal"`
+	Interest  decimal.Decimal `db:"interest" json:"interest"`
+	// principal plus interest
+	Amount  decimal.Decimal `db:"amount" json:"amount"`
+	LateFee decimal.Decimal `db:"late_fee" json:"late_fee"`
+	// 'scheduled' | 'late' | 'paid' | 'prepaid'
+	Status        string     `db:"status" json:"status"`
+	NextAttemptAt *time.Time `db:"next_attempt_at" json:"next_attempt_at"`
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	PaidAt        *time.Time `db:"paid_at" json:"paid_at"`
+}
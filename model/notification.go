@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Notification struct {
+	Id     uuid.UUID `db:"id" json:"id"`
+	UserId uuid.UUID `db:"user_id" json:"user_id"`
+	// what the notification is about, like 'scheduled_transfer_failed'
+	Kind      string     `db:"kind" json:"kind"`
+	Message   string     `db:"message" json:"message"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	ReadAt    *time.Time `db:"read_at" json:"read_at"`
+}
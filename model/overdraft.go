@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// OverdraftFacility lets the available balance of an account go down to minus the limit
+type OverdraftFacility struct {
+	AccountId      uuid.UUID       `db:"account_id" json:"account_id"`
+	OverdraftLimit decimal.Decimal `db:"overdraft_limit" json:"overdraft_limit"`
+	// charged daily on the negative end-of-day balance, as a fraction
+	AnnualRate decimal.Decimal `db:"annual_rate" json:"annual_rate"`
+	GrantedBy  uuid.UUID       `db:"granted_by" json:"granted_by"`
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// OverdraftInterest is the interest an overdrawn account owes for a day
+type OverdraftInterest struct {
+	AccountId  uuid.UUID `db:"account_id" json:"account_id"`
+	ChargeDate time.Time `db:"charge_date" json:"charge_date"`
+	// end-of-day ledger balance
+	Balance    decimal.Decimal `db:"balance" json:"balance"`
+	AnnualRate decimal.Decimal `db:"annual_rate" json:"annual_rate"`
+	// interest of the day before rounding
+	Accrued decimal.Decimal `db:"accrued" json:"accrued"`
+	// charged to the account, fractions of the minor unit are carried to the next days
+	Amount decimal.Decimal `db:"amount" json:"amount"`
+	// nil when nothing was charged
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
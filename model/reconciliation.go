@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type ReconciliationImport struct {
+	Id           uuid.UUID `db:"id" json:"id"`
+	UserId       uuid.UUID `db:"user_id" json:"user_id"`
+	FileName     string    `db:"file_name" json:"file_name"`
+	Currency     string    `db:"currency" json:"currency"`
+	DateFrom     time.Time `db:"date_from" json:"date_from"`
+	DateTo       time.Time `db:"date_to" json:"date_to"`
+	LineCount    int       `db:"line_count" json:"line_count"`
+	MatchedCount int       `db:"matched_count" json:"matched_count"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// StatementLine is a booking of an imported partner bank statement
+type StatementLine struct {
+	Id         uuid.UUID `db:"id" json:"id"`
+	ImportId   uuid.UUID `db:"import_id" json:"import_id"`
+	LineNumber int       `db:"line_number" json:"line_number"`
+	BookedOn   time.Time `db:"booked_on" json:"booked_on"`
+	// credits to the partner bank account are positive
+	Amount      decimal.Decimal `db:"amount" json:"amount"`
+	Currency    string          `db:"currency" json:"currency"`
+	Reference   string          `db:"reference" json:"reference"`
+	Description string          `db:"description" json:"description"`
+	// 'matched' | 'unmatched' | 'adjusted' | 'dismissed'
+	Status string `db:"status" json:"status"`
+	// the deposit or withdrawal the line was matched with
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+}
+
+// ReconciliationItem is a statement line or a transaction waiting in the reconciliation queue
+type ReconciliationItem struct {
+	Id              uuid.UUID  `db:"id" json:"id"`
+	ImportId        uuid.UUID  `db:"import_id" json:"import_id"`
+	StatementLineId *uuid.UUID `db:"statement_line_id" json:"statement_line_id"`
+	TransactionId   *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	// 'open' | 'matched' | 'adjusted' | 'dismissed'
+	Status                  string     `db:"status" json:"status"`
+	AdjustmentTransactionId *uuid.UUID `db:"adjustment_transaction_id" json:"adjustment_transaction_id"`
+	Note                    string     `db:"note" json:"note"`
+	ResolvedBy              *uuid.UUID `db:"resolved_by" json:"resolved_by"`
+	CreatedAt               time.Time  `db:"created_at" json:"created_at"`
+	ResolvedAt              *time.Time `db:"resolved_at" json:"resolved_at"`
+	// one of them is loaded, depending on the side the item is on
+	StatementLine *StatementLine `db:"-" json:"statement_line,omitempty"`
+	Transaction   *Transaction   `db:"-" json:"transaction,omitempty"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// TransactionReview is a held transaction, or batch, waiting in the manual review queue
+type TransactionReview struct {
+	Id uuid.UUID `db:"id" json:"id"`
+	// one of them is set
+	TransactionId   *uuid.UUID      `db:"transaction_id" json:"transaction_id"`
+	BatchId         *uuid.UUID      `db:"batch_id" json:"batch_id"`
+	UserId          uuid.UUID       `db:"user_id" json:"user_id"`
+	AccountId       uuid.UUID       `db:"account_id" json:"account_id"`
+	TransactionKind string          `db:"transaction_kind" json:"transaction_kind"`
+	Amount          decimal.Decimal `db:"amount" json:"amount"`
+	Currency        string          `db:"currency" json:"currency"`
+	// the limits it went over and the fraud rules it matched
+	Reasons pq.StringArray `db:"reasons" json:"reasons"`
+	// 'pending' | 'approved' | 'rejected'
+	Status         string     `db:"status" json:"status"`
+	DecisionReason string     `db:"decision_reason" json:"decision_reason"`
+	DecidedBy      *uuid.UUID `db:"decided_by" json:"decided_by"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	DecidedAt      *time.Time `db:"decided_at" json:"decided_at"`
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type ScheduledTransfer struct {
+	Id            uuid.UUID       `db:"id" json:"id"`
+	UserId        uuid.UUID       `db:"user_id" json:"user_id"`
+	FromAccountId uuid.UUID       `db:"from_account_id" json:"from_account_id"`
+	ToAccountId   uuid.UUID       `db:"to_account_id" json:"to_account_id"`
+	Amount        decimal.Decimal `db:"amount" json:"amount"`
+	Description   string          `db:"description" json:"description"`
+	// 'once' | 'daily' | 'weekly' | 'monthly'
+	Frequency     string     `db:"frequency" json:"frequency"`
+	StartDate     time.Time  `db:"start_date" json:"start_date"`
+	EndDate       *time.Time `db:"end_date" json:"end_date"`
+	MaxExecutions *int       `db:"max_executions" json:"max_executions"`
+	// 'none' | 'following' | 'preceding' | 'modified_following'
+	BusinessDayAdjustment string `db:"business_day_adjustment" json:"business_day_adjustment"`
+	// 'active' | 'paused' | 'cancelled' | 'completed'
+	Status string `db:"status" json:"status"`
+	// index of the next occurrence, counting from 0
+	Occurrence int `db:"occurrence" json:"occurrence"`
+	// nil once there is no occurrence left
+	NextRunOn  *time.Time `db:"next_run_on" json:"next_run_on"`
+	RetryCount int        `db:"retry_count" json:"retry_count"`
+	RetryAt    *time.Time `db:"retry_at" json:"retry_at"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+type ScheduledTransferExecution struct {
+	Id                  uuid.UUID `db:"id" json:"id"`
+	ScheduledTransferId uuid.UUID `db:"scheduled_transfer_id" json:"scheduled_transfer_id"`
+	Occurrence          int       `db:"occurrence" json:"occurrence"`
+	ScheduledFor        time.Time `db:"scheduled_for" json:"scheduled_for"`
+	Attempt             int       `db:"attempt" json:"attempt"`
+	// 'running' | 'succeeded' | 'retrying' | 'failed' | 'held'
+	Status        string     `db:"status" json:"status"`
+	TransactionId *uuid.UUID `db:"transaction_id" json:"transaction_id"`
+	Error         string     `db:"error" json:"error"`
+	ExecutedAt    time.Time  `db:"executed_at" json:"executed_at"`
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type Statement struct {
+	AccountId   uuid.UUID `json:"account_id"`
+	AccountName string    `json:"account_name"`
+	// 'checking' | 'savings'
+	AccountType    string          `json:"account_type"`
+	Currency       string          `json:"currency"`
+	DateFrom       time.Time       `json:"date_from"`
+	DateTo         time.Time       `json:"date_to"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	// oldest first, with the running balance filled
+	Movements    []AccountTransaction       `json:"movements"`
+	TotalsByKind map[string]decimal.Decimal `json:"totals_by_kind"`
+	TotalCredits decimal.Decimal            `json:"total_credits"`
+	TotalDebits  decimal.Decimal            `json:"total_debits"`
+	GeneratedAt  time.Time                  `json:"generated_at"`
+}
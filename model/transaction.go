@@ -9,11 +9,30 @@ import (
 
 type Transaction struct {
 	Id uuid.UUID `db:"id" json:"id"`
-	// 'deposit' | 'withdrawal' | 'transfer' | 'refund'
-	Kind          string          `db:"kind" json:"kind"`
-	FromAccountId *uuid.UUID      `db:"from_account_id" json:"from_account_id"`
-	ToAccountId   *uuid.UUID      `db:"to_account_id" json:"to_account_id"`
-	Amount        decimal.Decimal `db:"amount" json:"amount"`
-	DateIssued    time.Time       `db:"date_issued" json:"date_issued"`
-	RelatedTransactionId *uuid.UUID `db:"related_transaction_id" json:"related_transaction_id"`
-}
\ No newline at end of file
+	// 'deposit' | 'withdrawal' | 'transfer' | 'refund' | 'capture' | 'exchange' | 'adjustment' | 'interest' | 'fee' | 'overdraft_interest' | 'loan_disbursement' | 'loan_payment'
+	Kind                 string          `db:"kind" json:"kind"`
+	FromAccountId        *uuid.UUID      `db:"from_account_id" json:"from_account_id"`
+	ToAccountId          *uuid.UUID      `db:"to_account_id" json:"to_account_id"`
+	Amount               decimal.Decimal `db:"amount" json:"amount"`
+	Currency             string          `db:"currency" json:"currency"`
+	DateIssued           time.Time       `db:"date_issued" json:"date_issued"`
+	RelatedTransactionId *uuid.UUID      `db:"related_transaction_id" json:"related_transaction_id"`
+	// 'pending' | 'posted' | 'failed' | 'reversed'
+	Status     string     `db:"status" json:"status"`
+	PostedAt   *time.Time `db:"posted_at" json:"posted_at"`
+	FailedAt   *time.Time `db:"failed_at" json:"failed_at"`
+	ReversedAt *time.Time `db:"reversed_at" json:"reversed_at"`
+}
+
+// AccountTransaction is a transaction seen from one of its accounts
+type AccountTransaction struct {
+	Transaction
+	// credits minus debits of the transaction on the account
+	SignedAmount decimal.Decimal `db:"signed_amount" json:"signed_amount"`
+	// ledger balance of the account right after the transaction, nil while it is not posted
+	RunningBalance *decimal.Decimal `db:"running_balance" json:"running_balance"`
+	// when the movement hit the account's ledger balance, nil while it is not posted
+	BookedAt *time.Time `db:"booked_at" json:"booked_at"`
+	// whether the movement undoes a previously booked one
+	Reversal bool `db:"reversal" json:"reversal"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// TransactionBatch groups the transfers from one account to many made by a single request
+type TransactionBatch struct {
+	Id            uuid.UUID       `db:"id" json:"id"`
+	UserId        uuid.UUID       `db:"user_id" json:"user_id"`
+	FromAccountId uuid.UUID       `db:"from_account_id" json:"from_account_id"`
+	Currency      string          `db:"currency" json:"currency"`
+	TotalAmount   decimal.Decimal `db:"total_amount" json:"total_amount"`
+	LegCount      int             `db:"leg_count" json:"leg_count"`
+	CreatedAt     time.Time       `db:"created_at" json:"created_at"`
+}
+
+type TransactionBatchLeg struct {
+	TransactionId uuid.UUID
+	ToAccountId   uuid.UUID
+	Amount        decimal.Decimal
+	// transfer fee of the leg, nil when there is none
+	Fee *Fee
+}
@@ -10,6 +10,7 @@ type User struct {
 	Id                uuid.UUID `db:"id" json:"id"`
 	Email             string    `db:"email" json:"email"`
 	EncryptedPassword string    `db:"password" json:"-"`
+	IsAdmin           bool      `db:"is_admin" json:"is_admin"`
 	CreatedAt         time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt         time.Time `db:"updated_at" json:"updated_at"`
 }
\ No newline at end of file
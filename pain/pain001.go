@@ -0,0 +1,185 @@
+package pain
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+const Pain001NamespacePrefix = "urn:iso:std:iso:20022:tech:xsd:pain.001.001."
+
+const iso20022NamespacePrefix = "urn:iso:std:iso:20022:tech:xsd:"
+
+var ErrNotPain001 = errors.New("document is not a pain.001 customer credit transfer initiation")
+var ErrMissingGroupHeader = errors.New("group header is missing or not first")
+
+type GroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+	NbOfTxs string `xml:"NbOfTxs"`
+	CtrlSum string `xml:"CtrlSum"`
+	// taken from the document namespace, like pain.001.001.09
+	MsgNmId string `xml:"-"`
+}
+
+type PaymentInstruction struct {
+	PmtInfId string
+	// account identification of the debtor, either the Othr/Id or the IBAN
+	DebtorAccount  string
+	DebtorCurrency string
+}
+
+type CreditTransfer struct {
+	InstrId    string
+	EndToEndId string
+	// zero when the amount could not be read
+	Amount          decimal.Decimal
+	Currency        string
+	CreditorAccount string
+	Remittance      string
+}
+
+type xmlAccount struct {
+	IBAN string `xml:"Id>IBAN"`
+	Othr string `xml:"Id>Othr>Id"`
+	Ccy  string `xml:"Ccy"`
+}
+
+func (a *xmlAccount) id() string {
+	if a.Othr != "" {
+		return strings.TrimSpace(a.Othr)
+	}
+
+	return strings.TrimSpace(a.IBAN)
+}
+
+type xmlCreditTransfer struct {
+	InstrId    string `xml:"PmtId>InstrId"`
+	EndToEndId string `xml:"PmtId>EndToEndId"`
+	Amount     struct {
+		Ccy   string `xml:"Ccy,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Amt>InstdAmt"`
+	CdtrAcct xmlAccount `xml:"CdtrAcct"`
+	Ustrd    []string   `xml:"RmtInf>Ustrd"`
+}
+
+// Pain001Handler receives the file as it is read, returning an error from it stops the reading
+type Pain001Handler struct {
+	GroupHeader    func(header *GroupHeader) error
+	CreditTransfer func(instruction *PaymentInstruction, transfer *CreditTransfer) error
+}
+
+// ReadPain001 streams a pain.001 file, only one CdtTrfTxInf is held in memory at a time
+// so files of any size can be processed. Elements that are not needed to book the transfers are skipped.
+func ReadPain001(r io.Reader, handler Pain001Handler) error {
+	decoder := xml.NewDecoder(r)
+
+	var header *GroupHeader
+	var instruction *PaymentInstruction
+	root_checked := false
+	message_name := ""
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if !root_checked {
+				if element.Name.Local != "Document" || !strings.HasPrefix(element.Name.Space, Pain001NamespacePrefix) {
+					return ErrNotPain001
+				}
+				root_checked = true
+				message_name = strings.TrimPrefix(element.Name.Space, iso20022NamespacePrefix)
+				continue
+			}
+
+			if instruction == nil {
+				switch element.Name.Local {
+				case "CstmrCdtTrfInitn":
+				case "GrpHdr":
+					header = new(GroupHeader)
+					err = decoder.DecodeElement(header, &element)
+					if err != nil {
+						return err
+					}
+					header.MsgNmId = message_name
+
+					err = handler.GroupHeader(header)
+					if err != nil {
+						return err
+					}
+				case "PmtInf":
+					if header == nil {
+						return ErrMissingGroupHeader
+					}
+					instruction = new(PaymentInstruction)
+				default:
+					err = decoder.Skip()
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			switch element.Name.Local {
+			case "PmtInfId":
+				err = decoder.DecodeElement(&instruction.PmtInfId, &element)
+			case "DbtrAcct":
+				account := xmlAccount{}
+				err = decoder.DecodeElement(&account, &element)
+				instruction.DebtorAccount = account.id()
+				instruction.DebtorCurrency = account.Ccy
+			case "CdtTrfTxInf":
+				raw := xmlCreditTransfer{}
+				err = decoder.DecodeElement(&raw, &element)
+				if err != nil {
+					return fmt.Errorf("payment %s: %w", instruction.PmtInfId, err)
+				}
+
+				amount, parse_err := decimal.NewFromString(strings.TrimSpace(raw.Amount.Value))
+				if parse_err != nil {
+					amount = decimal.Zero
+				}
+
+				err = handler.CreditTransfer(instruction, &CreditTransfer{
+					InstrId:         raw.InstrId,
+					EndToEndId:      raw.EndToEndId,
+					Amount:          amount,
+					Currency:        raw.Amount.Ccy,
+					CreditorAccount: raw.CdtrAcct.id(),
+					Remittance:      strings.Join(raw.Ustrd, " "),
+				})
+			default:
+				err = decoder.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if element.Name.Local == "PmtInf" {
+				instruction = nil
+			}
+		}
+	}
+
+	if !root_checked {
+		return ErrNotPain001
+	}
+	if header == nil {
+		return ErrMissingGroupHeader
+	}
+
+	return nil
+}
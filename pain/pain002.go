@@ -0,0 +1,256 @@
+package pain
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+const Pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.11"
+
+const (
+	// the transfer was booked on both accounts
+	StatusAccepted = "ACSC"
+	StatusRejected = "RJCT"
+	// the transfer was held for review and is not booked yet
+	StatusPending = "PDNG"
+	// some of the transfers of the group were rejected
+	StatusPartiallyAccepted = "PART"
+)
+
+// ISO 20022 status reason codes used when rejecting a transfer or a whole file
+const (
+	ReasonInvalidDebtorAccount   = "AC02"
+	ReasonInvalidCreditorAccount = "AC03"
+	ReasonTransactionForbidden   = "AG01"
+	ReasonNotAllowedCurrency     = "AM03"
+	ReasonInsufficientFunds      = "AM04"
+	ReasonInvalidAmount          = "AM12"
+	ReasonExceedsAgreedLimit     = "AM14"
+	ReasonInvalidDecimalPlaces   = "CH20"
+	ReasonDuplicateMessage       = "DU01"
+	ReasonInvalidFileFormat      = "FF01"
+	ReasonFraudulentOrigin       = "FRAD"
+	ReasonNotSpecified           = "MS03"
+)
+
+type TransactionStatus struct {
+	InstrId    string
+	EndToEndId string
+	Status     string
+	// status reason code, only for rejected transfers
+	Reason         string
+	AdditionalInfo string
+	// id of the booked transaction, only for accepted transfers
+	TransactionId string
+}
+
+type PaymentStatus struct {
+	PmtInfId     string
+	Transactions []TransactionStatus
+}
+
+type StatusReport struct {
+	MsgId         string
+	CreatedAt     time.Time
+	OriginalMsgId string
+	// message name of the original file, like pain.001.001.09
+	OriginalMsgNmId string
+	// set when the file as a whole has a problem, like being a duplicate or unreadable past some point
+	GroupReason         string
+	GroupAdditionalInfo string
+	Payments            []*PaymentStatus
+}
+
+// Add records the outcome of a transfer under its payment information block, in the order of the file
+func (r *StatusReport) Add(pmt_inf_id string, status TransactionStatus) {
+	if len(r.Payments) == 0 || r.Payments[len(r.Payments)-1].PmtInfId != pmt_inf_id {
+		r.Payments = append(r.Payments, &PaymentStatus{PmtInfId: pmt_inf_id})
+	}
+
+	payment := r.Payments[len(r.Payments)-1]
+	payment.Transactions = append(payment.Transactions, status)
+}
+
+// Counts returns how many transfers were accepted and rejected
+func (r *StatusReport) Counts() (int, int) {
+	accepted, rejected := 0, 0
+	for _, payment := range r.Payments {
+		a, rj := payment.counts()
+		accepted += a
+		rejected += rj
+	}
+
+	return accepted, rejected
+}
+
+// counts returns how many transfers were accepted, pending ones included, and how many were rejected
+func (p *PaymentStatus) counts() (int, int) {
+	rejected := 0
+	for _, transaction := range p.Transactions {
+		if transaction.Status == StatusRejected {
+			rejected++
+		}
+	}
+
+	return len(p.Transactions) - rejected, rejected
+}
+
+func groupStatus(accepted int, rejected int) string {
+	if accepted == 0 {
+		return StatusRejected
+	}
+	if rejected == 0 {
+		return StatusAccepted
+	}
+
+	return StatusPartiallyAccepted
+}
+
+type xmlReason struct {
+	Cd       string `xml:"Rsn>Cd"`
+	AddtlInf string `xml:"AddtlInf,omitempty"`
+}
+
+type xmlCountPerStatus struct {
+	DtldNbOfTxs int    `xml:"DtldNbOfTxs"`
+	DtldSts     string `xml:"DtldSts"`
+}
+
+type xmlTransactionStatus struct {
+	OrgnlInstrId    string     `xml:"OrgnlInstrId,omitempty"`
+	OrgnlEndToEndId string     `xml:"OrgnlEndToEndId,omitempty"`
+	TxSts           string     `xml:"TxSts"`
+	StsRsnInf       *xmlReason `xml:"StsRsnInf,omitempty"`
+	AcctSvcrRef     string     `xml:"AcctSvcrRef,omitempty"`
+}
+
+type xmlPaymentStatus struct {
+	OrgnlPmtInfId string                 `xml:"OrgnlPmtInfId"`
+	OrgnlNbOfTxs  int                    `xml:"OrgnlNbOfTxs"`
+	PmtInfSts     string                 `xml:"PmtInfSts"`
+	NbOfTxsPerSts []xmlCountPerStatus    `xml:"NbOfTxsPerSts"`
+	TxInfAndSts   []xmlTransactionStatus `xml:"TxInfAndSts"`
+}
+
+type xmlStatusReport struct {
+	XMLName           xml.Name            `xml:"Document"`
+	Namespace         string              `xml:"xmlns,attr"`
+	MsgId             string              `xml:"CstmrPmtStsRpt>GrpHdr>MsgId"`
+	CreDtTm           string              `xml:"CstmrPmtStsRpt>GrpHdr>CreDtTm"`
+	OrgnlMsgId        string              `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>OrgnlMsgId"`
+	OrgnlMsgNmId      string              `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>OrgnlMsgNmId"`
+	OrgnlNbOfTxs      int                 `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>OrgnlNbOfTxs"`
+	GrpSts            string              `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>GrpSts"`
+	StsRsnInf         *xmlReason          `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>StsRsnInf,omitempty"`
+	NbOfTxsPerSts     []xmlCountPerStatus `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts>NbOfTxsPerSts"`
+	OrgnlPmtInfAndSts []xmlPaymentStatus  `xml:"CstmrPmtStsRpt>OrgnlPmtInfAndSts"`
+}
+
+// max35 fits an identifier in the 35 characters ISO 20022 allows for references
+func max35(text string) string {
+	if len(text) > 35 {
+		return text[:35]
+	}
+
+	return text
+}
+
+func max105(text string) string {
+	if len(text) > 105 {
+		return text[:105]
+	}
+
+	return text
+}
+
+func countsPerStatus(accepted int, rejected int) []xmlCountPerStatus {
+	counts := []xmlCountPerStatus{}
+	if accepted > 0 {
+		counts = append(counts, xmlCountPerStatus{DtldNbOfTxs: accepted, DtldSts: StatusAccepted})
+	}
+	if rejected > 0 {
+		counts = append(counts, xmlCountPerStatus{DtldNbOfTxs: rejected, DtldSts: StatusRejected})
+	}
+
+	return counts
+}
+
+// RenderPain002 writes the report as a pain.002 customer payment status report
+func RenderPain002(w io.Writer, report *StatusReport) error {
+	accepted, rejected := report.Counts()
+
+	original_message_id := report.OriginalMsgId
+	if original_message_id == "" {
+		original_message_id = "UNKNOWN"
+	}
+
+	original_message_name := report.OriginalMsgNmId
+	if original_message_name == "" {
+		original_message_name = "pain.001"
+	}
+
+	document := xmlStatusReport{
+		Namespace:     Pain002Namespace,
+		MsgId:         max35(report.MsgId),
+		CreDtTm:       report.CreatedAt.UTC().Format(time.RFC3339),
+		OrgnlMsgId:    max35(original_message_id),
+		OrgnlMsgNmId:  original_message_name,
+		OrgnlNbOfTxs:  accepted + rejected,
+		GrpSts:        groupStatus(accepted, rejected),
+		NbOfTxsPerSts: countsPerStatus(accepted, rejected),
+	}
+
+	if report.GroupReason != "" {
+		document.StsRsnInf = &xmlReason{Cd: report.GroupReason, AddtlInf: max105(report.GroupAdditionalInfo)}
+	}
+
+	for _, payment := range report.Payments {
+		payment_accepted, payment_rejected := payment.counts()
+
+		transactions := []xmlTransactionStatus{}
+		for _, transaction := range payment.Transactions {
+			status := xmlTransactionStatus{
+				OrgnlInstrId:    max35(transaction.InstrId),
+				OrgnlEndToEndId: max35(transaction.EndToEndId),
+				TxSts:           transaction.Status,
+				AcctSvcrRef:     max35(strings.ReplaceAll(transaction.TransactionId, "-", "")),
+			}
+
+			if transaction.Reason != "" {
+				status.StsRsnInf = &xmlReason{Cd: transaction.Reason, AddtlInf: max105(transaction.AdditionalInfo)}
+			}
+
+			transactions = append(transactions, status)
+		}
+
+		pmt_inf_id := payment.PmtInfId
+		if pmt_inf_id == "" {
+			pmt_inf_id = "UNKNOWN"
+		}
+
+		document.OrgnlPmtInfAndSts = append(document.OrgnlPmtInfAndSts, xmlPaymentStatus{
+			OrgnlPmtInfId: max35(pmt_inf_id),
+			OrgnlNbOfTxs:  len(payment.Transactions),
+			PmtInfSts:     groupStatus(payment_accepted, payment_rejected),
+			NbOfTxsPerSts: countsPerStatus(payment_accepted, payment_rejected),
+			TxInfAndSts:   transactions,
+		})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
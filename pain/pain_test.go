@@ -0,0 +1,157 @@
+package pain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// validateXSD runs the document through xmllint against one of the bundled schemas
+func validateXSD(t *testing.T, path string, schema string) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+
+	output, err := exec.Command(xmllint, "--noout", "--schema", filepath.Join("xsd", schema), path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s does not validate against %s: %s\n%s", path, schema, err, output)
+	}
+}
+
+func TestPain001FixtureValidatesAgainstSchema(t *testing.T) {
+	validateXSD(t, filepath.Join("testdata", "pain.001.xml"), "pain.001.001.10.xsd")
+}
+
+func TestReadPain001(t *testing.T) {
+	file, err := os.Open(filepath.Join("testdata", "pain.001.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var header *GroupHeader
+	transfers := []string{}
+	err = ReadPain001(file, Pain001Handler{
+		GroupHeader: func(h *GroupHeader) error {
+			header = h
+			return nil
+		},
+		CreditTransfer: func(instruction *PaymentInstruction, transfer *CreditTransfer) error {
+			transfers = append(transfers, fmt.Sprintf(
+				"%s %s %s %s %s %s %s %q",
+				instruction.PmtInfId,
+				instruction.DebtorAccount,
+				transfer.InstrId,
+				transfer.EndToEndId,
+				transfer.Amount,
+				transfer.Currency,
+				transfer.CreditorAccount,
+				transfer.Remittance,
+			))
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header == nil || header.MsgId != "PAYROLL-2026-10" || header.MsgNmId != "pain.001.001.10" {
+		t.Fatalf("unexpected group header %+v", header)
+	}
+
+	expected := []string{
+		`PAYROLL-2026-10-A 0192a3b4c5d67e8f9a0b1c2d3e4f5a6b INSTR-1 E2E-1 1500 EUR 0192a3b4c5d67e8f9a0b000000000001 "October salary"`,
+		`PAYROLL-2026-10-A 0192a3b4c5d67e8f9a0b1c2d3e4f5a6b  E2E-2 1000 EUR DE89370400440532013000 ""`,
+		`PAYROLL-2026-10-B 0192a3b4c5d67e8f9a0b1c2d3e4f5a6c  E2E-3 1251.25 USD 0192a3b4c5d67e8f9a0b000000000003 ""`,
+	}
+	if strings.Join(transfers, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected transfers:\n%s", strings.Join(transfers, "\n"))
+	}
+}
+
+func TestReadPain001RejectsOtherMessages(t *testing.T) {
+	document := `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"><BkToCstmrStmt/></Document>`
+	err := ReadPain001(strings.NewReader(document), Pain001Handler{})
+	if err != ErrNotPain001 {
+		t.Fatalf("expected ErrNotPain001, got %v", err)
+	}
+}
+
+// TestReadPain001Streams feeds a large file through a pipe, the reader must handle transfers before the file ends
+func TestReadPain001Streams(t *testing.T) {
+	reader, writer := io.Pipe()
+	total := 50000
+	var written atomic.Int64
+
+	go func() {
+		fmt.Fprint(writer, `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.09"><CstmrCdtTrfInitn>`)
+		fmt.Fprint(writer, `<GrpHdr><MsgId>BULK</MsgId><CreDtTm>2026-10-18T09:30:00Z</CreDtTm><NbOfTxs>50000</NbOfTxs></GrpHdr>`)
+		fmt.Fprint(writer, `<PmtInf><PmtInfId>BULK-1</PmtInfId><DbtrAcct><Id><Othr><Id>debtor</Id></Othr></Id></DbtrAcct>`)
+		for i := 0; i < total; i++ {
+			fmt.Fprintf(writer, `<CdtTrfTxInf><PmtId><EndToEndId>E2E-%d</EndToEndId></PmtId><Amt><InstdAmt Ccy="EUR">1.00</InstdAmt></Amt><CdtrAcct><Id><Othr><Id>creditor</Id></Othr></Id></CdtrAcct></CdtTrfTxInf>`, i)
+			written.Add(1)
+		}
+		fmt.Fprint(writer, `</PmtInf></CstmrCdtTrfInitn></Document>`)
+		writer.Close()
+	}()
+
+	count := 0
+	err := ReadPain001(reader, Pain001Handler{
+		GroupHeader: func(header *GroupHeader) error { return nil },
+		CreditTransfer: func(instruction *PaymentInstruction, transfer *CreditTransfer) error {
+			if count == 0 && written.Load() == int64(total) {
+				t.Error("first transfer was only handled once the whole file was written")
+			}
+			count++
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != total {
+		t.Fatalf("expected %d transfers, got %d", total, count)
+	}
+}
+
+func TestPain002ValidatesAgainstSchema(t *testing.T) {
+	report := StatusReport{
+		MsgId:           "0192a3b4c5d67e8f9a0b1c2d3e4f5a6b",
+		CreatedAt:       time.Date(2026, 10, 18, 9, 31, 0, 0, time.UTC),
+		OriginalMsgId:   "PAYROLL-2026-10",
+		OriginalMsgNmId: "pain.001.001.10",
+	}
+	report.Add("PAYROLL-2026-10-A", TransactionStatus{InstrId: "INSTR-1", EndToEndId: "E2E-1", Status: StatusAccepted, TransactionId: "0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b"})
+	report.Add("PAYROLL-2026-10-A", TransactionStatus{EndToEndId: "E2E-2", Status: StatusRejected, Reason: ReasonInvalidCreditorAccount, AdditionalInfo: "Creditor account not found"})
+	report.Add("PAYROLL-2026-10-A", TransactionStatus{EndToEndId: "E2E-4", Status: StatusPending, TransactionId: "0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6c"})
+	report.Add("PAYROLL-2026-10-B", TransactionStatus{EndToEndId: "E2E-3", Status: StatusRejected, Reason: ReasonInsufficientFunds})
+
+	var document bytes.Buffer
+	err := RenderPain002(&document, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "pain.002.xml")
+	err = os.WriteFile(path, document.Bytes(), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validateXSD(t, path, "pain.002.001.11.xsd")
+
+	for _, expected := range []string{"<GrpSts>PART</GrpSts>", "<PmtInfSts>RJCT</PmtInfSts>", "<Cd>AC03</Cd>", "<Cd>AM04</Cd>", "<TxSts>PDNG</TxSts>"} {
+		if !bytes.Contains(document.Bytes(), []byte(expected)) {
+			t.Errorf("expected the report to contain %s", expected)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package reconciliation
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ColumnMapping says where the fields of a statement line are in the CSV export of a partner bank,
+// columns are found by their header, ignoring case and surrounding spaces
+type ColumnMapping struct {
+	Date string
+	// Go layout of the dates, like 2006-01-02 or 02/01/2006
+	DateFormat string
+	// signed amount column, leave empty when the bank uses separate unsigned credit and debit columns
+	Amount      string
+	Credit      string
+	Debit       string
+	Reference   string
+	Description string
+	Delimiter   rune
+	// amounts like 1.234,56 instead of 1,234.56
+	DecimalComma bool
+}
+
+var DefaultColumnMapping = ColumnMapping{
+	Date:        "date",
+	DateFormat:  "2006-01-02",
+	Amount:      "amount",
+	Reference:   "reference",
+	Description: "description",
+	Delimiter:   ',',
+}
+
+var ErrMissingColumn = errors.New("missing column")
+
+// Line is a booking on the partner bank account, credits are positive
+type Line struct {
+	// line of the file, the header being line 1
+	LineNumber  int
+	BookedOn    time.Time
+	Amount      decimal.Decimal
+	Reference   string
+	Description string
+}
+
+// ParseAmount reads an amount as banks write them, with thousands separators and an optional sign
+func ParseAmount(text string, decimal_comma bool) (decimal.Decimal, error) {
+	text = strings.ReplaceAll(strings.TrimSpace(text), " ", "")
+	if decimal_comma {
+		text = strings.ReplaceAll(text, ".", "")
+		text = strings.Replace(text, ",", ".", 1)
+	} else {
+		text = strings.ReplaceAll(text, ",", "")
+	}
+	text = strings.TrimPrefix(text, "+")
+
+	return decimal.NewFromString(text)
+}
+
+func columnIndex(header []string, name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+
+	for i, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), strings.TrimSpace(name)) {
+			return i, nil
+		}
+	}
+
+	return -1, fmt.Errorf("%w %q", ErrMissingColumn, name)
+}
+
+// ParseStatementCSV reads the lines of a CSV statement with a header row, skipping empty lines
+func ParseStatementCSV(r io.Reader, mapping ColumnMapping) ([]Line, error) {
+	reader := csv.NewReader(r)
+	if mapping.Delimiter != 0 {
+		reader.Comma = mapping.Delimiter
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	// exports from spreadsheets often start with a byte order mark
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	if mapping.Amount == "" && (mapping.Credit == "" || mapping.Debit == "") {
+		return nil, errors.New("mapping needs an amount column or both credit and debit columns")
+	}
+
+	indexes := map[string]int{}
+	for key, name := range map[string]string{
+		"date":        mapping.Date,
+		"amount":      mapping.Amount,
+		"credit":      mapping.Credit,
+		"debit":       mapping.Debit,
+		"reference":   mapping.Reference,
+		"description": mapping.Description,
+	} {
+		indexes[key], err = columnIndex(header, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if indexes["date"] < 0 {
+		return nil, fmt.Errorf("%w for the date", ErrMissingColumn)
+	}
+
+	value := func(record []string, key string) string {
+		index := indexes[key]
+		if index < 0 || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	lines := []Line{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line_number, _ := reader.FieldPos(0)
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		booked_on, err := time.Parse(mapping.DateFormat, value(record, "date"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line_number, value(record, "date"))
+		}
+
+		var amount decimal.Decimal
+		if indexes["amount"] >= 0 {
+			amount, err = ParseAmount(value(record, "amount"), mapping.DecimalComma)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid amount %q", line_number, value(record, "amount"))
+			}
+		} else {
+			for _, key := range []string{"credit", "debit"} {
+				text := value(record, key)
+				if text == "" {
+					continue
+				}
+
+				part, err := ParseAmount(text, mapping.DecimalComma)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s %q", line_number, key, text)
+				}
+
+				if key == "debit" {
+					part = part.Abs().Neg()
+				}
+				amount = amount.Add(part)
+			}
+		}
+
+		if amount.IsZero() {
+			return nil, fmt.Errorf("line %d: amount is zero", line_number)
+		}
+
+		lines = append(lines, Line{
+			LineNumber:  line_number,
+			BookedOn:    booked_on,
+			Amount:      amount,
+			Reference:   value(record, "reference"),
+			Description: value(record, "description"),
+		})
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,129 @@
+package reconciliation
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultWindow is how far apart the booking date of a line and the issue date of a transaction can be
+const DefaultWindow = 3 * 24 * time.Hour
+
+type Match struct {
+	// index of the line in the parsed statement
+	Line          int
+	TransactionId uuid.UUID
+	// whether the line mentions the transaction, otherwise only the amount and the date matched
+	ByReference bool
+}
+
+// SignedAmount is how a deposit or a withdrawal shows on the partner bank statement:
+// deposits come into the bank's account there, withdrawals leave it
+func SignedAmount(transaction *model.Transaction) decimal.Decimal {
+	if transaction.Kind == "withdrawal" {
+		return transaction.Amount.Neg()
+	}
+
+	return transaction.Amount
+}
+
+func alphanumeric(text string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
+
+// mentions tells whether the line carries the transaction id, in full or as the last 15 digits
+// sent as identification number of ACH entries
+func mentions(line *Line, transaction_id uuid.UUID) bool {
+	text := alphanumeric(line.Reference + " " + line.Description)
+	id := strings.ReplaceAll(transaction_id.String(), "-", "")
+
+	return strings.Contains(text, id) || (len(text) >= 15 && strings.Contains(text, id[len(id)-15:]))
+}
+
+func distance(a time.Time, b time.Time) time.Duration {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	if a.After(b) {
+		return a.Sub(b)
+	}
+
+	return b.Sub(a)
+}
+
+type candidate struct {
+	line          int
+	transaction   int
+	by_reference  bool
+	date_distance time.Duration
+}
+
+// MatchLines pairs statement lines with deposits and withdrawals of the same signed amount issued within window
+// of the booking date, each line and transaction being used at most once. Lines mentioning a transaction are
+// paired first, then the pairs closest in date.
+func MatchLines(lines []Line, transactions []model.Transaction, window time.Duration) []Match {
+	by_amount := map[string][]int{}
+	for j := range transactions {
+		key := SignedAmount(&transactions[j]).String()
+		by_amount[key] = append(by_amount[key], j)
+	}
+
+	candidates := []candidate{}
+	for i := range lines {
+		for _, j := range by_amount[lines[i].Amount.String()] {
+			transaction := &transactions[j]
+
+			date_distance := distance(lines[i].BookedOn, transaction.DateIssued)
+			if date_distance > window {
+				continue
+			}
+
+			candidates = append(candidates, candidate{
+				line:          i,
+				transaction:   j,
+				by_reference:  mentions(&lines[i], transaction.Id),
+				date_distance: date_distance,
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(a int, b int) bool {
+		if candidates[a].by_reference != candidates[b].by_reference {
+			return candidates[a].by_reference
+		}
+		return candidates[a].date_distance < candidates[b].date_distance
+	})
+
+	matched_lines := map[int]bool{}
+	matched_transactions := map[int]bool{}
+	matches := []Match{}
+	for _, c := range candidates {
+		if matched_lines[c.line] || matched_transactions[c.transaction] {
+			continue
+		}
+
+		matched_lines[c.line] = true
+		matched_transactions[c.transaction] = true
+		matches = append(matches, Match{
+			Line:          c.line,
+			TransactionId: transactions[c.transaction].Id,
+			ByReference:   c.by_reference,
+		})
+	}
+
+	sort.Slice(matches, func(a int, b int) bool {
+		return matches[a].Line < matches[b].Line
+	})
+
+	return matches
+}
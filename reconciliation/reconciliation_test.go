@@ -0,0 +1,138 @@
+package reconciliation
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseStatementCSV(t *testing.T) {
+	file := "Date,Amount,Reference,Description\n" +
+		"2026-10-17,\"1,000.00\",DEP-1,Cash deposit\n" +
+		"\n" +
+		"2026-10-17,-250.5,,\"Payout, ACH\"\n"
+
+	lines, err := ParseStatementCSV(strings.NewReader(file), DefaultColumnMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+
+	if lines[0].LineNumber != 2 || !lines[0].Amount.Equal(decimal.RequireFromString("1000")) || lines[0].Reference != "DEP-1" {
+		t.Errorf("unexpected first line %+v", lines[0])
+	}
+
+	if lines[1].LineNumber != 4 || !lines[1].Amount.Equal(decimal.RequireFromString("-250.50")) || lines[1].Description != "Payout, ACH" {
+		t.Errorf("unexpected second line %+v", lines[1])
+	}
+}
+
+func TestParseStatementCSVWithCreditAndDebitColumns(t *testing.T) {
+	file := "Buchungstag;Soll;Haben;Verwendungszweck\n" +
+		"17.10.2026;1.234,56;;Auszahlung\n" +
+		"18.10.2026;;99,00;Einzahlung\n"
+
+	mapping := ColumnMapping{
+		Date:         "buchungstag",
+		DateFormat:   "02.01.2006",
+		Debit:        "Soll",
+		Credit:       "Haben",
+		Description:  "Verwendungszweck",
+		Delimiter:    ';',
+		DecimalComma: true,
+	}
+
+	lines, err := ParseStatementCSV(strings.NewReader(file), mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lines) != 2 || !lines[0].Amount.Equal(decimal.RequireFromString("-1234.56")) || !lines[1].Amount.Equal(decimal.RequireFromString("99")) {
+		t.Fatalf("unexpected lines %+v", lines)
+	}
+
+	if !lines[1].BookedOn.Equal(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected booking date %s", lines[1].BookedOn)
+	}
+}
+
+func TestParseStatementCSVErrors(t *testing.T) {
+	cases := map[string]string{
+		"missing column": "date,value\n2026-10-17,10\n",
+		"invalid date":   "date,amount\n17/10/2026,10\n",
+		"invalid amount": "date,amount\n2026-10-17,ten\n",
+		"zero amount":    "date,amount\n2026-10-17,0.00\n",
+	}
+
+	for name, file := range cases {
+		_, err := ParseStatementCSV(strings.NewReader(file), DefaultColumnMapping)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func testTransaction(id string, kind string, amount string, date_issued string) model.Transaction {
+	date, _ := time.Parse("2006-01-02", date_issued)
+
+	return model.Transaction{
+		Id:         uuid.MustParse(id),
+		Kind:       kind,
+		Amount:     decimal.RequireFromString(amount),
+		Currency:   "USD",
+		DateIssued: date.Add(15 * time.Hour),
+		Status:     "posted",
+	}
+}
+
+func testLine(booked_on string, amount string, reference string) Line {
+	date, _ := time.Parse("2006-01-02", booked_on)
+
+	return Line{BookedOn: date, Amount: decimal.RequireFromString(amount), Reference: reference}
+}
+
+func TestMatchLines(t *testing.T) {
+	transactions := []model.Transaction{
+		testTransaction("0192a3b4-0000-7000-8000-000000000001", "deposit", "100.00", "2026-10-15"),
+		testTransaction("0192a3b4-0000-7000-8000-000000000002", "deposit", "100.00", "2026-10-17"),
+		testTransaction("0192a3b4-0000-7000-8000-0000c0ffee03", "withdrawal", "250.50", "2026-10-16"),
+		testTransaction("0192a3b4-0000-7000-8000-000000000004", "withdrawal", "40.00", "2026-10-01"),
+	}
+
+	lines := []Line{
+		// closest in date to the second deposit, but the first one is mentioned by the other line
+		testLine("2026-10-17", "100", ""),
+		testLine("2026-10-17", "100.00", "DEP 0192A3B4-0000-7000-8000-000000000001"),
+		// last 15 digits of the withdrawal id, as sent in ACH files
+		testLine("2026-10-18", "-250.50", "ACH 0000000C0FFEE03"),
+		// same amount as a deposit but a debit
+		testLine("2026-10-17", "-100", ""),
+		// outside of the window
+		testLine("2026-10-17", "-40", ""),
+	}
+
+	matches := MatchLines(lines, transactions, DefaultWindow)
+
+	expected := []Match{
+		{Line: 0, TransactionId: transactions[1].Id},
+		{Line: 1, TransactionId: transactions[0].Id, ByReference: true},
+		{Line: 2, TransactionId: transactions[2].Id, ByReference: true},
+	}
+
+	if len(matches) != len(expected) {
+		t.Fatalf("expected %d matches, got %+v", len(expected), matches)
+	}
+
+	for i := range expected {
+		if matches[i] != expected[i] {
+			t.Errorf("match %d: expected %+v, got %+v", i, expected[i], matches[i])
+		}
+	}
+}
@@ -11,14 +11,16 @@ type AccountRepository struct {
 	Pg *sqlx.DB
 }
 
-func (ac *AccountRepository) CreateAccount(user_id string, name string, status string) error {
+func (ac *AccountRepository) CreateAccount(user_id string, name string, status string, currency string, account_type string) error {
 	_, err := ac.Pg.Exec(
-		`INSERT INTO "account" (user_id, name, status)
-		VALUES ($1, $2, $3)
+		`INSERT INTO "account" (user_id, name, status, currency, type)
+		VALUES ($1, $2, $3, $4, $5)
 		`,
 		user_id,
 		name,
 		status,
+		currency,
+		account_type,
 	)
 
 	return err
@@ -28,7 +30,7 @@ func (ac *AccountRepository) GetAccount(acc_id string) (*model.Account, error) {
 	account := new(model.Account)
 	err := ac.Pg.Get(
 		account,
-		`SELECT acc.id, acc.user_id, acc.name, acc.status, acc.created_at, acc.updated_at 
+		`SELECT acc.id, acc.user_id, acc.name, acc.currency, acc.type, acc.status, acc.created_at, acc.updated_at 
 		FROM "account" acc WHERE acc.id = $1`,
 		acc_id,
 	)
@@ -42,7 +44,7 @@ func (ac *AccountRepository) GetMyAccounts(user_id string, limit int, offset int
 		accounts,
 		`
 		SELECT 
-			acc.id, acc.user_id, acc.name, acc.status, acc.created_at, acc.updated_at 
+			acc.id, acc.user_id, acc.name, acc.currency, acc.type, acc.status, acc.created_at, acc.updated_at 
 		FROM 
 			"account" acc 
 		WHERE 
@@ -73,12 +75,13 @@ func (ac *AccountRepository) DisableAccount(acc_id string) error {
 	return err
 }
 
-func (ac *AccountRepository) GetBalanceSnapshot(account_id string) (*model.AccountBalance, error) {
+func (ac *AccountRepository) GetBalanceSnapshot(account_id string, currency string) (*model.AccountBalance, error) {
 	balance_snapshot := new(model.AccountBalance)
 	err := ac.Pg.Get(
 		balance_snapshot,
-		`SELECT bs.account_id, bs.balance, bs.updated_at FROM "balance_snapshot" bs WHERE bs.account_id = $1`,
+		`SELECT bs.account_id, bs.currency, bs.balance, bs.updated_at FROM "balance_snapshot" bs WHERE bs.account_id = $1 AND bs.currency = $2`,
 		account_id,
+		currency,
 	)
 
 	return balance_snapshot, err
@@ -90,7 +93,7 @@ func (ac *AccountRepository) GetAccounts(limit int, offset int) (*[]model.Accoun
 		accounts,
 		`
 		SELECT 
-			acc.id, acc.user_id, acc.name, acc.status, acc.created_at, acc.updated_at 
+			acc.id, acc.user_id, acc.name, acc.currency, acc.type, acc.status, acc.created_at, acc.updated_at 
 		FROM 
 			"account" acc 
 		ORDER BY
@@ -108,17 +111,17 @@ func (ac *AccountRepository) GetAccounts(limit int, offset int) (*[]model.Accoun
 }
 
 func (ac *AccountRepository) BulkUpsertBalanceSnapshots(balances *[]model.AccountBalance) error {
-	query := `INSERT INTO "balance_snapshot" (account_id, balance, created_at, updated_at) VALUES `
+	query := `INSERT INTO "balance_snapshot" (account_id, currency, balance, created_at, updated_at) VALUES `
 	values := []interface{}{}
 
 	for i, balance := range *balances {
-		num := i * 4
-		query += fmt.Sprintf("($%d, $%d, $%d, $%d),", num+1, num+2, num+3, num+4)
-		values = append(values, balance.AccountId, balance.Balance, balance.Date, balance.Date)
+		num := i * 5
+		query += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d),", num+1, num+2, num+3, num+4, num+5)
+		values = append(values, balance.AccountId, balance.Currency, balance.Balance, balance.Date, balance.Date)
 	}
 
 	query = query[:len(query)-1]
-	query += " ON CONFLICT (account_id) DO UPDATE SET balance = EXCLUDED.balance, updated_at = EXCLUDED.updated_at"
+	query += " ON CONFLICT (account_id, currency) DO UPDATE SET balance = EXCLUDED.balance, updated_at = EXCLUDED.updated_at"
 
 	_, err := ac.Pg.Exec(query, values...)
 
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+var ErrAchEntryNotFound = errors.New("no ACH entry with this trace number")
+var ErrAchEntryNotBatched = errors.New("ACH entry was not sent or was already returned")
+
+type AchRepository struct {
+	Pg *sqlx.DB
+}
+
+// CreateAchWithdrawal journals a posted withdrawal with its fee and queues its payout to the external bank account in entry
+func (ar *AchRepository) CreateAchWithdrawal(transaction_id uuid.UUID, from_account_id string, amount decimal.Decimal, status string, entry *model.AchEntry, fee *model.Fee) error {
+	tx, err := ar.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertTransaction(tx, transaction_id, "withdrawal", &from_account_id, nil, amount, nil, status)
+	if err != nil {
+		return err
+	}
+
+	err = insertFee(tx, fee, &from_account_id, transaction_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "ach_entry" (transaction_id, routing_number, account_number, account_type, name, sec_code, amount)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		transaction_id,
+		entry.RoutingNumber,
+		entry.AccountNumber,
+		entry.AccountType,
+		entry.Name,
+		entry.SECCode,
+		amount,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// BatchAchEntries assigns trace numbers to the queued entries and groups them in a new file, which write
+// has to prepare before the entries are marked as batched. write runs before the commit, so it must not hand
+// the file over: that is left to the caller once this returns. Returns nil when there is nothing queued.
+func (ar *AchRepository) BatchAchEntries(odfi string, write func(file *model.AchFile, entries []model.AchEntry) error) (*model.AchFile, error) {
+	tx, err := ar.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	entries := []model.AchEntry{}
+	err = tx.Select(
+		&entries,
+		`SELECT ae.id, ae.transaction_id, ae.routing_number, ae.account_number, ae.account_type, ae.name, ae.sec_code, ae.amount, ae.status,
+			ae.trace_number, ae.file_id, ae.return_code, ae.created_at, ae.batched_at, ae.returned_at
+		FROM "ach_entry" ae
+		JOIN "transaction" tx ON tx.id = ae.transaction_id
+		WHERE ae.status = 'queued' AND tx.status = 'posted'
+		ORDER BY ae.created_at
+		FOR UPDATE OF ae SKIP LOCKED`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	// files created on the same day are told apart by their modifier, A to Z
+	var files_today int
+	err = tx.Get(&files_today, `SELECT COUNT(*) FROM "ach_file" af WHERE af.created_at >= date_trunc('day', NOW())`)
+	if err != nil {
+		return nil, err
+	}
+
+	file_id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	created_at := time.Now().UTC()
+	modifier := string(rune('A' + files_today%26))
+	file := model.AchFile{
+		Id:             file_id,
+		FileName:       fmt.Sprintf("%s-%s.ach", created_at.Format("20060102150405"), modifier),
+		FileIdModifier: modifier,
+		EntryCount:     len(entries),
+		TotalCredit:    decimal.Zero,
+		CreatedAt:      created_at,
+	}
+
+	for i := range entries {
+		var sequence int64
+		err = tx.Get(&sequence, `SELECT nextval('ach_trace_number_seq')`)
+		if err != nil {
+			return nil, err
+		}
+
+		trace_number := fmt.Sprintf("%s%07d", odfi, sequence%10_000_000)
+		entries[i].TraceNumber = &trace_number
+		entries[i].FileId = &file_id
+		file.TotalCredit = file.TotalCredit.Add(entries[i].Amount)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "ach_file" (id, file_name, file_id_modifier, entry_count, total_credit, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		file.Id,
+		file.FileName,
+		file.FileIdModifier,
+		file.EntryCount,
+		file.TotalCredit,
+		file.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		_, err = tx.Exec(
+			`UPDATE "ach_entry" SET status = 'batched', trace_number = $2, file_id = $3, batched_at = NOW() WHERE id = $1`,
+			entry.Id,
+			entry.TraceNumber,
+			entry.FileId,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = write(&file, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return &file, tx.Commit()
+}
+
+// ReturnAchEntry records the return of a sent entry and reverses its withdrawal and fees, crediting the account back
+func (ar *AchRepository) ReturnAchEntry(trace_number string, return_code string) (*model.AchEntry, error) {
+	tx, err := ar.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	entry := new(model.AchEntry)
+	err = tx.Get(
+		entry,
+		`SELECT ae.id, ae.transaction_id, ae.routing_number, ae.account_number, ae.account_type, ae.name, ae.sec_code, ae.amount, ae.status,
+			ae.trace_number, ae.file_id, ae.return_code, ae.created_at, ae.batched_at, ae.returned_at
+		FROM "ach_entry" ae WHERE ae.trace_number = $1
+		FOR UPDATE`,
+		trace_number,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAchEntryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Status != "batched" {
+		return nil, ErrAchEntryNotBatched
+	}
+
+	err = reverseTransaction(tx, entry.TransactionId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = reverseFees(tx, entry.TransactionId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "ach_entry" SET status = 'returned', return_code = $2, returned_at = NOW() WHERE id = $1`,
+		entry.Id,
+		return_code,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Status = "returned"
+	entry.ReturnCode = &return_code
+
+	return entry, tx.Commit()
+}
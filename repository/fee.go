@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+type FeeRepository struct {
+	Pg *sqlx.DB
+}
+
+const feeRuleColumns = `fr.id, fr.account_type, fr.currency, fr.kind, fr.flat, fr.percentage, fr.min_amount, fr.max_amount, fr.waive_above_balance, fr.updated_by, fr.updated_at`
+
+// SetFeeRule creates the rule of its account type, currency and kind, or replaces the existing one
+func (fr *FeeRepository) SetFeeRule(rule *model.FeeRule) error {
+	_, err := fr.Pg.Exec(
+		`INSERT INTO "fee_rule" (account_type, currency, kind, flat, percentage, min_amount, max_amount, waive_above_balance, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (account_type, currency, kind) DO UPDATE SET
+			flat = EXCLUDED.flat,
+			percentage = EXCLUDED.percentage,
+			min_amount = EXCLUDED.min_amount,
+			max_amount = EXCLUDED.max_amount,
+			waive_above_balance = EXCLUDED.waive_above_balance,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()`,
+		rule.AccountType,
+		rule.Currency,
+		rule.Kind,
+		rule.Flat,
+		rule.Percentage,
+		rule.MinAmount,
+		rule.MaxAmount,
+		rule.WaiveAboveBalance,
+		rule.UpdatedBy,
+	)
+
+	return err
+}
+
+func (fr *FeeRepository) GetFeeRule(account_type string, currency string, kind string) (*model.FeeRule, error) {
+	rule := new(model.FeeRule)
+	err := fr.Pg.Get(
+		rule,
+		`SELECT `+feeRuleColumns+` FROM "fee_rule" fr WHERE fr.account_type = $1 AND fr.currency = $2 AND fr.kind = $3`,
+		account_type,
+		currency,
+		kind,
+	)
+
+	return rule, err
+}
+
+// GetFeeRules lists the rules of a kind, or of every kind when empty
+func (fr *FeeRepository) GetFeeRules(kind string) (*[]model.FeeRule, error) {
+	rules := new([]model.FeeRule)
+	err := fr.Pg.Select(
+		rules,
+		`SELECT `+feeRuleColumns+` FROM "fee_rule" fr
+		WHERE $1 = '' OR fr.kind::text = $1
+		ORDER BY fr.account_type, fr.currency, fr.kind`,
+		kind,
+	)
+
+	return rules, err
+}
+
+// DeleteFeeRule returns whether there was such a rule
+func (fr *FeeRepository) DeleteFeeRule(rule_id string) (bool, error) {
+	result, err := fr.Pg.Exec(`DELETE FROM "fee_rule" WHERE id = $1`, rule_id)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows == 1, err
+}
+
+// ChargeMaintenanceFee charges the maintenance fee of the month starting on period_start, once per month.
+// A zero amount is recorded as waived and a fee the account cannot cover as unpaid.
+// Returns nil when the month was already charged.
+func (fr *FeeRepository) ChargeMaintenanceFee(account_id uuid.UUID, period_start time.Time, balance decimal.Decimal, amount decimal.Decimal) (*model.MaintenanceFeeCharge, error) {
+	tx, err := fr.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	charge := model.MaintenanceFeeCharge{}
+	err = tx.Get(
+		&charge.Id,
+		`INSERT INTO "maintenance_fee_charge" (account_id, period_start, balance, amount, status)
+		VALUES ($1, $2, $3, $4, 'waived')
+		ON CONFLICT (account_id, period_start) DO NOTHING
+		RETURNING id`,
+		account_id,
+		period_start,
+		balance,
+		amount,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	charge.AccountId = account_id
+	charge.PeriodStart = period_start
+	charge.Balance = balance
+	charge.Amount = amount
+	charge.Status = "waived"
+
+	if amount.IsPositive() {
+		transaction_id, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+
+		charge.Status = "charged"
+		charge.TransactionId = &transaction_id
+
+		from_account_id := account_id.String()
+		err = insertTransaction(tx, transaction_id, "fee", &from_account_id, nil, amount, nil, "posted")
+		if errors.Is(err, ErrInsufficientBalance) {
+			charge.Status = "unpaid"
+			charge.TransactionId = nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(
+			`UPDATE "maintenance_fee_charge" SET status = $2, transaction_id = $3 WHERE id = $1`,
+			charge.Id,
+			charge.Status,
+			charge.TransactionId,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &charge, tx.Commit()
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"welloff-bank/model"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type FraudRepository struct {
+	Pg *sqlx.DB
+}
+
+func (fdr *FraudRepository) CreateFraudDecision(decision *model.FraudDecision) error {
+	return fdr.Pg.Get(
+		decision,
+		`INSERT INTO "fraud_decision" (user_id, account_id, transaction_kind, amount, currency, transaction_id, outcome, matched_rules)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, user_id, account_id, transaction_kind, amount, currency, transaction_id, outcome, matched_rules, created_at`,
+		decision.UserId,
+		decision.AccountId,
+		decision.TransactionKind,
+		decision.Amount,
+		decision.Currency,
+		decision.TransactionId,
+		decision.Outcome,
+		decision.MatchedRules,
+	)
+}
+
+// HasPaidAll tells whether the account already made a pending or posted transfer to every one of the accounts
+func (fdr *FraudRepository) HasPaidAll(account_id string, to_account_ids []string) (bool, error) {
+	var paid int
+	err := fdr.Pg.Get(
+		&paid,
+		`SELECT COUNT(DISTINCT tx.to_account_id) FROM "transaction" tx
+		WHERE tx.from_account_id = $1 AND tx.to_account_id = ANY($2) AND tx.kind = 'transfer' AND tx.status IN ('pending', 'posted')`,
+		account_id,
+		pq.Array(to_account_ids),
+	)
+
+	return paid == len(to_account_ids), err
+}
+
+// GetFraudDecisions lists what the fraud rules decided for the transactions of the account, newest first
+func (fdr *FraudRepository) GetFraudDecisions(account_id string, limit int, offset int) (*[]model.FraudDecision, error) {
+	decisions := new([]model.FraudDecision)
+	err := fdr.Pg.Select(
+		decisions,
+		`SELECT fd.id, fd.user_id, fd.account_id, fd.transaction_kind, fd.amount, fd.currency, fd.transaction_id, fd.outcome, fd.matched_rules, fd.created_at
+		FROM "fraud_decision" fd
+		WHERE fd.account_id = $1
+		ORDER BY fd.created_at DESC, fd.id DESC
+		LIMIT $2 OFFSET $3`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return decisions, err
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"welloff-bank/fx"
+	"welloff-bank/model"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+// FxRateRepository is the database backed fx.RateProvider
+type FxRateRepository struct {
+	Pg *sqlx.DB
+}
+
+// GetRate looks up the pair and falls back to the inverse of the opposite pair
+func (fr *FxRateRepository) GetRate(base string, quote string) (decimal.Decimal, error) {
+	rate := new(model.FxRate)
+	err := fr.Pg.Get(
+		rate,
+		`SELECT r.base, r.quote, r.rate, r.updated_at FROM "fx_rate" r WHERE r.base = $1 AND r.quote = $2`,
+		base,
+		quote,
+	)
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return decimal.Zero, err
+	}
+
+	err = fr.Pg.Get(
+		rate,
+		`SELECT r.base, r.quote, r.rate, r.updated_at FROM "fx_rate" r WHERE r.base = $1 AND r.quote = $2`,
+		quote,
+		base,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return decimal.Zero, fx.ErrRateNotFound
+	}
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return decimal.NewFromInt(1).DivRound(rate.Rate, 12), nil
+}
+
+func (fr *FxRateRepository) UpsertRates(rates []model.FxRate) error {
+	tx, err := fr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		_, err = tx.Exec(
+			`INSERT INTO "fx_rate" (base, quote, rate)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (base, quote) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()`,
+			rate.Base,
+			rate.Quote,
+			rate.Rate,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (fr *FxRateRepository) GetConversion(transaction_id string) (*model.FxConversion, error) {
+	conversion := new(model.FxConversion)
+	err := fr.Pg.Get(
+		conversion,
+		`SELECT c.transaction_id, c.from_currency, c.to_currency, c.from_amount, c.to_amount, c.rate, c.spread, c.fee, c.created_at
+		FROM "fx_conversion" c WHERE c.transaction_id = $1`,
+		transaction_id,
+	)
+
+	return conversion, err
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"errors"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+var ErrHoldNotActive = errors.New("hold is not active")
+var ErrCaptureExceedsHold = errors.New("capture amount is greater than the held amount")
+
+type HoldRepository struct {
+	Pg *sqlx.DB
+}
+
+func (hr *HoldRepository) GetHold(hold_id string) (*model.Hold, error) {
+	hold := new(model.Hold)
+	err := hr.Pg.Get(
+		hold,
+		`SELECT h.id, h.account_id, h.amount, h.captured_amount, h.merchant, h.purpose, h.status, h.expires_at, h.capture_transaction_id, h.created_at, h.updated_at
+		FROM "hold" h WHERE h.id = $1`,
+		hold_id,
+	)
+
+	return hold, err
+}
+
+func (hr *HoldRepository) GetActiveHoldsAmount(account_id string) (decimal.Decimal, error) {
+	var amount decimal.Decimal
+	err := hr.Pg.Get(
+		&amount,
+		`SELECT COALESCE(SUM(h.amount), 0) FROM "hold" h 
+		WHERE h.account_id = $1 AND h.status = 'active' AND h.expires_at > NOW()`,
+		account_id,
+	)
+
+	return amount, err
+}
+
+// CreateHold reserves the amount on the account, failing when the available balance cannot cover it
+func (hr *HoldRepository) CreateHold(hold_id uuid.UUID, account_id string, amount decimal.Decimal, merchant string, purpose string, expires_at time.Time) error {
+	tx, err := hr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = debitAccount(tx, account_id, amount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "hold" (id, account_id, amount, merchant, purpose, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		hold_id,
+		account_id,
+		amount,
+		merchant,
+		purpose,
+		expires_at,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockActiveHold locks the hold's account and then the hold, failing when the hold is no longer active
+func lockActiveHold(tx *sqlx.Tx, hold_id string) (*model.Hold, error) {
+	hold := new(model.Hold)
+	err := tx.Get(hold, `SELECT h.id, h.account_id FROM "hold" h WHERE h.id = $1`, hold_id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockAccount(tx, hold.AccountId.String())
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Get(
+		hold,
+		`SELECT h.id, h.account_id, h.amount, h.captured_amount, h.merchant, h.purpose, h.status, h.expires_at, h.capture_transaction_id, h.created_at, h.updated_at
+		FROM "hold" h WHERE h.id = $1 FOR UPDATE`,
+		hold_id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.Status != "active" || !hold.ExpiresAt.After(time.Now()) {
+		return nil, ErrHoldNotActive
+	}
+
+	return hold, nil
+}
+
+// IncrementHold raises the reserved amount, failing when the available balance cannot cover the increment
+func (hr *HoldRepository) IncrementHold(hold_id string, amount decimal.Decimal) error {
+	tx, err := hr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hold, err := lockActiveHold(tx, hold_id)
+	if err != nil {
+		return err
+	}
+
+	err = debitAccount(tx, hold.AccountId.String(), amount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "hold" SET amount = amount + $2, updated_at = NOW() WHERE id = $1`,
+		hold_id,
+		amount,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CaptureHold posts a capture transaction of up to the held amount and releases the remainder of the hold
+func (hr *HoldRepository) CaptureHold(hold_id string, transaction_id uuid.UUID, amount decimal.Decimal) error {
+	tx, err := hr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hold, err := lockActiveHold(tx, hold_id)
+	if err != nil {
+		return err
+	}
+
+	if amount.GreaterThan(hold.Amount) {
+		return ErrCaptureExceedsHold
+	}
+
+	// the hold stops reserving balance before the capture is debited from the account
+	_, err = tx.Exec(
+		`UPDATE "hold" SET status = 'captured', captured_amount = $2, updated_at = NOW() WHERE id = $1`,
+		hold_id,
+		amount,
+	)
+	if err != nil {
+		return err
+	}
+
+	account_id := hold.AccountId.String()
+	err = insertTransaction(tx, transaction_id, "capture", &account_id, nil, amount, nil, "posted")
+	if err != nil {
+		return err
+	}
+
+	// only once the capture transaction exists, for the foreign key
+	_, err = tx.Exec(
+		`UPDATE "hold" SET capture_transaction_id = $2 WHERE id = $1`,
+		hold_id,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (hr *HoldRepository) ReleaseHold(hold_id string) error {
+	tx, err := hr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = lockActiveHold(tx, hold_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "hold" SET status = 'released', updated_at = NOW() WHERE id = $1`,
+		hold_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ExpireHolds marks the active holds past their expiry as expired and returns how many were
+func (hr *HoldRepository) ExpireHolds() (int64, error) {
+	result, err := hr.Pg.Exec(
+		`UPDATE "hold" SET status = 'expired', updated_at = NOW() WHERE status = 'active' AND expires_at <= NOW()`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"time"
+	"welloff-bank/model"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IdempotencyKeyRepository struct {
+	Pg *sqlx.DB
+}
+
+// ReserveIdempotencyKey returns false when the key was already used by the user, a reservation whose request
+// never completed is taken over once its lease expired
+func (ir *IdempotencyKeyRepository) ReserveIdempotencyKey(user_id string, key string, fingerprint string, lease time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	result, err := ir.Pg.Exec(
+		`INSERT INTO "idempotency_key" AS ik (user_id, key, fingerprint, locked_until)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, locked_until = EXCLUDED.locked_until, created_at = $5, updated_at = $5
+		WHERE ik.response_status IS NULL AND ik.locked_until < $5`,
+		user_id,
+		key,
+		fingerprint,
+		now.Add(lease),
+		now,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows == 1, err
+}
+
+// RenewIdempotencyKey extends the lease of a reservation whose request is still running
+func (ir *IdempotencyKeyRepository) RenewIdempotencyKey(user_id string, key string, lease time.Duration) error {
+	_, err := ir.Pg.Exec(
+		`UPDATE "idempotency_key"
+		SET locked_until = $3, updated_at = NOW()
+		WHERE user_id = $1 AND key = $2 AND response_status IS NULL`,
+		user_id,
+		key,
+		time.Now().UTC().Add(lease),
+	)
+
+	return err
+}
+
+func (ir *IdempotencyKeyRepository) GetIdempotencyKey(user_id string, key string) (*model.IdempotencyKey, error) {
+	idempotency_key := new(model.IdempotencyKey)
+	err := ir.Pg.Get(
+		idempotency_key,
+		`SELECT ik.key, ik.user_id, ik.fingerprint, ik.response_status, ik.response_content_type, ik.response_body, ik.locked_until, ik.created_at, ik.updated_at
+		FROM "idempotency_key" ik WHERE ik.user_id = $1 AND ik.key = $2`,
+		user_id,
+		key,
+	)
+
+	return idempotency_key, err
+}
+
+func (ir *IdempotencyKeyRepository) CompleteIdempotencyKey(user_id string, key string, status int, content_type string, body []byte) error {
+	_, err := ir.Pg.Exec(
+		`UPDATE "idempotency_key"
+		SET response_status = $3, response_content_type = $4, response_body = $5, updated_at = NOW()
+		WHERE user_id = $1 AND key = $2`,
+		user_id,
+		key,
+		status,
+		content_type,
+		body,
+	)
+
+	return err
+}
+
+func (ir *IdempotencyKeyRepository) DeleteIdempotencyKey(user_id string, key string) error {
+	_, err := ir.Pg.Exec(
+		`DELETE FROM "idempotency_key" WHERE user_id = $1 AND key = $2`,
+		user_id,
+		key,
+	)
+
+	return err
+}
+
+func (ir *IdempotencyKeyRepository) DeleteIdempotencyKeysBefore(date time.Time) error {
+	_, err := ir.Pg.Exec(
+		`DELETE FROM "idempotency_key" WHERE created_at < $1`,
+		date,
+	)
+
+	return err
+}
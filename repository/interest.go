@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"time"
+	"welloff-bank/interest"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+type InterestRepository struct {
+	Pg *sqlx.DB
+}
+
+// SetSavingsRate sets the APY of a currency from a day on, replacing the one set for the same day
+func (ir *InterestRepository) SetSavingsRate(currency string, apy decimal.Decimal, effective_from time.Time, created_by uuid.UUID) error {
+	_, err := ir.Pg.Exec(
+		`INSERT INTO "savings_rate" (currency, apy, effective_from, created_by) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (currency, effective_from) DO UPDATE SET apy = EXCLUDED.apy, created_by = EXCLUDED.created_by, created_at = NOW()`,
+		currency,
+		apy,
+		effective_from,
+		created_by,
+	)
+
+	return err
+}
+
+// GetSavingsRates lists the rates of the currency, or of every currency when empty, oldest first
+func (ir *InterestRepository) GetSavingsRates(currency string) (*[]model.SavingsRate, error) {
+	rates := new([]model.SavingsRate)
+	err := ir.Pg.Select(
+		rates,
+		`SELECT sr.id, sr.currency, sr.apy, sr.effective_from, sr.created_by, sr.created_at
+		FROM "savings_rate" sr
+		WHERE $1 = '' OR sr.currency = $1
+		ORDER BY sr.currency, sr.effective_from`,
+		currency,
+	)
+
+	return rates, err
+}
+
+func (ir *InterestRepository) GetSavingsAccounts(limit int, offset int) (*[]model.Account, error) {
+	accounts := new([]model.Account)
+	err := ir.Pg.Select(
+		accounts,
+		`SELECT acc.id, acc.user_id, acc.name, acc.currency, acc.type, acc.status, acc.created_at, acc.updated_at
+		FROM "account" acc
+		WHERE acc.type = 'savings' AND acc.status = 'active'
+		ORDER BY acc.id
+		LIMIT $1 OFFSET $2`,
+		limit,
+		offset,
+	)
+
+	return accounts, err
+}
+
+// GetLastAccrualDate returns the last day accrued for the account, nil when none was
+func (ir *InterestRepository) GetLastAccrualDate(account_id string) (*time.Time, error) {
+	var date *time.Time
+	err := ir.Pg.Get(&date, `SELECT MAX(ia.accrual_date) FROM "interest_accrual" ia WHERE ia.account_id = $1`, account_id)
+
+	return date, err
+}
+
+// CreateInterestAccrual records the accrual of a day, accruing the same day again is a no-op
+func (ir *InterestRepository) CreateInterestAccrual(accrual *model.InterestAccrual) error {
+	_, err := ir.Pg.Exec(
+		`INSERT INTO "interest_accrual" (account_id, accrual_date, balance, apy, daily_rate, amount)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (account_id, accrual_date) DO NOTHING`,
+		accrual.AccountId,
+		accrual.AccrualDate,
+		accrual.Balance,
+		accrual.Apy,
+		accrual.DailyRate,
+		accrual.Amount,
+	)
+
+	return err
+}
+
+// GetUncreditedPeriods returns the first day of the months with accruals before the date that were not credited
+func (ir *InterestRepository) GetUncreditedPeriods(account_id string, before time.Time) ([]time.Time, error) {
+	periods := []time.Time{}
+	err := ir.Pg.Select(
+		&periods,
+		`SELECT DISTINCT date_trunc('month', ia.accrual_date)::date AS period_start
+		FROM "interest_accrual" ia
+		WHERE ia.account_id = $1 AND ia.credit_id IS NULL AND ia.accrual_date < $2
+		ORDER BY period_start`,
+		account_id,
+		before,
+	)
+
+	return periods, err
+}
+
+// CreditInterest pays the interest accrued by the account in the month starting on period_start as an
+// 'interest' transaction from the interest expense account. The month is credited once, nil is returned
+// when there was nothing left to credit.
+func (ir *InterestRepository) CreditInterest(account *model.Account, period_start time.Time) (*model.InterestCredit, error) {
+	tx, err := ir.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	period_end := period_start.AddDate(0, 1, -1)
+
+	accruals := []decimal.Decimal{}
+	err = tx.Select(
+		&accruals,
+		`SELECT ia.amount FROM "interest_accrual" ia
+		WHERE ia.account_id = $1 AND ia.accrual_date BETWEEN $2 AND $3 AND ia.credit_id IS NULL
+		FOR UPDATE`,
+		account.Id,
+		period_start,
+		period_end,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accruals) == 0 {
+		return nil, nil
+	}
+
+	accrued, amount := interest.Credit(accruals, model.CurrencyMinorUnits[account.Currency])
+
+	credit_id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	credit := model.InterestCredit{
+		Id:          credit_id,
+		AccountId:   account.Id,
+		PeriodStart: period_start,
+		PeriodEnd:   period_end,
+		Accrued:     accrued,
+		Amount:      amount,
+	}
+
+	if amount.IsPositive() {
+		transaction_id, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+
+		account_id := account.Id.String()
+		err = insertTransaction(tx, transaction_id, "interest", nil, &account_id, amount, nil, "posted")
+		if err != nil {
+			return nil, err
+		}
+
+		credit.TransactionId = &transaction_id
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "interest_credit" (id, account_id, period_start, period_end, accrued, amount, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		credit.Id,
+		credit.AccountId,
+		credit.PeriodStart,
+		credit.PeriodEnd,
+		credit.Accrued,
+		credit.Amount,
+		credit.TransactionId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "interest_accrual" SET credit_id = $1
+		WHERE account_id = $2 AND accrual_date BETWEEN $3 AND $4 AND credit_id IS NULL`,
+		credit.Id,
+		account.Id,
+		period_start,
+		period_end,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &credit, tx.Commit()
+}
+
+// GetInterestAccruals lists the daily accruals of the account, newest first
+func (ir *InterestRepository) GetInterestAccruals(account_id string, limit int, offset int) (*[]model.InterestAccrual, error) {
+	accruals := new([]model.InterestAccrual)
+	err := ir.Pg.Select(
+		accruals,
+		`SELECT ia.account_id, ia.accrual_date, ia.balance, ia.apy, ia.daily_rate, ia.amount, ia.credit_id, ia.created_at
+		FROM "interest_accrual" ia
+		WHERE ia.account_id = $1
+		ORDER BY ia.accrual_date DESC
+		LIMIT $2 OFFSET $3`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return accruals, err
+}
+
+// GetInterestCredits lists the monthly interest payments of the account, newest first
+func (ir *InterestRepository) GetInterestCredits(account_id string) (*[]model.InterestCredit, error) {
+	credits := new([]model.InterestCredit)
+	err := ir.Pg.Select(
+		credits,
+		`SELECT ic.id, ic.account_id, ic.period_start, ic.period_end, ic.accrued, ic.amount, ic.transaction_id, ic.created_at
+		FROM "interest_credit" ic
+		WHERE ic.account_id = $1
+		ORDER BY ic.period_start DESC`,
+		account_id,
+	)
+
+	return credits, err
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"errors"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+type LimitRepository struct {
+	Pg *sqlx.DB
+}
+
+// SetAccountLimit sets a limit of the account or changes its amount
+func (lmr *LimitRepository) SetAccountLimit(account_id string, kind string, period string, amount decimal.Decimal, updated_by uuid.UUID) error {
+	_, err := lmr.Pg.Exec(
+		`INSERT INTO "account_limit" (account_id, kind, period, amount, updated_by) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (account_id, kind, period) DO UPDATE SET
+			amount = EXCLUDED.amount,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()`,
+		account_id,
+		kind,
+		period,
+		amount,
+		updated_by,
+	)
+
+	return err
+}
+
+// DeleteAccountLimit lifts a limit of the account, returns false when it had none
+func (lmr *LimitRepository) DeleteAccountLimit(account_id string, kind string, period string) (bool, error) {
+	result, err := lmr.Pg.Exec(
+		`DELETE FROM "account_limit" WHERE account_id = $1 AND kind = $2 AND period = $3`,
+		account_id,
+		kind,
+		period,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows == 1, err
+}
+
+// GetAccountLimits lists the limits of the account with the temporary increase active at the instant
+func (lmr *LimitRepository) GetAccountLimits(account_id string, at time.Time) (*[]model.AccountLimit, error) {
+	limits := new([]model.AccountLimit)
+	err := lmr.Pg.Select(
+		limits,
+		`SELECT al.account_id, al.kind, al.period, al.amount, al.updated_by, al.created_at, al.updated_at,
+			li.amount AS increased_amount, li.expires_at AS increase_expires_at
+		FROM "account_limit" al
+		LEFT JOIN LATERAL (
+			SELECT li.amount, li.expires_at FROM "limit_increase" li
+			WHERE li.account_id = al.account_id AND li.kind = al.kind AND li.period = al.period AND li.created_at <= $2 AND li.expires_at > $2
+			ORDER BY li.created_at DESC
+			LIMIT 1
+		) li ON TRUE
+		WHERE al.account_id = $1
+		ORDER BY al.kind, al.period`,
+		account_id,
+		at,
+	)
+
+	return limits, err
+}
+
+var ErrLimitIncreaseCooldown = errors.New("limit was increased within the cooldown")
+
+// CreateLimitIncrease requests an increase of a limit of the account under a lock on the limit, failing with
+// ErrLimitIncreaseCooldown and the last increase when the limit was increased less than the cooldown ago
+func (lmr *LimitRepository) CreateLimitIncrease(increase *model.LimitIncrease, cooldown time.Duration) (*model.LimitIncrease, error) {
+	tx, err := lmr.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`SELECT 1 FROM "account_limit" WHERE account_id = $1 AND kind = $2 AND period = $3 FOR UPDATE`,
+		increase.AccountId,
+		increase.Kind,
+		increase.Period,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	last_increase, err := lastLimitIncrease(tx, increase.AccountId.String(), increase.Kind, increase.Period)
+	if err != nil {
+		return nil, err
+	}
+
+	if last_increase != nil && time.Now().Before(last_increase.CreatedAt.Add(cooldown)) {
+		return last_increase, ErrLimitIncreaseCooldown
+	}
+
+	err = tx.Get(
+		increase,
+		`INSERT INTO "limit_increase" (account_id, kind, period, amount, reason, requested_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, account_id, kind, period, amount, reason, requested_by, created_at, expires_at`,
+		increase.AccountId,
+		increase.Kind,
+		increase.Period,
+		increase.Amount,
+		increase.Reason,
+		increase.RequestedBy,
+		increase.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return last_increase, tx.Commit()
+}
+
+// lastLimitIncrease returns the latest increase of a limit of the account, nil when there was none
+func lastLimitIncrease(q sqlx.Queryer, account_id string, kind string, period string) (*model.LimitIncrease, error) {
+	increases := []model.LimitIncrease{}
+	err := sqlx.Select(
+		q,
+		&increases,
+		`SELECT li.id, li.account_id, li.kind, li.period, li.amount, li.reason, li.requested_by, li.created_at, li.expires_at
+		FROM "limit_increase" li
+		WHERE li.account_id = $1 AND li.kind = $2 AND li.period = $3
+		ORDER BY li.created_at DESC
+		LIMIT 1`,
+		account_id,
+		kind,
+		period,
+	)
+	if err != nil || len(increases) == 0 {
+		return nil, err
+	}
+
+	return &increases[0], nil
+}
+
+func (lmr *LimitRepository) GetLimitIncreases(account_id string, limit int, offset int) (*[]model.LimitIncrease, error) {
+	increases := new([]model.LimitIncrease)
+	err := lmr.Pg.Select(
+		increases,
+		`SELECT li.id, li.account_id, li.kind, li.period, li.amount, li.reason, li.requested_by, li.created_at, li.expires_at
+		FROM "limit_increase" li
+		WHERE li.account_id = $1
+		ORDER BY li.created_at DESC
+		LIMIT $2 OFFSET $3`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return increases, err
+}
+
+// GetOutgoingTransactions lists the pending and posted transactions of the kinds made from the account since the instant,
+// what its limits are checked against. A refund is made from the destination account of the transfer it refunds.
+func (lmr *LimitRepository) GetOutgoingTransactions(account_id string, kinds []string, since time.Time) (*[]model.Transaction, error) {
+	transactions := new([]model.Transaction)
+	err := lmr.Pg.Select(
+		transactions,
+		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM "transaction" tx
+		WHERE ((tx.from_account_id = $1 AND tx.kind <> 'refund') OR (tx.to_account_id = $1 AND tx.kind = 'refund')) AND tx.kind::text = ANY($2) AND tx.status IN ('pending', 'posted') AND tx.date_issued > $3
+		ORDER BY tx.date_issued`,
+		account_id,
+		pq.Array(kinds),
+		since,
+	)
+
+	return transactions, err
+}
@@ -0,0 +1,399 @@
+package repository
+
+import (
+	"errors"
+	"time"
+	"welloff-bank/amortization"
+	"welloff-bank/model"
+	"welloff-bank/schedule"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+var ErrLoanNotActive = errors.New("loan is already paid off")
+
+type LoanRepository struct {
+	Pg *sqlx.DB
+}
+
+const loanColumns = `ln.id, ln.user_id, ln.account_id, ln.repayment_account_id, ln.currency, ln.principal, ln.annual_rate,
+	ln.term_months, ln.method, ln.first_due_date, ln.late_fee, ln.outstanding_principal, ln.status,
+	ln.disbursement_transaction_id, ln.originated_by, ln.created_at, ln.paid_off_at`
+
+const loanInstallmentColumns = `li.id, li.loan_id, li.number, li.due_date, li.principal, li.interest, li.amount, li.late_fee,
+	li.status, li.next_attempt_at, li.transaction_id, li.paid_at`
+
+// OriginateLoan records the loan with its schedule and disburses the principal into its account
+func (lr *LoanRepository) OriginateLoan(loan *model.Loan, installments []amortization.Installment) error {
+	tx, err := lr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	account_id := loan.AccountId.String()
+	err = insertTransaction(tx, loan.DisbursementTransactionId, "loan_disbursement", nil, &account_id, loan.Principal, nil, "posted")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "loan" (id, user_id, account_id, repayment_account_id, currency, principal, annual_rate, term_months,
+			method, first_due_date, late_fee, outstanding_principal, disbursement_transaction_id, originated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $6, $12, $13)`,
+		loan.Id,
+		loan.UserId,
+		loan.AccountId,
+		loan.RepaymentAccountId,
+		loan.Currency,
+		loan.Principal,
+		loan.AnnualRate,
+		loan.TermMonths,
+		loan.Method,
+		loan.FirstDueDate,
+		loan.LateFee,
+		loan.DisbursementTransactionId,
+		loan.OriginatedBy,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, installment := range installments {
+		_, err = tx.Exec(
+			`INSERT INTO "loan_installment" (loan_id, number, due_date, principal, interest, amount) VALUES ($1, $2, $3, $4, $5, $6)`,
+			loan.Id,
+			installment.Number,
+			installment.DueDate,
+			installment.Principal,
+			installment.Interest,
+			installment.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (lr *LoanRepository) GetLoan(loan_id string) (*model.Loan, error) {
+	loan := new(model.Loan)
+	err := lr.Pg.Get(loan, `SELECT `+loanColumns+` FROM "loan" ln WHERE ln.id = $1`, loan_id)
+
+	return loan, err
+}
+
+func (lr *LoanRepository) GetLoansByUser(user_id string, limit int, offset int) (*[]model.Loan, error) {
+	loans := new([]model.Loan)
+	err := lr.Pg.Select(
+		loans,
+		`SELECT `+loanColumns+` FROM "loan" ln
+		WHERE ln.user_id = $1
+		ORDER BY ln.created_at DESC
+		LIMIT $2 OFFSET $3`,
+		user_id,
+		limit,
+		offset,
+	)
+
+	return loans, err
+}
+
+func (lr *LoanRepository) GetLoanInstallments(loan_id string) (*[]model.LoanInstallment, error) {
+	installments := new([]model.LoanInstallment)
+	err := lr.Pg.Select(
+		installments,
+		`SELECT `+loanInstallmentColumns+` FROM "loan_installment" li WHERE li.loan_id = $1 ORDER BY li.number`,
+		loan_id,
+	)
+
+	return installments, err
+}
+
+// GetDueLoanInstallments lists the unpaid installments of active loans due up to today whose next attempt time
+// has come, the oldest of every loan first
+func (lr *LoanRepository) GetDueLoanInstallments(today time.Time, now time.Time, limit int) (*[]model.LoanInstallment, error) {
+	installments := new([]model.LoanInstallment)
+	err := lr.Pg.Select(
+		installments,
+		`SELECT `+loanInstallmentColumns+` FROM "loan_installment" li
+		JOIN "loan" ln ON ln.id = li.loan_id
+		WHERE ln.status = 'active'
+			AND li.status IN ('scheduled', 'late')
+			AND li.due_date <= $1
+			AND (li.next_attempt_at IS NULL OR li.next_attempt_at <= $2)
+		ORDER BY li.loan_id, li.number
+		LIMIT $3`,
+		today,
+		now,
+		limit,
+	)
+
+	return installments, err
+}
+
+// lockLoan locks the loan row until tx ends and returns it, failing with ErrLoanNotActive when it is paid off
+func lockLoan(tx *sqlx.Tx, loan_id string) (*model.Loan, error) {
+	loan := new(model.Loan)
+	err := tx.Get(loan, `SELECT `+loanColumns+` FROM "loan" ln WHERE ln.id = $1 FOR UPDATE`, loan_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "active" {
+		return nil, ErrLoanNotActive
+	}
+
+	return loan, nil
+}
+
+// insertLoanPayment posts a repayment debited from the account as part of tx: the principal goes back to the
+// loans receivable account, the interest to the interest income account and the late fees to the fee income account
+func insertLoanPayment(tx *sqlx.Tx, transaction_id uuid.UUID, account_id string, currency string, principal decimal.Decimal, interest decimal.Decimal, late_fees decimal.Decimal) error {
+	total := principal.Add(interest).Add(late_fees)
+
+	err := debitAccount(tx, account_id, total)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "transaction" (id, kind, from_account_id, amount, currency, status, posted_at)
+		VALUES ($1, 'loan_payment', $2, $3, $4, 'posted', NOW())`,
+		transaction_id,
+		account_id,
+		total,
+		currency,
+	)
+	if err != nil {
+		return err
+	}
+
+	entries := []model.Entry{
+		{AccountId: uuid.MustParse(account_id), Direction: "debit", Amount: total},
+		{AccountId: model.LoansReceivableAccountId, Direction: "credit", Amount: principal},
+		{AccountId: model.InterestIncomeAccountId, Direction: "credit", Amount: interest},
+		{AccountId: model.FeeIncomeAccountId, Direction: "credit", Amount: late_fees},
+	}
+
+	for _, entry := range entries {
+		if entry.Amount.IsZero() {
+			continue
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO "journal_entry" (transaction_id, account_id, direction, amount, currency, posted_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())`,
+			transaction_id,
+			entry.AccountId,
+			entry.Direction,
+			entry.Amount,
+			currency,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CollectLoanInstallment debits an unpaid installment, with its late fee, from the repayment account of the loan,
+// paying the loan off with its last installment. When the account cannot cover it the installment turns late,
+// is charged the late fee of the loan the first time and is attempted again from retry_at on.
+// Returns the status the installment was left in.
+func (lr *LoanRepository) CollectLoanInstallment(installment_id string, retry_at time.Time) (string, error) {
+	tx, err := lr.Pg.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var loan_id string
+	err = tx.Get(&loan_id, `SELECT li.loan_id FROM "loan_installment" li WHERE li.id = $1`, installment_id)
+	if err != nil {
+		return "", err
+	}
+
+	loan, err := lockLoan(tx, loan_id)
+	if err != nil {
+		return "", err
+	}
+
+	installment := new(model.LoanInstallment)
+	err = tx.Get(installment, `SELECT `+loanInstallmentColumns+` FROM "loan_installment" li WHERE li.id = $1`, installment_id)
+	if err != nil {
+		return "", err
+	}
+
+	if installment.Status != "scheduled" && installment.Status != "late" {
+		return installment.Status, nil
+	}
+
+	transaction_id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+
+	err = insertLoanPayment(tx, transaction_id, loan.RepaymentAccountId.String(), loan.Currency, installment.Principal, installment.Interest, installment.LateFee)
+	if errors.Is(err, ErrInsufficientBalance) {
+		// nothing was written yet, the rest of tx is still usable
+		_, err = tx.Exec(
+			`UPDATE "loan_installment"
+			SET status = 'late', late_fee = CASE WHEN status = 'scheduled' THEN $2 ELSE late_fee END, next_attempt_at = $3
+			WHERE id = $1`,
+			installment_id,
+			loan.LateFee,
+			retry_at,
+		)
+		if err != nil {
+			return "", err
+		}
+
+		return "late", tx.Commit()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "loan_installment" SET status = 'paid', transaction_id = $2, paid_at = NOW(), next_attempt_at = NULL WHERE id = $1`,
+		installment_id,
+		transaction_id,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "loan" SET
+			outstanding_principal = outstanding_principal - $2,
+			status = CASE WHEN outstanding_principal - $2 = 0 THEN 'paid_off'::loan_status ELSE status END,
+			paid_off_at = CASE WHEN outstanding_principal - $2 = 0 THEN NOW() END
+		WHERE id = $1`,
+		loan_id,
+		installment.Principal,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return "paid", tx.Commit()
+}
+
+// loanPayoffQuote quotes the payoff of the loan on the as_of day from its unpaid installments. Those due up to
+// as_of are overdue, the interest of the next one accrues from the previous due date, or from the origination
+// for the first one.
+func loanPayoffQuote(q sqlx.Queryer, loan *model.Loan, as_of time.Time) (amortization.Quote, error) {
+	unpaid := []model.LoanInstallment{}
+	err := sqlx.Select(
+		q,
+		&unpaid,
+		`SELECT `+loanInstallmentColumns+` FROM "loan_installment" li
+		WHERE li.loan_id = $1 AND li.status IN ('scheduled', 'late')
+		ORDER BY li.number`,
+		loan.Id,
+	)
+	if err != nil {
+		return amortization.Quote{}, err
+	}
+
+	as_of = schedule.Date(as_of)
+	overdue := []amortization.Installment{}
+	late_fees := decimal.Zero
+	// the first installment not due yet
+	var next *model.LoanInstallment
+	for i, installment := range unpaid {
+		late_fees = late_fees.Add(installment.LateFee)
+
+		if installment.DueDate.After(as_of) {
+			if next == nil {
+				next = &unpaid[i]
+			}
+			continue
+		}
+
+		overdue = append(overdue, amortization.Installment{
+			Number:    installment.Number,
+			DueDate:   installment.DueDate,
+			Principal: installment.Principal,
+			Interest:  installment.Interest,
+			Amount:    installment.Amount,
+		})
+	}
+
+	// nothing accrues once every installment is due
+	period_start := as_of
+	period_end := as_of
+	if next != nil {
+		period_start = loan.CreatedAt
+		if next.Number > 1 {
+			period_start = amortization.DueDate(loan.FirstDueDate, next.Number-1)
+		}
+		period_end = next.DueDate
+	}
+
+	return amortization.Payoff(
+		loan.OutstandingPrincipal,
+		loan.AnnualRate,
+		overdue,
+		late_fees,
+		period_start,
+		period_end,
+		as_of,
+		model.CurrencyMinorUnits[loan.Currency],
+	), nil
+}
+
+// QuoteLoanPayoff quotes what pays the loan off on the as_of day
+func (lr *LoanRepository) QuoteLoanPayoff(loan *model.Loan, as_of time.Time) (amortization.Quote, error) {
+	return loanPayoffQuote(lr.Pg, loan, as_of)
+}
+
+// PayOffLoan repays the whole loan today from its repayment account, settling every unpaid installment.
+// The quote is made again under the loan lock so a collection made meanwhile is accounted for.
+func (lr *LoanRepository) PayOffLoan(loan_id string, transaction_id uuid.UUID) (*amortization.Quote, error) {
+	tx, err := lr.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	loan, err := lockLoan(tx, loan_id)
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := loanPayoffQuote(tx, loan, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertLoanPayment(tx, transaction_id, loan.RepaymentAccountId.String(), loan.Currency, quote.Principal, quote.Interest, quote.LateFees)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "loan_installment" SET status = 'prepaid', transaction_id = $2, paid_at = NOW(), next_attempt_at = NULL
+		WHERE loan_id = $1 AND status IN ('scheduled', 'late')`,
+		loan_id,
+		transaction_id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "loan" SET outstanding_principal = 0, status = 'paid_off', paid_off_at = NOW() WHERE id = $1`,
+		loan_id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quote, tx.Commit()
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"welloff-bank/model"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type NotificationRepository struct {
+	Pg *sqlx.DB
+}
+
+func (nr *NotificationRepository) CreateNotification(user_id string, kind string, message string) error {
+	_, err := nr.Pg.Exec(
+		`INSERT INTO "notification" (user_id, kind, message) VALUES ($1, $2, $3)`,
+		user_id,
+		kind,
+		message,
+	)
+
+	return err
+}
+
+// GetNotifications lists the notifications of the user, newest first
+func (nr *NotificationRepository) GetNotifications(user_id string, unread bool, limit int, offset int) (*[]model.Notification, error) {
+	notifications := new([]model.Notification)
+	err := nr.Pg.Select(
+		notifications,
+		`SELECT n.id, n.user_id, n.kind, n.message, n.created_at, n.read_at
+		FROM "notification" n
+		WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		ORDER BY n.created_at DESC
+		LIMIT $3 OFFSET $4`,
+		user_id,
+		unread,
+		limit,
+		offset,
+	)
+
+	return notifications, err
+}
+
+// MarkNotificationRead returns whether the user had such a notification
+func (nr *NotificationRepository) MarkNotificationRead(notification_id string, user_id string) (bool, error) {
+	result, err := nr.Pg.Exec(
+		`UPDATE "notification" SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`,
+		notification_id,
+		user_id,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows == 1, err
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+	"welloff-bank/interest"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+type OverdraftRepository struct {
+	Pg *sqlx.DB
+}
+
+const overdraftFacilityColumns = `od.account_id, od.overdraft_limit, od.annual_rate, od.granted_by, od.created_at, od.updated_at`
+
+// SetOverdraftFacility grants an overdraft to the account or changes the one it has
+func (odr *OverdraftRepository) SetOverdraftFacility(account_id string, overdraft_limit decimal.Decimal, annual_rate decimal.Decimal, granted_by uuid.UUID) error {
+	_, err := odr.Pg.Exec(
+		`INSERT INTO "overdraft_facility" (account_id, overdraft_limit, annual_rate, granted_by) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id) DO UPDATE SET
+			overdraft_limit = EXCLUDED.overdraft_limit,
+			annual_rate = EXCLUDED.annual_rate,
+			granted_by = EXCLUDED.granted_by,
+			updated_at = NOW()`,
+		account_id,
+		overdraft_limit,
+		annual_rate,
+		granted_by,
+	)
+
+	return err
+}
+
+func (odr *OverdraftRepository) GetOverdraftFacility(account_id string) (*model.OverdraftFacility, error) {
+	facility := new(model.OverdraftFacility)
+	err := odr.Pg.Get(
+		facility,
+		`SELECT `+overdraftFacilityColumns+` FROM "overdraft_facility" od WHERE od.account_id = $1`,
+		account_id,
+	)
+
+	return facility, err
+}
+
+func (odr *OverdraftRepository) GetOverdraftFacilities(limit int, offset int) (*[]model.OverdraftFacility, error) {
+	facilities := new([]model.OverdraftFacility)
+	err := odr.Pg.Select(
+		facilities,
+		`SELECT `+overdraftFacilityColumns+` FROM "overdraft_facility" od
+		ORDER BY od.account_id
+		LIMIT $1 OFFSET $2`,
+		limit,
+		offset,
+	)
+
+	return facilities, err
+}
+
+// GetLastOverdraftInterestDate returns the last day the account was charged for, nil when it never was
+func (odr *OverdraftRepository) GetLastOverdraftInterestDate(account_id string) (*time.Time, error) {
+	var date *time.Time
+	err := odr.Pg.Get(&date, `SELECT MAX(oi.charge_date) FROM "overdraft_interest" oi WHERE oi.account_id = $1`, account_id)
+
+	return date, err
+}
+
+// ChargeOverdraftInterest charges the interest of a day on the end-of-day balance, once per day.
+// What is owed is charged in whole minor units and the rest carried to the next days. The interest is
+// charged even past the overdraft limit. Returns nil when the day was already charged.
+func (odr *OverdraftRepository) ChargeOverdraftInterest(account *model.Account, charge_date time.Time, balance decimal.Decimal, annual_rate decimal.Decimal) (*model.OverdraftInterest, error) {
+	tx, err := odr.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	account_id := account.Id.String()
+
+	// serializes the charges of the account so the carry is read once per day
+	err = lockAccount(tx, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	var carry decimal.Decimal
+	err = tx.Get(&carry, `SELECT COALESCE(SUM(oi.accrued - oi.amount), 0) FROM "overdraft_interest" oi WHERE oi.account_id = $1`, account_id)
+	if err != nil {
+		return nil, err
+	}
+
+	accrued := interest.OverdraftAccrual(balance, annual_rate)
+	charge := model.OverdraftInterest{
+		AccountId:  account.Id,
+		ChargeDate: charge_date,
+		Balance:    balance,
+		AnnualRate: annual_rate,
+		Accrued:    accrued,
+		Amount:     interest.Charge(carry, accrued, model.CurrencyMinorUnits[account.Currency]),
+	}
+
+	if charge.Amount.IsPositive() {
+		transaction_id, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+
+		err = journalTransaction(tx, transaction_id, "overdraft_interest", &account_id, nil, account_id, model.InterestIncomeAccountId.String(), charge.Amount, account.Currency, nil, "posted")
+		if err != nil {
+			return nil, err
+		}
+
+		charge.TransactionId = &transaction_id
+	}
+
+	err = tx.Get(
+		&charge.CreatedAt,
+		`INSERT INTO "overdraft_interest" (account_id, charge_date, balance, annual_rate, accrued, amount, transaction_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (account_id, charge_date) DO NOTHING
+		RETURNING created_at`,
+		charge.AccountId,
+		charge.ChargeDate,
+		charge.Balance,
+		charge.AnnualRate,
+		charge.Accrued,
+		charge.Amount,
+		charge.TransactionId,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		// charged meanwhile, the transaction is rolled back with the rest
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &charge, tx.Commit()
+}
+
+// GetOverdraftInterest lists the daily overdraft interest of the account, newest first
+func (odr *OverdraftRepository) GetOverdraftInterest(account_id string, limit int, offset int) (*[]model.OverdraftInterest, error) {
+	charges := new([]model.OverdraftInterest)
+	err := odr.Pg.Select(
+		charges,
+		`SELECT oi.account_id, oi.charge_date, oi.balance, oi.annual_rate, oi.accrued, oi.amount, oi.transaction_id, oi.created_at
+		FROM "overdraft_interest" oi
+		WHERE oi.account_id = $1
+		ORDER BY oi.charge_date DESC
+		LIMIT $2 OFFSET $3`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return charges, err
+}
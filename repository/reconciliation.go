@@ -0,0 +1,470 @@
+package repository
+
+import (
+	"errors"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+var ErrReconciliationItemNotOpen = errors.New("reconciliation item is already resolved")
+var ErrAlreadyReconciled = errors.New("statement line or transaction is already reconciled")
+var ErrReconciliationAmountMismatch = errors.New("statement line and transaction amounts differ")
+
+type ReconciliationRepository struct {
+	Pg *sqlx.DB
+}
+
+const statementLineColumns = `sl.id, sl.import_id, sl.line_number, sl.booked_on, sl.amount, sl.currency, sl.reference, sl.description, sl.status, sl.transaction_id, sl.created_at`
+
+const reconciliationItemColumns = `ri.id, ri.import_id, ri.statement_line_id, ri.transaction_id, ri.status, ri.adjustment_transaction_id, ri.note, ri.resolved_by, ri.created_at, ri.resolved_at`
+
+// GetReconciliationCandidates lists the posted deposits and withdrawals issued between date_from and date_to
+// that were neither matched with a statement line nor resolved in the reconciliation queue
+func (rr *ReconciliationRepository) GetReconciliationCandidates(currency string, date_from time.Time, date_to time.Time) (*[]model.Transaction, error) {
+	transactions := new([]model.Transaction)
+	err := rr.Pg.Select(
+		transactions,
+		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM "transaction" tx
+		WHERE tx.kind IN ('deposit', 'withdrawal') AND tx.status = 'posted' AND tx.currency = $1
+			AND tx.date_issued >= $2 AND tx.date_issued < $3
+			AND NOT EXISTS (SELECT 1 FROM "statement_line" sl WHERE sl.transaction_id = tx.id)
+			AND NOT EXISTS (SELECT 1 FROM "reconciliation_item" ri WHERE ri.transaction_id = tx.id AND ri.status <> 'open')
+		ORDER BY tx.date_issued`,
+		currency,
+		date_from,
+		date_to,
+	)
+
+	return transactions, err
+}
+
+// CreateReconciliationImport stores the lines of an import, queueing the unmatched ones along with the unmatched
+// transactions. Transactions left in the queue by an earlier import are taken out of it when they match now.
+func (rr *ReconciliationRepository) CreateReconciliationImport(reconciliation_import *model.ReconciliationImport, lines []model.StatementLine, unmatched_transaction_ids []uuid.UUID) error {
+	tx, err := rr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO "reconciliation_import" (id, user_id, file_name, currency, date_from, date_to, line_count, matched_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		reconciliation_import.Id,
+		reconciliation_import.UserId,
+		reconciliation_import.FileName,
+		reconciliation_import.Currency,
+		reconciliation_import.DateFrom,
+		reconciliation_import.DateTo,
+		reconciliation_import.LineCount,
+		reconciliation_import.MatchedCount,
+	)
+	if err != nil {
+		return err
+	}
+
+	matched_transaction_ids := []uuid.UUID{}
+	for _, line := range lines {
+		_, err = tx.Exec(
+			`INSERT INTO "statement_line" (id, import_id, line_number, booked_on, amount, currency, reference, description, status, transaction_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			line.Id,
+			reconciliation_import.Id,
+			line.LineNumber,
+			line.BookedOn,
+			line.Amount,
+			line.Currency,
+			line.Reference,
+			line.Description,
+			line.Status,
+			line.TransactionId,
+		)
+		if err != nil {
+			return err
+		}
+
+		if line.TransactionId != nil {
+			matched_transaction_ids = append(matched_transaction_ids, *line.TransactionId)
+			continue
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO "reconciliation_item" (import_id, statement_line_id) VALUES ($1, $2)`,
+			reconciliation_import.Id,
+			line.Id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "reconciliation_item" SET status = 'matched', resolved_at = NOW()
+		WHERE transaction_id = ANY($1) AND status = 'open'`,
+		pq.Array(matched_transaction_ids),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, transaction_id := range unmatched_transaction_ids {
+		_, err = tx.Exec(
+			`INSERT INTO "reconciliation_item" (import_id, transaction_id) VALUES ($1, $2)
+			ON CONFLICT (transaction_id) DO NOTHING`,
+			reconciliation_import.Id,
+			transaction_id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (rr *ReconciliationRepository) GetReconciliationImport(import_id string) (*model.ReconciliationImport, error) {
+	reconciliation_import := new(model.ReconciliationImport)
+	err := rr.Pg.Get(
+		reconciliation_import,
+		`SELECT ri.id, ri.user_id, ri.file_name, ri.currency, ri.date_from, ri.date_to, ri.line_count, ri.matched_count, ri.created_at
+		FROM "reconciliation_import" ri WHERE ri.id = $1`,
+		import_id,
+	)
+
+	return reconciliation_import, err
+}
+
+func (rr *ReconciliationRepository) GetStatementLines(import_id string) (*[]model.StatementLine, error) {
+	lines := new([]model.StatementLine)
+	err := rr.Pg.Select(
+		lines,
+		`SELECT `+statementLineColumns+` FROM "statement_line" sl WHERE sl.import_id = $1 ORDER BY sl.line_number`,
+		import_id,
+	)
+
+	return lines, err
+}
+
+// loadItemSides fills the statement line or the transaction of each item
+func (rr *ReconciliationRepository) loadItemSides(items []model.ReconciliationItem) error {
+	line_ids := []uuid.UUID{}
+	transaction_ids := []uuid.UUID{}
+	for _, item := range items {
+		if item.StatementLineId != nil {
+			line_ids = append(line_ids, *item.StatementLineId)
+		}
+		if item.TransactionId != nil {
+			transaction_ids = append(transaction_ids, *item.TransactionId)
+		}
+	}
+
+	lines := []model.StatementLine{}
+	err := rr.Pg.Select(&lines, `SELECT `+statementLineColumns+` FROM "statement_line" sl WHERE sl.id = ANY($1)`, pq.Array(line_ids))
+	if err != nil {
+		return err
+	}
+
+	transactions := []model.Transaction{}
+	err = rr.Pg.Select(
+		&transactions,
+		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM "transaction" tx WHERE tx.id = ANY($1)`,
+		pq.Array(transaction_ids),
+	)
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		for j := range lines {
+			if items[i].StatementLineId != nil && *items[i].StatementLineId == lines[j].Id {
+				items[i].StatementLine = &lines[j]
+			}
+		}
+		for j := range transactions {
+			if items[i].TransactionId != nil && *items[i].TransactionId == transactions[j].Id {
+				items[i].Transaction = &transactions[j]
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetReconciliationItems lists the queue oldest first, with the statement line or transaction of each item
+func (rr *ReconciliationRepository) GetReconciliationItems(status string, limit int, offset int) (*[]model.ReconciliationItem, error) {
+	items := new([]model.ReconciliationItem)
+	err := rr.Pg.Select(
+		items,
+		`SELECT `+reconciliationItemColumns+` FROM "reconciliation_item" ri
+		WHERE ri.status = $1
+		ORDER BY ri.created_at, ri.id
+		LIMIT $2 OFFSET $3`,
+		status,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, rr.loadItemSides(*items)
+}
+
+func (rr *ReconciliationRepository) GetReconciliationItem(item_id string) (*model.ReconciliationItem, error) {
+	item := new(model.ReconciliationItem)
+	err := rr.Pg.Get(item, `SELECT `+reconciliationItemColumns+` FROM "reconciliation_item" ri WHERE ri.id = $1`, item_id)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []model.ReconciliationItem{*item}
+	err = rr.loadItemSides(items)
+
+	return &items[0], err
+}
+
+// lockOpenItem locks the item until tx ends, failing when it was already resolved
+func lockOpenItem(tx *sqlx.Tx, item_id string) (*model.ReconciliationItem, error) {
+	item := new(model.ReconciliationItem)
+	err := tx.Get(item, `SELECT `+reconciliationItemColumns+` FROM "reconciliation_item" ri WHERE ri.id = $1 FOR UPDATE`, item_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Status != "open" {
+		return nil, ErrReconciliationItemNotOpen
+	}
+
+	return item, nil
+}
+
+func resolveItem(tx *sqlx.Tx, item_id uuid.UUID, status string, adjustment_transaction_id *uuid.UUID, note string, user_id uuid.UUID) error {
+	_, err := tx.Exec(
+		`UPDATE "reconciliation_item"
+		SET status = $2, adjustment_transaction_id = $3, note = $4, resolved_by = $5, resolved_at = NOW()
+		WHERE id = $1`,
+		item_id,
+		status,
+		adjustment_transaction_id,
+		note,
+		user_id,
+	)
+
+	return err
+}
+
+// MatchReconciliationItem matches the statement line and the transaction by hand, one of them being the side
+// of the open item. Both must be unreconciled and have the same signed amount. The other side is taken out
+// of the queue too when it was waiting there.
+func (rr *ReconciliationRepository) MatchReconciliationItem(item_id string, statement_line_id uuid.UUID, transaction_id uuid.UUID, note string, user_id uuid.UUID) error {
+	tx, err := rr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	item, err := lockOpenItem(tx, item_id)
+	if err != nil {
+		return err
+	}
+
+	line := new(model.StatementLine)
+	err = tx.Get(line, `SELECT `+statementLineColumns+` FROM "statement_line" sl WHERE sl.id = $1 FOR UPDATE`, statement_line_id)
+	if err != nil {
+		return err
+	}
+
+	if line.Status != "unmatched" {
+		return ErrAlreadyReconciled
+	}
+
+	transaction := new(model.Transaction)
+	err = tx.Get(
+		transaction,
+		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM "transaction" tx WHERE tx.id = $1`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	var reconciled bool
+	err = tx.Get(
+		&reconciled,
+		`SELECT EXISTS (SELECT 1 FROM "statement_line" sl WHERE sl.transaction_id = $1)
+			OR EXISTS (SELECT 1 FROM "reconciliation_item" ri WHERE ri.transaction_id = $1 AND ri.status <> 'open')`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if reconciled {
+		return ErrAlreadyReconciled
+	}
+
+	signed_amount := transaction.Amount
+	if transaction.Kind == "withdrawal" {
+		signed_amount = signed_amount.Neg()
+	}
+
+	if (transaction.Kind != "deposit" && transaction.Kind != "withdrawal") || transaction.Currency != line.Currency || !signed_amount.Equal(line.Amount) {
+		return ErrReconciliationAmountMismatch
+	}
+
+	_, err = tx.Exec(`UPDATE "statement_line" SET status = 'matched', transaction_id = $2 WHERE id = $1`, line.Id, transaction.Id)
+	if err != nil {
+		return err
+	}
+
+	err = resolveItem(tx, item.Id, "matched", nil, note, user_id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "reconciliation_item" SET status = 'matched', note = $3, resolved_by = $4, resolved_at = NOW()
+		WHERE (statement_line_id = $1 OR transaction_id = $2) AND status = 'open'`,
+		line.Id,
+		transaction.Id,
+		note,
+		user_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AdjustReconciliationItem books the difference the item stands for against the suspense account: money the
+// partner bank moved without a transaction in the ledger, or a transaction the partner bank never saw
+func (rr *ReconciliationRepository) AdjustReconciliationItem(item_id string, adjustment_transaction_id uuid.UUID, note string, user_id uuid.UUID) error {
+	tx, err := rr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	item, err := lockOpenItem(tx, item_id)
+	if err != nil {
+		return err
+	}
+
+	var debit_account_id, credit_account_id uuid.UUID
+	var amount decimal.Decimal
+	var currency string
+	var related_transaction_id *uuid.UUID
+
+	if item.StatementLineId != nil {
+		line := new(model.StatementLine)
+		err = tx.Get(line, `SELECT `+statementLineColumns+` FROM "statement_line" sl WHERE sl.id = $1 FOR UPDATE`, item.StatementLineId)
+		if err != nil {
+			return err
+		}
+
+		amount = line.Amount.Abs()
+		currency = line.Currency
+		if line.Amount.IsPositive() {
+			debit_account_id, credit_account_id = model.CashInAccountId, model.SuspenseAccountId
+		} else {
+			debit_account_id, credit_account_id = model.SuspenseAccountId, model.CashOutAccountId
+		}
+
+		_, err = tx.Exec(`UPDATE "statement_line" SET status = 'adjusted' WHERE id = $1`, line.Id)
+		if err != nil {
+			return err
+		}
+	} else {
+		transaction := new(model.Transaction)
+		err = tx.Get(
+			transaction,
+			`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+			FROM "transaction" tx WHERE tx.id = $1`,
+			item.TransactionId,
+		)
+		if err != nil {
+			return err
+		}
+
+		// undoes the cash side of the transaction, the customer side stays booked
+		amount = transaction.Amount
+		currency = transaction.Currency
+		related_transaction_id = &transaction.Id
+		if transaction.Kind == "deposit" {
+			debit_account_id, credit_account_id = model.SuspenseAccountId, model.CashInAccountId
+		} else {
+			debit_account_id, credit_account_id = model.CashOutAccountId, model.SuspenseAccountId
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "transaction" (id, kind, from_account_id, to_account_id, amount, currency, related_transaction_id, status, posted_at)
+		VALUES ($1, 'adjustment', $2, $3, $4, $5, $6, 'posted', NOW())`,
+		adjustment_transaction_id,
+		debit_account_id,
+		credit_account_id,
+		amount,
+		currency,
+		related_transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "journal_entry" (transaction_id, account_id, direction, amount, currency, posted_at)
+		VALUES ($1, $2, 'debit', $4, $5, NOW()), ($1, $3, 'credit', $4, $5, NOW())`,
+		adjustment_transaction_id,
+		debit_account_id,
+		credit_account_id,
+		amount,
+		currency,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = resolveItem(tx, item.Id, "adjusted", &adjustment_transaction_id, note, user_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DismissReconciliationItem takes the item out of the queue without touching the ledger
+func (rr *ReconciliationRepository) DismissReconciliationItem(item_id string, note string, user_id uuid.UUID) error {
+	tx, err := rr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	item, err := lockOpenItem(tx, item_id)
+	if err != nil {
+		return err
+	}
+
+	if item.StatementLineId != nil {
+		_, err = tx.Exec(`UPDATE "statement_line" SET status = 'dismissed' WHERE id = $1`, item.StatementLineId)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = resolveItem(tx, item.Id, "dismissed", nil, note, user_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
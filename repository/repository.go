@@ -12,11 +12,26 @@ import (
 )
 
 type Repositories struct {
-	Pg                    *sqlx.DB
-	Valkey                valkey.Client
-	UserRepository        UserRepository
-	AccountRepository     AccountRepository
-	TransactionRepository TransactionRepository
+	Pg                          *sqlx.DB
+	Valkey                      valkey.Client
+	UserRepository              UserRepository
+	AccountRepository           AccountRepository
+	TransactionRepository       TransactionRepository
+	IdempotencyKeyRepository    IdempotencyKeyRepository
+	HoldRepository              HoldRepository
+	FxRateRepository            FxRateRepository
+	AchRepository               AchRepository
+	ReconciliationRepository    ReconciliationRepository
+	ScheduledTransferRepository ScheduledTransferRepository
+	NotificationRepository      NotificationRepository
+	TransactionBatchRepository  TransactionBatchRepository
+	InterestRepository          InterestRepository
+	FeeRepository               FeeRepository
+	OverdraftRepository         OverdraftRepository
+	LoanRepository              LoanRepository
+	LimitRepository             LimitRepository
+	FraudRepository             FraudRepository
+	ReviewRepository            ReviewRepository
 }
 
 func New() Repositories {
@@ -59,10 +74,25 @@ func New() Repositories {
 	log.Println("Connected to Valkey")
 
 	return Repositories{
-		Pg:                    pg,
-		Valkey:                valkey,
-		UserRepository:        UserRepository{pg},
-		AccountRepository:     AccountRepository{pg},
-		TransactionRepository: TransactionRepository{pg},
+		Pg:                          pg,
+		Valkey:                      valkey,
+		UserRepository:              UserRepository{pg},
+		AccountRepository:           AccountRepository{pg},
+		TransactionRepository:       TransactionRepository{pg},
+		IdempotencyKeyRepository:    IdempotencyKeyRepository{pg},
+		HoldRepository:              HoldRepository{pg},
+		FxRateRepository:            FxRateRepository{pg},
+		AchRepository:               AchRepository{pg},
+		ReconciliationRepository:    ReconciliationRepository{pg},
+		ScheduledTransferRepository: ScheduledTransferRepository{pg},
+		NotificationRepository:      NotificationRepository{pg},
+		TransactionBatchRepository:  TransactionBatchRepository{pg},
+		InterestRepository:          InterestRepository{pg},
+		FeeRepository:               FeeRepository{pg},
+		OverdraftRepository:         OverdraftRepository{pg},
+		LoanRepository:              LoanRepository{pg},
+		LimitRepository:             LimitRepository{pg},
+		FraudRepository:             FraudRepository{pg},
+		ReviewRepository:            ReviewRepository{pg},
 	}
 }
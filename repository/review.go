@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+var ErrReviewNotPending = errors.New("transaction review is already decided")
+
+type ReviewRepository struct {
+	Pg *sqlx.DB
+}
+
+const transactionReviewColumns = `rv.id, rv.transaction_id, rv.batch_id, rv.user_id, rv.account_id, rv.transaction_kind, rv.amount, rv.currency, rv.reasons, rv.status, rv.decision_reason, rv.decided_by, rv.created_at, rv.decided_at`
+
+func (rvr *ReviewRepository) CreateTransactionReview(review *model.TransactionReview) error {
+	return rvr.Pg.Get(
+		review,
+		`INSERT INTO "transaction_review" AS rv (transaction_id, batch_id, user_id, account_id, transaction_kind, amount, currency, reasons)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+transactionReviewColumns,
+		review.TransactionId,
+		review.BatchId,
+		review.UserId,
+		review.AccountId,
+		review.TransactionKind,
+		review.Amount,
+		review.Currency,
+		review.Reasons,
+	)
+}
+
+// GetTransactionReviews lists the reviews with the status, oldest first so the queue is worked in order
+func (rvr *ReviewRepository) GetTransactionReviews(status string, limit int, offset int) (*[]model.TransactionReview, error) {
+	reviews := new([]model.TransactionReview)
+	err := rvr.Pg.Select(
+		reviews,
+		`SELECT `+transactionReviewColumns+` FROM "transaction_review" rv
+		WHERE rv.status = $1
+		ORDER BY rv.created_at, rv.id
+		LIMIT $2 OFFSET $3`,
+		status,
+		limit,
+		offset,
+	)
+
+	return reviews, err
+}
+
+func (rvr *ReviewRepository) GetTransactionReview(review_id string) (*model.TransactionReview, error) {
+	review := new(model.TransactionReview)
+	err := rvr.Pg.Get(review, `SELECT `+transactionReviewColumns+` FROM "transaction_review" rv WHERE rv.id = $1`, review_id)
+
+	return review, err
+}
+
+// GetTransactionReviewByTransaction returns the review of the transaction, or of the batch it is a leg of,
+// nil when it was never held
+func (rvr *ReviewRepository) GetTransactionReviewByTransaction(transaction_id string) (*model.TransactionReview, error) {
+	reviews := []model.TransactionReview{}
+	err := rvr.Pg.Select(
+		&reviews,
+		`SELECT `+transactionReviewColumns+` FROM "transaction_review" rv
+		WHERE rv.transaction_id = $1 OR rv.batch_id = (SELECT tx.batch_id FROM "transaction" tx WHERE tx.id = $1)`,
+		transaction_id,
+	)
+	if err != nil || len(reviews) == 0 {
+		return nil, err
+	}
+
+	return &reviews[0], nil
+}
+
+// GetTransactionReviewsByAccount lists the reviews of the transactions made from the account, newest first
+func (rvr *ReviewRepository) GetTransactionReviewsByAccount(account_id string, limit int, offset int) (*[]model.TransactionReview, error) {
+	reviews := new([]model.TransactionReview)
+	err := rvr.Pg.Select(
+		reviews,
+		`SELECT `+transactionReviewColumns+` FROM "transaction_review" rv
+		WHERE rv.account_id = $1
+		ORDER BY rv.created_at DESC, rv.id DESC
+		LIMIT $2 OFFSET $3`,
+		account_id,
+		limit,
+		offset,
+	)
+
+	return reviews, err
+}
+
+// lockPendingReview locks the review until tx ends, failing when it was already decided
+func lockPendingReview(tx *sqlx.Tx, review_id string) (*model.TransactionReview, error) {
+	review := new(model.TransactionReview)
+	err := tx.Get(review, `SELECT `+transactionReviewColumns+` FROM "transaction_review" rv WHERE rv.id = $1 FOR UPDATE`, review_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if review.Status != "pending" {
+		return nil, ErrReviewNotPending
+	}
+
+	return review, nil
+}
+
+// heldTransactionIds lists the pending transactions held with the review, the transaction or the legs of the batch
+func heldTransactionIds(tx *sqlx.Tx, transaction_id *uuid.UUID, batch_id *uuid.UUID) ([]string, error) {
+	transaction_ids := []string{}
+	err := tx.Select(
+		&transaction_ids,
+		`SELECT tx.id FROM "transaction" tx
+		WHERE (tx.id = $1 OR tx.batch_id = $2) AND tx.status = 'pending'
+		ORDER BY tx.id`,
+		transaction_id,
+		batch_id,
+	)
+
+	return transaction_ids, err
+}
+
+// failHeldTransactions fails the pending transactions held with a review as part of tx and gives their fees back
+func failHeldTransactions(tx *sqlx.Tx, transaction_id *uuid.UUID, batch_id *uuid.UUID) error {
+	transaction_ids, err := heldTransactionIds(tx, transaction_id, batch_id)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range transaction_ids {
+		err = failTransaction(tx, id)
+		if err != nil {
+			return err
+		}
+
+		// queued ACH entries of failed withdrawals are never batched
+		err = reverseFees(tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// settleHeldScheduledTransfers moves the scheduled transfer executions held with the transactions to the status
+// the review decided as part of tx, the user is notified of the ones that failed
+func settleHeldScheduledTransfers(tx *sqlx.Tx, transaction_ids []string, status string) error {
+	error_message := ""
+	if status == "failed" {
+		error_message = "Rejected in review"
+	}
+
+	failed := []struct {
+		UserId       uuid.UUID       `db:"user_id"`
+		Amount       decimal.Decimal `db:"amount"`
+		ToAccountId  uuid.UUID       `db:"to_account_id"`
+		ScheduledFor time.Time       `db:"scheduled_for"`
+	}{}
+	err := tx.Select(
+		&failed,
+		`UPDATE "scheduled_transfer_execution" ste
+		SET status = $2, error = $3
+		FROM "scheduled_transfer" st
+		WHERE ste.transaction_id = ANY($1) AND ste.status = 'held' AND st.id = ste.scheduled_transfer_id
+		RETURNING st.user_id, st.amount, st.to_account_id, ste.scheduled_for`,
+		pq.Array(transaction_ids),
+		status,
+		error_message,
+	)
+	if err != nil || status != "failed" {
+		return err
+	}
+
+	for _, execution := range failed {
+		message := fmt.Sprintf(
+			"Your scheduled transfer of %s to account %s due on %s failed: %s.",
+			execution.Amount,
+			execution.ToAccountId,
+			execution.ScheduledFor.Format("2006-01-02"),
+			error_message,
+		)
+
+		_, err = tx.Exec(
+			`INSERT INTO "notification" (user_id, kind, message) VALUES ($1, 'scheduled_transfer_failed', $2)`,
+			execution.UserId,
+			message,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decideReview(tx *sqlx.Tx, review *model.TransactionReview, status string, reason string, user_id uuid.UUID) error {
+	return tx.Get(
+		review,
+		`UPDATE "transaction_review" rv
+		SET status = $2, decision_reason = $3, decided_by = $4, decided_at = NOW()
+		WHERE rv.id = $1
+		RETURNING `+transactionReviewColumns,
+		review.Id,
+		status,
+		reason,
+		user_id,
+	)
+}
+
+// ApproveTransactionReview posts the transactions held with the review and takes it out of the queue
+func (rvr *ReviewRepository) ApproveTransactionReview(review_id string, reason string, user_id uuid.UUID) (*model.TransactionReview, error) {
+	tx, err := rvr.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	review, err := lockPendingReview(tx, review_id)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction_ids, err := heldTransactionIds(tx, review.TransactionId, review.BatchId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range transaction_ids {
+		err = postTransaction(tx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = settleHeldScheduledTransfers(tx, transaction_ids, "succeeded")
+	if err != nil {
+		return nil, err
+	}
+
+	err = decideReview(tx, review, "approved", reason, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, tx.Commit()
+}
+
+// RejectTransactionReview fails the transactions held with the review, giving their fees back, and takes it out of the queue
+func (rvr *ReviewRepository) RejectTransactionReview(review_id string, reason string, user_id uuid.UUID) (*model.TransactionReview, error) {
+	tx, err := rvr.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	review, err := lockPendingReview(tx, review_id)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction_ids, err := heldTransactionIds(tx, review.TransactionId, review.BatchId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = failHeldTransactions(tx, review.TransactionId, review.BatchId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = settleHeldScheduledTransfers(tx, transaction_ids, "failed")
+	if err != nil {
+		return nil, err
+	}
+
+	err = decideReview(tx, review, "rejected", reason, user_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, tx.Commit()
+}
+
+// FailHeldTransactions fails a transaction, or the legs of a batch, made pending to be held when it could not
+// be put in the queue, so none is left pending without a review
+func (rvr *ReviewRepository) FailHeldTransactions(transaction_id *uuid.UUID, batch_id *uuid.UUID) error {
+	tx, err := rvr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = failHeldTransactions(tx, transaction_id, batch_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
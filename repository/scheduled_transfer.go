@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"errors"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var ErrInvalidScheduledTransferStatus = errors.New("invalid scheduled transfer status transition")
+var ErrScheduledTransferClaimed = errors.New("scheduled transfer occurrence is already claimed")
+var ErrScheduledTransferAlreadyRun = errors.New("scheduled transfer occurrence was already run")
+
+type ScheduledTransferRepository struct {
+	Pg *sqlx.DB
+}
+
+const scheduledTransferColumns = `st.id, st.user_id, st.from_account_id, st.to_account_id, st.amount, st.description, st.frequency, st.start_date, st.end_date, st.max_executions,
+	st.business_day_adjustment, st.status, st.occurrence, st.next_run_on, st.retry_count, st.retry_at, st.created_at, st.updated_at`
+
+const scheduledTransferExecutionColumns = `ste.id, ste.scheduled_transfer_id, ste.occurrence, ste.scheduled_for, ste.attempt, ste.status, ste.transaction_id, ste.error, ste.executed_at`
+
+func (sr *ScheduledTransferRepository) CreateScheduledTransfer(scheduled_transfer *model.ScheduledTransfer) error {
+	_, err := sr.Pg.Exec(
+		`INSERT INTO "scheduled_transfer" (id, user_id, from_account_id, to_account_id, amount, description, frequency, start_date, end_date, max_executions,
+			business_day_adjustment, occurrence, next_run_on)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		scheduled_transfer.Id,
+		scheduled_transfer.UserId,
+		scheduled_transfer.FromAccountId,
+		scheduled_transfer.ToAccountId,
+		scheduled_transfer.Amount,
+		scheduled_transfer.Description,
+		scheduled_transfer.Frequency,
+		scheduled_transfer.StartDate,
+		scheduled_transfer.EndDate,
+		scheduled_transfer.MaxExecutions,
+		scheduled_transfer.BusinessDayAdjustment,
+		scheduled_transfer.Occurrence,
+		scheduled_transfer.NextRunOn,
+	)
+
+	return err
+}
+
+func (sr *ScheduledTransferRepository) GetScheduledTransfer(scheduled_transfer_id string) (*model.ScheduledTransfer, error) {
+	scheduled_transfer := new(model.ScheduledTransfer)
+	err := sr.Pg.Get(
+		scheduled_transfer,
+		`SELECT `+scheduledTransferColumns+` FROM "scheduled_transfer" st WHERE st.id = $1`,
+		scheduled_transfer_id,
+	)
+
+	return scheduled_transfer, err
+}
+
+func (sr *ScheduledTransferRepository) GetScheduledTransfersByUser(user_id string, limit int, offset int) (*[]model.ScheduledTransfer, error) {
+	scheduled_transfers := new([]model.ScheduledTransfer)
+	err := sr.Pg.Select(
+		scheduled_transfers,
+		`SELECT `+scheduledTransferColumns+` FROM "scheduled_transfer" st
+		WHERE st.user_id = $1
+		ORDER BY st.created_at DESC
+		LIMIT $2 OFFSET $3`,
+		user_id,
+		limit,
+		offset,
+	)
+
+	return scheduled_transfers, err
+}
+
+// GetDueScheduledTransfers lists the active scheduled transfers with an occurrence to run by date,
+// leaving out the ones waiting to be retried
+func (sr *ScheduledTransferRepository) GetDueScheduledTransfers(date time.Time, limit int) (*[]model.ScheduledTransfer, error) {
+	scheduled_transfers := new([]model.ScheduledTransfer)
+	err := sr.Pg.Select(
+		scheduled_transfers,
+		`SELECT `+scheduledTransferColumns+` FROM "scheduled_transfer" st
+		WHERE st.status = 'active' AND st.next_run_on <= $1 AND (st.retry_at IS NULL OR st.retry_at <= NOW())
+		ORDER BY st.next_run_on, st.id
+		LIMIT $2`,
+		date,
+		limit,
+	)
+
+	return scheduled_transfers, err
+}
+
+func (sr *ScheduledTransferRepository) GetScheduledTransferExecutions(scheduled_transfer_id string) (*[]model.ScheduledTransferExecution, error) {
+	executions := new([]model.ScheduledTransferExecution)
+	err := sr.Pg.Select(
+		executions,
+		`SELECT `+scheduledTransferExecutionColumns+` FROM "scheduled_transfer_execution" ste
+		WHERE ste.scheduled_transfer_id = $1
+		ORDER BY ste.executed_at DESC`,
+		scheduled_transfer_id,
+	)
+
+	return executions, err
+}
+
+// ClaimScheduledTransferOccurrence takes the current occurrence of the scheduled transfer until lease_until, when it
+// is still active and due, and starts a running execution of it, so the occurrence is run by a single runner.
+// ErrScheduledTransferClaimed is returned when another runner has it or it changed meanwhile. When the occurrence
+// already succeeded or is held for review, or a previous run of it never finished, that execution is returned with
+// ErrScheduledTransferAlreadyRun, still claimed, since running it again could pay it twice.
+func (sr *ScheduledTransferRepository) ClaimScheduledTransferOccurrence(scheduled_transfer *model.ScheduledTransfer, lease_until time.Time) (*model.ScheduledTransferExecution, error) {
+	tx, err := sr.Pg.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE "scheduled_transfer"
+		SET retry_at = $4, updated_at = NOW()
+		WHERE id = $1 AND status = 'active' AND occurrence = $2 AND next_run_on = $3 AND (retry_at IS NULL OR retry_at <= NOW())`,
+		scheduled_transfer.Id,
+		scheduled_transfer.Occurrence,
+		scheduled_transfer.NextRunOn,
+		lease_until,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rows != 1 {
+		return nil, ErrScheduledTransferClaimed
+	}
+
+	executions := []model.ScheduledTransferExecution{}
+	err = tx.Select(
+		&executions,
+		`SELECT `+scheduledTransferExecutionColumns+` FROM "scheduled_transfer_execution" ste
+		WHERE ste.scheduled_transfer_id = $1 AND ste.occurrence = $2 AND ste.status IN ('running', 'succeeded', 'held')
+		ORDER BY ste.attempt DESC
+		LIMIT 1`,
+		scheduled_transfer.Id,
+		scheduled_transfer.Occurrence,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(executions) > 0 {
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		return &executions[0], ErrScheduledTransferAlreadyRun
+	}
+
+	execution := new(model.ScheduledTransferExecution)
+	err = tx.Get(
+		execution,
+		`INSERT INTO "scheduled_transfer_execution" AS ste (scheduled_transfer_id, occurrence, scheduled_for, attempt, status)
+		SELECT $1, $2, $3, COALESCE(MAX(prev.attempt), 0) + 1, 'running'
+		FROM "scheduled_transfer_execution" prev
+		WHERE prev.scheduled_transfer_id = $1 AND prev.occurrence = $2
+		RETURNING `+scheduledTransferExecutionColumns,
+		scheduled_transfer.Id,
+		scheduled_transfer.Occurrence,
+		scheduled_transfer.NextRunOn,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return execution, tx.Commit()
+}
+
+// RecordScheduledTransferExecution stores the outcome of a claimed execution and moves the scheduled transfer, from
+// the occurrence it was claimed at, to the state the execution left it in: the same occurrence to retry, the next
+// one, or completed. A scheduled transfer paused meanwhile keeps its status but still moves on, so the occurrence
+// is not run again once resumed. One cancelled meanwhile is left alone and ErrInvalidScheduledTransferStatus returned.
+func (sr *ScheduledTransferRepository) RecordScheduledTransferExecution(execution *model.ScheduledTransferExecution, scheduled_transfer *model.ScheduledTransfer, claimed_occurrence int) error {
+	tx, err := sr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`UPDATE "scheduled_transfer_execution" SET status = $2, transaction_id = $3, error = $4 WHERE id = $1`,
+		execution.Id,
+		execution.Status,
+		execution.TransactionId,
+		execution.Error,
+	)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		`UPDATE "scheduled_transfer"
+		SET 
+			status = CASE WHEN status = 'active' OR $2::text = 'completed' THEN $2::scheduled_transfer_status ELSE status END,
+			occurrence = $3, next_run_on = $4, retry_count = $5, retry_at = $6, updated_at = NOW()
+		WHERE id = $1 AND occurrence = $7 AND status IN ('active', 'paused')`,
+		scheduled_transfer.Id,
+		scheduled_transfer.Status,
+		scheduled_transfer.Occurrence,
+		scheduled_transfer.NextRunOn,
+		scheduled_transfer.RetryCount,
+		scheduled_transfer.RetryAt,
+		claimed_occurrence,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if rows != 1 {
+		return ErrInvalidScheduledTransferStatus
+	}
+
+	return nil
+}
+
+// UpdateScheduledTransferStatus moves the scheduled transfer from one of from_statuses to status, setting the
+// next occurrence to run. Pending retries are dropped.
+func (sr *ScheduledTransferRepository) UpdateScheduledTransferStatus(scheduled_transfer_id string, from_statuses []string, status string, occurrence int, next_run_on *time.Time) error {
+	result, err := sr.Pg.Exec(
+		`UPDATE "scheduled_transfer"
+		SET status = $2, occurrence = $3, next_run_on = $4, retry_count = 0, retry_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status::text = ANY($5)`,
+		scheduled_transfer_id,
+		status,
+		occurrence,
+		next_run_on,
+		pq.Array(from_statuses),
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows != 1 {
+		return ErrInvalidScheduledTransferStatus
+	}
+
+	return nil
+}
@@ -1,14 +1,58 @@
 package repository
 
 import (
+	"errors"
 	"time"
 	"welloff-bank/model"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/shopspring/decimal"
 )
 
+var ErrInsufficientBalance = errors.New("insufficient balance")
+var ErrInvalidTransactionStatus = errors.New("invalid transaction status transition")
+var ErrCurrencyMismatch = errors.New("accounts have different currencies")
+var ErrInvalidAmount = errors.New("amount has more decimal places than the currency allows")
+var ErrNotRefundable = errors.New("transaction cannot be refunded")
+var ErrRefundExceedsAmount = errors.New("refund exceeds the amount left to refund")
+
+// availableBalanceQuery sums the posted entries of an account minus the debits of its pending transactions
+// and the amounts reserved by its active holds
+const availableBalanceQuery = `
+	SELECT (
+		SELECT 
+			COALESCE(SUM(
+				CASE 
+					WHEN je.posted_at IS NOT NULL AND je.direction = 'credit' THEN je.amount
+					WHEN je.posted_at IS NOT NULL THEN -je.amount
+					WHEN tx.status = 'pending' AND je.direction = 'debit' THEN -je.amount
+					ELSE 0
+				END
+			), 0)
+		FROM 
+			"journal_entry" je 
+		INNER JOIN 
+			"transaction" tx ON tx.id = je.transaction_id
+		WHERE 
+			je.account_id = $1
+		AND 
+			je.currency = (SELECT acc.currency FROM "account" acc WHERE acc.id = $1)
+	) - (
+		SELECT 
+			COALESCE(SUM(h.amount), 0)
+		FROM 
+			"hold" h
+		WHERE 
+			h.account_id = $1
+		AND 
+			h.status = 'active'
+		AND 
+			h.expires_at > NOW()
+	)
+`
+
 type TransactionRepository struct {
 	Pg *sqlx.DB
 }
@@ -17,7 +61,7 @@ func (tr *TransactionRepository) GetTransaction(transaction_id string) (*model.T
 	transaction := new(model.Transaction)
 	err := tr.Pg.Get(
 		transaction,
-		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.date_issued, tx.related_transaction_id
+		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
 		FROM "transaction" tx WHERE tx.id = $1`,
 		transaction_id,
 	)
@@ -31,11 +75,11 @@ func (tr *TransactionRepository) GetTransactionsByAccount(account_id string, lim
 		transactions,
 		`
 		SELECT 
-			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.date_issued, tx.related_transaction_id
+			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
 		FROM 
 			"transaction" tx 
 		WHERE 
-			tx.from_account_id = $1
+			(tx.from_account_id = $1 OR tx.to_account_id = $1)
 		ORDER BY
 			tx.date_issued DESC
 		LIMIT 
@@ -51,13 +95,145 @@ func (tr *TransactionRepository) GetTransactionsByAccount(account_id string, lim
 	return transactions, err
 }
 
+type TransactionFilter struct {
+	Kind           *string
+	DateFrom       *time.Time
+	DateTo         *time.Time
+	MinAmount      *decimal.Decimal
+	MaxAmount      *decimal.Decimal
+	CounterpartyId *string
+	// id of the last transaction of the previous page
+	Cursor *string
+	Limit  int
+}
+
+// GetAccountHistory lists the transactions of an account, newest first, paginated by id since ids are UUIDv7.
+// The running balance of each posted transaction is the ledger balance right after it was booked, worked out
+// from the account's balance snapshot so only the movements between the snapshot and the transaction are summed.
+func (tr *TransactionRepository) GetAccountHistory(account_id string, filter TransactionFilter) (*[]model.AccountTransaction, error) {
+	transactions := new([]model.AccountTransaction)
+	err := tr.Pg.Select(
+		transactions,
+		`
+		WITH snapshot AS (
+			SELECT 
+				acc.currency,
+				COALESCE(bs.balance, 0) AS balance,
+				COALESCE(bs.updated_at, '-infinity') AS taken_at
+			FROM 
+				"account" acc
+			LEFT JOIN 
+				"balance_snapshot" bs ON bs.account_id = acc.id AND bs.currency = acc.currency
+			WHERE 
+				acc.id = $1
+		), page AS (
+			SELECT 
+				tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at,
+				m.signed_amount,
+				m.booked_at
+			FROM 
+				"transaction" tx
+			CROSS JOIN LATERAL (
+				SELECT 
+					SUM(CASE WHEN je.direction = 'credit' THEN je.amount ELSE -je.amount END) AS signed_amount,
+					MAX(je.posted_at) AS booked_at
+				FROM 
+					"journal_entry" je
+				WHERE 
+					je.transaction_id = tx.id
+				AND 
+					je.account_id = $1
+				AND 
+					je.currency = (SELECT sn.currency FROM snapshot sn)
+				GROUP BY 
+					je.transaction_id
+			) m
+			WHERE 
+				(tx.from_account_id = $1 OR tx.to_account_id = $1)
+			AND 
+				($2::text IS NULL OR tx.kind::text = $2)
+			AND 
+				($3::timestamptz IS NULL OR tx.date_issued >= $3)
+			AND 
+				($4::timestamptz IS NULL OR tx.date_issued <= $4)
+			AND 
+				($5::numeric IS NULL OR tx.amount >= $5)
+			AND 
+				($6::numeric IS NULL OR tx.amount <= $6)
+			AND 
+				($7::uuid IS NULL OR tx.from_account_id = $7 OR tx.to_account_id = $7)
+			AND 
+				($8::uuid IS NULL OR tx.id < $8)
+			ORDER BY
+				tx.id DESC
+			LIMIT 
+				$9
+		)
+		SELECT 
+			p.id, p.kind, p.from_account_id, p.to_account_id, p.amount, p.currency, p.date_issued, p.related_transaction_id, p.status, p.posted_at, p.failed_at, p.reversed_at,
+			p.signed_amount,
+			p.booked_at,
+			CASE 
+				WHEN p.status NOT IN ('posted', 'reversed') THEN NULL
+				-- booked after the snapshot: add the movements booked since the snapshot, up to this one
+				WHEN p.booked_at > sn.taken_at THEN sn.balance + (
+					SELECT 
+						COALESCE(SUM(CASE WHEN je.direction = 'credit' THEN je.amount ELSE -je.amount END), 0)
+					FROM 
+						"journal_entry" je
+					WHERE 
+						je.account_id = $1
+					AND 
+						je.currency = sn.currency
+					AND 
+						je.posted_at > sn.taken_at
+					AND 
+						(je.posted_at, je.transaction_id) <= (p.booked_at, p.id)
+				)
+				-- booked before the snapshot: take back the movements booked after this one, up to the snapshot
+				ELSE sn.balance - (
+					SELECT 
+						COALESCE(SUM(CASE WHEN je.direction = 'credit' THEN je.amount ELSE -je.amount END), 0)
+					FROM 
+						"journal_entry" je
+					WHERE 
+						je.account_id = $1
+					AND 
+						je.currency = sn.currency
+					AND 
+						je.posted_at <= sn.taken_at
+					AND 
+						(je.posted_at, je.transaction_id) > (p.booked_at, p.id)
+				)
+			END AS running_balance
+		FROM 
+			page p
+		CROSS JOIN 
+			snapshot sn
+		ORDER BY
+			p.id DESC
+		`,
+		account_id,
+		filter.Kind,
+		filter.DateFrom,
+		filter.DateTo,
+		filter.MinAmount,
+		filter.MaxAmount,
+		filter.CounterpartyId,
+		filter.Cursor,
+		filter.Limit,
+	)
+
+	return transactions, err
+}
+
 func (tr *TransactionRepository) GetAllTransactionsByAccount(account_id string) (*[]model.Transaction, error) {
 	transactions := new([]model.Transaction)
 	err := tr.Pg.Select(
 		transactions,
 		`
 		SELECT 
-			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.date_issued, tx.related_transaction_id
+			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
 		FROM 
 			"transaction" tx 
 		WHERE 
@@ -71,21 +247,32 @@ func (tr *TransactionRepository) GetAllTransactionsByAccount(account_id string)
 	return transactions, err
 }
 
-func (tr *TransactionRepository) GetTransactionsByDate(account_id string, date_from time.Time, date_to time.Time) (*[]model.Transaction, error) {
-	transactions := new([]model.Transaction)
+// GetTransactionsByDate lists the movements booked on an account between the dates, oldest first. A transaction
+// reversed in the period shows twice: once when it was posted and once, with the opposite sign, when it was reversed.
+func (tr *TransactionRepository) GetTransactionsByDate(account_id string, date_from time.Time, date_to time.Time) (*[]model.AccountTransaction, error) {
+	transactions := new([]model.AccountTransaction)
 	err := tr.Pg.Select(
 		transactions,
 		`
 		SELECT 
-			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.date_issued, tx.related_transaction_id
+			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at,
+			SUM(CASE WHEN je.direction = 'credit' THEN je.amount ELSE -je.amount END) AS signed_amount,
+			je.posted_at AS booked_at,
+			(tx.reversed_at IS NOT NULL AND je.posted_at = tx.reversed_at) AS reversal
 		FROM 
-			"transaction" tx 
+			"journal_entry" je
+		INNER JOIN 
+			"transaction" tx ON tx.id = je.transaction_id
 		WHERE 
-			(tx.from_account_id = $1 OR tx.to_account_id = $1)
+			je.account_id = $1
 		AND 
-			tx.date_issued BETWEEN $2 AND $3
+			je.currency = (SELECT acc.currency FROM "account" acc WHERE acc.id = $1)
+		AND 
+			je.posted_at BETWEEN $2 AND $3
+		GROUP BY
+			tx.id, je.posted_at
 		ORDER BY
-			tx.date_issued DESC
+			je.posted_at ASC, tx.id ASC
 		`,
 		account_id,
 		date_from,
@@ -95,17 +282,805 @@ func (tr *TransactionRepository) GetTransactionsByDate(account_id string, date_f
 	return transactions, err
 }
 
-func (tr *TransactionRepository) CreateTransaction(transaction_id uuid.UUID, kind string, from_account_id *string, to_account_id *string, amount decimal.Decimal, related_transaction_id *string) error {
-	_, err := tr.Pg.Exec(
-		`INSERT INTO "transaction" (id, kind, from_account_id, to_account_id, amount, related_transaction_id)
-		VALUES ($1, $2, $3, $4, $5, $6)`,
+// postings returns the account debited and the account credited by a transaction of the given kind
+func postings(kind string, from_account_id *string, to_account_id *string) (string, string, error) {
+	switch kind {
+	case "deposit":
+		if to_account_id == nil {
+			return "", "", errors.New("deposit without destination account")
+		}
+
+		return model.CashInAccountId.String(), *to_account_id, nil
+	case "withdrawal", "capture":
+		if from_account_id == nil {
+			return "", "", errors.New(kind + " without source account")
+		}
+
+		return *from_account_id, model.CashOutAccountId.String(), nil
+	case "transfer":
+		if from_account_id == nil || to_account_id == nil {
+			return "", "", errors.New("transfer without source or destination account")
+		}
+
+		return *from_account_id, *to_account_id, nil
+	case "fee":
+		if from_account_id == nil {
+			return "", "", errors.New("fee without source account")
+		}
+
+		return *from_account_id, model.FeeIncomeAccountId.String(), nil
+	case "loan_disbursement":
+		if to_account_id == nil {
+			return "", "", errors.New("loan disbursement without destination account")
+		}
+
+		return model.LoansReceivableAccountId.String(), *to_account_id, nil
+	case "overdraft_interest":
+		if from_account_id == nil {
+			return "", "", errors.New("overdraft interest without source account")
+		}
+
+		return *from_account_id, model.InterestIncomeAccountId.String(), nil
+	case "interest":
+		if to_account_id == nil {
+			return "", "", errors.New("interest without destination account")
+		}
+
+		return model.InterestExpenseAccountId.String(), *to_account_id, nil
+	case "refund":
+		// a refund moves the money back from the original destination to the original source
+		if from_account_id == nil || to_account_id == nil {
+			return "", "", errors.New("refund without source or destination account")
+		}
+
+		return *to_account_id, *from_account_id, nil
+	default:
+		return "", "", errors.New("unknown transaction kind")
+	}
+}
+
+// lockAccount locks the account row until tx ends, locking it again in the same tx is a no-op
+func lockAccount(tx *sqlx.Tx, account_id string) error {
+	var id uuid.UUID
+	return tx.Get(&id, `SELECT acc.id FROM "account" acc WHERE acc.id = $1 FOR UPDATE`, account_id)
+}
+
+// debitAccount locks the account row until tx ends and fails when its available balance plus its overdraft limit
+// cannot cover the amount, so concurrent debits of the same account are serialized and each one sees the previous ones.
+// The owner is notified when the debit takes the account into overdraft.
+// System accounts are not locked nor checked since their balances are expected to go negative.
+func debitAccount(tx *sqlx.Tx, account_id string, amount decimal.Decimal) error {
+	id, err := uuid.Parse(account_id)
+	if err != nil {
+		return err
+	}
+
+	if model.IsSystemAccount(id) {
+		return nil
+	}
+
+	err = lockAccount(tx, account_id)
+	if err != nil {
+		return err
+	}
+
+	var balance decimal.Decimal
+	err = tx.Get(&balance, availableBalanceQuery, account_id)
+	if err != nil {
+		return err
+	}
+
+	var overdraft_limit decimal.Decimal
+	err = tx.Get(
+		&overdraft_limit,
+		`SELECT COALESCE((SELECT od.overdraft_limit FROM "overdraft_facility" od WHERE od.account_id = $1), 0)`,
+		account_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	if balance.Add(overdraft_limit).LessThan(amount) {
+		return ErrInsufficientBalance
+	}
+
+	if !balance.IsNegative() && balance.LessThan(amount) {
+		_, err = tx.Exec(
+			`INSERT INTO "notification" (user_id, kind, message)
+			SELECT acc.user_id, 'overdraft_entered', 'Your account ' || acc.id::text || ' is overdrawn, its available balance is ' || $2::text || ' ' || acc.currency || '.'
+			FROM "account" acc WHERE acc.id = $1`,
+			account_id,
+			balance.Sub(amount).String(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transactionCurrency returns the currency shared by the non system accounts, failing when they differ
+func transactionCurrency(tx *sqlx.Tx, account_ids ...string) (string, error) {
+	currencies := []string{}
+	err := tx.Select(
+		&currencies,
+		`SELECT DISTINCT acc.currency FROM "account" acc WHERE acc.id = ANY($1) AND acc.currency <> $2`,
+		pq.Array(account_ids),
+		model.SystemCurrency,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if len(currencies) != 1 {
+		return "", ErrCurrencyMismatch
+	}
+
+	return currencies[0], nil
+}
+
+// CreateTransaction journals a 'pending' or 'posted' transaction, pending debits already reduce the available balance
+func (tr *TransactionRepository) CreateTransaction(transaction_id uuid.UUID, kind string, from_account_id *string, to_account_id *string, amount decimal.Decimal, related_transaction_id *string, status string) error {
+	tx, err := tr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertTransaction(tx, transaction_id, kind, from_account_id, to_account_id, amount, related_transaction_id, status)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateTransactionWithFee journals the transaction like CreateTransaction and posts its fee, when there is one,
+// in the same database transaction, so the account has to cover both or neither is made
+func (tr *TransactionRepository) CreateTransactionWithFee(transaction_id uuid.UUID, kind string, from_account_id *string, to_account_id *string, amount decimal.Decimal, status string, fee *model.Fee) error {
+	tx, err := tr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertTransaction(tx, transaction_id, kind, from_account_id, to_account_id, amount, nil, status)
+	if err != nil {
+		return err
+	}
+
+	err = insertFee(tx, fee, from_account_id, transaction_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertFee posts the fee of a transaction as part of tx, debiting the account that made it, a nil fee is a no-op
+func insertFee(tx *sqlx.Tx, fee *model.Fee, account_id *string, transaction_id uuid.UUID) error {
+	if fee == nil {
+		return nil
+	}
+
+	related_transaction_id := transaction_id.String()
+
+	return insertTransaction(tx, fee.TransactionId, "fee", account_id, nil, fee.Amount, &related_transaction_id, "posted")
+}
+
+// reverseFees reverses the posted fees of a transaction as part of tx, giving them back to the account
+func reverseFees(tx *sqlx.Tx, transaction_id string) error {
+	fee_ids := []string{}
+	err := tx.Select(
+		&fee_ids,
+		`SELECT tx.id FROM "transaction" tx WHERE tx.related_transaction_id = $1 AND tx.kind = 'fee' AND tx.status = 'posted'`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, fee_id := range fee_ids {
+		err = reverseTransaction(tx, fee_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertTransaction journals a transaction as part of tx, debiting the account with the same checks as CreateTransaction
+func insertTransaction(tx *sqlx.Tx, transaction_id uuid.UUID, kind string, from_account_id *string, to_account_id *string, amount decimal.Decimal, related_transaction_id *string, status string) error {
+	if status != "pending" && status != "posted" {
+		return ErrInvalidTransactionStatus
+	}
+
+	debit_account_id, credit_account_id, err := postings(kind, from_account_id, to_account_id)
+	if err != nil {
+		return err
+	}
+
+	currency, err := transactionCurrency(tx, debit_account_id, credit_account_id)
+	if err != nil {
+		return err
+	}
+
+	if !model.IsValidAmount(amount, currency) {
+		return ErrInvalidAmount
+	}
+
+	err = debitAccount(tx, debit_account_id, amount)
+	if err != nil {
+		return err
+	}
+
+	return journalTransaction(tx, transaction_id, kind, from_account_id, to_account_id, debit_account_id, credit_account_id, amount, currency, related_transaction_id, status)
+}
+
+// journalTransaction writes the transaction and its entries as part of tx, the caller is in charge of the checks
+func journalTransaction(tx *sqlx.Tx, transaction_id uuid.UUID, kind string, from_account_id *string, to_account_id *string, debit_account_id string, credit_account_id string, amount decimal.Decimal, currency string, related_transaction_id *string, status string) error {
+	_, err := tx.Exec(
+		`INSERT INTO "transaction" (id, kind, from_account_id, to_account_id, amount, currency, related_transaction_id, status, posted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $8 = 'posted' THEN NOW() END)`,
 		transaction_id,
 		kind,
 		from_account_id,
 		to_account_id,
 		amount,
+		currency,
 		related_transaction_id,
+		status,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "journal_entry" (transaction_id, account_id, direction, amount, currency, posted_at)
+		VALUES ($1, $2, 'debit', $4, $5, CASE WHEN $6 = 'posted' THEN NOW() END), ($1, $3, 'credit', $4, $5, CASE WHEN $6 = 'posted' THEN NOW() END)`,
+		transaction_id,
+		debit_account_id,
+		credit_account_id,
+		amount,
+		currency,
+		status,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateExchangeTransaction posts a conversion between accounts of different currencies: the source leg minus the
+// fee goes to the FX position account, which pays the target leg, and the fee is charged as a fee transaction
+// related to the exchange. The rate and the fee are recorded alongside the transaction.
+func (tr *TransactionRepository) CreateExchangeTransaction(transaction_id uuid.UUID, quote *model.FxQuote, status string) error {
+	if status != "pending" && status != "posted" {
+		return ErrInvalidTransactionStatus
+	}
+
+	tx, err := tr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	from_account_id := quote.FromAccountId.String()
+	to_account_id := quote.ToAccountId.String()
+
+	from_currency, err := transactionCurrency(tx, from_account_id)
+	if err != nil {
+		return err
+	}
+
+	to_currency, err := transactionCurrency(tx, to_account_id)
+	if err != nil {
+		return err
+	}
+
+	if from_currency != quote.FromCurrency || to_currency != quote.ToCurrency {
+		return ErrCurrencyMismatch
+	}
+
+	exchanged_amount := quote.FromAmount.Sub(quote.Fee)
+	err = debitAccount(tx, from_account_id, exchanged_amount)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "transaction" (id, kind, from_account_id, to_account_id, amount, currency, status, posted_at)
+		VALUES ($1, 'exchange', $2, $3, $4, $5, $6, CASE WHEN $6 = 'posted' THEN NOW() END)`,
+		transaction_id,
+		from_account_id,
+		to_account_id,
+		exchanged_amount,
+		quote.FromCurrency,
+		status,
+	)
+	if err != nil {
+		return err
+	}
+
+	entries := []model.Entry{
+		{AccountId: quote.FromAccountId, Direction: "debit", Amount: exchanged_amount, Currency: quote.FromCurrency},
+		{AccountId: model.FxPositionAccountId, Direction: "credit", Amount: exchanged_amount, Currency: quote.FromCurrency},
+		{AccountId: model.FxPositionAccountId, Direction: "debit", Amount: quote.ToAmount, Currency: quote.ToCurrency},
+		{AccountId: quote.ToAccountId, Direction: "credit", Amount: quote.ToAmount, Currency: quote.ToCurrency},
+	}
+
+	for _, entry := range entries {
+		if entry.Amount.IsZero() {
+			continue
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO "journal_entry" (transaction_id, account_id, direction, amount, currency, posted_at)
+			VALUES ($1, $2, $3, $4, $5, CASE WHEN $6 = 'posted' THEN NOW() END)`,
+			transaction_id,
+			entry.AccountId,
+			entry.Direction,
+			entry.Amount,
+			entry.Currency,
+			status,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if quote.Fee.IsPositive() {
+		fee_transaction_id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+
+		err = insertFee(tx, &model.Fee{TransactionId: fee_transaction_id, Amount: quote.Fee}, &from_account_id, transaction_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "fx_conversion" (transaction_id, from_currency, to_currency, from_amount, to_amount, rate, spread, fee)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		transaction_id,
+		quote.FromCurrency,
+		quote.ToCurrency,
+		quote.FromAmount,
+		quote.ToAmount,
+		quote.Rate,
+		quote.Spread,
+		quote.Fee,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateRefundTransaction refunds part of a posted transfer, or what is left to refund when amount is nil.
+// The original transaction is locked so concurrent refunds never add up to more than its amount.
+// The fees of the transfer are reversed once it is refunded in full by posted refunds.
+func (tr *TransactionRepository) CreateRefundTransaction(refund_transaction_id uuid.UUID, transaction_id string, amount *decimal.Decimal, status string) (decimal.Decimal, error) {
+	tx, err := tr.Pg.Beginx()
+	if err != nil {
+		return decimal.Zero, err
+	}
+	defer tx.Rollback()
+
+	transaction := new(model.Transaction)
+	err = tx.Get(
+		transaction,
+		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM "transaction" tx WHERE tx.id = $1 FOR UPDATE`,
+		transaction_id,
+	)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if transaction.Kind != "transfer" || transaction.Status != "posted" {
+		return decimal.Zero, ErrNotRefundable
+	}
+
+	var refunded decimal.Decimal
+	err = tx.Get(&refunded, refundedAmountQuery, transaction_id)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	remaining := transaction.Amount.Sub(refunded)
+	refund_amount := remaining
+	if amount != nil {
+		refund_amount = *amount
+	}
+
+	if !remaining.IsPositive() || refund_amount.GreaterThan(remaining) {
+		return decimal.Zero, ErrRefundExceedsAmount
+	}
+
+	from_account_id := transaction.FromAccountId.String()
+	to_account_id := transaction.ToAccountId.String()
+	err = insertTransaction(tx, refund_transaction_id, "refund", &from_account_id, &to_account_id, refund_amount, &transaction_id, status)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if status == "posted" {
+		err = reverseRefundedFees(tx, refund_transaction_id.String())
+		if err != nil {
+			return decimal.Zero, err
+		}
+	}
+
+	return refund_amount, tx.Commit()
+}
+
+// refundedAmountQuery sums the refunds of a transaction that were not failed nor reversed
+const refundedAmountQuery = `
+	SELECT 
+		COALESCE(SUM(tx.amount), 0)
+	FROM 
+		"transaction" tx
+	WHERE 
+		tx.related_transaction_id = $1
+	AND 
+		tx.kind = 'refund'
+	AND 
+		tx.status IN ('pending', 'posted')
+`
+
+func (tr *TransactionRepository) GetRefundedAmount(transaction_id string) (decimal.Decimal, error) {
+	var refunded decimal.Decimal
+	err := tr.Pg.Get(&refunded, refundedAmountQuery, transaction_id)
+
+	return refunded, err
+}
+
+func (tr *TransactionRepository) GetRefunds(transaction_id string) (*[]model.Transaction, error) {
+	transactions := new([]model.Transaction)
+	err := tr.Pg.Select(
+		transactions,
+		`
+		SELECT 
+			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM 
+			"transaction" tx 
+		WHERE 
+			tx.related_transaction_id = $1
+		AND 
+			tx.kind = 'refund'
+		ORDER BY
+			tx.date_issued ASC
+		`,
+		transaction_id,
+	)
+
+	return transactions, err
+}
+
+func (tr *TransactionRepository) GetFees(transaction_id string) (*[]model.Transaction, error) {
+	transactions := new([]model.Transaction)
+	err := tr.Pg.Select(
+		transactions,
+		`
+		SELECT 
+			tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM 
+			"transaction" tx 
+		WHERE 
+			tx.related_transaction_id = $1
+		AND 
+			tx.kind = 'fee'
+		ORDER BY
+			tx.date_issued ASC
+		`,
+		transaction_id,
+	)
+
+	return transactions, err
+}
+
+// PostTransaction moves a pending transaction to posted, its entries start counting on the ledger balance
+func (tr *TransactionRepository) PostTransaction(transaction_id string) error {
+	tx, err := tr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = postTransaction(tx, transaction_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// postTransaction posts a pending transaction as part of tx
+func postTransaction(tx *sqlx.Tx, transaction_id string) error {
+	result, err := tx.Exec(
+		`UPDATE "transaction"
+		SET status = 'posted', posted_at = NOW()
+		WHERE id = $1 AND status = 'pending'`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows != 1 {
+		return ErrInvalidTransactionStatus
+	}
+
+	_, err = tx.Exec(
+		`UPDATE "journal_entry" SET posted_at = NOW() WHERE transaction_id = $1`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return reverseRefundedFees(tx, transaction_id)
+}
+
+// reverseRefundedFees reverses the fees of the transfer refunded by a posted refund as part of tx once the posted
+// refunds add up to its amount, a no-op for other transactions
+func reverseRefundedFees(tx *sqlx.Tx, transaction_id string) error {
+	refunded_ids := []string{}
+	err := tx.Select(
+		&refunded_ids,
+		`SELECT t.id FROM "transaction" r
+		INNER JOIN "transaction" t ON t.id = r.related_transaction_id
+		WHERE r.id = $1 AND r.kind = 'refund' AND r.status = 'posted'
+		AND t.amount <= (
+			SELECT COALESCE(SUM(rf.amount), 0) FROM "transaction" rf
+			WHERE rf.related_transaction_id = t.id AND rf.kind = 'refund' AND rf.status = 'posted'
+		)`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, refunded_id := range refunded_ids {
+		err = reverseFees(tx, refunded_id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FailTransaction moves a pending transaction to failed, its entries are never posted
+func (tr *TransactionRepository) FailTransaction(transaction_id string) error {
+	tx, err := tr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = failTransaction(tx, transaction_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// failTransaction fails a pending transaction as part of tx
+func failTransaction(tx *sqlx.Tx, transaction_id string) error {
+	result, err := tx.Exec(
+		`UPDATE "transaction"
+		SET status = 'failed', failed_at = NOW()
+		WHERE id = $1 AND status = 'pending'`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows != 1 {
+		return ErrInvalidTransactionStatus
+	}
+
+	return nil
+}
+
+// ReverseTransaction moves a posted transaction to reversed and posts the opposite of each of its entries,
+// the accounts debited by the reversal must have enough available balance
+func (tr *TransactionRepository) ReverseTransaction(transaction_id string) error {
+	tx, err := tr.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = reverseTransaction(tx, transaction_id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// reverseTransaction reverses a posted transaction as part of tx, with the same checks as ReverseTransaction
+func reverseTransaction(tx *sqlx.Tx, transaction_id string) error {
+	result, err := tx.Exec(
+		`UPDATE "transaction"
+		SET status = 'reversed', reversed_at = NOW()
+		WHERE id = $1 AND status = 'posted'`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows != 1 {
+		return ErrInvalidTransactionStatus
+	}
+
+	entries := new([]model.Entry)
+	err = tx.Select(
+		entries,
+		`SELECT je.id, je.transaction_id, je.account_id, je.direction, je.amount, je.currency, je.created_at, je.posted_at
+		FROM "journal_entry" je WHERE je.transaction_id = $1 AND je.posted_at IS NOT NULL`,
+		transaction_id,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range *entries {
+		direction := "debit"
+		if entry.Direction == "debit" {
+			direction = "credit"
+		} else {
+			err = debitAccount(tx, entry.AccountId.String(), entry.Amount)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO "journal_entry" (transaction_id, account_id, direction, amount, currency, posted_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())`,
+			transaction_id,
+			entry.AccountId,
+			direction,
+			entry.Amount,
+			entry.Currency,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tr *TransactionRepository) GetEntriesByTransaction(transaction_id string) (*[]model.Entry, error) {
+	entries := new([]model.Entry)
+	err := tr.Pg.Select(
+		entries,
+		`
+		SELECT 
+			je.id, je.transaction_id, je.account_id, je.direction, je.amount, je.currency, je.created_at, je.posted_at
+		FROM 
+			"journal_entry" je 
+		WHERE 
+			je.transaction_id = $1
+		ORDER BY
+			je.direction DESC
+		`,
+		transaction_id,
+	)
+
+	return entries, err
+}
+
+// GetEntriesBalance sums the credits minus the debits of an account posted in the (date_from, date_to] interval
+func (tr *TransactionRepository) GetEntriesBalance(account_id string, currency string, date_from time.Time, date_to time.Time) (decimal.Decimal, error) {
+	var balance decimal.Decimal
+	err := tr.Pg.Get(
+		&balance,
+		`
+		SELECT 
+			COALESCE(SUM(CASE WHEN je.direction = 'credit' THEN je.amount ELSE -je.amount END), 0)
+		FROM 
+			"journal_entry" je 
+		WHERE 
+			je.account_id = $1
+		AND 
+			je.currency = $2
+		AND 
+			je.posted_at > $3
+		AND 
+			je.posted_at <= $4
+		`,
+		account_id,
+		currency,
+		date_from,
+		date_to,
 	)
 
-	return err
+	return balance, err
+}
+
+func (tr *TransactionRepository) GetPendingDebits(account_id string, currency string) (decimal.Decimal, error) {
+	var pending_debits decimal.Decimal
+	err := tr.Pg.Get(
+		&pending_debits,
+		`
+		SELECT 
+			COALESCE(SUM(je.amount), 0)
+		FROM 
+			"journal_entry" je 
+		INNER JOIN 
+			"transaction" tx ON tx.id = je.transaction_id
+		WHERE 
+			je.account_id = $1
+		AND 
+			je.currency = $2
+		AND 
+			je.direction = 'debit'
+		AND 
+			tx.status = 'pending'
+		`,
+		account_id,
+		currency,
+	)
+
+	return pending_debits, err
+}
+
+// GetLedgerTotal sums the credits minus the debits of every account, it is zero for a consistent ledger
+func (tr *TransactionRepository) GetLedgerTotal() (decimal.Decimal, error) {
+	var total decimal.Decimal
+	err := tr.Pg.Get(
+		&total,
+		`SELECT COALESCE(SUM(CASE WHEN je.direction = 'credit' THEN je.amount ELSE -je.amount END), 0) FROM "journal_entry" je WHERE je.posted_at IS NOT NULL`,
+	)
+
+	return total, err
+}
+
+// CreatePain001Message remembers the message id of a pain.001 file imported by the user, returns false when the
+// user already imported a file with this message id
+func (tr *TransactionRepository) CreatePain001Message(user_id string, msg_id string, status_msg_id string) (bool, error) {
+	result, err := tr.Pg.Exec(
+		`INSERT INTO "pain001_message" (user_id, msg_id, status_msg_id) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, msg_id) DO NOTHING`,
+		user_id,
+		msg_id,
+		status_msg_id,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+
+	return rows == 1, err
 }
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"welloff-bank/model"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type TransactionBatchRepository struct {
+	Pg *sqlx.DB
+}
+
+// CreateTransactionBatch journals a 'pending' or 'posted' transfer from the source account for every leg in a single
+// database transaction and posts the fees of the legs, checking the available balance of the source against the total
+// plus the fees once, so either every leg is made or none is
+func (br *TransactionBatchRepository) CreateTransactionBatch(batch *model.TransactionBatch, legs []model.TransactionBatchLeg, status string) error {
+	if status != "pending" && status != "posted" {
+		return ErrInvalidTransactionStatus
+	}
+
+	tx, err := br.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	from_account_id := batch.FromAccountId.String()
+	account_ids := []string{from_account_id}
+	for _, leg := range legs {
+		account_ids = append(account_ids, leg.ToAccountId.String())
+	}
+
+	currency, err := transactionCurrency(tx, account_ids...)
+	if err != nil {
+		return err
+	}
+
+	debit := batch.TotalAmount
+	for _, leg := range legs {
+		if !model.IsValidAmount(leg.Amount, currency) {
+			return ErrInvalidAmount
+		}
+
+		if leg.Fee != nil {
+			if !model.IsValidAmount(leg.Fee.Amount, currency) {
+				return ErrInvalidAmount
+			}
+
+			debit = debit.Add(leg.Fee.Amount)
+		}
+	}
+
+	err = debitAccount(tx, from_account_id, debit)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO "transaction_batch" (id, user_id, from_account_id, currency, total_amount, leg_count)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		batch.Id,
+		batch.UserId,
+		batch.FromAccountId,
+		currency,
+		batch.TotalAmount,
+		len(legs),
+	)
+	if err != nil {
+		return err
+	}
+
+	transaction_ids := []string{}
+	for _, leg := range legs {
+		to_account_id := leg.ToAccountId.String()
+
+		err = journalTransaction(tx, leg.TransactionId, "transfer", &from_account_id, &to_account_id, from_account_id, to_account_id, leg.Amount, currency, nil, status)
+		if err != nil {
+			return err
+		}
+
+		if leg.Fee != nil {
+			transaction_id := leg.TransactionId.String()
+
+			debit_account_id, credit_account_id, err := postings("fee", &from_account_id, nil)
+			if err != nil {
+				return err
+			}
+
+			err = journalTransaction(tx, leg.Fee.TransactionId, "fee", &from_account_id, nil, debit_account_id, credit_account_id, leg.Fee.Amount, currency, &transaction_id, "posted")
+			if err != nil {
+				return err
+			}
+		}
+
+		transaction_ids = append(transaction_ids, leg.TransactionId.String())
+	}
+
+	_, err = tx.Exec(`UPDATE "transaction" SET batch_id = $1 WHERE id = ANY($2)`, batch.Id, pq.Array(transaction_ids))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (br *TransactionBatchRepository) GetTransactionBatch(batch_id string) (*model.TransactionBatch, error) {
+	batch := new(model.TransactionBatch)
+	err := br.Pg.Get(
+		batch,
+		`SELECT tb.id, tb.user_id, tb.from_account_id, tb.currency, tb.total_amount, tb.leg_count, tb.created_at
+		FROM "transaction_batch" tb WHERE tb.id = $1`,
+		batch_id,
+	)
+
+	return batch, err
+}
+
+// GetTransactionsByBatch lists the legs of the batch in the order they were requested
+func (br *TransactionBatchRepository) GetTransactionsByBatch(batch_id string) (*[]model.Transaction, error) {
+	transactions := new([]model.Transaction)
+	err := br.Pg.Select(
+		transactions,
+		`SELECT tx.id, tx.kind, tx.from_account_id, tx.to_account_id, tx.amount, tx.currency, tx.date_issued, tx.related_transaction_id, tx.status, tx.posted_at, tx.failed_at, tx.reversed_at
+		FROM "transaction" tx
+		WHERE tx.batch_id = $1
+		ORDER BY tx.id`,
+		batch_id,
+	)
+
+	return transactions, err
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"time"
 	"welloff-bank/model"
 
 	"github.com/google/uuid"
@@ -26,7 +27,7 @@ func (ur *UserRepository) GetUserById(id uuid.UUID) (*model.User, error) {
 	user := new(model.User)
 	err := ur.Pg.Get(
 		user,
-		`SELECT u.id, u.email, u.password, u.created_at, u.updated_at
+		`SELECT u.id, u.email, u.password, u.is_admin, u.created_at, u.updated_at
 		FROM "user" u WHERE u.id=$1`,
 		id,
 	)
@@ -38,10 +39,60 @@ func (ur *UserRepository) GetUserByEmail(email string) (*model.User, error) {
 	user := new(model.User)
 	err := ur.Pg.Get(
 		user,
-		`SELECT u.id, u.email, u.password, u.created_at, u.updated_at
+		`SELECT u.id, u.email, u.password, u.is_admin, u.created_at, u.updated_at
 		FROM "user" u WHERE u.email=$1`,
 		email,
 	)
 
 	return user, err
 }
+
+// UpdatePassword replaces the password of the user and records the change as a security event
+func (ur *UserRepository) UpdatePassword(id uuid.UUID, password string) error {
+	tx, err := ur.Pg.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE "user" SET password = $2, updated_at = NOW() WHERE id = $1`, id, password)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO "security_event" (user_id, kind) VALUES ($1, 'password_changed')`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ur *UserRepository) CreateSecurityEvent(id uuid.UUID, kind string) error {
+	_, err := ur.Pg.Exec(`INSERT INTO "security_event" (user_id, kind) VALUES ($1, $2)`, id, kind)
+
+	return err
+}
+
+// GetLastSecurityEvents returns when each kind of security event last happened to the user
+func (ur *UserRepository) GetLastSecurityEvents(id uuid.UUID) (map[string]time.Time, error) {
+	events := []struct {
+		Kind      string    `db:"kind"`
+		CreatedAt time.Time `db:"created_at"`
+	}{}
+	err := ur.Pg.Select(
+		&events,
+		`SELECT se.kind, MAX(se.created_at) AS created_at FROM "security_event" se WHERE se.user_id = $1 GROUP BY se.kind`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	last := map[string]time.Time{}
+	for _, event := range events {
+		last[event.Kind] = event.CreatedAt
+	}
+
+	return last, nil
+}
@@ -0,0 +1,170 @@
+package schedule
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	Once    = "once"
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+// Business day conventions, moving a run date that falls on a weekend
+const (
+	// run on the weekend anyway
+	NoAdjustment = "none"
+	// run on the next business day
+	Following = "following"
+	// run on the previous business day
+	Preceding = "preceding"
+	// run on the next business day unless it is in the next month, then on the previous one
+	ModifiedFollowing = "modified_following"
+)
+
+var ErrInvalidFrequency = errors.New("frequency must be once, daily, weekly or monthly")
+var ErrInvalidAdjustment = errors.New("business day adjustment must be none, following, preceding or modified_following")
+var ErrEndBeforeStart = errors.New("end date is before the start date")
+var ErrInvalidCount = errors.New("count must be positive")
+
+// Recurrence describes when a scheduled transfer runs, dates are days in UTC
+type Recurrence struct {
+	Frequency  string
+	StartDate  time.Time
+	EndDate    *time.Time
+	Count      *int
+	Adjustment string
+}
+
+// Date truncates t to its day in UTC
+func Date(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (r *Recurrence) Validate() error {
+	switch r.Frequency {
+	case Once, Daily, Weekly, Monthly:
+	default:
+		return ErrInvalidFrequency
+	}
+
+	switch r.Adjustment {
+	case NoAdjustment, Following, Preceding, ModifiedFollowing:
+	default:
+		return ErrInvalidAdjustment
+	}
+
+	if r.EndDate != nil && Date(*r.EndDate).Before(Date(r.StartDate)) {
+		return ErrEndBeforeStart
+	}
+
+	if r.Count != nil && *r.Count <= 0 {
+		return ErrInvalidCount
+	}
+
+	return nil
+}
+
+// addMonths moves the date by months, keeping the day or using the last day of shorter months
+func addMonths(date time.Time, months int) time.Time {
+	first := time.Date(date.Year(), date.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	last_day := first.AddDate(0, 1, -1).Day()
+
+	day := date.Day()
+	if day > last_day {
+		day = last_day
+	}
+
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+func IsBusinessDay(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+// Adjust moves the date to a business day following the convention
+func Adjust(date time.Time, adjustment string) time.Time {
+	step := func(date time.Time, days int) time.Time {
+		for !IsBusinessDay(date) {
+			date = date.AddDate(0, 0, days)
+		}
+		return date
+	}
+
+	switch adjustment {
+	case Following:
+		return step(date, 1)
+	case Preceding:
+		return step(date, -1)
+	case ModifiedFollowing:
+		following := step(date, 1)
+		if following.Month() != date.Month() {
+			return step(date, -1)
+		}
+		return following
+	}
+
+	return date
+}
+
+// Occurrence returns the unadjusted date of the nth occurrence, counting from 0, and false once the
+// recurrence is over. Monthly occurrences keep the day of the start date when the month has it.
+func (r *Recurrence) Occurrence(n int) (time.Time, bool) {
+	if n < 0 || (r.Count != nil && n >= *r.Count) {
+		return time.Time{}, false
+	}
+
+	start := Date(r.StartDate)
+	var date time.Time
+	switch r.Frequency {
+	case Once:
+		if n > 0 {
+			return time.Time{}, false
+		}
+		date = start
+	case Daily:
+		date = start.AddDate(0, 0, n)
+	case Weekly:
+		date = start.AddDate(0, 0, 7*n)
+	case Monthly:
+		date = addMonths(start, n)
+	default:
+		return time.Time{}, false
+	}
+
+	if r.EndDate != nil && date.After(Date(*r.EndDate)) {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
+
+// RunDate is the business day adjusted date of the nth occurrence
+func (r *Recurrence) RunDate(n int) (time.Time, bool) {
+	date, ok := r.Occurrence(n)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return Adjust(date, r.Adjustment), true
+}
+
+// Next returns the first occurrence from n on that runs on or after not_before, with its run date,
+// and false when there is none left
+func (r *Recurrence) Next(n int, not_before time.Time) (int, time.Time, bool) {
+	not_before = Date(not_before)
+
+	for ; ; n++ {
+		date, ok := r.RunDate(n)
+		if !ok {
+			return n, time.Time{}, false
+		}
+
+		if !date.Before(not_before) {
+			return n, date, true
+		}
+	}
+}
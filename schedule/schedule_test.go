@@ -0,0 +1,119 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func day(text string) time.Time {
+	date, err := time.Parse("2006-01-02", text)
+	if err != nil {
+		panic(err)
+	}
+
+	return date
+}
+
+func runDates(r *Recurrence, limit int) []string {
+	dates := []string{}
+	for n := 0; n < limit; n++ {
+		date, ok := r.RunDate(n)
+		if !ok {
+			break
+		}
+		dates = append(dates, date.Format("2006-01-02"))
+	}
+
+	return dates
+}
+
+func assertDates(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestMonthlyKeepsTheDayOfTheStartDate(t *testing.T) {
+	count := 5
+	r := Recurrence{Frequency: Monthly, StartDate: day("2026-01-31"), Count: &count, Adjustment: NoAdjustment}
+
+	assertDates(t, runDates(&r, 10), "2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30", "2026-05-31")
+}
+
+func TestBusinessDayAdjustment(t *testing.T) {
+	// 2026-10-31 is a Saturday, the next business day is in November
+	cases := map[string]string{
+		NoAdjustment:      "2026-10-31",
+		Following:         "2026-11-02",
+		Preceding:         "2026-10-30",
+		ModifiedFollowing: "2026-10-30",
+	}
+
+	for adjustment, expected := range cases {
+		got := Adjust(day("2026-10-31"), adjustment).Format("2006-01-02")
+		if got != expected {
+			t.Errorf("%s: expected %s, got %s", adjustment, expected, got)
+		}
+	}
+
+	// 2026-10-17 is a Saturday too, but the following Monday is in the same month
+	if got := Adjust(day("2026-10-17"), ModifiedFollowing).Format("2006-01-02"); got != "2026-10-19" {
+		t.Errorf("expected 2026-10-19, got %s", got)
+	}
+}
+
+func TestEndDate(t *testing.T) {
+	end_date := day("2026-11-08")
+	r := Recurrence{Frequency: Weekly, StartDate: day("2026-10-18"), EndDate: &end_date, Adjustment: Following}
+
+	// Sundays moved to Mondays, the last one still runs after the end date since its occurrence is within it
+	assertDates(t, runDates(&r, 10), "2026-10-19", "2026-10-26", "2026-11-02", "2026-11-09")
+}
+
+func TestOnce(t *testing.T) {
+	r := Recurrence{Frequency: Once, StartDate: day("2026-10-20"), Adjustment: NoAdjustment}
+
+	assertDates(t, runDates(&r, 10), "2026-10-20")
+}
+
+func TestNextSkipsMissedOccurrences(t *testing.T) {
+	r := Recurrence{Frequency: Daily, StartDate: day("2026-10-01"), Adjustment: NoAdjustment}
+
+	n, date, ok := r.Next(2, day("2026-10-18"))
+	if !ok || n != 17 || !date.Equal(day("2026-10-18")) {
+		t.Fatalf("unexpected next occurrence %d %s %v", n, date, ok)
+	}
+
+	count := 3
+	r.Count = &count
+	_, _, ok = r.Next(0, day("2026-10-18"))
+	if ok {
+		t.Fatal("expected no occurrence left")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	end_date := day("2026-10-01")
+	zero := 0
+
+	invalid := []Recurrence{
+		{Frequency: "yearly", StartDate: day("2026-10-18"), Adjustment: NoAdjustment},
+		{Frequency: Daily, StartDate: day("2026-10-18"), Adjustment: "nearest"},
+		{Frequency: Daily, StartDate: day("2026-10-18"), EndDate: &end_date, Adjustment: NoAdjustment},
+		{Frequency: Daily, StartDate: day("2026-10-18"), Count: &zero, Adjustment: NoAdjustment},
+	}
+
+	for _, r := range invalid {
+		if r.Validate() == nil {
+			t.Errorf("expected %+v to be invalid", r)
+		}
+	}
+}
@@ -1,17 +1,28 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"log"
 	"strconv"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/statement"
 	"welloff-bank/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
 type CreateAccountRequest struct {
 	Name string `json:"name"`
+	// ISO 4217 code, defaults to USD
+	Currency string `json:"currency"`
+	// 'checking' | 'savings', defaults to checking
+	Type string `json:"type"`
 }
 
 func (s *Server) CreateAccount() gin.HandlerFunc {
@@ -22,6 +33,24 @@ func (s *Server) CreateAccount() gin.HandlerFunc {
 			return
 		}
 
+		if req.Currency == "" {
+			req.Currency = "USD"
+		}
+
+		if !model.IsValidCurrency(req.Currency) {
+			ctx.JSON(422, gin.H{"error": "Unsupported currency"})
+			return
+		}
+
+		if req.Type == "" {
+			req.Type = "checking"
+		}
+
+		if !model.IsValidAccountType(req.Type) {
+			ctx.JSON(422, gin.H{"error": "Account type must be checking or savings"})
+			return
+		}
+
 		user, err := utils.GetUser(ctx)
 		if err != nil {
 			log.Println("[ERROR] [CreateAccount] failed to get user from context: ", err)
@@ -29,7 +58,7 @@ func (s *Server) CreateAccount() gin.HandlerFunc {
 			return
 		}
 
-		err = s.Repositories.AccountRepository.CreateAccount(user.Id.String(), req.Name, "active")
+		err = s.Repositories.AccountRepository.CreateAccount(user.Id.String(), req.Name, "active", req.Currency, req.Type)
 		if err != nil {
 			log.Println("[ERROR] [CreateAccount] failed to create account: ", err)
 			ctx.JSON(500, gin.H{"error": "Failed to create account"})
@@ -41,9 +70,13 @@ func (s *Server) CreateAccount() gin.HandlerFunc {
 }
 
 type GetAccountResponse struct {
-	Id      string `json:"id"`
-	Name    string `json:"name"`
-	Balance string `json:"balance"`
+	Id               string `json:"id"`
+	Name             string `json:"name"`
+	Currency         string `json:"currency"`
+	Balance          string `json:"balance"`
+	AvailableBalance string `json:"available_balance"`
+	// 'checking' | 'savings'
+	Type string `json:"type"`
 	// 'active' | 'inactive'
 	Status string `json:"status"`
 }
@@ -82,10 +115,13 @@ func (s *Server) GetAccount() gin.HandlerFunc {
 		}
 
 		ctx.JSON(200, gin.H{"payload": GetAccountResponse{
-			Id:      account.Id.String(),
-			Name:    account.Name,
-			Balance: account_balance.Balance.String(),
-			Status:  account.Status,
+			Id:               account.Id.String(),
+			Name:             account.Name,
+			Currency:         account.Currency,
+			Balance:          account_balance.Balance.String(),
+			AvailableBalance: account_balance.AvailableBalance.String(),
+			Type:             account.Type,
+			Status:           account.Status,
 		}})
 	}
 }
@@ -93,6 +129,9 @@ func (s *Server) GetAccount() gin.HandlerFunc {
 type GetAccountsResponse struct {
 	AccountId string `json:"account_id"`
 	Name      string `json:"name"`
+	Currency  string `json:"currency"`
+	// 'checking' | 'savings'
+	Type string `json:"type"`
 	// 'active' | 'inactive'
 	Status string `json:"status"`
 }
@@ -129,6 +168,8 @@ func (s *Server) GetAccounts() gin.HandlerFunc {
 			payload = append(payload, GetAccountsResponse{
 				AccountId: account.Id.String(),
 				Name:      account.Name,
+				Currency:  account.Currency,
+				Type:      account.Type,
 				Status:    account.Status,
 			})
 		}
@@ -176,6 +217,11 @@ func (s *Server) DisableAccount() gin.HandlerFunc {
 			return
 		}
 
+		if account_balance.Balance.IsNegative() {
+			ctx.JSON(400, gin.H{"error": "Account has an outstanding overdraft and cannot be deleted"})
+			return
+		}
+
 		err = s.Repositories.AccountRepository.DisableAccount(account_id)
 		if err != nil {
 			log.Println("[ERROR] [DisableAccount] failed to disable account: ", err)
@@ -186,3 +232,441 @@ func (s *Server) DisableAccount() gin.HandlerFunc {
 		ctx.Status(200)
 	}
 }
+
+// parseDateQuery accepts RFC 3339 timestamps or plain dates, end_of_day moves plain dates to their last instant
+func parseDateQuery(value string, end_of_day bool) (*time.Time, error) {
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return &date, nil
+	}
+
+	date, err = time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if end_of_day {
+		date = date.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	return &date, nil
+}
+
+func (s *Server) GetAccountTransactions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account_id := ctx.Param("id")
+		if account_id == "" {
+			ctx.JSON(400, gin.H{"error": "Missing account id"})
+			return
+		}
+
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 {
+			limit = 20
+		}
+		if limit > 100 {
+			limit = 100
+		}
+
+		filter := repository.TransactionFilter{Limit: limit}
+
+		if kind := ctx.Query("kind"); kind != "" {
+			filter.Kind = &kind
+		}
+
+		if from := ctx.Query("from"); from != "" {
+			filter.DateFrom, err = parseDateQuery(from, false)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid from date"})
+				return
+			}
+		}
+
+		if to := ctx.Query("to"); to != "" {
+			filter.DateTo, err = parseDateQuery(to, true)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid to date"})
+				return
+			}
+		}
+
+		if min_amount := ctx.Query("min_amount"); min_amount != "" {
+			amount, err := decimal.NewFromString(min_amount)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid min_amount"})
+				return
+			}
+			filter.MinAmount = &amount
+		}
+
+		if max_amount := ctx.Query("max_amount"); max_amount != "" {
+			amount, err := decimal.NewFromString(max_amount)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid max_amount"})
+				return
+			}
+			filter.MaxAmount = &amount
+		}
+
+		if counterparty := ctx.Query("counterparty"); counterparty != "" {
+			if uuid.Validate(counterparty) != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid counterparty"})
+				return
+			}
+			filter.CounterpartyId = &counterparty
+		}
+
+		if cursor := ctx.Query("cursor"); cursor != "" {
+			if uuid.Validate(cursor) != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid cursor"})
+				return
+			}
+			filter.Cursor = &cursor
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountTransactions] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if account.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+			return
+		}
+
+		transactions, err := s.Repositories.TransactionRepository.GetAccountHistory(account_id, filter)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountTransactions] failed to get transactions: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transactions"})
+			return
+		}
+
+		var next_cursor *string
+		if len(*transactions) == limit {
+			cursor := (*transactions)[len(*transactions)-1].Id.String()
+			next_cursor = &cursor
+		}
+
+		ctx.JSON(200, gin.H{"payload": *transactions, "next_cursor": next_cursor})
+	}
+}
+
+func (s *Server) GetAccountStatement() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account_id := ctx.Param("id")
+		if account_id == "" {
+			ctx.JSON(400, gin.H{"error": "Missing account id"})
+			return
+		}
+
+		format := ctx.DefaultQuery("format", "json")
+		if format != "json" && format != "csv" && format != "pdf" && format != "mt940" {
+			ctx.JSON(422, gin.H{"error": "Format must be json, csv, pdf or mt940"})
+			return
+		}
+
+		if ctx.Query("from") == "" || ctx.Query("to") == "" {
+			ctx.JSON(422, gin.H{"error": "Missing from or to date"})
+			return
+		}
+
+		date_from, err := parseDateQuery(ctx.Query("from"), false)
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid from date"})
+			return
+		}
+
+		date_to, err := parseDateQuery(ctx.Query("to"), true)
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid to date"})
+			return
+		}
+
+		if date_to.Before(*date_from) {
+			ctx.JSON(422, gin.H{"error": "The to date must not be before the from date"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountStatement] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if account.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+			return
+		}
+
+		account_statement, err := utils.BuildStatement(account, *date_from, *date_to, s.Repositories)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountStatement] failed to build statement: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get statement"})
+			return
+		}
+
+		if format == "json" {
+			ctx.JSON(200, gin.H{"payload": account_statement})
+			return
+		}
+
+		var content bytes.Buffer
+		content_type := "text/csv"
+		extension := format
+		switch format {
+		case "csv":
+			err = statement.RenderCSV(&content, account_statement)
+		case "pdf":
+			content_type = "application/pdf"
+			err = statement.RenderPDF(&content, account_statement)
+		case "mt940":
+			content_type = "text/plain"
+			extension = "sta"
+			err = statement.RenderMT940(&content, account_statement, "WB"+date_to.UTC().Format("060102"))
+		}
+		if err != nil {
+			log.Println("[ERROR] [GetAccountStatement] failed to render statement: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get statement"})
+			return
+		}
+
+		filename := fmt.Sprintf("statement-%s-%s-%s.%s", account.Id, date_from.UTC().Format("20060102"), date_to.UTC().Format("20060102"), extension)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Data(200, content_type, content.Bytes())
+	}
+}
+
+// DefaultExportPeriod is how far back an export goes when no from date is given
+const DefaultExportPeriod = 90 * 24 * time.Hour
+
+func (s *Server) ExportAccountTransactions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account_id := ctx.Param("id")
+		if account_id == "" {
+			ctx.JSON(400, gin.H{"error": "Missing account id"})
+			return
+		}
+
+		format := ctx.DefaultQuery("format", "ofx")
+		if format != "ofx" && format != "qfx" {
+			ctx.JSON(422, gin.H{"error": "Format must be ofx or qfx"})
+			return
+		}
+
+		now := time.Now().UTC()
+		date_to := &now
+		date_from := new(time.Time)
+		*date_from = now.Add(-DefaultExportPeriod)
+
+		var err error
+		if from := ctx.Query("from"); from != "" {
+			date_from, err = parseDateQuery(from, false)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid from date"})
+				return
+			}
+		}
+
+		if to := ctx.Query("to"); to != "" {
+			date_to, err = parseDateQuery(to, true)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid to date"})
+				return
+			}
+		}
+
+		if date_to.Before(*date_from) {
+			ctx.JSON(422, gin.H{"error": "The to date must not be before the from date"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [ExportAccountTransactions] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if account.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+			return
+		}
+
+		account_statement, err := utils.BuildStatement(account, *date_from, *date_to, s.Repositories)
+		if err != nil {
+			log.Println("[ERROR] [ExportAccountTransactions] failed to build statement: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to export transactions"})
+			return
+		}
+
+		balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
+		if err != nil {
+			log.Println("[ERROR] [ExportAccountTransactions] failed to get account balance: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to export transactions"})
+			return
+		}
+
+		var content bytes.Buffer
+		err = statement.RenderOFX(&content, account_statement, balance, format == "qfx")
+		if err != nil {
+			log.Println("[ERROR] [ExportAccountTransactions] failed to render export: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to export transactions"})
+			return
+		}
+
+		content_type := "application/x-ofx"
+		if format == "qfx" {
+			content_type = "application/vnd.intu.qfx"
+		}
+
+		filename := fmt.Sprintf("transactions-%s-%s-%s.%s", account.Id, date_from.UTC().Format("20060102"), date_to.UTC().Format("20060102"), format)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Data(200, content_type, content.Bytes())
+	}
+}
+
+// getOwnedAccount loads the account and checks that the user owns it, answering the request when it fails
+func (s *Server) getOwnedAccount(ctx *gin.Context, handler string) (*model.Account, bool) {
+	account_id := ctx.Param("id")
+	if account_id == "" {
+		ctx.JSON(400, gin.H{"error": "Missing account id"})
+		return nil, false
+	}
+
+	user, err := utils.GetUser(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get user from context: %s\n", handler, err)
+		ctx.Status(401)
+		return nil, false
+	}
+
+	account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Account not found"})
+		return nil, false
+	}
+
+	if account.UserId.String() != user.Id.String() {
+		ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+		return nil, false
+	}
+
+	return account, true
+}
+
+// GetAccountCamt053 renders the end-of-day statement of a past day, yesterday by default
+func (s *Server) GetAccountCamt053() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		date := today.Add(-24 * time.Hour)
+		if query := ctx.Query("date"); query != "" {
+			parsed, err := time.Parse(time.DateOnly, query)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid date"})
+				return
+			}
+			date = parsed
+		}
+
+		if !date.Before(today) {
+			ctx.JSON(422, gin.H{"error": "The day must be over to get its statement"})
+			return
+		}
+
+		account, ok := s.getOwnedAccount(ctx, "GetAccountCamt053")
+		if !ok {
+			return
+		}
+
+		account_statement, err := utils.BuildStatement(account, date, date.Add(24*time.Hour-time.Nanosecond), s.Repositories)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountCamt053] failed to build statement: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get statement"})
+			return
+		}
+
+		message_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [GetAccountCamt053] failed to create message id: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get statement"})
+			return
+		}
+
+		var content bytes.Buffer
+		err = statement.RenderCamt053(&content, account_statement, message_id.String())
+		if err != nil {
+			log.Println("[ERROR] [GetAccountCamt053] failed to render statement: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get statement"})
+			return
+		}
+
+		filename := fmt.Sprintf("camt053-%s-%s.xml", account.Id, date.Format("20060102"))
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Data(200, "application/xml", content.Bytes())
+	}
+}
+
+// GetAccountCamt052 renders the intraday report of the movements booked since the start of the day
+func (s *Server) GetAccountCamt052() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account, ok := s.getOwnedAccount(ctx, "GetAccountCamt052")
+		if !ok {
+			return
+		}
+
+		now := time.Now().UTC()
+		account_statement, err := utils.BuildStatement(account, now.Truncate(24*time.Hour), now, s.Repositories)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountCamt052] failed to build report: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get report"})
+			return
+		}
+
+		balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountCamt052] failed to get account balance: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get report"})
+			return
+		}
+
+		message_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [GetAccountCamt052] failed to create message id: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get report"})
+			return
+		}
+
+		var content bytes.Buffer
+		err = statement.RenderCamt052(&content, account_statement, balance, message_id.String())
+		if err != nil {
+			log.Println("[ERROR] [GetAccountCamt052] failed to render report: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get report"})
+			return
+		}
+
+		filename := fmt.Sprintf("camt052-%s-%s.xml", account.Id, now.Format("20060102T150405"))
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Data(200, "application/xml", content.Bytes())
+	}
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"welloff-bank/ach"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+)
+
+// AchConfig says where ACH files are exchanged and how the bank identifies itself in them
+type AchConfig struct {
+	// generated files are written here for the operator to pick up
+	OutboxDir string
+	// return files dropped here are processed, then moved to its processed/ or failed/ subdirectory
+	InboxDir                 string
+	ImmediateDestination     string
+	ImmediateDestinationName string
+	// routing number of the bank, its first 8 digits prefix the trace numbers
+	ImmediateOrigin     string
+	ImmediateOriginName string
+	CompanyName         string
+	CompanyId           string
+}
+
+// loadAchConfig reads the ACH settings from the env, ACH is disabled when neither directory is set
+func loadAchConfig() (*AchConfig, error) {
+	config := AchConfig{
+		OutboxDir:                os.Getenv("ACH_OUTBOX_DIR"),
+		InboxDir:                 os.Getenv("ACH_INBOX_DIR"),
+		ImmediateDestination:     os.Getenv("ACH_IMMEDIATE_DESTINATION"),
+		ImmediateDestinationName: os.Getenv("ACH_IMMEDIATE_DESTINATION_NAME"),
+		ImmediateOrigin:          os.Getenv("ACH_IMMEDIATE_ORIGIN"),
+		ImmediateOriginName:      os.Getenv("ACH_IMMEDIATE_ORIGIN_NAME"),
+		CompanyName:              os.Getenv("ACH_COMPANY_NAME"),
+		CompanyId:                os.Getenv("ACH_COMPANY_ID"),
+	}
+
+	if config.OutboxDir == "" && config.InboxDir == "" {
+		return nil, nil
+	}
+
+	if config.OutboxDir == "" || config.InboxDir == "" {
+		return nil, errors.New("both ACH_OUTBOX_DIR and ACH_INBOX_DIR must be set")
+	}
+
+	if !ach.ValidRoutingNumber(config.ImmediateDestination) {
+		return nil, errors.New("ACH_IMMEDIATE_DESTINATION is not a valid routing number")
+	}
+
+	if !ach.ValidRoutingNumber(config.ImmediateOrigin) {
+		return nil, errors.New("ACH_IMMEDIATE_ORIGIN is not a valid routing number")
+	}
+
+	if config.CompanyName == "" || config.CompanyId == "" {
+		return nil, errors.New("ACH_COMPANY_NAME and ACH_COMPANY_ID must be set")
+	}
+
+	for _, dir := range []string{config.OutboxDir, config.InboxDir, filepath.Join(config.InboxDir, "processed"), filepath.Join(config.InboxDir, "failed")} {
+		err := os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &config, nil
+}
+
+// ODFI is the originating bank identification of the batches, the routing number without its check digit
+func (c *AchConfig) ODFI() string {
+	return c.ImmediateOrigin[:8]
+}
+
+// achFile lays the entries out in one batch per standard entry class, in the order they were queued
+func (c *AchConfig) achFile(file *model.AchFile, entries []model.AchEntry) *ach.File {
+	effective_date := file.CreatedAt.AddDate(0, 0, 1)
+
+	batches := []ach.Batch{}
+	batch_index := map[string]int{}
+	for _, entry := range entries {
+		index, ok := batch_index[entry.SECCode]
+		if !ok {
+			index = len(batches)
+			batch_index[entry.SECCode] = index
+			batches = append(batches, ach.Batch{
+				SECCode:          entry.SECCode,
+				CompanyName:      c.CompanyName,
+				CompanyId:        c.CompanyId,
+				EntryDescription: "WITHDRAWAL",
+				EffectiveDate:    effective_date,
+			})
+		}
+
+		transaction_code := ach.CheckingCredit
+		if entry.AccountType == "savings" {
+			transaction_code = ach.SavingsCredit
+		}
+
+		transaction_id := strings.ReplaceAll(entry.TransactionId.String(), "-", "")
+		batches[index].Entries = append(batches[index].Entries, ach.Entry{
+			TransactionCode:      transaction_code,
+			RoutingNumber:        entry.RoutingNumber,
+			AccountNumber:        entry.AccountNumber,
+			Amount:               entry.Amount,
+			IdentificationNumber: transaction_id[len(transaction_id)-15:],
+			Name:                 entry.Name,
+			TraceNumber:          *entry.TraceNumber,
+		})
+	}
+
+	return &ach.File{
+		ImmediateDestination:     c.ImmediateDestination,
+		ImmediateOrigin:          c.ImmediateOrigin,
+		ImmediateDestinationName: c.ImmediateDestinationName,
+		ImmediateOriginName:      c.ImmediateOriginName,
+		CreatedAt:                file.CreatedAt,
+		FileIdModifier:           file.FileIdModifier,
+		ODFI:                     c.ODFI(),
+		Batches:                  batches,
+	}
+}
+
+// WriteAchFile batches the queued external withdrawals into a new file in the outbox. The file is written
+// under a temporary name and only renamed once the entries are committed as batched, so nobody picks up a
+// partial file nor a file whose entries are still queued.
+func (s *Server) WriteAchFile() (*model.AchFile, error) {
+	config := s.AchConfig
+	tmp_path := ""
+
+	file, err := s.Repositories.AchRepository.BatchAchEntries(config.ODFI(), func(file *model.AchFile, entries []model.AchEntry) error {
+		tmp_path = filepath.Join(config.OutboxDir, file.FileName+".tmp")
+
+		output, err := os.Create(tmp_path)
+		if err != nil {
+			return err
+		}
+
+		err = ach.WriteFile(output, config.achFile(file, entries))
+		if err != nil {
+			output.Close()
+			return err
+		}
+
+		return output.Close()
+	})
+	if err != nil {
+		if tmp_path != "" {
+			os.Remove(tmp_path)
+		}
+		return nil, err
+	}
+
+	if file == nil {
+		return nil, nil
+	}
+
+	// the entries are batched by now, the temporary file is left behind for the operator when it can't be renamed
+	err = os.Rename(tmp_path, filepath.Join(config.OutboxDir, file.FileName))
+	if err != nil {
+		return file, fmt.Errorf("%s is batched but was left at %s: %w", file.FileName, tmp_path, err)
+	}
+
+	return file, nil
+}
+
+// processAchReturnFile reverses the withdrawals returned in the file. Returns of unknown or already returned
+// entries are logged and skipped, other failures stop the file so it is retried on the next run.
+func (s *Server) processAchReturnFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	returns, err := ach.ReadReturns(file)
+	if err != nil {
+		return 0, err
+	}
+
+	returned := 0
+	for _, r := range returns {
+		entry, err := s.Repositories.AchRepository.ReturnAchEntry(r.OriginalTraceNumber, r.ReturnCode)
+		if errors.Is(err, repository.ErrAchEntryNotFound) || errors.Is(err, repository.ErrAchEntryNotBatched) {
+			log.Printf("[ERROR] [ACH Return Processor] skipping return %s of trace number %s: %s\n", r.ReturnCode, r.OriginalTraceNumber, err)
+			continue
+		}
+		if err != nil {
+			return returned, fmt.Errorf("trace number %s: %w", r.OriginalTraceNumber, err)
+		}
+
+		log.Printf("[INFO] [ACH Return Processor] reversed withdrawal %s, return %s %s\n", entry.TransactionId, r.ReturnCode, ach.ReturnReasons[r.ReturnCode])
+		returned++
+	}
+
+	return returned, nil
+}
+
+// ProcessAchReturns processes the return files of the inbox in name order, moving each one to processed/
+// once done or to failed/ when it cannot be read
+func (s *Server) ProcessAchReturns() error {
+	inbox := s.AchConfig.InboxDir
+
+	dir_entries, err := os.ReadDir(inbox)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, dir_entry := range dir_entries {
+		if dir_entry.Type().IsRegular() && !strings.HasPrefix(dir_entry.Name(), ".") {
+			names = append(names, dir_entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(inbox, name)
+
+		returned, err := s.processAchReturnFile(path)
+		if errors.Is(err, ach.ErrInvalidRecord) {
+			log.Printf("[ERROR] [ACH Return Processor] moving unreadable file %s to failed: %s\n", name, err)
+			err = os.Rename(path, filepath.Join(inbox, "failed", name))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		err = os.Rename(path, filepath.Join(inbox, "processed", time.Now().UTC().Format("20060102150405")+"-"+name))
+		if err != nil {
+			return err
+		}
+
+		log.Printf("[INFO] [ACH Return Processor] processed %s, %d withdrawals reversed\n", name, returned)
+	}
+
+	return nil
+}
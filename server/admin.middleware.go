@@ -0,0 +1,29 @@
+package server
+
+import (
+	"log"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware only lets admins through, it has to run after AuthMiddleware
+func (s *Server) AdminMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Printf("[ERROR] [AdminMiddleware] failed to get user from context: %s\n", err)
+			ctx.JSON(401, gin.H{"message": "Unauthorized"})
+			ctx.Abort()
+			return
+		}
+
+		if !user.IsAdmin {
+			ctx.JSON(403, gin.H{"error": "Only admins can access this resource"})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
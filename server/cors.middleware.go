@@ -16,7 +16,7 @@ func CorsMiddleware() gin.HandlerFunc {
 
 		ctx.Writer.Header().Set("Access-Control-Allow-Origin", access_control_origin)
 		ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		ctx.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 		ctx.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 
 		if ctx.Request.Method == "OPTIONS" {
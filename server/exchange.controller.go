@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+	"welloff-bank/fee"
+	"welloff-bank/fx"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/valkey-io/valkey-go"
+)
+
+// FxQuoteTTL is how long a quoted rate is locked for
+const FxQuoteTTL = 30 * time.Second
+
+// fxSpread is the spread of the fee schedule of the account, or the FX_SPREAD default when it has none
+func (s *Server) fxSpread(account *model.Account) (decimal.Decimal, error) {
+	rule, err := s.Repositories.FeeRepository.GetFeeRule(account.Type, account.Currency, fee.FxSpread)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultFxSpread(), nil
+	}
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return rule.Percentage, nil
+}
+
+func defaultFxSpread() decimal.Decimal {
+	spread, ok := os.LookupEnv("FX_SPREAD")
+	if !ok || spread == "" {
+		return decimal.NewFromFloat(0.01)
+	}
+
+	d, err := decimal.NewFromString(spread)
+	if err != nil || d.IsNegative() || d.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		log.Println("[ERROR] [FX] invalid FX_SPREAD, using the default: ", spread)
+		return decimal.NewFromFloat(0.01)
+	}
+
+	return d
+}
+
+type QuoteExchangeRequest struct {
+	Amount        decimal.Decimal `json:"amount"`
+	FromAccountId string          `json:"from_account_id"`
+	ToAccountId   string          `json:"to_account_id"`
+}
+
+func (s *Server) QuoteExchange() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := QuoteExchangeRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [QuoteExchange] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		from_account, err := s.Repositories.AccountRepository.GetAccount(req.FromAccountId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if from_account.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+			return
+		}
+
+		to_account, err := s.Repositories.AccountRepository.GetAccount(req.ToAccountId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if from_account.Currency == to_account.Currency {
+			ctx.JSON(400, gin.H{"error": "Accounts have the same currency, use a transfer instead"})
+			return
+		}
+
+		if !model.IsValidAmount(req.Amount, from_account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		rate, err := s.RateProvider.GetRate(from_account.Currency, to_account.Currency)
+		if errors.Is(err, fx.ErrRateNotFound) {
+			ctx.JSON(400, gin.H{"error": "No exchange rate for the currency pair"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [QuoteExchange] failed to get exchange rate: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to quote exchange"})
+			return
+		}
+
+		spread, err := s.fxSpread(from_account)
+		if err != nil {
+			log.Println("[ERROR] [QuoteExchange] failed to get FX spread: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to quote exchange"})
+			return
+		}
+
+		fx_fee, to_amount := fx.Convert(req.Amount, from_account.Currency, to_account.Currency, rate, spread)
+		if !to_amount.IsPositive() {
+			ctx.JSON(400, gin.H{"error": "Amount is too small to be converted"})
+			return
+		}
+
+		quote_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [QuoteExchange] failed to create quote id: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to quote exchange"})
+			return
+		}
+
+		quote := model.FxQuote{
+			Id:            quote_id,
+			UserId:        user.Id,
+			FromAccountId: from_account.Id,
+			ToAccountId:   to_account.Id,
+			FromCurrency:  from_account.Currency,
+			ToCurrency:    to_account.Currency,
+			FromAmount:    req.Amount,
+			ToAmount:      to_amount,
+			Rate:          rate,
+			Spread:        spread,
+			Fee:           fx_fee,
+			ExpiresAt:     time.Now().UTC().Add(FxQuoteTTL),
+		}
+
+		b, err := json.Marshal(quote)
+		if err != nil {
+			log.Println("[ERROR] [QuoteExchange] failed to encode quote: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to quote exchange"})
+			return
+		}
+
+		valkey := s.Repositories.Valkey
+		err = valkey.Do(context.Background(), valkey.B().Set().Key("fx_quote:"+quote_id.String()).Value(string(b)).Ex(FxQuoteTTL).Build()).Error()
+		if err != nil {
+			log.Println("[ERROR] [QuoteExchange] failed to store quote: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to quote exchange"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": quote})
+	}
+}
+
+type ExchangeTransactionRequest struct {
+	QuoteId string `json:"quote_id"`
+}
+
+func (s *Server) ExchangeTransaction() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := ExchangeTransactionRequest{}
+		if ctx.ShouldBindJSON(&req) != nil || req.QuoteId == "" {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [ExchangeTransaction] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		valkey_client := s.Repositories.Valkey
+		quote_as_bytes, err := valkey_client.Do(context.Background(), valkey_client.B().Get().Key("fx_quote:"+req.QuoteId).Build()).AsBytes()
+		if err != nil {
+			ctx.JSON(400, gin.H{"error": "Quote not found or expired"})
+			return
+		}
+
+		var quote model.FxQuote
+		err = json.Unmarshal(quote_as_bytes, &quote)
+		if err != nil {
+			log.Println("[ERROR] [ExchangeTransaction] failed to decode quote: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete exchange transaction"})
+			return
+		}
+
+		if quote.UserId != user.Id {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the quote"})
+			return
+		}
+
+		// a quote can only be executed once, the claim outlives the quote so it is never executed twice and
+		// is given back when the exchange is not made so the owner can retry
+		claim_key := "fx_quote_claim:" + req.QuoteId
+		err = valkey_client.Do(context.Background(), valkey_client.B().Set().Key(claim_key).Value(user.Id.String()).Nx().Ex(FxQuoteTTL).Build()).Error()
+		if valkey.IsValkeyNil(err) {
+			ctx.JSON(409, gin.H{"error": "Quote is already being executed"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [ExchangeTransaction] failed to claim quote: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete exchange transaction"})
+			return
+		}
+
+		executed := false
+		defer func() {
+			if !executed {
+				valkey_client.Do(context.Background(), valkey_client.B().Del().Key(claim_key).Build())
+			}
+		}()
+
+		transaction_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [ExchangeTransaction] failed to create transaction id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete exchange transaction"})
+			return
+		}
+
+		from_account, err := s.Repositories.AccountRepository.GetAccount(quote.FromAccountId.String())
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Source account not found"})
+			return
+		}
+
+		// like transfer fees, the fee is a transaction of its own that does not count against the limits
+		exchanged_amount := quote.FromAmount.Sub(quote.Fee)
+		check, err := utils.CheckOutbound(s.FraudRules, user, from_account, "exchange", transaction_id, exchanged_amount, nil, s.Repositories)
+		if errors.Is(err, utils.ErrTransactionBlocked) {
+			ctx.JSON(403, gin.H{"error": "Transaction blocked"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [ExchangeTransaction] failed to check transaction: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete exchange transaction"})
+			return
+		}
+
+		err = s.Repositories.TransactionRepository.CreateExchangeTransaction(transaction_id, &quote, check.Status)
+		if err != nil {
+			utils.ReleaseLimits(from_account.Id, "exchange", transaction_id, exchanged_amount, s.Repositories)
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
+			return
+		}
+		if errors.Is(err, repository.ErrCurrencyMismatch) {
+			ctx.JSON(400, gin.H{"error": "Account currencies changed since the quote"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [ExchangeTransaction] failed to create transaction: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete exchange transaction"})
+			return
+		}
+
+		executed = true
+		err = valkey_client.Do(context.Background(), valkey_client.B().Del().Key("fx_quote:"+req.QuoteId).Build()).Error()
+		if err != nil {
+			log.Println("[ERROR] [ExchangeTransaction] failed to delete executed quote: ", err)
+		}
+
+		payload := gin.H{
+			"transaction_id": transaction_id,
+			"from_amount":    quote.FromAmount,
+			"to_amount":      quote.ToAmount,
+			"rate":           quote.Rate,
+			"fee":            quote.Fee,
+		}
+
+		if check.Status == "pending" {
+			s.holdForReview(ctx, "ExchangeTransaction", check, &transaction_id, nil, payload)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": payload})
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"log"
+	"welloff-bank/fee"
+	"welloff-bank/model"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func (s *Server) GetFeeRules() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rules, err := s.Repositories.FeeRepository.GetFeeRules(ctx.Query("kind"))
+		if err != nil {
+			log.Println("[ERROR] [GetFeeRules] failed to get fee rules: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get fee rules"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": rules})
+	}
+}
+
+type SetFeeRuleRequest struct {
+	// 'checking' | 'savings'
+	AccountType string `json:"account_type"`
+	// ISO 4217 code
+	Currency string `json:"currency"`
+	// 'transfer' | 'withdrawal' | 'maintenance' | 'fx_spread'
+	Kind       string           `json:"kind"`
+	Flat       decimal.Decimal  `json:"flat"`
+	Percentage decimal.Decimal  `json:"percentage"`
+	MinAmount  *decimal.Decimal `json:"min_amount"`
+	MaxAmount  *decimal.Decimal `json:"max_amount"`
+	// maintenance fees only
+	WaiveAboveBalance *decimal.Decimal `json:"waive_above_balance"`
+}
+
+// SetFeeRule creates or replaces the rule of an account type, currency and kind of fee
+func (s *Server) SetFeeRule() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := SetFeeRuleRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !model.IsValidAccountType(req.AccountType) {
+			ctx.JSON(422, gin.H{"error": "Account type must be checking or savings"})
+			return
+		}
+
+		if !model.IsValidCurrency(req.Currency) {
+			ctx.JSON(422, gin.H{"error": "Unsupported currency"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [SetFeeRule] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		rule := model.FeeRule{
+			AccountType:       req.AccountType,
+			Currency:          req.Currency,
+			Kind:              req.Kind,
+			Flat:              req.Flat,
+			Percentage:        req.Percentage,
+			MinAmount:         req.MinAmount,
+			MaxAmount:         req.MaxAmount,
+			WaiveAboveBalance: req.WaiveAboveBalance,
+			UpdatedBy:         user.Id,
+		}
+
+		err = fee.Validate(&rule)
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = s.Repositories.FeeRepository.SetFeeRule(&rule)
+		if err != nil {
+			log.Println("[ERROR] [SetFeeRule] failed to set fee rule: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to set fee rule"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+func (s *Server) DeleteFeeRule() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rule_id, err := uuid.Parse(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Fee rule not found"})
+			return
+		}
+
+		found, err := s.Repositories.FeeRepository.DeleteFeeRule(rule_id.String())
+		if err != nil {
+			log.Println("[ERROR] [DeleteFeeRule] failed to delete fee rule: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to delete fee rule"})
+			return
+		}
+
+		if !found {
+			ctx.JSON(404, gin.H{"error": "Fee rule not found"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"log"
+	"time"
+	"welloff-bank/fee"
+	"welloff-bank/model"
+	"welloff-bank/schedule"
+	"welloff-bank/utils"
+)
+
+// accounts charged the maintenance fee per page
+const maintenanceFeeBatchSize = 100
+
+// ChargeMaintenanceFees charges last month's maintenance fee to the accounts whose fee schedule has one,
+// waiving it for those that ended the month with enough balance. Months already charged are skipped.
+func (s *Server) ChargeMaintenanceFees() error {
+	today := schedule.Date(time.Now())
+	month_start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	period_start := month_start.AddDate(0, -1, 0)
+
+	maintenance_rules, err := s.Repositories.FeeRepository.GetFeeRules(fee.Maintenance)
+	if err != nil {
+		return err
+	}
+
+	if len(*maintenance_rules) == 0 {
+		return nil
+	}
+
+	rules := map[string]*model.FeeRule{}
+	for i, rule := range *maintenance_rules {
+		rules[rule.AccountType+rule.Currency] = &(*maintenance_rules)[i]
+	}
+
+	offset := 0
+	for {
+		accounts, err := s.Repositories.AccountRepository.GetAccounts(maintenanceFeeBatchSize, offset)
+		if err != nil {
+			return err
+		}
+
+		for i := range *accounts {
+			account := &(*accounts)[i]
+
+			rule, ok := rules[account.Type+account.Currency]
+			if !ok || account.Status != "active" || model.IsSystemAccount(account.Id) || !account.CreatedAt.Before(month_start) {
+				continue
+			}
+
+			balance, err := utils.GetAccountBalanceAt(account, month_start.Add(-time.Microsecond), s.Repositories)
+			if err != nil {
+				log.Printf("[ERROR] [Maintenance Fee] failed to get balance of account %s: %s\n", account.Id, err)
+				continue
+			}
+
+			charge, err := s.Repositories.FeeRepository.ChargeMaintenanceFee(account.Id, period_start, balance, fee.MaintenanceFee(rule, balance))
+			if err != nil {
+				log.Printf("[ERROR] [Maintenance Fee] failed to charge account %s: %s\n", account.Id, err)
+				continue
+			}
+
+			if charge != nil && charge.Status == "unpaid" {
+				log.Printf("[INFO] [Maintenance Fee] account %s cannot cover its maintenance fee of %s\n", account.Id, charge.Amount)
+			}
+		}
+
+		if len(*accounts) < maintenanceFeeBatchSize {
+			return nil
+		}
+		offset += maintenanceFeeBatchSize
+	}
+}
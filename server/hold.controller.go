@@ -0,0 +1,282 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const DefaultHoldDuration = 7 * 24 * time.Hour
+
+// getOwnedHold loads the hold and its account and checks that the user owns it, answering the request when it fails
+func (s *Server) getOwnedHold(ctx *gin.Context, handler string) (*model.Hold, *model.Account, bool) {
+	hold_id := ctx.Param("id")
+	if hold_id == "" {
+		ctx.JSON(400, gin.H{"error": "Missing id param"})
+		return nil, nil, false
+	}
+
+	user, err := utils.GetUser(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get user from context: %s\n", handler, err)
+		ctx.Status(401)
+		return nil, nil, false
+	}
+
+	hold, err := s.Repositories.HoldRepository.GetHold(hold_id)
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Hold not found"})
+		return nil, nil, false
+	}
+
+	account, err := s.Repositories.AccountRepository.GetAccount(hold.AccountId.String())
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get account: %s\n", handler, err)
+		ctx.JSON(404, gin.H{"error": "Account not found"})
+		return nil, nil, false
+	}
+
+	if account.UserId.String() != user.Id.String() {
+		ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+		return nil, nil, false
+	}
+
+	return hold, account, true
+}
+
+type CreateHoldRequest struct {
+	Amount   decimal.Decimal `json:"amount"`
+	Merchant string          `json:"merchant"`
+	Purpose  string          `json:"purpose"`
+	// defaults to 7 days from now
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (s *Server) CreateHold() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account_id := ctx.Param("id")
+		if account_id == "" {
+			ctx.JSON(400, gin.H{"error": "Missing account id"})
+			return
+		}
+
+		req := CreateHoldRequest{}
+		if ctx.ShouldBindJSON(&req) != nil || req.Merchant == "" {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
+		expires_at := time.Now().UTC().Add(DefaultHoldDuration)
+		if req.ExpiresAt != nil {
+			expires_at = req.ExpiresAt.UTC()
+		}
+
+		if !expires_at.After(time.Now()) {
+			ctx.JSON(422, gin.H{"error": "Expiry must be in the future"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [CreateHold] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(account_id)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if account.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+			return
+		}
+
+		if !model.IsValidAmount(req.Amount, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		hold_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [CreateHold] failed to create hold id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to create hold"})
+			return
+		}
+
+		err = s.Repositories.HoldRepository.CreateHold(hold_id, account_id, req.Amount, req.Merchant, req.Purpose, expires_at)
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [CreateHold] failed to create hold: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to create hold"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": gin.H{"hold_id": hold_id, "expires_at": expires_at}})
+	}
+}
+
+func (s *Server) GetHold() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hold, _, ok := s.getOwnedHold(ctx, "GetHold")
+		if !ok {
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": hold})
+	}
+}
+
+type CaptureHoldRequest struct {
+	// defaults to the whole held amount
+	Amount *decimal.Decimal `json:"amount"`
+}
+
+func (s *Server) CaptureHold() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := CaptureHoldRequest{}
+		if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		hold, account, ok := s.getOwnedHold(ctx, "CaptureHold")
+		if !ok {
+			return
+		}
+
+		amount := hold.Amount
+		if req.Amount != nil {
+			amount = *req.Amount
+		}
+
+		if !amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
+		if !model.IsValidAmount(amount, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		transaction_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [CaptureHold] failed to create transaction id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to capture hold"})
+			return
+		}
+
+		err = s.Repositories.HoldRepository.CaptureHold(hold.Id.String(), transaction_id, amount)
+		if errors.Is(err, repository.ErrHoldNotActive) {
+			ctx.JSON(400, gin.H{"error": "Hold is not active"})
+			return
+		}
+		if errors.Is(err, repository.ErrCaptureExceedsHold) {
+			ctx.JSON(400, gin.H{"error": "Capture amount is greater than the held amount"})
+			return
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [CaptureHold] failed to capture hold: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to capture hold"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": gin.H{"transaction_id": transaction_id}})
+	}
+}
+
+type IncrementHoldRequest struct {
+	Amount decimal.Decimal `json:"amount"`
+}
+
+func (s *Server) IncrementHold() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := IncrementHoldRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
+		hold, account, ok := s.getOwnedHold(ctx, "IncrementHold")
+		if !ok {
+			return
+		}
+
+		if !model.IsValidAmount(req.Amount, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		err := s.Repositories.HoldRepository.IncrementHold(hold.Id.String(), req.Amount)
+		if errors.Is(err, repository.ErrHoldNotActive) {
+			ctx.JSON(400, gin.H{"error": "Hold is not active"})
+			return
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [IncrementHold] failed to increment hold: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to increment hold"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+func (s *Server) ReleaseHold() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hold, _, ok := s.getOwnedHold(ctx, "ReleaseHold")
+		if !ok {
+			return
+		}
+
+		err := s.Repositories.HoldRepository.ReleaseHold(hold.Id.String())
+		if errors.Is(err, repository.ErrHoldNotActive) {
+			ctx.JSON(400, gin.H{"error": "Hold is not active"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [ReleaseHold] failed to release hold: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to release hold"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
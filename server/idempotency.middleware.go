@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// how long a reservation blocks retries of a request that stopped renewing it, the lease is renewed every
+// IdempotencyKeyRenewal while the request runs so only a request that died loses its reservation
+const IdempotencyKeyLease = time.Minute
+const IdempotencyKeyRenewal = IdempotencyKeyLease / 3
+
+// set by a handler answering with a server error once everything it did was rolled back
+const idempotencyRolledBackKey = "idempotency_rolled_back"
+
+// rolledBack tells IdempotencyMiddleware that the server error the handler is answering with left nothing committed,
+// so the key is released for the client to retry with it. Other server errors are stored and replayed like any
+// response, since the request may have moved money before failing.
+func rolledBack(ctx *gin.Context) {
+	ctx.Set(idempotencyRolledBackKey, true)
+}
+
+type idempotencyResponseWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *idempotencyResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyResponseWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// requestFingerprint hashes the method, the path and the body, JSON bodies are
+// re-encoded first so formatting and key order don't change the fingerprint
+func requestFingerprint(method string, path string, body []byte) string {
+	var payload interface{}
+	if json.Unmarshal(body, &payload) == nil {
+		canonical, err := json.Marshal(payload)
+		if err == nil {
+			body = canonical
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayIdempotencyKey answers a request whose key was already used
+func replayIdempotencyKey(ctx *gin.Context, idempotency_key *model.IdempotencyKey, fingerprint string) {
+	if idempotency_key.Fingerprint != fingerprint {
+		ctx.AbortWithStatusJSON(422, gin.H{"error": "Idempotency-Key was already used with a different payload"})
+		return
+	}
+
+	if idempotency_key.ResponseStatus == nil {
+		ctx.AbortWithStatusJSON(409, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+		return
+	}
+
+	ctx.Header("Idempotent-Replayed", "true")
+	if len(idempotency_key.ResponseBody) == 0 || idempotency_key.ResponseContentType == nil {
+		ctx.AbortWithStatus(*idempotency_key.ResponseStatus)
+		return
+	}
+
+	ctx.Data(*idempotency_key.ResponseStatus, *idempotency_key.ResponseContentType, idempotency_key.ResponseBody)
+	ctx.Abort()
+}
+
+func (s *Server) IdempotencyMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader("Idempotency-Key")
+		if key == "" {
+			ctx.Next()
+			return
+		}
+
+		if len(key) > 255 {
+			ctx.AbortWithStatusJSON(422, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [IdempotencyMiddleware] failed to get user from context: ", err)
+			ctx.AbortWithStatus(401)
+			return
+		}
+
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.AbortWithStatusJSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(ctx.Request.Method, ctx.Request.URL.Path, body)
+		cache_key := "idempotency:" + user.Id.String() + ":" + key
+		idempotency_keys := s.Repositories.IdempotencyKeyRepository
+
+		valkey := s.Repositories.Valkey
+		cached_key_as_bytes, err := valkey.Do(context.Background(), valkey.B().Get().Key(cache_key).Build()).AsBytes()
+		if err == nil {
+			var cached_key model.IdempotencyKey
+			if json.Unmarshal(cached_key_as_bytes, &cached_key) == nil {
+				replayIdempotencyKey(ctx, &cached_key, fingerprint)
+				return
+			}
+		}
+
+		reserved, err := idempotency_keys.ReserveIdempotencyKey(user.Id.String(), key, fingerprint, IdempotencyKeyLease)
+		if err != nil {
+			log.Println("[ERROR] [IdempotencyMiddleware] failed to reserve idempotency key: ", err)
+			ctx.AbortWithStatusJSON(500, gin.H{"error": "Failed to process Idempotency-Key"})
+			return
+		}
+
+		if !reserved {
+			stored_key, err := idempotency_keys.GetIdempotencyKey(user.Id.String(), key)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Println("[ERROR] [IdempotencyMiddleware] failed to get idempotency key: ", err)
+				ctx.AbortWithStatusJSON(500, gin.H{"error": "Failed to process Idempotency-Key"})
+				return
+			}
+
+			if err == nil {
+				replayIdempotencyKey(ctx, stored_key, fingerprint)
+				return
+			}
+
+			// the key was released between the insert and the select, let the client retry
+			ctx.AbortWithStatusJSON(409, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			return
+		}
+
+		writer := &idempotencyResponseWriter{ResponseWriter: ctx.Writer, body: &bytes.Buffer{}}
+		ctx.Writer = writer
+
+		// a slow request, waiting on an account lock for example, keeps its reservation while it runs
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(IdempotencyKeyRenewal)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					err := idempotency_keys.RenewIdempotencyKey(user.Id.String(), key, IdempotencyKeyLease)
+					if err != nil {
+						log.Println("[ERROR] [IdempotencyMiddleware] failed to renew idempotency key: ", err)
+					}
+				}
+			}
+		}()
+
+		// a panicking handler may have moved money before panicking, its key answers 500 from then on unless
+		// it said it rolled back
+		defer func() {
+			if r := recover(); r != nil {
+				var err error
+				if ctx.GetBool(idempotencyRolledBackKey) {
+					err = idempotency_keys.DeleteIdempotencyKey(user.Id.String(), key)
+				} else {
+					err = idempotency_keys.CompleteIdempotencyKey(user.Id.String(), key, 500, "", nil)
+				}
+				if err != nil {
+					log.Println("[ERROR] [IdempotencyMiddleware] failed to settle idempotency key: ", err)
+				}
+				panic(r)
+			}
+		}()
+
+		ctx.Next()
+
+		// server errors of requests that rolled back are not stored so the client can retry with the same key
+		if writer.Status() >= 500 && ctx.GetBool(idempotencyRolledBackKey) {
+			err = idempotency_keys.DeleteIdempotencyKey(user.Id.String(), key)
+			if err != nil {
+				log.Println("[ERROR] [IdempotencyMiddleware] failed to release idempotency key: ", err)
+			}
+			return
+		}
+
+		status := writer.Status()
+		content_type := writer.Header().Get("Content-Type")
+		err = idempotency_keys.CompleteIdempotencyKey(user.Id.String(), key, status, content_type, writer.body.Bytes())
+		if err != nil {
+			log.Println("[ERROR] [IdempotencyMiddleware] failed to store idempotent response: ", err)
+			return
+		}
+
+		stored_key := model.IdempotencyKey{
+			Key:                 key,
+			UserId:              user.Id,
+			Fingerprint:         fingerprint,
+			ResponseStatus:      &status,
+			ResponseContentType: &content_type,
+			ResponseBody:        writer.body.Bytes(),
+		}
+
+		b, err := json.Marshal(stored_key)
+		if err == nil {
+			valkey.Do(context.Background(), valkey.B().Set().Key(cache_key).Value(string(b)).Ex(IdempotencyKeyTTL).Build())
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"log"
+	"strconv"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/schedule"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+type GetAccountInterestResponse struct {
+	Accruals []model.InterestAccrual `json:"accruals"`
+	Credits  []model.InterestCredit  `json:"credits"`
+}
+
+// GetAccountInterest returns the accrual ledger of a savings account with its monthly credits
+func (s *Server) GetAccountInterest() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > 366 {
+			limit = 31
+		}
+
+		offset, err := strconv.Atoi(ctx.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		account, ok := s.getOwnedAccount(ctx, "GetAccountInterest")
+		if !ok {
+			return
+		}
+
+		if account.Type != "savings" {
+			ctx.JSON(400, gin.H{"error": "Account is not a savings account"})
+			return
+		}
+
+		accruals, err := s.Repositories.InterestRepository.GetInterestAccruals(account.Id.String(), limit, offset)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountInterest] failed to get accruals: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get account interest"})
+			return
+		}
+
+		credits, err := s.Repositories.InterestRepository.GetInterestCredits(account.Id.String())
+		if err != nil {
+			log.Println("[ERROR] [GetAccountInterest] failed to get credits: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get account interest"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetAccountInterestResponse{Accruals: *accruals, Credits: *credits}})
+	}
+}
+
+func (s *Server) GetSavingsRates() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rates, err := s.Repositories.InterestRepository.GetSavingsRates(ctx.Query("currency"))
+		if err != nil {
+			log.Println("[ERROR] [GetSavingsRates] failed to get savings rates: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get savings rates"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": rates})
+	}
+}
+
+type SetSavingsRateRequest struct {
+	// ISO 4217 code
+	Currency string `json:"currency"`
+	// as a fraction, 0.045 is 4.5%
+	Apy decimal.Decimal `json:"apy"`
+	// YYYY-MM-DD, defaults to today
+	EffectiveFrom string `json:"effective_from"`
+}
+
+// SetSavingsRate changes the APY of a currency from a day on, days already accrued keep the rate they had
+func (s *Server) SetSavingsRate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := SetSavingsRateRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !model.IsValidCurrency(req.Currency) {
+			ctx.JSON(422, gin.H{"error": "Unsupported currency"})
+			return
+		}
+
+		if req.Apy.IsNegative() || req.Apy.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			ctx.JSON(422, gin.H{"error": "APY must be a fraction between 0 and 1"})
+			return
+		}
+
+		if !req.Apy.Equal(req.Apy.Truncate(6)) {
+			ctx.JSON(422, gin.H{"error": "APY must have at most 6 decimal places"})
+			return
+		}
+
+		today := schedule.Date(time.Now())
+		effective_from := today
+		if req.EffectiveFrom != "" {
+			date, err := time.Parse("2006-01-02", req.EffectiveFrom)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid effective_from, expected YYYY-MM-DD"})
+				return
+			}
+
+			if date.Before(today) {
+				ctx.JSON(422, gin.H{"error": "Rates cannot change for days already accrued"})
+				return
+			}
+			effective_from = date
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [SetSavingsRate] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		err = s.Repositories.InterestRepository.SetSavingsRate(req.Currency, req.Apy, effective_from, user.Id)
+		if err != nil {
+			log.Println("[ERROR] [SetSavingsRate] failed to set savings rate: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to set savings rate"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"log"
+	"time"
+	"welloff-bank/interest"
+	"welloff-bank/model"
+	"welloff-bank/schedule"
+	"welloff-bank/utils"
+)
+
+// savings accounts accrued per page
+const interestAccrualBatchSize = 100
+
+// accrueAccountInterest accrues every day of the account from the one after the last accrued until yesterday,
+// each on its end-of-day ledger balance at the rate in force that day
+func (s *Server) accrueAccountInterest(account *model.Account, rates []interest.Rate, today time.Time) error {
+	last_accrual_date, err := s.Repositories.InterestRepository.GetLastAccrualDate(account.Id.String())
+	if err != nil {
+		return err
+	}
+
+	day := schedule.Date(account.CreatedAt)
+	if last_accrual_date != nil {
+		day = schedule.Date(*last_accrual_date).AddDate(0, 0, 1)
+	}
+
+	for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+		end_of_day := day.AddDate(0, 0, 1).Add(-time.Microsecond)
+
+		balance, err := utils.GetAccountBalanceAt(account, end_of_day, s.Repositories)
+		if err != nil {
+			return err
+		}
+
+		accrual := model.InterestAccrual{
+			AccountId:   account.Id,
+			AccrualDate: day,
+			Balance:     balance,
+		}
+
+		// days before the first rate of the currency are accrued at zero so the ledger has no gaps
+		rate, ok := interest.RateOn(rates, day)
+		if ok {
+			accrual.Apy = rate.Apy
+			accrual.DailyRate = interest.DailyRate(rate.Apy)
+			accrual.Amount = interest.Accrue(balance, accrual.DailyRate)
+		}
+
+		err = s.Repositories.InterestRepository.CreateInterestAccrual(&accrual)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AccrueInterest accrues the interest of the savings accounts up to yesterday and credits the months that are
+// over. Days and months already done are skipped, so it can run as often as needed.
+func (s *Server) AccrueInterest() error {
+	today := schedule.Date(time.Now())
+	month_start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	savings_rates, err := s.Repositories.InterestRepository.GetSavingsRates("")
+	if err != nil {
+		return err
+	}
+
+	rates := map[string][]interest.Rate{}
+	for _, rate := range *savings_rates {
+		rates[rate.Currency] = append(rates[rate.Currency], interest.Rate{Apy: rate.Apy, EffectiveFrom: rate.EffectiveFrom})
+	}
+
+	offset := 0
+	for {
+		accounts, err := s.Repositories.InterestRepository.GetSavingsAccounts(interestAccrualBatchSize, offset)
+		if err != nil {
+			return err
+		}
+
+		for i := range *accounts {
+			account := &(*accounts)[i]
+
+			err = s.accrueAccountInterest(account, rates[account.Currency], today)
+			if err != nil {
+				log.Printf("[ERROR] [Interest Accrual] failed to accrue account %s: %s\n", account.Id, err)
+				continue
+			}
+
+			periods, err := s.Repositories.InterestRepository.GetUncreditedPeriods(account.Id.String(), month_start)
+			if err != nil {
+				log.Printf("[ERROR] [Interest Accrual] failed to get periods to credit of account %s: %s\n", account.Id, err)
+				continue
+			}
+
+			for _, period_start := range periods {
+				credit, err := s.Repositories.InterestRepository.CreditInterest(account, period_start)
+				if err != nil {
+					log.Printf("[ERROR] [Interest Accrual] failed to credit account %s for %s: %s\n", account.Id, period_start.Format("2006-01"), err)
+					break
+				}
+
+				if credit != nil {
+					log.Printf("[INFO] [Interest Accrual] credited %s %s to account %s for %s\n", credit.Amount, account.Currency, account.Id, period_start.Format("2006-01"))
+				}
+			}
+		}
+
+		if len(*accounts) < interestAccrualBatchSize {
+			return nil
+		}
+		offset += interestAccrualBatchSize
+	}
+}
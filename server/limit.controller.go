@@ -0,0 +1,268 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"welloff-bank/limit"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// how long a temporary limit increase lasts
+	LimitIncreaseDuration = 24 * time.Hour
+	// wait between two increases of the same limit
+	LimitIncreaseCooldown = 7 * 24 * time.Hour
+)
+
+// a temporary increase raises a limit to at most this many times its amount
+var LimitIncreaseMaxFactor = decimal.NewFromInt(2)
+
+type SetAccountLimitRequest struct {
+	// 'withdrawal' | 'transfer' | 'outbound'
+	Kind string `json:"kind"`
+	// 'single' | 'daily' | 'monthly'
+	Period string          `json:"period"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// SetAccountLimit caps what can leave an account, or changes the cap, transactions going over it are held for review
+func (s *Server) SetAccountLimit() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := SetAccountLimitRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if model.IsSystemAccount(account.Id) {
+			ctx.JSON(400, gin.H{"error": "System accounts cannot have limits"})
+			return
+		}
+
+		err = limit.Validate(&model.AccountLimit{Kind: req.Kind, Period: req.Period, Amount: req.Amount}, account.Currency)
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [SetAccountLimit] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		err = s.Repositories.LimitRepository.SetAccountLimit(account.Id.String(), req.Kind, req.Period, req.Amount, user.Id)
+		if err != nil {
+			log.Println("[ERROR] [SetAccountLimit] failed to set limit: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to set account limit"})
+			return
+		}
+
+		// counters of kinds that had no rolling limit until now may be stale
+		err = utils.ResetLimitCounters(account.Id, s.Repositories)
+		if err != nil {
+			log.Println("[ERROR] [SetAccountLimit] failed to reset limit counters: ", err)
+		}
+
+		ctx.Status(200)
+	}
+}
+
+func (s *Server) DeleteAccountLimit() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		found, err := s.Repositories.LimitRepository.DeleteAccountLimit(ctx.Param("id"), ctx.Param("kind"), ctx.Param("period"))
+		if err != nil {
+			log.Println("[ERROR] [DeleteAccountLimit] failed to delete limit: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to delete account limit"})
+			return
+		}
+
+		if !found {
+			ctx.JSON(404, gin.H{"error": "Limit not found"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+type AccountLimitUsage struct {
+	model.AccountLimit
+	// the amount, or the increased amount while an increase is active
+	Effective decimal.Decimal `json:"effective"`
+	// what left the account within the period, nothing for single limits
+	Used      decimal.Decimal `json:"used"`
+	Remaining decimal.Decimal `json:"remaining"`
+}
+
+type GetAccountLimitsResponse struct {
+	Limits    []AccountLimitUsage   `json:"limits"`
+	Increases []model.LimitIncrease `json:"increases"`
+}
+
+// GetAccountLimits returns the limits of the account with what is left of them, and its latest increases
+func (s *Server) GetAccountLimits() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		account, ok := s.getOwnedAccount(ctx, "GetAccountLimits")
+		if !ok {
+			return
+		}
+
+		now := time.Now().UTC()
+
+		limits, err := s.Repositories.LimitRepository.GetAccountLimits(account.Id.String(), now)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountLimits] failed to get limits: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get account limits"})
+			return
+		}
+
+		// movements by limit kind, read once per kind
+		movements := map[string][]limit.Movement{}
+		usages := []AccountLimitUsage{}
+		for _, account_limit := range *limits {
+			usage := AccountLimitUsage{AccountLimit: account_limit, Effective: limit.Effective(&account_limit, now), Used: decimal.Zero}
+
+			if account_limit.Period != limit.Single {
+				_, ok := movements[account_limit.Kind]
+				if !ok {
+					movements[account_limit.Kind], err = utils.GetLimitMovements(account.Id, account_limit.Kind, now, s.Repositories)
+					if err != nil {
+						log.Println("[ERROR] [GetAccountLimits] failed to get limit movements: ", err)
+						ctx.JSON(500, gin.H{"error": "Failed to get account limits"})
+						return
+					}
+				}
+
+				usage.Used = limit.Used(movements[account_limit.Kind], limit.Window(account_limit.Period), now)
+			}
+
+			usage.Remaining = decimal.Max(usage.Effective.Sub(usage.Used), decimal.Zero)
+			usages = append(usages, usage)
+		}
+
+		increases, err := s.Repositories.LimitRepository.GetLimitIncreases(account.Id.String(), 20, 0)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountLimits] failed to get limit increases: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get account limits"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetAccountLimitsResponse{Limits: usages, Increases: *increases}})
+	}
+}
+
+type RequestLimitIncreaseRequest struct {
+	Kind   string `json:"kind"`
+	Period string `json:"period"`
+	// the limit while the increase lasts
+	Amount decimal.Decimal `json:"amount"`
+	Reason string          `json:"reason"`
+}
+
+// RequestLimitIncrease raises a limit of the account for a day, up to twice its amount.
+// The same limit can be raised again only once the cooldown since the previous increase is over.
+func (s *Server) RequestLimitIncrease() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := RequestLimitIncreaseRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if len(req.Reason) > 255 {
+			ctx.JSON(422, gin.H{"error": "Reason must have at most 255 characters"})
+			return
+		}
+
+		account, ok := s.getOwnedAccount(ctx, "RequestLimitIncrease")
+		if !ok {
+			return
+		}
+
+		now := time.Now().UTC()
+
+		limits, err := s.Repositories.LimitRepository.GetAccountLimits(account.Id.String(), now)
+		if err != nil {
+			log.Println("[ERROR] [RequestLimitIncrease] failed to get limits: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to request limit increase"})
+			return
+		}
+
+		var account_limit *model.AccountLimit
+		for i := range *limits {
+			if (*limits)[i].Kind == req.Kind && (*limits)[i].Period == req.Period {
+				account_limit = &(*limits)[i]
+			}
+		}
+
+		if account_limit == nil {
+			ctx.JSON(404, gin.H{"error": "Limit not found"})
+			return
+		}
+
+		if !req.Amount.GreaterThan(account_limit.Amount) {
+			ctx.JSON(422, gin.H{"error": "Amount must be above the current limit"})
+			return
+		}
+
+		max_amount := account_limit.Amount.Mul(LimitIncreaseMaxFactor)
+		if req.Amount.GreaterThan(max_amount) {
+			ctx.JSON(422, gin.H{"error": fmt.Sprintf("Amount must be at most %s", max_amount)})
+			return
+		}
+
+		if !model.IsValidAmount(req.Amount, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [RequestLimitIncrease] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		increase := model.LimitIncrease{
+			AccountId:   account.Id,
+			Kind:        req.Kind,
+			Period:      req.Period,
+			Amount:      req.Amount,
+			Reason:      req.Reason,
+			RequestedBy: user.Id,
+			ExpiresAt:   now.Add(LimitIncreaseDuration),
+		}
+
+		// the cooldown is checked under a lock on the limit so that concurrent requests cannot both increase it
+		last_increase, err := s.Repositories.LimitRepository.CreateLimitIncrease(&increase, LimitIncreaseCooldown)
+		if errors.Is(err, repository.ErrLimitIncreaseCooldown) {
+			ctx.JSON(429, gin.H{
+				"error":            "Limit was increased recently",
+				"next_increase_at": last_increase.CreatedAt.Add(LimitIncreaseCooldown).UTC().Format(time.RFC3339),
+			})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [RequestLimitIncrease] failed to create limit increase: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to request limit increase"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": increase})
+	}
+}
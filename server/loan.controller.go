@@ -0,0 +1,345 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+	"welloff-bank/amortization"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/schedule"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type OriginateLoanRequest struct {
+	UserId string `json:"user_id"`
+	// receives the principal
+	AccountId string `json:"account_id"`
+	// the installments are debited from it, defaults to account_id
+	RepaymentAccountId string          `json:"repayment_account_id"`
+	Principal          decimal.Decimal `json:"principal"`
+	// fixed nominal rate, as a fraction
+	AnnualRate decimal.Decimal `json:"annual_rate"`
+	TermMonths int             `json:"term_months"`
+	// 'price' | 'sac'
+	Method string `json:"method"`
+	// YYYY-MM-DD, defaults to a month from today
+	FirstDueDate string `json:"first_due_date"`
+	// charged once on every installment not paid on its due date
+	LateFee decimal.Decimal `json:"late_fee"`
+}
+
+type GetLoanResponse struct {
+	model.Loan
+	Installments []model.LoanInstallment `json:"installments"`
+}
+
+// OriginateLoan lends the principal to the user, disbursing it into one of their accounts, and schedules
+// the installments that repay it
+func (s *Server) OriginateLoan() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := OriginateLoanRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !req.AnnualRate.Equal(req.AnnualRate.Truncate(6)) {
+			ctx.JSON(422, gin.H{"error": "Annual rate must have at most 6 decimal places"})
+			return
+		}
+
+		if req.LateFee.IsNegative() {
+			ctx.JSON(422, gin.H{"error": "Late fee must not be negative"})
+			return
+		}
+
+		if req.RepaymentAccountId == "" {
+			req.RepaymentAccountId = req.AccountId
+		}
+
+		today := schedule.Date(time.Now())
+
+		first_due_date := today.AddDate(0, 1, 0)
+		if req.FirstDueDate != "" {
+			date, err := time.Parse("2006-01-02", req.FirstDueDate)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid first_due_date, expected YYYY-MM-DD"})
+				return
+			}
+			first_due_date = date
+		}
+
+		if !first_due_date.After(today) {
+			ctx.JSON(422, gin.H{"error": "First due date must be after today"})
+			return
+		}
+
+		user_id, err := uuid.Parse(req.UserId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "User not found"})
+			return
+		}
+
+		borrower, err := s.Repositories.UserRepository.GetUserById(user_id)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "User not found"})
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(req.AccountId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		repayment_account, err := s.Repositories.AccountRepository.GetAccount(req.RepaymentAccountId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Repayment account not found"})
+			return
+		}
+
+		if account.UserId != borrower.Id || repayment_account.UserId != borrower.Id {
+			ctx.JSON(400, gin.H{"error": "Accounts must belong to the borrower"})
+			return
+		}
+
+		if account.Status != "active" || repayment_account.Status != "active" {
+			ctx.JSON(400, gin.H{"error": "Accounts must be active"})
+			return
+		}
+
+		if account.Currency != repayment_account.Currency {
+			ctx.JSON(400, gin.H{"error": "Accounts have different currencies"})
+			return
+		}
+
+		if !model.IsValidAmount(req.Principal, account.Currency) || !model.IsValidAmount(req.LateFee, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		installments, err := amortization.Schedule(req.Principal, req.AnnualRate, req.TermMonths, first_due_date, req.Method, model.CurrencyMinorUnits[account.Currency])
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": err.Error()})
+			return
+		}
+
+		admin, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [OriginateLoan] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		loan_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [OriginateLoan] failed to create loan id: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to originate loan"})
+			return
+		}
+
+		disbursement_transaction_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [OriginateLoan] failed to create transaction id: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to originate loan"})
+			return
+		}
+
+		loan := model.Loan{
+			Id:                        loan_id,
+			UserId:                    borrower.Id,
+			AccountId:                 account.Id,
+			RepaymentAccountId:        repayment_account.Id,
+			Currency:                  account.Currency,
+			Principal:                 req.Principal,
+			AnnualRate:                req.AnnualRate,
+			TermMonths:                req.TermMonths,
+			Method:                    req.Method,
+			FirstDueDate:              first_due_date,
+			LateFee:                   req.LateFee,
+			DisbursementTransactionId: disbursement_transaction_id,
+			OriginatedBy:              admin.Id,
+		}
+
+		err = s.Repositories.LoanRepository.OriginateLoan(&loan, installments)
+		if errors.Is(err, repository.ErrCurrencyMismatch) {
+			ctx.JSON(400, gin.H{"error": "Accounts have different currencies"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [OriginateLoan] failed to originate loan: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to originate loan"})
+			return
+		}
+
+		created, err := s.Repositories.LoanRepository.GetLoan(loan_id.String())
+		if err != nil {
+			log.Println("[ERROR] [OriginateLoan] failed to get loan: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to originate loan"})
+			return
+		}
+
+		scheduled, err := s.Repositories.LoanRepository.GetLoanInstallments(loan_id.String())
+		if err != nil {
+			log.Println("[ERROR] [OriginateLoan] failed to get installments: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to originate loan"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetLoanResponse{Loan: *created, Installments: *scheduled}})
+	}
+}
+
+func (s *Server) GetLoans() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+
+		offset, err := strconv.Atoi(ctx.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetLoans] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		loans, err := s.Repositories.LoanRepository.GetLoansByUser(user.Id.String(), limit, offset)
+		if err != nil {
+			log.Println("[ERROR] [GetLoans] failed to get loans: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get loans"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": loans})
+	}
+}
+
+func (s *Server) getOwnedLoan(ctx *gin.Context, handler string) (*model.Loan, bool) {
+	user, err := utils.GetUser(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get user from context: %s\n", handler, err)
+		ctx.Status(401)
+		return nil, false
+	}
+
+	loan, err := s.Repositories.LoanRepository.GetLoan(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Loan not found"})
+		return nil, false
+	}
+
+	if loan.UserId.String() != user.Id.String() {
+		ctx.JSON(401, gin.H{"error": "User is not the owner of the loan"})
+		return nil, false
+	}
+
+	return loan, true
+}
+
+// GetLoan returns the loan with its schedule, the outstanding principal and the late fees charged
+func (s *Server) GetLoan() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		loan, ok := s.getOwnedLoan(ctx, "GetLoan")
+		if !ok {
+			return
+		}
+
+		installments, err := s.Repositories.LoanRepository.GetLoanInstallments(loan.Id.String())
+		if err != nil {
+			log.Println("[ERROR] [GetLoan] failed to get installments: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get loan"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetLoanResponse{Loan: *loan, Installments: *installments}})
+	}
+}
+
+// QuoteLoanPayoff quotes what pays the loan off on a day, today by default
+func (s *Server) QuoteLoanPayoff() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		today := schedule.Date(time.Now())
+
+		as_of := today
+		if ctx.Query("date") != "" {
+			date, err := time.Parse("2006-01-02", ctx.Query("date"))
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+				return
+			}
+			as_of = date
+		}
+
+		if as_of.Before(today) {
+			ctx.JSON(422, gin.H{"error": "Date is in the past"})
+			return
+		}
+
+		loan, ok := s.getOwnedLoan(ctx, "QuoteLoanPayoff")
+		if !ok {
+			return
+		}
+
+		if loan.Status != "active" {
+			ctx.JSON(409, gin.H{"error": "Loan is already paid off"})
+			return
+		}
+
+		quote, err := s.Repositories.LoanRepository.QuoteLoanPayoff(loan, as_of)
+		if err != nil {
+			log.Println("[ERROR] [QuoteLoanPayoff] failed to quote payoff: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to quote loan payoff"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": quote})
+	}
+}
+
+// PayOffLoan repays the whole loan today from its repayment account at the payoff quote of today
+func (s *Server) PayOffLoan() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		loan, ok := s.getOwnedLoan(ctx, "PayOffLoan")
+		if !ok {
+			return
+		}
+
+		transaction_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [PayOffLoan] failed to create transaction id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to pay off loan"})
+			return
+		}
+
+		quote, err := s.Repositories.LoanRepository.PayOffLoan(loan.Id.String(), transaction_id)
+		if errors.Is(err, repository.ErrLoanNotActive) {
+			ctx.JSON(409, gin.H{"error": "Loan is already paid off"})
+			return
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [PayOffLoan] failed to pay off loan: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to pay off loan"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": gin.H{"transaction_id": transaction_id, "quote": quote}})
+	}
+}
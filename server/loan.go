@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/schedule"
+)
+
+const (
+	// wait after an installment the repayment account could not cover before debiting it again
+	LoanInstallmentRetryDelay = 24 * time.Hour
+	// installments collected per cron tick at most
+	loanInstallmentBatchSize = 100
+)
+
+// collectLoanInstallment debits the installment and notifies the borrower the first time it could not be
+func (s *Server) collectLoanInstallment(installment *model.LoanInstallment, now time.Time) (string, error) {
+	status, err := s.Repositories.LoanRepository.CollectLoanInstallment(installment.Id.String(), now.Add(LoanInstallmentRetryDelay))
+	if err != nil {
+		return "", err
+	}
+
+	if status == "late" && installment.Status == "scheduled" {
+		loan, err := s.Repositories.LoanRepository.GetLoan(installment.LoanId.String())
+		if err != nil {
+			return status, err
+		}
+
+		message := fmt.Sprintf(
+			"Installment %d of your loan %s, %s %s due on %s, could not be debited from account %s: Insufficient balance. A late fee of %s %s was charged, it will be debited again tomorrow.",
+			installment.Number,
+			loan.Id,
+			installment.Amount,
+			loan.Currency,
+			installment.DueDate.Format("2006-01-02"),
+			loan.RepaymentAccountId,
+			loan.LateFee,
+			loan.Currency,
+		)
+
+		err = s.Repositories.NotificationRepository.CreateNotification(loan.UserId.String(), "loan_installment_late", message)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	return status, nil
+}
+
+// CollectLoanInstallments debits the installments due up to today from the repayment accounts, oldest first.
+// A loan is skipped for the rest of the run once one of its installments cannot be collected, so later
+// installments are never paid before earlier ones. Returns how many installments were attempted.
+func (s *Server) CollectLoanInstallments() (int, error) {
+	now := time.Now().UTC()
+
+	due, err := s.Repositories.LoanRepository.GetDueLoanInstallments(schedule.Date(now), now, loanInstallmentBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	// loans with an installment left unpaid in this run
+	stopped := map[string]bool{}
+	for i := range *due {
+		installment := &(*due)[i]
+		if stopped[installment.LoanId.String()] {
+			continue
+		}
+
+		attempted++
+		status, err := s.collectLoanInstallment(installment, now)
+		if errors.Is(err, repository.ErrLoanNotActive) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[ERROR] [Loan Collector] failed to collect installment %s: %s\n", installment.Id, err)
+		}
+
+		if status != "paid" {
+			stopped[installment.LoanId.String()] = true
+		}
+	}
+
+	return attempted, nil
+}
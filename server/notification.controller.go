@@ -0,0 +1,71 @@
+package server
+
+import (
+	"log"
+	"strconv"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (s *Server) GetNotifications() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+
+		offset, err := strconv.Atoi(ctx.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetNotifications] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		notifications, err := s.Repositories.NotificationRepository.GetNotifications(user.Id.String(), ctx.Query("unread") == "true", limit, offset)
+		if err != nil {
+			log.Println("[ERROR] [GetNotifications] failed to get notifications: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get notifications"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": notifications})
+	}
+}
+
+func (s *Server) ReadNotification() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		notification_id, err := uuid.Parse(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Notification not found"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [ReadNotification] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		found, err := s.Repositories.NotificationRepository.MarkNotificationRead(notification_id.String(), user.Id.String())
+		if err != nil {
+			log.Println("[ERROR] [ReadNotification] failed to mark notification as read: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to mark notification as read"})
+			return
+		}
+
+		if !found {
+			ctx.JSON(404, gin.H{"error": "Notification not found"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
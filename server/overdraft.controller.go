@@ -0,0 +1,121 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"welloff-bank/model"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+)
+
+type SetOverdraftFacilityRequest struct {
+	// how far below zero the available balance can go, 0 stops new overdrafts
+	Limit decimal.Decimal `json:"limit"`
+	// charged daily on the negative end-of-day balance, as a fraction
+	AnnualRate decimal.Decimal `json:"annual_rate"`
+}
+
+// SetOverdraftFacility grants an overdraft to an account or changes its limit and rate
+func (s *Server) SetOverdraftFacility() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := SetOverdraftFacilityRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if req.Limit.IsNegative() {
+			ctx.JSON(422, gin.H{"error": "Limit must not be negative"})
+			return
+		}
+
+		if req.AnnualRate.IsNegative() || req.AnnualRate.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+			ctx.JSON(422, gin.H{"error": "Annual rate must be a fraction between 0 and 1"})
+			return
+		}
+
+		if !req.AnnualRate.Equal(req.AnnualRate.Truncate(6)) {
+			ctx.JSON(422, gin.H{"error": "Annual rate must have at most 6 decimal places"})
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Account not found"})
+			return
+		}
+
+		if model.IsSystemAccount(account.Id) {
+			ctx.JSON(400, gin.H{"error": "System accounts cannot have an overdraft"})
+			return
+		}
+
+		if !model.IsValidAmount(req.Limit, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Limit has more decimal places than the account currency allows"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [SetOverdraftFacility] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		err = s.Repositories.OverdraftRepository.SetOverdraftFacility(account.Id.String(), req.Limit, req.AnnualRate, user.Id)
+		if err != nil {
+			log.Println("[ERROR] [SetOverdraftFacility] failed to set overdraft facility: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to set overdraft facility"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+type GetAccountOverdraftResponse struct {
+	Facility *model.OverdraftFacility  `json:"facility"`
+	Interest []model.OverdraftInterest `json:"interest"`
+}
+
+// GetAccountOverdraft returns the overdraft facility of the account, nil when it has none, with the interest charged
+func (s *Server) GetAccountOverdraft() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > 366 {
+			limit = 31
+		}
+
+		offset, err := strconv.Atoi(ctx.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		account, ok := s.getOwnedAccount(ctx, "GetAccountOverdraft")
+		if !ok {
+			return
+		}
+
+		facility, err := s.Repositories.OverdraftRepository.GetOverdraftFacility(account.Id.String())
+		if errors.Is(err, sql.ErrNoRows) {
+			facility = nil
+		} else if err != nil {
+			log.Println("[ERROR] [GetAccountOverdraft] failed to get overdraft facility: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get account overdraft"})
+			return
+		}
+
+		charges, err := s.Repositories.OverdraftRepository.GetOverdraftInterest(account.Id.String(), limit, offset)
+		if err != nil {
+			log.Println("[ERROR] [GetAccountOverdraft] failed to get overdraft interest: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get account overdraft"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetAccountOverdraftResponse{Facility: facility, Interest: *charges}})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"log"
+	"time"
+	"welloff-bank/schedule"
+	"welloff-bank/utils"
+)
+
+// overdraft facilities charged per page
+const overdraftInterestBatchSize = 100
+
+// ChargeOverdraftInterest charges every account with an overdraft facility the interest of the days up to
+// yesterday not charged yet, on their end-of-day balance. Days already charged are skipped.
+func (s *Server) ChargeOverdraftInterest() error {
+	today := schedule.Date(time.Now())
+
+	offset := 0
+	for {
+		facilities, err := s.Repositories.OverdraftRepository.GetOverdraftFacilities(overdraftInterestBatchSize, offset)
+		if err != nil {
+			return err
+		}
+
+		for _, facility := range *facilities {
+			account, err := s.Repositories.AccountRepository.GetAccount(facility.AccountId.String())
+			if err != nil {
+				log.Printf("[ERROR] [Overdraft Interest] failed to get account %s: %s\n", facility.AccountId, err)
+				continue
+			}
+
+			last_charge_date, err := s.Repositories.OverdraftRepository.GetLastOverdraftInterestDate(account.Id.String())
+			if err != nil {
+				log.Printf("[ERROR] [Overdraft Interest] failed to get last charge of account %s: %s\n", account.Id, err)
+				continue
+			}
+
+			day := schedule.Date(facility.CreatedAt)
+			if last_charge_date != nil {
+				day = schedule.Date(*last_charge_date).AddDate(0, 0, 1)
+			}
+
+			for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+				balance, err := utils.GetAccountBalanceAt(account, day.AddDate(0, 0, 1).Add(-time.Microsecond), s.Repositories)
+				if err != nil {
+					log.Printf("[ERROR] [Overdraft Interest] failed to get balance of account %s: %s\n", account.Id, err)
+					break
+				}
+
+				_, err = s.Repositories.OverdraftRepository.ChargeOverdraftInterest(account, day, balance, facility.AnnualRate)
+				if err != nil {
+					log.Printf("[ERROR] [Overdraft Interest] failed to charge account %s for %s: %s\n", account.Id, day.Format("2006-01-02"), err)
+					break
+				}
+			}
+		}
+
+		if len(*facilities) < overdraftInterestBatchSize {
+			return nil
+		}
+		offset += overdraftInterestBatchSize
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/pain"
+	"welloff-bank/repository"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/valkey-io/valkey-go"
+)
+
+// Pain001MessageIdTTL is how long Valkey remembers the message id of an imported file to turn duplicates away early
+const Pain001MessageIdTTL = 90 * 24 * time.Hour
+
+var errDuplicatePain001 = errors.New("pain.001 message id was already imported")
+
+// bookCreditTransfer runs one CdtTrfTxInf through the same checks as a transfer, turning failures into reason codes
+func (s *Server) bookCreditTransfer(user *model.User, instruction *pain.PaymentInstruction, transfer *pain.CreditTransfer) pain.TransactionStatus {
+	status := pain.TransactionStatus{
+		InstrId:    transfer.InstrId,
+		EndToEndId: transfer.EndToEndId,
+		Status:     pain.StatusRejected,
+	}
+
+	from_account_id, err := uuid.Parse(instruction.DebtorAccount)
+	if err != nil {
+		status.Reason = pain.ReasonInvalidDebtorAccount
+		status.AdditionalInfo = "Debtor account is not a Welloff Bank account id"
+		return status
+	}
+
+	to_account_id, err := uuid.Parse(transfer.CreditorAccount)
+	if err != nil {
+		status.Reason = pain.ReasonInvalidCreditorAccount
+		status.AdditionalInfo = "Creditor account is not a Welloff Bank account id"
+		return status
+	}
+
+	if !transfer.Amount.IsPositive() {
+		status.Reason = pain.ReasonInvalidAmount
+		status.AdditionalInfo = "Amount must be positive"
+		return status
+	}
+
+	account, err := s.Repositories.AccountRepository.GetAccount(from_account_id.String())
+	if err != nil {
+		status.Reason = pain.ReasonInvalidDebtorAccount
+		status.AdditionalInfo = "Debtor account not found"
+		return status
+	}
+
+	if account.Currency != transfer.Currency {
+		status.Reason = pain.ReasonNotAllowedCurrency
+		status.AdditionalInfo = "Instructed currency differs from the debtor account currency " + account.Currency
+		return status
+	}
+
+	transaction_id, check, err := utils.Transfer(user, from_account_id.String(), to_account_id.String(), transfer.Amount, s.FraudRules, s.Repositories)
+	switch {
+	case err == nil && check.Status == "pending":
+		status.Status = pain.StatusPending
+		status.TransactionId = transaction_id.String()
+	case err == nil:
+		status.Status = pain.StatusAccepted
+		status.TransactionId = transaction_id.String()
+	case errors.Is(err, utils.ErrTransactionBlocked):
+		status.Reason = pain.ReasonFraudulentOrigin
+		status.AdditionalInfo = "Transaction blocked"
+	case errors.Is(err, utils.ErrSourceAccountNotFound):
+		status.Reason = pain.ReasonInvalidDebtorAccount
+		status.AdditionalInfo = "Debtor account not found"
+	case errors.Is(err, utils.ErrDestinationAccountNotFound):
+		status.Reason = pain.ReasonInvalidCreditorAccount
+		status.AdditionalInfo = "Creditor account not found"
+	case errors.Is(err, utils.ErrNotAccountOwner):
+		status.Reason = pain.ReasonTransactionForbidden
+		status.AdditionalInfo = "User is not the owner of the debtor account"
+	case errors.Is(err, repository.ErrInvalidAmount):
+		status.Reason = pain.ReasonInvalidDecimalPlaces
+		status.AdditionalInfo = "Amount has more decimal places than the account currency allows"
+	case errors.Is(err, repository.ErrCurrencyMismatch):
+		status.Reason = pain.ReasonNotAllowedCurrency
+		status.AdditionalInfo = "Creditor account has a different currency"
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		status.Reason = pain.ReasonInsufficientFunds
+		status.AdditionalInfo = "Insufficient balance"
+	default:
+		log.Println("[ERROR] [ImportPain001] failed to create transaction: ", err)
+		status.Reason = pain.ReasonNotSpecified
+		status.AdditionalInfo = "Failed to complete transfer transaction"
+	}
+
+	return status
+}
+
+// ImportPain001 books every credit transfer of an uploaded pain.001 file and answers with a pain.002 status report.
+// The file is either the raw request body or the "file" field of a multipart form, and it is read as a stream.
+func (s *Server) ImportPain001() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [ImportPain001] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		var body io.Reader = ctx.Request.Body
+		if strings.HasPrefix(ctx.ContentType(), "multipart/form-data") {
+			file_header, err := ctx.FormFile("file")
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Missing file"})
+				return
+			}
+
+			file, err := file_header.Open()
+			if err != nil {
+				log.Println("[ERROR] [ImportPain001] failed to open uploaded file: ", err)
+				rolledBack(ctx)
+				ctx.JSON(500, gin.H{"error": "Failed to import file"})
+				return
+			}
+			defer file.Close()
+			body = file
+		}
+
+		message_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [ImportPain001] failed to create message id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to import file"})
+			return
+		}
+
+		report := pain.StatusReport{
+			MsgId:     strings.ReplaceAll(message_id.String(), "-", ""),
+			CreatedAt: time.Now().UTC(),
+		}
+		transfers := 0
+		var header_err error
+
+		valkey_client := s.Repositories.Valkey
+		err = pain.ReadPain001(body, pain.Pain001Handler{
+			GroupHeader: func(header *pain.GroupHeader) error {
+				report.OriginalMsgId = header.MsgId
+				report.OriginalMsgNmId = header.MsgNmId
+
+				// Valkey turns most duplicates away early, Postgres remembers the message id for good before booking
+				key := "pain001:" + user.Id.String() + ":" + header.MsgId
+				err := valkey_client.Do(context.Background(), valkey_client.B().Set().Key(key).Value(report.MsgId).Nx().Ex(Pain001MessageIdTTL).Build()).Error()
+				if valkey.IsValkeyNil(err) {
+					return errDuplicatePain001
+				}
+				if err != nil {
+					header_err = err
+					return err
+				}
+
+				created, err := s.Repositories.TransactionRepository.CreatePain001Message(user.Id.String(), header.MsgId, report.MsgId)
+				if err != nil {
+					// the message id was not imported, a retry must not be turned away by Valkey
+					valkey_client.Do(context.Background(), valkey_client.B().Del().Key(key).Build())
+					header_err = err
+					return err
+				}
+				if !created {
+					return errDuplicatePain001
+				}
+
+				return nil
+			},
+			CreditTransfer: func(instruction *pain.PaymentInstruction, transfer *pain.CreditTransfer) error {
+				transfers++
+				report.Add(instruction.PmtInfId, s.bookCreditTransfer(user, instruction, transfer))
+				return nil
+			},
+		})
+
+		status := 200
+		switch {
+		case err == nil:
+		case errors.Is(err, errDuplicatePain001):
+			status = 409
+			report.GroupReason = pain.ReasonDuplicateMessage
+			report.GroupAdditionalInfo = "A file with this message id was already imported"
+		case header_err != nil:
+			log.Println("[ERROR] [ImportPain001] failed to store message id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to import file"})
+			return
+		case report.OriginalMsgId == "":
+			ctx.JSON(422, gin.H{"error": "Invalid pain.001 file"})
+			return
+		default:
+			// the transfers read so far are booked, the report says where the file stopped making sense
+			report.GroupReason = pain.ReasonInvalidFileFormat
+			report.GroupAdditionalInfo = fmt.Sprintf("File could not be read after %d transfers: %s", transfers, err)
+		}
+
+		var content bytes.Buffer
+		err = pain.RenderPain002(&content, &report)
+		if err != nil {
+			log.Println("[ERROR] [ImportPain001] failed to render status report: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to import file"})
+			return
+		}
+
+		ctx.Data(status, "application/xml", content.Bytes())
+	}
+}
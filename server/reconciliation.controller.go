@@ -0,0 +1,424 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"welloff-bank/model"
+	"welloff-bank/reconciliation"
+	"welloff-bank/repository"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ImportReconciliationStatementResponse struct {
+	Import model.ReconciliationImport `json:"import"`
+	// statement lines and transactions left in the reconciliation queue
+	UnmatchedLines        int `json:"unmatched_lines"`
+	UnmatchedTransactions int `json:"unmatched_transactions"`
+}
+
+// columnMapping reads the column mapping of the partner bank from the query, falling back to the default one,
+// returning the error message for the client when it is invalid
+func columnMapping(ctx *gin.Context) (reconciliation.ColumnMapping, string) {
+	mapping := reconciliation.DefaultColumnMapping
+
+	for name, field := range map[string]*string{
+		"date_column":        &mapping.Date,
+		"date_format":        &mapping.DateFormat,
+		"amount_column":      &mapping.Amount,
+		"credit_column":      &mapping.Credit,
+		"debit_column":       &mapping.Debit,
+		"reference_column":   &mapping.Reference,
+		"description_column": &mapping.Description,
+	} {
+		value, ok := ctx.GetQuery(name)
+		if ok {
+			*field = value
+		}
+	}
+
+	// separate credit and debit columns replace the amount one
+	if mapping.Credit != "" && mapping.Debit != "" && ctx.Query("amount_column") == "" {
+		mapping.Amount = ""
+	}
+
+	delimiter := ctx.Query("delimiter")
+	if delimiter != "" {
+		if delimiter == "tab" {
+			delimiter = "\t"
+		}
+
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) {
+			return mapping, "Delimiter must be a single character"
+		}
+		mapping.Delimiter = r
+	}
+
+	mapping.DecimalComma = ctx.Query("decimal_comma") == "true"
+
+	return mapping, ""
+}
+
+// ImportReconciliationStatement reconciles a CSV statement of the partner bank against the deposits and withdrawals
+// in the given currency. The file is the raw body or the "file" field of a multipart form, the column mapping and
+// the matching window in days come from the query.
+func (s *Server) ImportReconciliationStatement() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [ImportReconciliationStatement] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		currency := strings.ToUpper(ctx.Query("currency"))
+		if !model.IsValidCurrency(currency) {
+			ctx.JSON(422, gin.H{"error": "Invalid currency"})
+			return
+		}
+
+		window := reconciliation.DefaultWindow
+		window_days := ctx.Query("window_days")
+		if window_days != "" {
+			days, err := strconv.Atoi(window_days)
+			if err != nil || days < 0 || days > 31 {
+				ctx.JSON(422, gin.H{"error": "Window must be between 0 and 31 days"})
+				return
+			}
+			window = time.Duration(days) * 24 * time.Hour
+		}
+
+		mapping, message := columnMapping(ctx)
+		if message != "" {
+			ctx.JSON(422, gin.H{"error": message})
+			return
+		}
+
+		var body io.Reader = ctx.Request.Body
+		file_name := "statement.csv"
+		if strings.HasPrefix(ctx.ContentType(), "multipart/form-data") {
+			file_header, err := ctx.FormFile("file")
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Missing file"})
+				return
+			}
+
+			file, err := file_header.Open()
+			if err != nil {
+				log.Println("[ERROR] [ImportReconciliationStatement] failed to open uploaded file: ", err)
+				ctx.JSON(500, gin.H{"error": "Failed to import statement"})
+				return
+			}
+			defer file.Close()
+			body = file
+			file_name = file_header.Filename
+		}
+
+		parsed_lines, err := reconciliation.ParseStatementCSV(body, mapping)
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid statement: " + err.Error()})
+			return
+		}
+
+		if len(parsed_lines) == 0 {
+			ctx.JSON(422, gin.H{"error": "Statement has no lines"})
+			return
+		}
+
+		for _, line := range parsed_lines {
+			if !model.IsValidAmount(line.Amount, currency) {
+				ctx.JSON(422, gin.H{"error": "Invalid statement: line " + strconv.Itoa(line.LineNumber) + " has more decimal places than the currency allows"})
+				return
+			}
+		}
+
+		date_from, date_to := parsed_lines[0].BookedOn, parsed_lines[0].BookedOn
+		for _, line := range parsed_lines {
+			if line.BookedOn.Before(date_from) {
+				date_from = line.BookedOn
+			}
+			if line.BookedOn.After(date_to) {
+				date_to = line.BookedOn
+			}
+		}
+		period_end := date_to.AddDate(0, 0, 1)
+
+		transactions, err := s.Repositories.ReconciliationRepository.GetReconciliationCandidates(currency, date_from.Add(-window), period_end.Add(window))
+		if err != nil {
+			log.Println("[ERROR] [ImportReconciliationStatement] failed to get transactions: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to import statement"})
+			return
+		}
+
+		matches := reconciliation.MatchLines(parsed_lines, *transactions, window)
+
+		import_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [ImportReconciliationStatement] failed to create import id: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to import statement"})
+			return
+		}
+
+		lines := make([]model.StatementLine, len(parsed_lines))
+		for i, line := range parsed_lines {
+			line_id, err := uuid.NewV7()
+			if err != nil {
+				log.Println("[ERROR] [ImportReconciliationStatement] failed to create line id: ", err)
+				ctx.JSON(500, gin.H{"error": "Failed to import statement"})
+				return
+			}
+
+			lines[i] = model.StatementLine{
+				Id:          line_id,
+				ImportId:    import_id,
+				LineNumber:  line.LineNumber,
+				BookedOn:    line.BookedOn,
+				Amount:      line.Amount,
+				Currency:    currency,
+				Reference:   line.Reference,
+				Description: line.Description,
+				Status:      "unmatched",
+			}
+		}
+
+		matched := map[uuid.UUID]bool{}
+		for _, match := range matches {
+			transaction_id := match.TransactionId
+			lines[match.Line].Status = "matched"
+			lines[match.Line].TransactionId = &transaction_id
+			matched[transaction_id] = true
+		}
+
+		// transactions only reach the queue when they belong to the statement period, the ones
+		// around it were only candidates for the lines near its edges
+		unmatched_transaction_ids := []uuid.UUID{}
+		for _, transaction := range *transactions {
+			if matched[transaction.Id] || transaction.DateIssued.Before(date_from) || !transaction.DateIssued.Before(period_end) {
+				continue
+			}
+			unmatched_transaction_ids = append(unmatched_transaction_ids, transaction.Id)
+		}
+
+		reconciliation_import := model.ReconciliationImport{
+			Id:           import_id,
+			UserId:       user.Id,
+			FileName:     file_name,
+			Currency:     currency,
+			DateFrom:     date_from,
+			DateTo:       date_to,
+			LineCount:    len(lines),
+			MatchedCount: len(matches),
+			CreatedAt:    time.Now().UTC(),
+		}
+
+		err = s.Repositories.ReconciliationRepository.CreateReconciliationImport(&reconciliation_import, lines, unmatched_transaction_ids)
+		if err != nil {
+			log.Println("[ERROR] [ImportReconciliationStatement] failed to store import: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to import statement"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": ImportReconciliationStatementResponse{
+			Import:                reconciliation_import,
+			UnmatchedLines:        len(lines) - len(matches),
+			UnmatchedTransactions: len(unmatched_transaction_ids),
+		}})
+	}
+}
+
+type GetReconciliationImportResponse struct {
+	Import model.ReconciliationImport `json:"import"`
+	Lines  []model.StatementLine      `json:"lines"`
+}
+
+func (s *Server) GetReconciliationImport() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		import_id := ctx.Param("id")
+
+		reconciliation_import, err := s.Repositories.ReconciliationRepository.GetReconciliationImport(import_id)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Import not found"})
+			return
+		}
+
+		lines, err := s.Repositories.ReconciliationRepository.GetStatementLines(import_id)
+		if err != nil {
+			log.Println("[ERROR] [GetReconciliationImport] failed to get statement lines: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get import"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetReconciliationImportResponse{Import: *reconciliation_import, Lines: *lines}})
+	}
+}
+
+// GetReconciliationItems lists the reconciliation queue, the open items unless another status is asked for
+func (s *Server) GetReconciliationItems() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		status := ctx.DefaultQuery("status", "open")
+		if status != "open" && status != "matched" && status != "adjusted" && status != "dismissed" {
+			ctx.JSON(422, gin.H{"error": "Invalid status"})
+			return
+		}
+
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+
+		offset, err := strconv.Atoi(ctx.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		items, err := s.Repositories.ReconciliationRepository.GetReconciliationItems(status, limit, offset)
+		if err != nil {
+			log.Println("[ERROR] [GetReconciliationItems] failed to get reconciliation items: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get reconciliation items"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": items})
+	}
+}
+
+type ResolveReconciliationItemRequest struct {
+	// the other side of a manual match, a transaction for a statement line item or a line for a transaction item
+	TransactionId   *uuid.UUID `json:"transaction_id"`
+	StatementLineId *uuid.UUID `json:"statement_line_id"`
+	Note            string     `json:"note"`
+}
+
+// resolveReconciliationItem binds the request and loads the open item, answering the client when it can't
+func (s *Server) resolveReconciliationItem(ctx *gin.Context, handler string) (*model.User, *model.ReconciliationItem, *ResolveReconciliationItemRequest, bool) {
+	req := ResolveReconciliationItemRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(422, gin.H{"error": "Invalid input"})
+		return nil, nil, nil, false
+	}
+
+	user, err := utils.GetUser(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get user from context: %s\n", handler, err)
+		ctx.Status(401)
+		return nil, nil, nil, false
+	}
+
+	item, err := s.Repositories.ReconciliationRepository.GetReconciliationItem(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Reconciliation item not found"})
+		return nil, nil, nil, false
+	}
+
+	if item.Status != "open" {
+		ctx.JSON(409, gin.H{"error": "Reconciliation item is already resolved"})
+		return nil, nil, nil, false
+	}
+
+	return user, item, &req, true
+}
+
+func reconciliationError(ctx *gin.Context, handler string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrReconciliationItemNotOpen):
+		ctx.JSON(409, gin.H{"error": "Reconciliation item is already resolved"})
+	case errors.Is(err, repository.ErrAlreadyReconciled):
+		ctx.JSON(409, gin.H{"error": "Statement line or transaction is already reconciled"})
+	case errors.Is(err, repository.ErrReconciliationAmountMismatch):
+		ctx.JSON(422, gin.H{"error": "Statement line and transaction do not have the same amount and currency"})
+	case errors.Is(err, sql.ErrNoRows):
+		ctx.JSON(404, gin.H{"error": "Statement line or transaction not found"})
+	default:
+		log.Printf("[ERROR] [%s] failed to resolve reconciliation item: %s\n", handler, err)
+		ctx.JSON(500, gin.H{"error": "Failed to resolve reconciliation item"})
+	}
+}
+
+// MatchReconciliationItem matches a queued statement line with a transaction, or a queued transaction with a line
+func (s *Server) MatchReconciliationItem() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, item, req, ok := s.resolveReconciliationItem(ctx, "MatchReconciliationItem")
+		if !ok {
+			return
+		}
+
+		var statement_line_id, transaction_id uuid.UUID
+		if item.StatementLineId != nil {
+			if req.TransactionId == nil {
+				ctx.JSON(422, gin.H{"error": "Missing transaction_id"})
+				return
+			}
+			statement_line_id, transaction_id = *item.StatementLineId, *req.TransactionId
+		} else {
+			if req.StatementLineId == nil {
+				ctx.JSON(422, gin.H{"error": "Missing statement_line_id"})
+				return
+			}
+			statement_line_id, transaction_id = *req.StatementLineId, *item.TransactionId
+		}
+
+		err := s.Repositories.ReconciliationRepository.MatchReconciliationItem(item.Id.String(), statement_line_id, transaction_id, req.Note, user.Id)
+		if err != nil {
+			reconciliationError(ctx, "MatchReconciliationItem", err)
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
+
+// AdjustReconciliationItem books an adjusting transaction against the suspense account for the queued item
+func (s *Server) AdjustReconciliationItem() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, item, req, ok := s.resolveReconciliationItem(ctx, "AdjustReconciliationItem")
+		if !ok {
+			return
+		}
+
+		transaction_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [AdjustReconciliationItem] failed to create transaction id: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to resolve reconciliation item"})
+			return
+		}
+
+		err = s.Repositories.ReconciliationRepository.AdjustReconciliationItem(item.Id.String(), transaction_id, req.Note, user.Id)
+		if err != nil {
+			reconciliationError(ctx, "AdjustReconciliationItem", err)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": gin.H{"transaction_id": transaction_id}})
+	}
+}
+
+func (s *Server) DismissReconciliationItem() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, item, req, ok := s.resolveReconciliationItem(ctx, "DismissReconciliationItem")
+		if !ok {
+			return
+		}
+
+		if strings.TrimSpace(req.Note) == "" {
+			ctx.JSON(422, gin.H{"error": "A note is required to dismiss an item"})
+			return
+		}
+
+		err := s.Repositories.ReconciliationRepository.DismissReconciliationItem(item.Id.String(), req.Note, user.Id)
+		if err != nil {
+			reconciliationError(ctx, "DismissReconciliationItem", err)
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// how much of the account an operator sees when inspecting a review
+const reviewHistoryLimit = 50
+
+// heldResponse answers that the transaction was held for review, telling the customer the limit it went over
+// but not the fraud rules it matched
+func heldResponse(ctx *gin.Context, check *utils.OutboundCheck, payload gin.H) {
+	payload["status"] = check.Status
+	if check.Exceeded != nil {
+		payload["limit"] = check.Exceeded
+	}
+
+	ctx.JSON(202, gin.H{"payload": payload})
+}
+
+// holdForReview puts the transaction, or batch, made pending after its checks in the review queue and answers the client
+func (s *Server) holdForReview(ctx *gin.Context, handler string, check *utils.OutboundCheck, transaction_id *uuid.UUID, batch_id *uuid.UUID, payload gin.H) {
+	_, err := utils.HoldForReview(check, transaction_id, batch_id, s.Repositories)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to hold transaction for review: %s\n", handler, err)
+		ctx.JSON(500, gin.H{"error": "Failed to hold transaction for review"})
+		return
+	}
+
+	heldResponse(ctx, check, payload)
+}
+
+func (s *Server) GetTransactionReviews() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		status := ctx.DefaultQuery("status", "pending")
+		if status != "pending" && status != "approved" && status != "rejected" {
+			ctx.JSON(422, gin.H{"error": "Invalid status"})
+			return
+		}
+
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+
+		offset, err := strconv.Atoi(ctx.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		reviews, err := s.Repositories.ReviewRepository.GetTransactionReviews(status, limit, offset)
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionReviews] failed to get reviews: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction reviews"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": reviews})
+	}
+}
+
+type GetTransactionReviewResponse struct {
+	model.TransactionReview
+	// the held transaction, or the legs of the batch
+	Transactions []model.Transaction `json:"transactions"`
+	Account      model.Account       `json:"account"`
+	// latest transactions of the account
+	History []model.AccountTransaction `json:"history"`
+	// what the fraud rules decided for the latest transactions of the account
+	FraudDecisions []model.FraudDecision `json:"fraud_decisions"`
+	// latest reviews of the account, this one included
+	Reviews []model.TransactionReview `json:"reviews"`
+}
+
+// GetTransactionReview returns a review with what an operator needs to decide it: the held transactions,
+// the history of the account, and the prior fraud decisions and reviews of the account
+func (s *Server) GetTransactionReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		review, err := s.Repositories.ReviewRepository.GetTransactionReview(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Transaction review not found"})
+			return
+		}
+
+		var transactions *[]model.Transaction
+		if review.BatchId != nil {
+			transactions, err = s.Repositories.TransactionBatchRepository.GetTransactionsByBatch(review.BatchId.String())
+		} else {
+			var transaction *model.Transaction
+			transaction, err = s.Repositories.TransactionRepository.GetTransaction(review.TransactionId.String())
+			if err == nil {
+				transactions = &[]model.Transaction{*transaction}
+			}
+		}
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionReview] failed to get held transactions: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction review"})
+			return
+		}
+
+		account, err := s.Repositories.AccountRepository.GetAccount(review.AccountId.String())
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionReview] failed to get account: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction review"})
+			return
+		}
+
+		history, err := s.Repositories.TransactionRepository.GetAccountHistory(account.Id.String(), repository.TransactionFilter{Limit: reviewHistoryLimit})
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionReview] failed to get account history: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction review"})
+			return
+		}
+
+		decisions, err := s.Repositories.FraudRepository.GetFraudDecisions(account.Id.String(), reviewHistoryLimit, 0)
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionReview] failed to get fraud decisions: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction review"})
+			return
+		}
+
+		reviews, err := s.Repositories.ReviewRepository.GetTransactionReviewsByAccount(account.Id.String(), reviewHistoryLimit, 0)
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionReview] failed to get account reviews: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction review"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetTransactionReviewResponse{
+			TransactionReview: *review,
+			Transactions:      *transactions,
+			Account:           *account,
+			History:           *history,
+			FraudDecisions:    *decisions,
+			Reviews:           *reviews,
+		}})
+	}
+}
+
+type DecideTransactionReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+// decideTransactionReview binds the request, answering the client when it can't
+func decideTransactionReview(ctx *gin.Context, handler string) (*model.User, *DecideTransactionReviewRequest, bool) {
+	req := DecideTransactionReviewRequest{}
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(422, gin.H{"error": "Invalid input"})
+		return nil, nil, false
+	}
+
+	if len(req.Reason) > 255 {
+		ctx.JSON(422, gin.H{"error": "Reason must have at most 255 characters"})
+		return nil, nil, false
+	}
+
+	user, err := utils.GetUser(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get user from context: %s\n", handler, err)
+		ctx.Status(401)
+		return nil, nil, false
+	}
+
+	return user, &req, true
+}
+
+func reviewError(ctx *gin.Context, handler string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrReviewNotPending):
+		ctx.JSON(409, gin.H{"error": "Transaction review is already decided"})
+	case errors.Is(err, sql.ErrNoRows):
+		ctx.JSON(404, gin.H{"error": "Transaction review not found"})
+	default:
+		log.Printf("[ERROR] [%s] failed to decide transaction review: %s\n", handler, err)
+		ctx.JSON(500, gin.H{"error": "Failed to decide transaction review"})
+	}
+}
+
+// notifyReviewDecision tells the customer what became of the held transaction
+func (s *Server) notifyReviewDecision(review *model.TransactionReview, handler string) {
+	var subject string
+	if review.BatchId != nil {
+		subject = "batch transfer " + review.BatchId.String()
+	} else {
+		subject = "transaction " + review.TransactionId.String()
+	}
+
+	message := fmt.Sprintf("Your %s of %s %s was approved after review.", subject, review.Amount, review.Currency)
+	if review.Status == "rejected" {
+		message = fmt.Sprintf("Your %s of %s %s was rejected after review.", subject, review.Amount, review.Currency)
+	}
+
+	err := s.Repositories.NotificationRepository.CreateNotification(review.UserId.String(), "transaction_"+review.Status, message)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to notify review decision: %s\n", handler, err)
+	}
+}
+
+// ApproveTransactionReview posts the transactions held with the review
+func (s *Server) ApproveTransactionReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, req, ok := decideTransactionReview(ctx, "ApproveTransactionReview")
+		if !ok {
+			return
+		}
+
+		review, err := s.Repositories.ReviewRepository.ApproveTransactionReview(ctx.Param("id"), req.Reason, user.Id)
+		if err != nil {
+			reviewError(ctx, "ApproveTransactionReview", err)
+			return
+		}
+
+		s.notifyReviewDecision(review, "ApproveTransactionReview")
+
+		ctx.JSON(200, gin.H{"payload": review})
+	}
+}
+
+// RejectTransactionReview fails the transactions held with the review, a reason is required
+func (s *Server) RejectTransactionReview() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, req, ok := decideTransactionReview(ctx, "RejectTransactionReview")
+		if !ok {
+			return
+		}
+
+		if strings.TrimSpace(req.Reason) == "" {
+			ctx.JSON(422, gin.H{"error": "A reason is required to reject a transaction"})
+			return
+		}
+
+		review, err := s.Repositories.ReviewRepository.RejectTransactionReview(ctx.Param("id"), req.Reason, user.Id)
+		if err != nil {
+			reviewError(ctx, "RejectTransactionReview", err)
+			return
+		}
+
+		// the failed transactions no longer count against the limits of the account
+		err = utils.ResetLimitCounters(review.AccountId, s.Repositories)
+		if err != nil {
+			log.Println("[ERROR] [RejectTransactionReview] failed to reset limit counters: ", err)
+		}
+
+		s.notifyReviewDecision(review, "RejectTransactionReview")
+
+		ctx.JSON(200, gin.H{"payload": review})
+	}
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/schedule"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+type CreateScheduledTransferRequest struct {
+	Amount        decimal.Decimal `json:"amount"`
+	FromAccountId string          `json:"from_account_id"`
+	ToAccountId   string          `json:"to_account_id"`
+	Description   string          `json:"description"`
+	// 'once' | 'daily' | 'weekly' | 'monthly'
+	Frequency string `json:"frequency"`
+	// YYYY-MM-DD, the first occurrence
+	StartDate string `json:"start_date"`
+	// YYYY-MM-DD, no occurrence after it
+	EndDate *string `json:"end_date"`
+	// number of occurrences
+	Count *int `json:"count"`
+	// 'none' | 'following' | 'preceding' | 'modified_following', defaults to following
+	BusinessDayAdjustment string `json:"business_day_adjustment"`
+}
+
+func (s *Server) CreateScheduledTransfer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := CreateScheduledTransferRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
+		if req.FromAccountId == req.ToAccountId {
+			ctx.JSON(422, gin.H{"error": "Source and destination accounts must differ"})
+			return
+		}
+
+		if len(req.Description) > 255 {
+			ctx.JSON(422, gin.H{"error": "Description must have at most 255 characters"})
+			return
+		}
+
+		today := schedule.Date(time.Now())
+
+		start_date, err := time.Parse("2006-01-02", req.StartDate)
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid start_date, expected YYYY-MM-DD"})
+			return
+		}
+
+		if start_date.Before(today) {
+			ctx.JSON(422, gin.H{"error": "Start date is in the past"})
+			return
+		}
+
+		var end_date *time.Time
+		if req.EndDate != nil {
+			date, err := time.Parse("2006-01-02", *req.EndDate)
+			if err != nil {
+				ctx.JSON(422, gin.H{"error": "Invalid end_date, expected YYYY-MM-DD"})
+				return
+			}
+			end_date = &date
+		}
+
+		if req.BusinessDayAdjustment == "" {
+			req.BusinessDayAdjustment = schedule.Following
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [CreateScheduledTransfer] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		from_account, err := s.Repositories.AccountRepository.GetAccount(req.FromAccountId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Source account not found"})
+			return
+		}
+
+		if from_account.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+			return
+		}
+
+		to_account, err := s.Repositories.AccountRepository.GetAccount(req.ToAccountId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Destination account not found"})
+			return
+		}
+
+		if from_account.Currency != to_account.Currency {
+			ctx.JSON(422, gin.H{"error": "Accounts have different currencies"})
+			return
+		}
+
+		if !model.IsValidAmount(req.Amount, from_account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		scheduled_transfer_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [CreateScheduledTransfer] failed to create scheduled transfer id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to create scheduled transfer"})
+			return
+		}
+
+		scheduled_transfer := model.ScheduledTransfer{
+			Id:                    scheduled_transfer_id,
+			UserId:                user.Id,
+			FromAccountId:         from_account.Id,
+			ToAccountId:           to_account.Id,
+			Amount:                req.Amount,
+			Description:           req.Description,
+			Frequency:             req.Frequency,
+			StartDate:             start_date,
+			EndDate:               end_date,
+			MaxExecutions:         req.Count,
+			BusinessDayAdjustment: req.BusinessDayAdjustment,
+			Status:                "active",
+		}
+
+		err = recurrence(&scheduled_transfer).Validate()
+		if err != nil {
+			ctx.JSON(422, gin.H{"error": err.Error()})
+			return
+		}
+
+		// a start date moved back to the previous business day may already be gone
+		moveToOccurrence(&scheduled_transfer, 0, today)
+		if scheduled_transfer.NextRunOn == nil {
+			ctx.JSON(422, gin.H{"error": "Schedule has no occurrence from today on"})
+			return
+		}
+
+		err = s.Repositories.ScheduledTransferRepository.CreateScheduledTransfer(&scheduled_transfer)
+		if err != nil {
+			log.Println("[ERROR] [CreateScheduledTransfer] failed to create scheduled transfer: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to create scheduled transfer"})
+			return
+		}
+
+		created, err := s.Repositories.ScheduledTransferRepository.GetScheduledTransfer(scheduled_transfer_id.String())
+		if err != nil {
+			log.Println("[ERROR] [CreateScheduledTransfer] failed to get scheduled transfer: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to create scheduled transfer"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": created})
+	}
+}
+
+func (s *Server) GetScheduledTransfers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit, err := strconv.Atoi(ctx.Query("limit"))
+		if err != nil || limit <= 0 || limit > 100 {
+			limit = 20
+		}
+
+		offset, err := strconv.Atoi(ctx.Query("offset"))
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetScheduledTransfers] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		scheduled_transfers, err := s.Repositories.ScheduledTransferRepository.GetScheduledTransfersByUser(user.Id.String(), limit, offset)
+		if err != nil {
+			log.Println("[ERROR] [GetScheduledTransfers] failed to get scheduled transfers: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get scheduled transfers"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": scheduled_transfers})
+	}
+}
+
+func (s *Server) getOwnedScheduledTransfer(ctx *gin.Context, handler string) (*model.ScheduledTransfer, bool) {
+	user, err := utils.GetUser(ctx)
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to get user from context: %s\n", handler, err)
+		ctx.Status(401)
+		return nil, false
+	}
+
+	scheduled_transfer, err := s.Repositories.ScheduledTransferRepository.GetScheduledTransfer(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(404, gin.H{"error": "Scheduled transfer not found"})
+		return nil, false
+	}
+
+	if scheduled_transfer.UserId.String() != user.Id.String() {
+		ctx.JSON(401, gin.H{"error": "User is not the owner of the scheduled transfer"})
+		return nil, false
+	}
+
+	return scheduled_transfer, true
+}
+
+type GetScheduledTransferResponse struct {
+	model.ScheduledTransfer
+	Executions []model.ScheduledTransferExecution `json:"executions"`
+}
+
+func (s *Server) GetScheduledTransfer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scheduled_transfer, ok := s.getOwnedScheduledTransfer(ctx, "GetScheduledTransfer")
+		if !ok {
+			return
+		}
+
+		executions, err := s.Repositories.ScheduledTransferRepository.GetScheduledTransferExecutions(scheduled_transfer.Id.String())
+		if err != nil {
+			log.Println("[ERROR] [GetScheduledTransfer] failed to get executions: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get scheduled transfer"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetScheduledTransferResponse{ScheduledTransfer: *scheduled_transfer, Executions: *executions}})
+	}
+}
+
+// updateScheduledTransferStatus answers the client for a status change of the scheduled transfer
+func (s *Server) updateScheduledTransferStatus(ctx *gin.Context, handler string, scheduled_transfer *model.ScheduledTransfer, from_statuses []string) {
+	err := s.Repositories.ScheduledTransferRepository.UpdateScheduledTransferStatus(
+		scheduled_transfer.Id.String(),
+		from_statuses,
+		scheduled_transfer.Status,
+		scheduled_transfer.Occurrence,
+		scheduled_transfer.NextRunOn,
+	)
+	if errors.Is(err, repository.ErrInvalidScheduledTransferStatus) {
+		ctx.JSON(409, gin.H{"error": "Scheduled transfer cannot be " + scheduled_transfer.Status})
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [%s] failed to update scheduled transfer: %s\n", handler, err)
+		ctx.JSON(500, gin.H{"error": "Failed to update scheduled transfer"})
+		return
+	}
+
+	ctx.Status(200)
+}
+
+func (s *Server) PauseScheduledTransfer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scheduled_transfer, ok := s.getOwnedScheduledTransfer(ctx, "PauseScheduledTransfer")
+		if !ok {
+			return
+		}
+
+		scheduled_transfer.Status = "paused"
+		s.updateScheduledTransferStatus(ctx, "PauseScheduledTransfer", scheduled_transfer, []string{"active"})
+	}
+}
+
+// ResumeScheduledTransfer reactivates a paused scheduled transfer, the occurrences missed while paused are skipped
+func (s *Server) ResumeScheduledTransfer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scheduled_transfer, ok := s.getOwnedScheduledTransfer(ctx, "ResumeScheduledTransfer")
+		if !ok {
+			return
+		}
+
+		scheduled_transfer.Status = "active"
+		moveToOccurrence(scheduled_transfer, scheduled_transfer.Occurrence, schedule.Date(time.Now()))
+		s.updateScheduledTransferStatus(ctx, "ResumeScheduledTransfer", scheduled_transfer, []string{"paused"})
+	}
+}
+
+func (s *Server) CancelScheduledTransfer() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		scheduled_transfer, ok := s.getOwnedScheduledTransfer(ctx, "CancelScheduledTransfer")
+		if !ok {
+			return
+		}
+
+		scheduled_transfer.Status = "cancelled"
+		scheduled_transfer.NextRunOn = nil
+		s.updateScheduledTransferStatus(ctx, "CancelScheduledTransfer", scheduled_transfer, []string{"active", "paused"})
+	}
+}
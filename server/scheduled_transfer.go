@@ -0,0 +1,194 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/schedule"
+	"welloff-bank/utils"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// attempts of an occurrence after the first one when the account cannot cover the transfer
+	ScheduledTransferMaxRetries = 3
+	ScheduledTransferRetryDelay = 2 * time.Hour
+	// scheduled transfers run per cron tick at most
+	scheduledTransferBatchSize = 100
+	// how long a runner holds an occurrence, well above the time a transfer takes
+	scheduledTransferLease = 5 * time.Minute
+)
+
+func recurrence(scheduled_transfer *model.ScheduledTransfer) *schedule.Recurrence {
+	return &schedule.Recurrence{
+		Frequency:  scheduled_transfer.Frequency,
+		StartDate:  scheduled_transfer.StartDate,
+		EndDate:    scheduled_transfer.EndDate,
+		Count:      scheduled_transfer.MaxExecutions,
+		Adjustment: scheduled_transfer.BusinessDayAdjustment,
+	}
+}
+
+// moveToOccurrence points the scheduled transfer at the first occurrence from n on running no earlier than
+// not_before, completing it when there is none left
+func moveToOccurrence(scheduled_transfer *model.ScheduledTransfer, n int, not_before time.Time) {
+	n, date, ok := recurrence(scheduled_transfer).Next(n, not_before)
+
+	scheduled_transfer.Occurrence = n
+	scheduled_transfer.RetryCount = 0
+	scheduled_transfer.RetryAt = nil
+	if ok {
+		scheduled_transfer.NextRunOn = &date
+	} else {
+		scheduled_transfer.NextRunOn = nil
+		scheduled_transfer.Status = "completed"
+	}
+}
+
+// transferErrorMessage is the reason a transfer failed as told to its user
+func transferErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrTransactionBlocked):
+		return "Transaction blocked"
+	case errors.Is(err, utils.ErrSourceAccountNotFound):
+		return "Source account not found"
+	case errors.Is(err, utils.ErrDestinationAccountNotFound):
+		return "Destination account not found"
+	case errors.Is(err, utils.ErrNotAccountOwner):
+		return "User is not the owner of the account"
+	case errors.Is(err, repository.ErrInvalidAmount):
+		return "Amount has more decimal places than the account currency allows"
+	case errors.Is(err, repository.ErrCurrencyMismatch):
+		return "Accounts have different currencies"
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		return "Insufficient balance"
+	}
+
+	return "Failed to complete transfer transaction"
+}
+
+// isPermanentTransferError tells whether retrying the transfer later cannot help
+func isPermanentTransferError(err error) bool {
+	return errors.Is(err, utils.ErrSourceAccountNotFound) ||
+		errors.Is(err, utils.ErrDestinationAccountNotFound) ||
+		errors.Is(err, utils.ErrNotAccountOwner) ||
+		errors.Is(err, repository.ErrInvalidAmount) ||
+		errors.Is(err, repository.ErrCurrencyMismatch) ||
+		errors.Is(err, utils.ErrTransactionBlocked)
+}
+
+// transferScheduledOccurrence makes the transfer of the claimed execution, setting its outcome and the state the
+// scheduled transfer moves to
+func (s *Server) transferScheduledOccurrence(scheduled_transfer *model.ScheduledTransfer, execution *model.ScheduledTransferExecution, next *model.ScheduledTransfer, now time.Time) {
+	var transaction_id uuid.UUID
+	var check *utils.OutboundCheck
+	user, err := s.Repositories.UserRepository.GetUserById(scheduled_transfer.UserId)
+	if err == nil {
+		transaction_id, check, err = utils.Transfer(user, scheduled_transfer.FromAccountId.String(), scheduled_transfer.ToAccountId.String(), scheduled_transfer.Amount, s.FraudRules, s.Repositories)
+	}
+
+	switch {
+	case err == nil && check.Status == "pending":
+		// the review decides whether the occurrence succeeds or fails
+		execution.Status = "held"
+		execution.TransactionId = &transaction_id
+		moveToOccurrence(next, scheduled_transfer.Occurrence+1, time.Time{})
+	case err == nil:
+		execution.Status = "succeeded"
+		execution.TransactionId = &transaction_id
+		moveToOccurrence(next, scheduled_transfer.Occurrence+1, time.Time{})
+	case !isPermanentTransferError(err) && scheduled_transfer.RetryCount < ScheduledTransferMaxRetries:
+		if !errors.Is(err, repository.ErrInsufficientBalance) {
+			log.Printf("[ERROR] [Scheduled Transfer Runner] scheduled transfer %s failed, retrying: %s\n", scheduled_transfer.Id, err)
+		}
+
+		execution.Status = "retrying"
+		execution.Error = transferErrorMessage(err)
+		retry_at := now.Add(ScheduledTransferRetryDelay)
+		next.RetryCount++
+		next.RetryAt = &retry_at
+	default:
+		execution.Status = "failed"
+		execution.Error = transferErrorMessage(err)
+		moveToOccurrence(next, scheduled_transfer.Occurrence+1, time.Time{})
+	}
+}
+
+// runScheduledTransfer claims the current occurrence and attempts it through the same path as a transfer made by
+// the user. Insufficient funds and unexpected errors are retried a few times, then the occurrence fails, the user
+// is notified and the next occurrence is scheduled. An occurrence held for review is settled by the review. An
+// occurrence that already succeeded or is held is skipped and one whose run was interrupted fails, since it may
+// have been paid.
+func (s *Server) runScheduledTransfer(scheduled_transfer *model.ScheduledTransfer, now time.Time) error {
+	scheduled_transfers := s.Repositories.ScheduledTransferRepository
+
+	execution, err := scheduled_transfers.ClaimScheduledTransferOccurrence(scheduled_transfer, now.Add(scheduledTransferLease))
+	if errors.Is(err, repository.ErrScheduledTransferClaimed) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, repository.ErrScheduledTransferAlreadyRun) {
+		return err
+	}
+	next := *scheduled_transfer
+
+	switch {
+	case execution.Status == "succeeded" || execution.Status == "held":
+		moveToOccurrence(&next, scheduled_transfer.Occurrence+1, time.Time{})
+	case execution.Status == "running":
+		log.Printf("[ERROR] [Scheduled Transfer Runner] run %d of scheduled transfer %s was interrupted, not running it again\n", execution.Attempt, scheduled_transfer.Id)
+
+		execution.Status = "failed"
+		execution.Error = "Interrupted, check your account before making the transfer again"
+		moveToOccurrence(&next, scheduled_transfer.Occurrence+1, time.Time{})
+	default:
+		s.transferScheduledOccurrence(scheduled_transfer, execution, &next, now)
+	}
+
+	err = scheduled_transfers.RecordScheduledTransferExecution(execution, &next, scheduled_transfer.Occurrence)
+	if errors.Is(err, repository.ErrInvalidScheduledTransferStatus) {
+		log.Printf("[INFO] [Scheduled Transfer Runner] scheduled transfer %s was cancelled while running\n", scheduled_transfer.Id)
+	} else if err != nil {
+		return err
+	}
+
+	if execution.Status == "failed" {
+		message := fmt.Sprintf(
+			"Your scheduled transfer of %s to account %s due on %s failed: %s.",
+			scheduled_transfer.Amount,
+			scheduled_transfer.ToAccountId,
+			execution.ScheduledFor.Format("2006-01-02"),
+			execution.Error,
+		)
+
+		err = s.Repositories.NotificationRepository.CreateNotification(scheduled_transfer.UserId.String(), "scheduled_transfer_failed", message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunScheduledTransfers runs the occurrences due today and the retries whose time has come,
+// returning how many were attempted
+func (s *Server) RunScheduledTransfers() (int, error) {
+	now := time.Now().UTC()
+
+	due, err := s.Repositories.ScheduledTransferRepository.GetDueScheduledTransfers(schedule.Date(now), scheduledTransferBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range *due {
+		err = s.runScheduledTransfer(&(*due)[i], now)
+		if err != nil {
+			log.Printf("[ERROR] [Scheduled Transfer Runner] failed to run scheduled transfer %s: %s\n", (*due)[i].Id, err)
+		}
+	}
+
+	return len(*due), nil
+}
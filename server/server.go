@@ -3,6 +3,10 @@ package server
 import (
 	"context"
 	"log"
+	"os"
+	"time"
+	"welloff-bank/fraud"
+	"welloff-bank/fx"
 	"welloff-bank/model"
 	"welloff-bank/repository"
 	"welloff-bank/utils"
@@ -14,6 +18,11 @@ import (
 type Server struct {
 	Repositories repository.Repositories
 	Router       *gin.Engine
+	RateProvider fx.RateProvider
+	// nil when ACH is not configured
+	AchConfig *AchConfig
+	// nil when no rules are configured, every transaction is allowed
+	FraudRules *fraud.Config
 }
 
 func New() *Server {
@@ -21,8 +30,53 @@ func New() *Server {
 
 	server := Server{
 		Repositories: repositories,
+		RateProvider: &repositories.FxRateRepository,
 	}
 
+	rates_file, ok := os.LookupEnv("FX_RATES_FILE")
+	if ok && rates_file != "" {
+		file, err := os.Open(rates_file)
+		if err != nil {
+			log.Fatal("Failed to open FX_RATES_FILE: ", err)
+		}
+		defer file.Close()
+
+		rates, err := fx.ParseRatesCSV(file)
+		if err != nil {
+			log.Fatal("Failed to parse FX_RATES_FILE: ", err)
+		}
+
+		err = repositories.FxRateRepository.UpsertRates(rates)
+		if err != nil {
+			log.Fatal("Failed to load FX rates: ", err)
+		}
+
+		log.Printf("Loaded %d FX rates\n", len(rates))
+	}
+
+	rules_file, ok := os.LookupEnv("FRAUD_RULES_FILE")
+	if ok && rules_file != "" {
+		file, err := os.Open(rules_file)
+		if err != nil {
+			log.Fatal("Failed to open FRAUD_RULES_FILE: ", err)
+		}
+		defer file.Close()
+
+		rules, err := fraud.ParseConfig(file)
+		if err != nil {
+			log.Fatal("Failed to parse FRAUD_RULES_FILE: ", err)
+		}
+
+		server.FraudRules = rules
+		log.Printf("Loaded %d fraud rules\n", len(rules.Rules))
+	}
+
+	ach_config, err := loadAchConfig()
+	if err != nil {
+		log.Fatal("Invalid ACH settings: ", err)
+	}
+	server.AchConfig = ach_config
+
 	return &server
 }
 
@@ -40,19 +94,86 @@ func (s *Server) SetupRouter(addr string) *gin.Engine {
 
 	// User enpoints
 	router.GET("/me", s.Me())
+	router.POST("/me/password", s.ChangePassword())
 
 	// Account enpoints
 	router.POST("/account", s.CreateAccount())
 	router.GET("/account/:id", s.GetAccount())
+	router.GET("/account/:id/transactions", s.GetAccountTransactions())
+	router.GET("/account/:id/statement", s.GetAccountStatement())
+	router.GET("/account/:id/export", s.ExportAccountTransactions())
+	router.GET("/account/:id/camt.053", s.GetAccountCamt053())
+	router.GET("/account/:id/camt.052", s.GetAccountCamt052())
+	router.GET("/account/:id/interest", s.GetAccountInterest())
+	router.GET("/account/:id/overdraft", s.GetAccountOverdraft())
+	router.POST("/account/:id/overdraft", s.AdminMiddleware(), s.SetOverdraftFacility())
+	router.GET("/account/:id/limits", s.GetAccountLimits())
+	router.POST("/account/:id/limit", s.AdminMiddleware(), s.SetAccountLimit())
+	router.DELETE("/account/:id/limit/:kind/:period", s.AdminMiddleware(), s.DeleteAccountLimit())
+	router.POST("/account/:id/limit/increase", s.RequestLimitIncrease())
 	router.GET("/accounts", s.GetAccounts())
 	router.DELETE("/account/:id", s.DisableAccount())
 
 	// Transaction enpoints
 	router.GET("/transaction/:id", s.GetTransaction())
-	router.POST("/transaction/deposit", s.DepositTransaction())
-	router.POST("/transaction/withdrawal", s.WithdrawalTransaction())
-	router.POST("/transaction/transfer", s.TransferTransaction())
-	router.POST("/transaction/refund/:id", s.RefundTransaction())
+	router.POST("/transaction/deposit", s.IdempotencyMiddleware(), s.DepositTransaction())
+	router.POST("/transaction/withdrawal", s.IdempotencyMiddleware(), s.WithdrawalTransaction())
+	router.POST("/transaction/transfer", s.IdempotencyMiddleware(), s.TransferTransaction())
+	router.POST("/transaction/batch", s.IdempotencyMiddleware(), s.BatchTransferTransaction())
+	router.GET("/transaction/batch/:id", s.GetTransactionBatch())
+	router.POST("/transaction/refund/:id", s.IdempotencyMiddleware(), s.RefundTransaction())
+	router.POST("/transaction/exchange/quote", s.QuoteExchange())
+	router.POST("/transaction/exchange", s.IdempotencyMiddleware(), s.ExchangeTransaction())
+	router.POST("/transaction/pain.001", s.IdempotencyMiddleware(), s.ImportPain001())
+
+	// Hold enpoints
+	router.POST("/account/:id/hold", s.IdempotencyMiddleware(), s.CreateHold())
+	router.GET("/hold/:id", s.GetHold())
+	router.POST("/hold/:id/capture", s.IdempotencyMiddleware(), s.CaptureHold())
+	router.POST("/hold/:id/increment", s.IdempotencyMiddleware(), s.IncrementHold())
+	router.POST("/hold/:id/release", s.ReleaseHold())
+
+	// Reconciliation enpoints
+	router.POST("/reconciliation/import", s.AdminMiddleware(), s.ImportReconciliationStatement())
+	router.GET("/reconciliation/import/:id", s.AdminMiddleware(), s.GetReconciliationImport())
+	router.GET("/reconciliation/items", s.AdminMiddleware(), s.GetReconciliationItems())
+	router.POST("/reconciliation/items/:id/match", s.AdminMiddleware(), s.MatchReconciliationItem())
+	router.POST("/reconciliation/items/:id/adjust", s.AdminMiddleware(), s.AdjustReconciliationItem())
+	router.POST("/reconciliation/items/:id/dismiss", s.AdminMiddleware(), s.DismissReconciliationItem())
+
+	// Scheduled transfer enpoints
+	router.POST("/scheduled-transfer", s.IdempotencyMiddleware(), s.CreateScheduledTransfer())
+	router.GET("/scheduled-transfer/:id", s.GetScheduledTransfer())
+	router.POST("/scheduled-transfer/:id/pause", s.PauseScheduledTransfer())
+	router.POST("/scheduled-transfer/:id/resume", s.ResumeScheduledTransfer())
+	router.POST("/scheduled-transfer/:id/cancel", s.CancelScheduledTransfer())
+	router.GET("/scheduled-transfers", s.GetScheduledTransfers())
+
+	// Savings enpoints
+	router.GET("/savings/rates", s.GetSavingsRates())
+	router.POST("/savings/rate", s.AdminMiddleware(), s.SetSavingsRate())
+
+	// Fee enpoints
+	router.GET("/fees", s.GetFeeRules())
+	router.POST("/fee", s.AdminMiddleware(), s.SetFeeRule())
+	router.DELETE("/fee/:id", s.AdminMiddleware(), s.DeleteFeeRule())
+
+	// Loan enpoints
+	router.POST("/loan", s.AdminMiddleware(), s.OriginateLoan())
+	router.GET("/loan/:id", s.GetLoan())
+	router.GET("/loan/:id/payoff", s.QuoteLoanPayoff())
+	router.POST("/loan/:id/payoff", s.IdempotencyMiddleware(), s.PayOffLoan())
+	router.GET("/loans", s.GetLoans())
+
+	// Review enpoints
+	router.GET("/reviews", s.AdminMiddleware(), s.GetTransactionReviews())
+	router.GET("/review/:id", s.AdminMiddleware(), s.GetTransactionReview())
+	router.POST("/review/:id/approve", s.AdminMiddleware(), s.ApproveTransactionReview())
+	router.POST("/review/:id/reject", s.AdminMiddleware(), s.RejectTransactionReview())
+
+	// Notification enpoints
+	router.GET("/notifications", s.GetNotifications())
+	router.POST("/notification/:id/read", s.ReadNotification())
 
 	return router
 }
@@ -98,6 +219,82 @@ func (s *Server) StartCron() {
 
 		log.Println("[INFO] [Balance Snapshot Updater] completed")
 	})
+	c.AddFunc("@every 1m", func() {
+		expired, err := s.Repositories.HoldRepository.ExpireHolds()
+		if err != nil {
+			log.Println("[ERROR] [Hold Expirer] failed to expire holds: ", err)
+			return
+		}
+
+		if expired > 0 {
+			log.Printf("[INFO] [Hold Expirer] released %d expired holds\n", expired)
+		}
+	})
+	c.AddFunc("@every 1m", func() {
+		attempted, err := s.RunScheduledTransfers()
+		if err != nil {
+			log.Println("[ERROR] [Scheduled Transfer Runner] failed to get due scheduled transfers: ", err)
+			return
+		}
+
+		if attempted > 0 {
+			log.Printf("[INFO] [Scheduled Transfer Runner] ran %d scheduled transfers\n", attempted)
+		}
+	})
+	if s.AchConfig != nil {
+		c.AddFunc("@every 1h", func() {
+			file, err := s.WriteAchFile()
+			if err != nil {
+				log.Println("[ERROR] [ACH File Writer] failed to write ACH file: ", err)
+				return
+			}
+
+			if file != nil {
+				log.Printf("[INFO] [ACH File Writer] wrote %s with %d entries\n", file.FileName, file.EntryCount)
+			}
+		})
+		c.AddFunc("@every 5m", func() {
+			err := s.ProcessAchReturns()
+			if err != nil {
+				log.Println("[ERROR] [ACH Return Processor] failed to process return files: ", err)
+			}
+		})
+	}
+	c.AddFunc("@every 1h", func() {
+		err := s.AccrueInterest()
+		if err != nil {
+			log.Println("[ERROR] [Interest Accrual] failed to accrue interest: ", err)
+		}
+	})
+	c.AddFunc("@every 1h", func() {
+		err := s.ChargeOverdraftInterest()
+		if err != nil {
+			log.Println("[ERROR] [Overdraft Interest] failed to charge overdraft interest: ", err)
+		}
+	})
+	c.AddFunc("@every 1h", func() {
+		attempted, err := s.CollectLoanInstallments()
+		if err != nil {
+			log.Println("[ERROR] [Loan Collector] failed to get due loan installments: ", err)
+			return
+		}
+
+		if attempted > 0 {
+			log.Printf("[INFO] [Loan Collector] attempted %d loan installments\n", attempted)
+		}
+	})
+	c.AddFunc("@every 1h", func() {
+		err := s.ChargeMaintenanceFees()
+		if err != nil {
+			log.Println("[ERROR] [Maintenance Fee] failed to charge maintenance fees: ", err)
+		}
+	})
+	c.AddFunc("@every 1h", func() {
+		err := s.Repositories.IdempotencyKeyRepository.DeleteIdempotencyKeysBefore(time.Now().UTC().Add(-IdempotencyKeyTTL))
+		if err != nil {
+			log.Println("[ERROR] [Idempotency Key Cleaner] failed to delete expired idempotency keys: ", err)
+		}
+	})
 	c.Start()
 }
 
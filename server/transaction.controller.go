@@ -1,8 +1,15 @@
 package server
 
 import (
-	"context"
+	"errors"
+	"io"
 	"log"
+	"strings"
+	"time"
+	"welloff-bank/ach"
+	"welloff-bank/fee"
+	"welloff-bank/model"
+	"welloff-bank/repository"
 	"welloff-bank/utils"
 
 	"github.com/gin-gonic/gin"
@@ -10,6 +17,23 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// TransactionReviewStatus is what the customer sees of the review of a held transaction, not why it was held
+type TransactionReviewStatus struct {
+	// 'pending' | 'approved' | 'rejected'
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at"`
+}
+
+type GetTransactionResponse struct {
+	model.Transaction
+	RefundedAmount decimal.Decimal     `json:"refunded_amount"`
+	Refunds        []model.Transaction `json:"refunds"`
+	Fees           []model.Transaction `json:"fees"`
+	// nil when the transaction was never held for review
+	Review *TransactionReviewStatus `json:"review"`
+}
+
 func (s *Server) GetTransaction() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id := ctx.Param("id")
@@ -24,7 +48,46 @@ func (s *Server) GetTransaction() gin.HandlerFunc {
 			return
 		}
 
-		ctx.JSON(200, gin.H{"payload": transaction})
+		refunds, err := s.Repositories.TransactionRepository.GetRefunds(id)
+		if err != nil {
+			log.Println("[ERROR] [GetTransaction] failed to get refunds: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction"})
+			return
+		}
+
+		fees, err := s.Repositories.TransactionRepository.GetFees(id)
+		if err != nil {
+			log.Println("[ERROR] [GetTransaction] failed to get fees: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction"})
+			return
+		}
+
+		refunded_amount, err := s.Repositories.TransactionRepository.GetRefundedAmount(id)
+		if err != nil {
+			log.Println("[ERROR] [GetTransaction] failed to get refunded amount: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction"})
+			return
+		}
+
+		review, err := s.Repositories.ReviewRepository.GetTransactionReviewByTransaction(id)
+		if err != nil {
+			log.Println("[ERROR] [GetTransaction] failed to get review: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get transaction"})
+			return
+		}
+
+		var review_status *TransactionReviewStatus
+		if review != nil {
+			review_status = &TransactionReviewStatus{Status: review.Status, CreatedAt: review.CreatedAt, DecidedAt: review.DecidedAt}
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetTransactionResponse{
+			Transaction:    *transaction,
+			RefundedAmount: refunded_amount,
+			Refunds:        *refunds,
+			Fees:           *fees,
+			Review:         review_status,
+		}})
 	}
 }
 
@@ -41,6 +104,11 @@ func (s *Server) DepositTransaction() gin.HandlerFunc {
 			return
 		}
 
+		if !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
 		user, err := utils.GetUser(ctx)
 		if err != nil {
 			log.Println("[ERROR] [DepositTransaction] failed to get user from context: ", err)
@@ -60,22 +128,23 @@ func (s *Server) DepositTransaction() gin.HandlerFunc {
 			return
 		}
 
+		if !model.IsValidAmount(req.Amount, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
 		transaction_id, err := uuid.NewV7()
 		if err != nil {
 			log.Println("[ERROR] [DepositTransaction] failed to create transaction id: ", err)
+			rolledBack(ctx)
 			ctx.JSON(500, gin.H{"error": "Failed to complete deposit transaction"})
 			return
 		}
 
-		tx, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id.String())
-		if tx != nil && err == nil {
-			ctx.JSON(500, gin.H{"error": "Duplicated transaction"})
-			return
-		}
-
-		err = s.Repositories.TransactionRepository.CreateTransaction(transaction_id, "deposit", nil, &req.ToAccountId, req.Amount, nil)
+		err = s.Repositories.TransactionRepository.CreateTransaction(transaction_id, "deposit", nil, &req.ToAccountId, req.Amount, nil, "posted")
 		if err != nil {
 			log.Println("[ERROR] [DepositTransaction] failed to create transaction: ", err)
+			rolledBack(ctx)
 			ctx.JSON(500, gin.H{"error": "Failed to complete deposit transaction"})
 			return
 		}
@@ -84,9 +153,65 @@ func (s *Server) DepositTransaction() gin.HandlerFunc {
 	}
 }
 
+// ExternalBankAccount is a US bank account a withdrawal is paid out to through ACH
+type ExternalBankAccount struct {
+	RoutingNumber string `json:"routing_number"`
+	AccountNumber string `json:"account_number"`
+	// 'checking' | 'savings', defaults to checking
+	AccountType string `json:"account_type"`
+	Name        string `json:"name"`
+	// 'PPD' for a person | 'CCD' for a company, defaults to PPD
+	SECCode string `json:"sec_code"`
+}
+
 type WithdrawalTransactionRequest struct {
 	Amount        decimal.Decimal `json:"amount"`
 	FromAccountId string          `json:"from_account_id"`
+	// when set the withdrawal is paid out to this account in the next ACH file
+	BankAccount *ExternalBankAccount `json:"bank_account"`
+}
+
+// achEntry validates the external bank account of a withdrawal, returning the error message for the client
+func (b *ExternalBankAccount) achEntry() (*model.AchEntry, string) {
+	entry := model.AchEntry{
+		RoutingNumber: b.RoutingNumber,
+		AccountNumber: strings.TrimSpace(b.AccountNumber),
+		AccountType:   b.AccountType,
+		Name:          strings.TrimSpace(b.Name),
+		SECCode:       b.SECCode,
+	}
+
+	if entry.AccountType == "" {
+		entry.AccountType = "checking"
+	}
+	if entry.SECCode == "" {
+		entry.SECCode = ach.SECConsumer
+	}
+
+	if !ach.ValidRoutingNumber(entry.RoutingNumber) {
+		return nil, "Invalid routing number"
+	}
+
+	if entry.AccountNumber == "" || len(entry.AccountNumber) > 17 {
+		return nil, "Account number must have between 1 and 17 characters"
+	}
+
+	if entry.AccountType != "checking" && entry.AccountType != "savings" {
+		return nil, "Account type must be checking or savings"
+	}
+
+	if entry.SECCode != ach.SECConsumer && entry.SECCode != ach.SECCorporate {
+		return nil, "SEC code must be PPD or CCD"
+	}
+
+	if entry.Name == "" {
+		return nil, "Missing account holder name"
+	}
+	if len(entry.Name) > 22 {
+		entry.Name = entry.Name[:22]
+	}
+
+	return &entry, ""
 }
 
 func (s *Server) WithdrawalTransaction() gin.HandlerFunc {
@@ -97,6 +222,11 @@ func (s *Server) WithdrawalTransaction() gin.HandlerFunc {
 			return
 		}
 
+		if !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
 		user, err := utils.GetUser(ctx)
 		if err != nil {
 			log.Println("[ERROR] [WithdrawalTransaction] failed to get user from context: ", err)
@@ -116,38 +246,84 @@ func (s *Server) WithdrawalTransaction() gin.HandlerFunc {
 			return
 		}
 
-		account_balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
-		if err != nil {
-			log.Println("[ERROR] [WithdrawalTransaction] failed to get account balance: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete withdrawal transaction"})
+		if !model.IsValidAmount(req.Amount, account.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
 			return
 		}
 
-		if account_balance.Balance.LessThan(req.Amount) {
-			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
-			return
+		var ach_entry *model.AchEntry
+		if req.BankAccount != nil {
+			// without ACH configured the entry would be queued but never sent
+			if s.AchConfig == nil {
+				ctx.JSON(503, gin.H{"error": "Withdrawals to external bank accounts are not available"})
+				return
+			}
+
+			var message string
+			ach_entry, message = req.BankAccount.achEntry()
+			if ach_entry == nil {
+				ctx.JSON(422, gin.H{"error": message})
+				return
+			}
+
+			if account.Currency != "USD" {
+				ctx.JSON(422, gin.H{"error": "Only USD accounts can withdraw to an external bank account"})
+				return
+			}
 		}
 
 		transaction_id, err := uuid.NewV7()
 		if err != nil {
 			log.Println("[ERROR] [WithdrawalTransaction] failed to create transaction id: ", err)
+			rolledBack(ctx)
 			ctx.JSON(500, gin.H{"error": "Failed to complete withdrawal transaction"})
 			return
 		}
 
-		tx, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id.String())
-		if tx != nil && err == nil {
-			ctx.JSON(500, gin.H{"error": "Duplicated transaction"})
+		withdrawal_fee, err := utils.TransactionFee(account, fee.Withdrawal, req.Amount, s.Repositories)
+		if err != nil {
+			log.Println("[ERROR] [WithdrawalTransaction] failed to get withdrawal fee: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete withdrawal transaction"})
 			return
 		}
 
-		err = s.Repositories.TransactionRepository.CreateTransaction(transaction_id, "withdrawal", &req.FromAccountId, nil, req.Amount, nil)
+		check, err := utils.CheckOutbound(s.FraudRules, user, account, "withdrawal", transaction_id, req.Amount, nil, s.Repositories)
+		if errors.Is(err, utils.ErrTransactionBlocked) {
+			ctx.JSON(403, gin.H{"error": "Transaction blocked"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [WithdrawalTransaction] failed to check transaction: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete withdrawal transaction"})
+			return
+		}
+
+		if ach_entry != nil {
+			err = s.Repositories.AchRepository.CreateAchWithdrawal(transaction_id, req.FromAccountId, req.Amount, check.Status, ach_entry, withdrawal_fee)
+		} else {
+			err = s.Repositories.TransactionRepository.CreateTransactionWithFee(transaction_id, "withdrawal", &req.FromAccountId, nil, req.Amount, check.Status, withdrawal_fee)
+		}
+		if err != nil {
+			utils.ReleaseLimits(account.Id, "withdrawal", transaction_id, req.Amount, s.Repositories)
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
+			return
+		}
 		if err != nil {
 			log.Println("[ERROR] [WithdrawalTransaction] failed to create transaction: ", err)
+			rolledBack(ctx)
 			ctx.JSON(500, gin.H{"error": "Failed to complete withdrawal transaction"})
 			return
 		}
 
+		if check.Status == "pending" {
+			s.holdForReview(ctx, "WithdrawalTransaction", check, &transaction_id, nil, gin.H{"transaction_id": transaction_id})
+			return
+		}
+
 		ctx.Status(200)
 	}
 }
@@ -166,6 +342,11 @@ func (s *Server) TransferTransaction() gin.HandlerFunc {
 			return
 		}
 
+		if !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
 		user, err := utils.GetUser(ctx)
 		if err != nil {
 			log.Println("[ERROR] [TransferTransaction] failed to get user from context: ", err)
@@ -173,47 +354,40 @@ func (s *Server) TransferTransaction() gin.HandlerFunc {
 			return
 		}
 
-		account, err := s.Repositories.AccountRepository.GetAccount(req.FromAccountId)
-		if err != nil {
-			log.Println("[ERROR] [TransferTransaction] failed to get account: ", err)
+		transaction_id, check, err := utils.Transfer(user, req.FromAccountId, req.ToAccountId, req.Amount, s.FraudRules, s.Repositories)
+		if errors.Is(err, utils.ErrTransactionBlocked) {
+			ctx.JSON(403, gin.H{"error": "Transaction blocked"})
+			return
+		}
+		if errors.Is(err, utils.ErrSourceAccountNotFound) || errors.Is(err, utils.ErrDestinationAccountNotFound) {
 			ctx.JSON(404, gin.H{"error": "Account not found"})
 			return
 		}
-
-		if account.UserId.String() != user.Id.String() {
+		if errors.Is(err, utils.ErrNotAccountOwner) {
 			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
 			return
 		}
-
-		account_balance, err := utils.GetAccountBalance(context.Background(), account.Id, s.Repositories, false)
-		if err != nil {
-			log.Println("[ERROR] [TransferTransaction] failed to get account balance: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete transfer transaction"})
+		if errors.Is(err, repository.ErrInvalidAmount) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
 			return
 		}
-
-		if account_balance.Balance.LessThan(req.Amount) {
+		if errors.Is(err, repository.ErrCurrencyMismatch) {
+			ctx.JSON(400, gin.H{"error": "Accounts have different currencies, use /transaction/exchange to convert"})
+			return
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
 			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
 			return
 		}
-
-		transaction_id, err := uuid.NewV7()
+		// the transfer may have been made before failing to be held for review, so the Idempotency-Key is kept
 		if err != nil {
-			log.Println("[ERROR] [TransferTransaction] failed to create transaction id: ", err)
+			log.Println("[ERROR] [TransferTransaction] failed to create transaction: ", err)
 			ctx.JSON(500, gin.H{"error": "Failed to complete transfer transaction"})
 			return
 		}
 
-		tx, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id.String())
-		if tx != nil && err == nil {
-			ctx.JSON(500, gin.H{"error": "Duplicated transaction"})
-			return
-		}
-
-		err = s.Repositories.TransactionRepository.CreateTransaction(transaction_id, "transfer", &req.FromAccountId, &req.ToAccountId, req.Amount, nil)
-		if err != nil {
-			log.Println("[ERROR] [TransferTransaction] failed to create transaction: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete transfer transaction"})
+		if check.Status == "pending" {
+			heldResponse(ctx, check, gin.H{"transaction_id": transaction_id})
 			return
 		}
 
@@ -221,6 +395,11 @@ func (s *Server) TransferTransaction() gin.HandlerFunc {
 	}
 }
 
+type RefundTransactionRequest struct {
+	// defaults to what is left to refund
+	Amount *decimal.Decimal `json:"amount"`
+}
+
 func (s *Server) RefundTransaction() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		transaction_id := ctx.Param("id")
@@ -229,6 +408,17 @@ func (s *Server) RefundTransaction() gin.HandlerFunc {
 			return
 		}
 
+		req := RefundTransactionRequest{}
+		if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if req.Amount != nil && !req.Amount.IsPositive() {
+			ctx.JSON(422, gin.H{"error": "Amount must be positive"})
+			return
+		}
+
 		transaction, err := s.Repositories.TransactionRepository.GetTransaction(transaction_id)
 		if err != nil {
 			log.Println("[ERROR] [RefundTransaction] failed to get transaction: ", err)
@@ -267,41 +457,95 @@ func (s *Server) RefundTransaction() gin.HandlerFunc {
 			return
 		}
 
-		to_account_balance, err := utils.GetAccountBalance(context.Background(), to_account.Id, s.Repositories, false)
+		if req.Amount != nil && !model.IsValidAmount(*req.Amount, transaction.Currency) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+
+		refund_transaction_id, err := uuid.NewV7()
 		if err != nil {
-			log.Println("[ERROR] [RefundTransaction] failed to get account balance: ", err)
+			log.Println("[ERROR] [RefundTransaction] failed to create transaction id: ", err)
+			rolledBack(ctx)
 			ctx.JSON(500, gin.H{"error": "Failed to complete refund transaction"})
 			return
 		}
 
-		if to_account_balance.Balance.LessThan(transaction.Amount) {
-			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
-			return
+		refund_amount := transaction.Amount
+		if req.Amount != nil {
+			refund_amount = *req.Amount
+		} else {
+			refunded, err := s.Repositories.TransactionRepository.GetRefundedAmount(transaction_id)
+			if err != nil {
+				log.Println("[ERROR] [RefundTransaction] failed to get refunded amount: ", err)
+				rolledBack(ctx)
+				ctx.JSON(500, gin.H{"error": "Failed to complete refund transaction"})
+				return
+			}
+
+			// what is left to refund is checked again under a lock when the refund is made
+			refund_amount = transaction.Amount.Sub(refunded)
+			if !refund_amount.IsPositive() {
+				ctx.JSON(400, gin.H{"error": "Refund exceeds the amount left to refund"})
+				return
+			}
 		}
 
-		refund_transaction_id, err := uuid.NewV7()
+		// the refund takes the money out of the destination account of the transfer, so it is checked against the
+		// limits of that account and screened on behalf of its owner. It goes back to the account that made the
+		// transfer, which is never a new payee.
+		owner := user
+		if to_account.UserId.String() != user.Id.String() {
+			owner, err = s.Repositories.UserRepository.GetUserById(to_account.UserId)
+			if err != nil {
+				log.Println("[ERROR] [RefundTransaction] failed to get account owner: ", err)
+				rolledBack(ctx)
+				ctx.JSON(500, gin.H{"error": "Failed to complete refund transaction"})
+				return
+			}
+		}
+
+		check, err := utils.CheckOutbound(s.FraudRules, owner, to_account, "refund", refund_transaction_id, refund_amount, nil, s.Repositories)
+		if errors.Is(err, utils.ErrTransactionBlocked) {
+			ctx.JSON(403, gin.H{"error": "Transaction blocked"})
+			return
+		}
 		if err != nil {
-			log.Println("[ERROR] [TransferTransaction] failed to create transaction id: ", err)
-			ctx.JSON(500, gin.H{"error": "Failed to complete transfer transaction"})
+			log.Println("[ERROR] [RefundTransaction] failed to check transaction: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete refund transaction"})
 			return
 		}
 
-		tx, err := s.Repositories.TransactionRepository.GetTransaction(refund_transaction_id.String())
-		if tx != nil && err == nil {
-			ctx.JSON(500, gin.H{"error": "Duplicated transaction"})
+		_, err = s.Repositories.TransactionRepository.CreateRefundTransaction(refund_transaction_id, transaction_id, &refund_amount, check.Status)
+		if err != nil {
+			utils.ReleaseLimits(to_account.Id, "refund", refund_transaction_id, refund_amount, s.Repositories)
+		}
+		if errors.Is(err, repository.ErrNotRefundable) {
+			ctx.JSON(400, gin.H{"error": "Transaction cannot be refunded"})
+			return
+		}
+		if errors.Is(err, repository.ErrRefundExceedsAmount) {
+			ctx.JSON(400, gin.H{"error": "Refund exceeds the amount left to refund"})
+			return
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
 			return
 		}
-
-		from_account_id := transaction.FromAccountId.String()
-		to_account_id := transaction.ToAccountId.String()
-
-		err = s.Repositories.TransactionRepository.CreateTransaction(refund_transaction_id, "refund", &from_account_id, &to_account_id, transaction.Amount, nil)
 		if err != nil {
 			log.Println("[ERROR] [RefundTransaction] failed to create transaction: ", err)
+			rolledBack(ctx)
 			ctx.JSON(500, gin.H{"error": "Failed to complete refund transaction"})
 			return
 		}
 
-		ctx.Status(200)
+		payload := gin.H{"transaction_id": refund_transaction_id, "amount": refund_amount}
+
+		if check.Status == "pending" {
+			s.holdForReview(ctx, "RefundTransaction", check, &refund_transaction_id, nil, payload)
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": payload})
 	}
 }
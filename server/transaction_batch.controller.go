@@ -0,0 +1,229 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"welloff-bank/fee"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+	"welloff-bank/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// legs a single batch transfer request can carry at most
+const MaxTransactionBatchLegs = 100
+
+type BatchTransferLeg struct {
+	Amount      decimal.Decimal `json:"amount"`
+	ToAccountId string          `json:"to_account_id"`
+}
+
+type BatchTransferTransactionRequest struct {
+	FromAccountId string             `json:"from_account_id"`
+	Legs          []BatchTransferLeg `json:"legs"`
+}
+
+// BatchTransferTransaction moves money from one account of the user to many accounts, posting every leg or none
+func (s *Server) BatchTransferTransaction() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := BatchTransferTransactionRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if len(req.Legs) == 0 {
+			ctx.JSON(422, gin.H{"error": "Batch must have at least one leg"})
+			return
+		}
+
+		if len(req.Legs) > MaxTransactionBatchLegs {
+			ctx.JSON(422, gin.H{"error": fmt.Sprintf("Batch must have at most %d legs", MaxTransactionBatchLegs)})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [BatchTransferTransaction] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		from_account, err := s.Repositories.AccountRepository.GetAccount(req.FromAccountId)
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Source account not found"})
+			return
+		}
+
+		if from_account.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the account"})
+			return
+		}
+
+		batch_id, err := uuid.NewV7()
+		if err != nil {
+			log.Println("[ERROR] [BatchTransferTransaction] failed to create batch id: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete batch transfer"})
+			return
+		}
+
+		batch := model.TransactionBatch{
+			Id:            batch_id,
+			UserId:        user.Id,
+			FromAccountId: from_account.Id,
+			Currency:      from_account.Currency,
+			TotalAmount:   decimal.Zero,
+		}
+
+		legs := []model.TransactionBatchLeg{}
+		transaction_ids := []uuid.UUID{}
+		// destination accounts already looked up
+		to_accounts := map[string]*model.Account{}
+		for i, leg := range req.Legs {
+			if !leg.Amount.IsPositive() {
+				ctx.JSON(422, gin.H{"error": fmt.Sprintf("Leg %d: Amount must be positive", i)})
+				return
+			}
+
+			if !model.IsValidAmount(leg.Amount, from_account.Currency) {
+				ctx.JSON(422, gin.H{"error": fmt.Sprintf("Leg %d: Amount has more decimal places than the account currency allows", i)})
+				return
+			}
+
+			to_account, ok := to_accounts[leg.ToAccountId]
+			if !ok {
+				to_account, err = s.Repositories.AccountRepository.GetAccount(leg.ToAccountId)
+				if err != nil {
+					ctx.JSON(404, gin.H{"error": fmt.Sprintf("Leg %d: Destination account not found", i)})
+					return
+				}
+				to_accounts[leg.ToAccountId] = to_account
+			}
+
+			if to_account.Id == from_account.Id {
+				ctx.JSON(422, gin.H{"error": fmt.Sprintf("Leg %d: Destination account is the source account", i)})
+				return
+			}
+
+			if to_account.Currency != from_account.Currency {
+				ctx.JSON(400, gin.H{"error": fmt.Sprintf("Leg %d: Accounts have different currencies", i)})
+				return
+			}
+
+			transaction_id, err := uuid.NewV7()
+			if err != nil {
+				log.Println("[ERROR] [BatchTransferTransaction] failed to create transaction id: ", err)
+				rolledBack(ctx)
+				ctx.JSON(500, gin.H{"error": "Failed to complete batch transfer"})
+				return
+			}
+
+			transfer_fee, err := utils.TransactionFee(from_account, fee.Transfer, leg.Amount, s.Repositories)
+			if err != nil {
+				log.Println("[ERROR] [BatchTransferTransaction] failed to get transfer fee: ", err)
+				rolledBack(ctx)
+				ctx.JSON(500, gin.H{"error": "Failed to complete batch transfer"})
+				return
+			}
+
+			legs = append(legs, model.TransactionBatchLeg{
+				TransactionId: transaction_id,
+				ToAccountId:   to_account.Id,
+				Amount:        leg.Amount,
+				Fee:           transfer_fee,
+			})
+			transaction_ids = append(transaction_ids, transaction_id)
+			batch.TotalAmount = batch.TotalAmount.Add(leg.Amount)
+		}
+
+		payees := []uuid.UUID{}
+		for _, leg := range legs {
+			payees = append(payees, leg.ToAccountId)
+		}
+
+		// the batch is checked against the limits of the account and the fraud rules as a single transfer of its total,
+		// every leg being held or blocked with it
+		check, err := utils.CheckOutbound(s.FraudRules, user, from_account, "transfer", batch_id, batch.TotalAmount, payees, s.Repositories)
+		if errors.Is(err, utils.ErrTransactionBlocked) {
+			ctx.JSON(403, gin.H{"error": "Transaction blocked"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [BatchTransferTransaction] failed to check batch: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete batch transfer"})
+			return
+		}
+
+		err = s.Repositories.TransactionBatchRepository.CreateTransactionBatch(&batch, legs, check.Status)
+		if err != nil {
+			utils.ReleaseLimits(from_account.Id, "transfer", batch_id, batch.TotalAmount, s.Repositories)
+		}
+		if errors.Is(err, repository.ErrInvalidAmount) {
+			ctx.JSON(422, gin.H{"error": "Amount has more decimal places than the account currency allows"})
+			return
+		}
+		if errors.Is(err, repository.ErrCurrencyMismatch) {
+			ctx.JSON(400, gin.H{"error": "Accounts have different currencies"})
+			return
+		}
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			ctx.JSON(400, gin.H{"error": "Insufficient balance"})
+			return
+		}
+		if err != nil {
+			log.Println("[ERROR] [BatchTransferTransaction] failed to create batch: ", err)
+			rolledBack(ctx)
+			ctx.JSON(500, gin.H{"error": "Failed to complete batch transfer"})
+			return
+		}
+
+		if check.Status == "pending" {
+			s.holdForReview(ctx, "BatchTransferTransaction", check, nil, &batch_id, gin.H{"batch_id": batch_id, "transaction_ids": transaction_ids})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": gin.H{"batch_id": batch_id, "transaction_ids": transaction_ids}})
+	}
+}
+
+type GetTransactionBatchResponse struct {
+	model.TransactionBatch
+	Transactions []model.Transaction `json:"transactions"`
+}
+
+func (s *Server) GetTransactionBatch() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionBatch] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		batch, err := s.Repositories.TransactionBatchRepository.GetTransactionBatch(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(404, gin.H{"error": "Batch not found"})
+			return
+		}
+
+		if batch.UserId.String() != user.Id.String() {
+			ctx.JSON(401, gin.H{"error": "User is not the owner of the batch"})
+			return
+		}
+
+		transactions, err := s.Repositories.TransactionBatchRepository.GetTransactionsByBatch(batch.Id.String())
+		if err != nil {
+			log.Println("[ERROR] [GetTransactionBatch] failed to get transactions: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to get batch"})
+			return
+		}
+
+		ctx.JSON(200, gin.H{"payload": GetTransactionBatchResponse{TransactionBatch: *batch, Transactions: *transactions}})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"log"
 	"time"
+	"welloff-bank/fraud"
 	"welloff-bank/utils"
 
 	"github.com/gin-gonic/gin"
@@ -93,6 +94,12 @@ func (s *Server) Login() gin.HandlerFunc {
 			return
 		}
 
+		// new sessions are screened by the fraud rules
+		err = s.Repositories.UserRepository.CreateSecurityEvent(user.Id, fraud.SessionCreated)
+		if err != nil {
+			log.Println("[ERROR] [Login] failed to record session: ", err)
+		}
+
 		ctx.SetCookie("sessionId", session_id.String(), 3600*24, "/", "localhost", true, true)
 		ctx.Status(200)
 	}
@@ -114,3 +121,59 @@ func (s *Server) Me() gin.HandlerFunc {
 		ctx.JSON(200, gin.H{"payload": MeResponse{Email: user.Email}})
 	}
 }
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (s *Server) ChangePassword() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		req := ChangePasswordRequest{}
+		if ctx.ShouldBindJSON(&req) != nil {
+			ctx.JSON(422, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		if len(req.NewPassword) < 8 || len(req.NewPassword) > 255 {
+			ctx.JSON(422, gin.H{"error": "Password must have between 8 and 255 characters"})
+			return
+		}
+
+		user, err := utils.GetUser(ctx)
+		if err != nil {
+			log.Println("[ERROR] [ChangePassword] failed to get user from context: ", err)
+			ctx.Status(401)
+			return
+		}
+
+		// the user in the context has no password
+		user, err = s.Repositories.UserRepository.GetUserById(user.Id)
+		if err != nil {
+			log.Println("[ERROR] [ChangePassword] failed to get user: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to change password"})
+			return
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(user.EncryptedPassword), []byte(req.CurrentPassword))
+		if err != nil {
+			ctx.JSON(409, gin.H{"error": "Wrong password"})
+			return
+		}
+
+		encrypted_password, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			ctx.JSON(500, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		err = s.Repositories.UserRepository.UpdatePassword(user.Id, string(encrypted_password))
+		if err != nil {
+			log.Println("[ERROR] [ChangePassword] failed to update password: ", err)
+			ctx.JSON(500, gin.H{"error": "Failed to change password"})
+			return
+		}
+
+		ctx.Status(200)
+	}
+}
@@ -0,0 +1,296 @@
+package statement
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	Camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"
+	Camt052Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.052.001.08"
+)
+
+type camt053Document struct {
+	XMLName   xml.Name          `xml:"Document"`
+	Namespace string            `xml:"xmlns,attr"`
+	GrpHdr    camtGroupHeader   `xml:"BkToCstmrStmt>GrpHdr"`
+	Stmt      camtAccountReport `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camt052Document struct {
+	XMLName   xml.Name          `xml:"Document"`
+	Namespace string            `xml:"xmlns,attr"`
+	GrpHdr    camtGroupHeader   `xml:"BkToCstmrAcctRpt>GrpHdr"`
+	Rpt       camtAccountReport `xml:"BkToCstmrAcctRpt>Rpt"`
+}
+
+type camtGroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+// camtAccountReport is shared by the camt.053 Stmt and the camt.052 Rpt, which have the same layout
+type camtAccountReport struct {
+	Id        string        `xml:"Id"`
+	CreDtTm   string        `xml:"CreDtTm"`
+	FrDtTm    string        `xml:"FrToDt>FrDtTm"`
+	ToDtTm    string        `xml:"FrToDt>ToDtTm"`
+	Acct      camtAccount   `xml:"Acct"`
+	Bal       []camtBalance `xml:"Bal"`
+	TxsSummry camtSummary   `xml:"TxsSummry"`
+	Ntry      []camtEntry   `xml:"Ntry"`
+}
+
+type camtAccount struct {
+	Id  string `xml:"Id>Othr>Id"`
+	Ccy string `xml:"Ccy"`
+	Nm  string `xml:"Nm,omitempty"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Cd        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	DtTm      string     `xml:"Dt>DtTm"`
+}
+
+type camtSummary struct {
+	NbOfNtries    int    `xml:"TtlNtries>NbOfNtries"`
+	Sum           string `xml:"TtlNtries>Sum"`
+	NetAmt        string `xml:"TtlNtries>TtlNetNtry>Amt"`
+	NetCdtDbtInd  string `xml:"TtlNtries>TtlNetNtry>CdtDbtInd"`
+	NbOfCdtNtries int    `xml:"TtlCdtNtries>NbOfNtries"`
+	CdtSum        string `xml:"TtlCdtNtries>Sum"`
+	NbOfDbtNtries int    `xml:"TtlDbtNtries>NbOfNtries"`
+	DbtSum        string `xml:"TtlDbtNtries>Sum"`
+}
+
+type camtEntry struct {
+	NtryRef       string     `xml:"NtryRef"`
+	Amt           camtAmount `xml:"Amt"`
+	CdtDbtInd     string     `xml:"CdtDbtInd"`
+	RvslInd       bool       `xml:"RvslInd,omitempty"`
+	Sts           string     `xml:"Sts>Cd"`
+	BookgDt       string     `xml:"BookgDt>DtTm"`
+	ValDt         string     `xml:"ValDt>DtTm"`
+	AcctSvcrRef   string     `xml:"AcctSvcrRef"`
+	Domain        string     `xml:"BkTxCd>Domn>Cd"`
+	Family        string     `xml:"BkTxCd>Domn>Fmly>Cd"`
+	SubFamily     string     `xml:"BkTxCd>Domn>Fmly>SubFmlyCd"`
+	TxAcctSvcrRef string     `xml:"NtryDtls>TxDtls>Refs>AcctSvcrRef"`
+	TxAmt         camtAmount `xml:"NtryDtls>TxDtls>Amt"`
+	TxCdtDbtInd   string     `xml:"NtryDtls>TxDtls>CdtDbtInd"`
+	Ustrd         string     `xml:"NtryDtls>TxDtls>RmtInf>Ustrd"`
+}
+
+// BankTransactionCode maps the kind of the movement to an ISO 20022 domain, family and sub-family,
+// transfers and refunds are issued or received depending on the side of the account
+func BankTransactionCode(movement *model.AccountTransaction) (string, string, string) {
+	credit := movement.SignedAmount.IsPositive()
+	if movement.Reversal {
+		// a reversal is reported with the code of the movement it undoes
+		credit = !credit
+	}
+
+	switch movement.Kind {
+	case "deposit":
+		return "PMNT", "CNTR", "CDPT"
+	case "withdrawal":
+		return "PMNT", "CNTR", "CWDL"
+	case "capture":
+		return "PMNT", "CCRD", "POSD"
+	case "transfer":
+		if credit {
+			return "PMNT", "RCDT", "BOOK"
+		}
+		return "PMNT", "ICDT", "BOOK"
+	case "refund":
+		if credit {
+			return "PMNT", "RCDT", "RRTN"
+		}
+		return "PMNT", "ICDT", "RRTN"
+	case "exchange":
+		return "FORX", "SPOT", "OTHR"
+	case "fee":
+		return "ACMT", "MDOP", "CHRG"
+	case "interest":
+		return "ACMT", "MCOP", "INTR"
+	case "overdraft_interest":
+		return "ACMT", "MDOP", "INTR"
+	case "loan_disbursement":
+		return "LDAS", "CSLN", "DDWN"
+	case "loan_payment":
+		return "LDAS", "CSLN", "RPMT"
+	}
+
+	return "XTND", "NTAV", "NTAV"
+}
+
+// camtMessageId fits an identifier in the 35 characters ISO 20022 allows for references
+func camtMessageId(id string) string {
+	id = strings.ReplaceAll(id, "-", "")
+	if len(id) > 35 {
+		id = id[:35]
+	}
+
+	return id
+}
+
+func camtDate(date time.Time) string {
+	return date.UTC().Format(time.RFC3339)
+}
+
+func camtCreditDebit(amount decimal.Decimal) string {
+	if amount.IsNegative() {
+		return "DBIT"
+	}
+
+	return "CRDT"
+}
+
+func camtBalanceOf(code string, amount decimal.Decimal, currency string, date time.Time) camtBalance {
+	return camtBalance{
+		Cd:        code,
+		Amt:       camtAmount{Ccy: currency, Value: FormatAmount(amount.Abs(), currency)},
+		CdtDbtInd: camtCreditDebit(amount),
+		DtTm:      camtDate(date),
+	}
+}
+
+func camtReport(statement *model.Statement, message_id string, balances []camtBalance) camtAccountReport {
+	currency := statement.Currency
+
+	description_of := func(movement *model.AccountTransaction) string {
+		description := Description(movement, statement.AccountId)
+		if len(description) > 140 {
+			description = description[:140]
+		}
+		return description
+	}
+
+	entries := []camtEntry{}
+	credits := 0
+	for _, movement := range statement.Movements {
+		booked_at := movement.DateIssued
+		if movement.BookedAt != nil {
+			booked_at = *movement.BookedAt
+		}
+
+		reference := camtMessageId(FITID(&movement))
+		domain, family, sub_family := BankTransactionCode(&movement)
+		amount := camtAmount{Ccy: currency, Value: FormatAmount(movement.SignedAmount.Abs(), currency)}
+		credit_debit := camtCreditDebit(movement.SignedAmount)
+		if movement.SignedAmount.IsPositive() {
+			credits++
+		}
+
+		entries = append(entries, camtEntry{
+			NtryRef:       reference,
+			Amt:           amount,
+			CdtDbtInd:     credit_debit,
+			RvslInd:       movement.Reversal,
+			Sts:           "BOOK",
+			BookgDt:       camtDate(booked_at),
+			ValDt:         camtDate(booked_at),
+			AcctSvcrRef:   reference,
+			Domain:        domain,
+			Family:        family,
+			SubFamily:     sub_family,
+			TxAcctSvcrRef: reference,
+			TxAmt:         amount,
+			TxCdtDbtInd:   credit_debit,
+			Ustrd:         description_of(&movement),
+		})
+	}
+
+	net := statement.TotalCredits.Sub(statement.TotalDebits)
+
+	name := statement.AccountName
+	if len(name) > 70 {
+		name = name[:70]
+	}
+
+	return camtAccountReport{
+		Id:      camtMessageId(message_id),
+		CreDtTm: camtDate(statement.GeneratedAt),
+		FrDtTm:  camtDate(statement.DateFrom),
+		ToDtTm:  camtDate(statement.DateTo),
+		Acct: camtAccount{
+			Id:  camtMessageId(statement.AccountId.String()),
+			Ccy: currency,
+			Nm:  name,
+		},
+		Bal: balances,
+		TxsSummry: camtSummary{
+			NbOfNtries:    len(entries),
+			Sum:           statement.TotalCredits.Add(statement.TotalDebits).String(),
+			NetAmt:        net.Abs().String(),
+			NetCdtDbtInd:  camtCreditDebit(net),
+			NbOfCdtNtries: credits,
+			CdtSum:        statement.TotalCredits.String(),
+			NbOfDbtNtries: len(entries) - credits,
+			DbtSum:        statement.TotalDebits.String(),
+		},
+		Ntry: entries,
+	}
+}
+
+func writeCamt(w io.Writer, document any) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// RenderCamt053 writes the statement as an end-of-day camt.053 bank to customer statement,
+// with the opening and closing booked balances
+func RenderCamt053(w io.Writer, statement *model.Statement, message_id string) error {
+	currency := statement.Currency
+	balances := []camtBalance{
+		camtBalanceOf("OPBD", statement.OpeningBalance, currency, statement.DateFrom),
+		camtBalanceOf("CLBD", statement.ClosingBalance, currency, statement.DateTo),
+	}
+
+	return writeCamt(w, camt053Document{
+		Namespace: Camt053Namespace,
+		GrpHdr:    camtGroupHeader{MsgId: camtMessageId(message_id), CreDtTm: camtDate(statement.GeneratedAt)},
+		Stmt:      camtReport(statement, message_id, balances),
+	})
+}
+
+// RenderCamt052 writes the statement as an intraday camt.052 account report, with the opening booked balance
+// and the interim booked and available balances at the time of the report
+func RenderCamt052(w io.Writer, statement *model.Statement, balance *model.AccountBalance, message_id string) error {
+	currency := statement.Currency
+	balances := []camtBalance{
+		camtBalanceOf("OPBD", statement.OpeningBalance, currency, statement.DateFrom),
+		camtBalanceOf("ITBD", statement.ClosingBalance, currency, statement.DateTo),
+		camtBalanceOf("ITAV", balance.AvailableBalance, currency, balance.Date),
+	}
+
+	return writeCamt(w, camt052Document{
+		Namespace: Camt052Namespace,
+		GrpHdr:    camtGroupHeader{MsgId: camtMessageId(message_id), CreDtTm: camtDate(statement.GeneratedAt)},
+		Rpt:       camtReport(statement, message_id, balances),
+	})
+}
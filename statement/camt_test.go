@@ -0,0 +1,190 @@
+package statement
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+func sampleStatement() *model.Statement {
+	account_id, _ := uuid.NewV7()
+	other_account_id, _ := uuid.NewV7()
+	date_from := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	date_to := date_from.Add(24*time.Hour - time.Nanosecond)
+
+	movement := func(kind string, signed_amount string, minutes int, reversal bool) model.AccountTransaction {
+		id, _ := uuid.NewV7()
+		amount := decimal.RequireFromString(signed_amount)
+		booked_at := date_from.Add(time.Duration(minutes) * time.Minute)
+
+		transaction := model.AccountTransaction{
+			Transaction: model.Transaction{
+				Id:         id,
+				Kind:       kind,
+				Amount:     amount.Abs(),
+				Currency:   "EUR",
+				DateIssued: booked_at,
+				Status:     "posted",
+				PostedAt:   &booked_at,
+			},
+			SignedAmount: amount,
+			BookedAt:     &booked_at,
+			Reversal:     reversal,
+		}
+
+		switch {
+		case kind == "deposit":
+			transaction.ToAccountId = &account_id
+		case amount.IsPositive():
+			transaction.FromAccountId = &other_account_id
+			transaction.ToAccountId = &account_id
+		default:
+			transaction.FromAccountId = &account_id
+			transaction.ToAccountId = &other_account_id
+		}
+
+		return transaction
+	}
+
+	movements := []model.AccountTransaction{
+		movement("deposit", "1000.00", 10, false),
+		movement("transfer", "-250.50", 20, false),
+		movement("transfer", "40.25", 30, false),
+		movement("capture", "-12.99", 40, false),
+		movement("refund", "5.00", 50, false),
+		movement("withdrawal", "-100.00", 60, false),
+		movement("withdrawal", "100.00", 70, true),
+		movement("exchange", "-300.00", 80, false),
+	}
+
+	statement := model.Statement{
+		AccountId:      account_id,
+		AccountName:    "Operating account",
+		Currency:       "EUR",
+		DateFrom:       date_from,
+		DateTo:         date_to,
+		OpeningBalance: decimal.RequireFromString("-20.00"),
+		Movements:      []model.AccountTransaction{},
+		TotalsByKind:   map[string]decimal.Decimal{},
+		GeneratedAt:    date_to.Add(time.Hour),
+	}
+
+	balance := statement.OpeningBalance
+	for _, m := range movements {
+		balance = balance.Add(m.SignedAmount)
+		running_balance := balance
+		m.RunningBalance = &running_balance
+
+		statement.TotalsByKind[m.Kind] = statement.TotalsByKind[m.Kind].Add(m.SignedAmount)
+		if m.SignedAmount.IsPositive() {
+			statement.TotalCredits = statement.TotalCredits.Add(m.SignedAmount)
+		} else {
+			statement.TotalDebits = statement.TotalDebits.Add(m.SignedAmount.Neg())
+		}
+
+		statement.Movements = append(statement.Movements, m)
+	}
+	statement.ClosingBalance = balance
+
+	return &statement
+}
+
+// validateXSD runs the document through xmllint against one of the bundled schemas
+func validateXSD(t *testing.T, document []byte, schema string) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+
+	path := filepath.Join(t.TempDir(), "document.xml")
+	err = os.WriteFile(path, document, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := exec.Command(xmllint, "--noout", "--schema", filepath.Join("xsd", schema), path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("document does not validate against %s: %s\n%s", schema, err, output)
+	}
+}
+
+func TestCamt053ValidatesAgainstSchema(t *testing.T) {
+	statement := sampleStatement()
+
+	var document bytes.Buffer
+	err := RenderCamt053(&document, statement, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validateXSD(t, document.Bytes(), "camt.053.001.08.xsd")
+
+	for _, expected := range []string{"<Cd>OPBD</Cd>", "<Cd>CLBD</Cd>", "<Amt Ccy=\"EUR\">20.00</Amt>", "<RvslInd>true</RvslInd>"} {
+		if !bytes.Contains(document.Bytes(), []byte(expected)) {
+			t.Errorf("expected the statement to contain %s", expected)
+		}
+	}
+}
+
+func TestCamt052ValidatesAgainstSchema(t *testing.T) {
+	statement := sampleStatement()
+	balance := model.AccountBalance{
+		AccountId:        statement.AccountId,
+		Currency:         statement.Currency,
+		Balance:          statement.ClosingBalance,
+		AvailableBalance: statement.ClosingBalance.Sub(decimal.NewFromInt(50)),
+		Date:             statement.GeneratedAt,
+	}
+
+	var document bytes.Buffer
+	err := RenderCamt052(&document, statement, &balance, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validateXSD(t, document.Bytes(), "camt.052.001.08.xsd")
+
+	for _, expected := range []string{"<Cd>ITBD</Cd>", "<Cd>ITAV</Cd>"} {
+		if !bytes.Contains(document.Bytes(), []byte(expected)) {
+			t.Errorf("expected the report to contain %s", expected)
+		}
+	}
+}
+
+func TestBankTransactionCode(t *testing.T) {
+	cases := []struct {
+		kind          string
+		signed_amount string
+		reversal      bool
+		expected      [3]string
+	}{
+		{"deposit", "10", false, [3]string{"PMNT", "CNTR", "CDPT"}},
+		{"withdrawal", "-10", false, [3]string{"PMNT", "CNTR", "CWDL"}},
+		{"transfer", "-10", false, [3]string{"PMNT", "ICDT", "BOOK"}},
+		{"transfer", "10", false, [3]string{"PMNT", "RCDT", "BOOK"}},
+		{"transfer", "10", true, [3]string{"PMNT", "ICDT", "BOOK"}},
+		{"refund", "10", false, [3]string{"PMNT", "RCDT", "RRTN"}},
+		{"capture", "-10", false, [3]string{"PMNT", "CCRD", "POSD"}},
+		{"exchange", "-10", false, [3]string{"FORX", "SPOT", "OTHR"}},
+	}
+
+	for _, c := range cases {
+		movement := model.AccountTransaction{
+			Transaction:  model.Transaction{Kind: c.kind},
+			SignedAmount: decimal.RequireFromString(c.signed_amount),
+			Reversal:     c.reversal,
+		}
+
+		domain, family, sub_family := BankTransactionCode(&movement)
+		if [3]string{domain, family, sub_family} != c.expected {
+			t.Errorf("%s %s reversal=%t: expected %v, got %s/%s/%s", c.kind, c.signed_amount, c.reversal, c.expected, domain, family, sub_family)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"time"
+	"welloff-bank/model"
+)
+
+// RenderCSV writes one row per movement between an opening and a closing balance row
+func RenderCSV(w io.Writer, statement *model.Statement) error {
+	writer := csv.NewWriter(w)
+
+	rows := [][]string{
+		{"date", "transaction_id", "kind", "description", "amount", "balance", "currency"},
+		{statement.DateFrom.UTC().Format(time.RFC3339), "", "", "Opening balance", "", FormatAmount(statement.OpeningBalance, statement.Currency), statement.Currency},
+	}
+
+	for _, movement := range statement.Movements {
+		booked_at := movement.DateIssued
+		if movement.BookedAt != nil {
+			booked_at = *movement.BookedAt
+		}
+
+		rows = append(rows, []string{
+			booked_at.UTC().Format(time.RFC3339),
+			movement.Id.String(),
+			movement.Kind,
+			Description(&movement, statement.AccountId),
+			FormatAmount(movement.SignedAmount, statement.Currency),
+			FormatAmount(*movement.RunningBalance, statement.Currency),
+			statement.Currency,
+		})
+	}
+
+	rows = append(rows, []string{statement.DateTo.UTC().Format(time.RFC3339), "", "", "Closing balance", "", FormatAmount(statement.ClosingBalance, statement.Currency), statement.Currency})
+
+	err := writer.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
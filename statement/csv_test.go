@@ -0,0 +1,71 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRenderCSV(t *testing.T) {
+	cases := []struct {
+		name      string
+		statement *model.Statement
+	}{
+		{
+			name:      "csv_movements",
+			statement: goldenStatement("1250.00", goldenMovements()...),
+		},
+		{
+			name:      "csv_overdrawn_without_movements",
+			statement: goldenStatement("-20.50"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := RenderCSV(&output, c.statement)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, c.name, output.Bytes())
+		})
+	}
+}
+
+func TestRenderCSVBalancesAddUp(t *testing.T) {
+	statement := goldenStatement("1250.00", goldenMovements()...)
+
+	var output bytes.Buffer
+	err := RenderCSV(&output, statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&output).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// header, opening balance, one row per movement and closing balance
+	if len(rows) != len(statement.Movements)+3 {
+		t.Fatalf("expected %d rows, got %d", len(statement.Movements)+3, len(rows))
+	}
+
+	balance := decimal.RequireFromString(rows[1][5])
+	for _, row := range rows[2 : len(rows)-1] {
+		balance = balance.Add(decimal.RequireFromString(row[4]))
+		if !balance.Equal(decimal.RequireFromString(row[5])) {
+			t.Errorf("%s: expected balance %s, got %s", row[1], balance, row[5])
+		}
+	}
+
+	closing_balance := rows[len(rows)-1][5]
+	if !balance.Equal(decimal.RequireFromString(closing_balance)) {
+		t.Errorf("expected closing balance %s, got %s", balance, closing_balance)
+	}
+}
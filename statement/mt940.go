@@ -0,0 +1,165 @@
+package statement
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	mt940LineBreak       = "\r\n"
+	mt940NarrativeLines  = 6
+	mt940NarrativeLength = 65
+)
+
+// mt940Amount formats the amount the SWIFT way, without sign and with a decimal comma
+func mt940Amount(amount decimal.Decimal, currency string) string {
+	return strings.Replace(FormatAmount(amount.Abs(), currency), ".", ",", 1)
+}
+
+// mt940Text keeps only the characters of the SWIFT X character set
+func mt940Text(text string) string {
+	var builder strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			builder.WriteRune(r)
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(' ')
+		}
+	}
+
+	return builder.String()
+}
+
+func mt940Balance(tag string, amount decimal.Decimal, currency string, date time.Time) string {
+	mark := "C"
+	if amount.IsNegative() {
+		mark = "D"
+	}
+
+	return fmt.Sprintf(":%s:%s%s%s%s", tag, mark, date.UTC().Format("060102"), currency, mt940Amount(amount, currency))
+}
+
+// MT940Mark is the debit/credit mark of a statement line, refunds and reversals undo an earlier movement
+// so they are reported as a reversal of credit (RC, a debit) or a reversal of debit (RD, a credit)
+func MT940Mark(movement *model.AccountTransaction) string {
+	credit := movement.SignedAmount.IsPositive()
+
+	if movement.Kind == "refund" || movement.Reversal {
+		if credit {
+			return "RD"
+		}
+		return "RC"
+	}
+
+	if credit {
+		return "C"
+	}
+	return "D"
+}
+
+// MT940TransactionType maps the kind of the movement to a SWIFT transaction type identification code
+func MT940TransactionType(movement *model.AccountTransaction) string {
+	switch movement.Kind {
+	case "transfer", "refund":
+		return "NTRF"
+	case "exchange":
+		return "NFEX"
+	case "fee":
+		return "NCHG"
+	case "interest", "overdraft_interest":
+		return "NINT"
+	case "loan_disbursement", "loan_payment":
+		return "NLDP"
+	}
+
+	return "NMSC"
+}
+
+// mt940Narrative splits the parts over the lines of a :86: field, each part starting on a new line,
+// dropping what doesn't fit
+func mt940Narrative(parts ...string) []string {
+	lines := []string{}
+	for _, text := range parts {
+		text = mt940Text(text)
+
+		for len(text) > 0 && len(lines) < mt940NarrativeLines {
+			length := mt940NarrativeLength
+			if length > len(text) {
+				length = len(text)
+			}
+
+			line := text[:length]
+			text = text[length:]
+
+			// a line starting with "-" would end the message
+			if strings.HasPrefix(line, "-") {
+				line = " " + line[1:]
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// RenderMT940 writes the statement as a SWIFT MT940 customer statement message, the reference goes in :20:
+func RenderMT940(w io.Writer, statement *model.Statement, reference string) error {
+	currency := statement.Currency
+	reference = mt940Text(reference)
+	if len(reference) > 16 {
+		reference = reference[:16]
+	}
+
+	account := strings.ReplaceAll(statement.AccountId.String(), "-", "")
+
+	lines := []string{
+		":20:" + reference,
+		":25:" + account,
+		fmt.Sprintf(":28C:%d/1", statement.DateTo.UTC().YearDay()),
+		mt940Balance("60F", statement.OpeningBalance, currency, statement.DateFrom),
+	}
+
+	for _, movement := range statement.Movements {
+		booked_at := movement.DateIssued
+		if movement.BookedAt != nil {
+			booked_at = *movement.BookedAt
+		}
+		booked_at = booked_at.UTC()
+
+		id := strings.ReplaceAll(movement.Id.String(), "-", "")
+
+		lines = append(lines, fmt.Sprintf(
+			":61:%s%s%s%s%sNONREF//%s",
+			booked_at.Format("060102"),
+			booked_at.Format("0102"),
+			MT940Mark(&movement),
+			mt940Amount(movement.SignedAmount, currency),
+			MT940TransactionType(&movement),
+			id[len(id)-16:],
+		))
+
+		narrative := mt940Narrative(Description(&movement, statement.AccountId), "REF "+movement.Id.String())
+		for i, line := range narrative {
+			if i == 0 {
+				line = ":86:" + line
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	lines = append(lines,
+		mt940Balance("62F", statement.ClosingBalance, currency, statement.DateTo),
+		"-",
+	)
+
+	_, err := io.WriteString(w, strings.Join(lines, mt940LineBreak)+mt940LineBreak)
+	return err
+}
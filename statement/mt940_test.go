@@ -0,0 +1,178 @@
+package statement
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// goldenStatement is a fixed statement so the rendered output can be compared byte for byte
+func goldenStatement(opening_balance string, movements ...model.AccountTransaction) *model.Statement {
+	account_id := uuid.MustParse("0192a3b4-c5d6-7e8f-9a0b-1c2d3e4f5a6b")
+	date_from := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	statement := model.Statement{
+		AccountId:      account_id,
+		AccountName:    "Operating account",
+		Currency:       "EUR",
+		DateFrom:       date_from,
+		DateTo:         date_from.Add(24*time.Hour - time.Nanosecond),
+		OpeningBalance: decimal.RequireFromString(opening_balance),
+		Movements:      []model.AccountTransaction{},
+		TotalsByKind:   map[string]decimal.Decimal{},
+		GeneratedAt:    date_from.Add(25 * time.Hour),
+	}
+
+	balance := statement.OpeningBalance
+	for _, movement := range movements {
+		if movement.ToAccountId == nil && movement.FromAccountId == nil {
+			if movement.SignedAmount.IsPositive() {
+				movement.ToAccountId = &account_id
+			} else {
+				movement.FromAccountId = &account_id
+			}
+		} else if movement.ToAccountId == nil {
+			movement.ToAccountId = &account_id
+		} else if movement.FromAccountId == nil {
+			movement.FromAccountId = &account_id
+		}
+
+		balance = balance.Add(movement.SignedAmount)
+		running_balance := balance
+		movement.RunningBalance = &running_balance
+
+		statement.TotalsByKind[movement.Kind] = statement.TotalsByKind[movement.Kind].Add(movement.SignedAmount)
+		if movement.SignedAmount.IsPositive() {
+			statement.TotalCredits = statement.TotalCredits.Add(movement.SignedAmount)
+		} else {
+			statement.TotalDebits = statement.TotalDebits.Add(movement.SignedAmount.Neg())
+		}
+
+		statement.Movements = append(statement.Movements, movement)
+	}
+	statement.ClosingBalance = balance
+
+	return &statement
+}
+
+func goldenMovement(id string, kind string, signed_amount string, booked_at string, counterparty string, reversal bool) model.AccountTransaction {
+	amount := decimal.RequireFromString(signed_amount)
+	date, _ := time.Parse(time.RFC3339, booked_at)
+
+	movement := model.AccountTransaction{
+		Transaction: model.Transaction{
+			Id:         uuid.MustParse(id),
+			Kind:       kind,
+			Amount:     amount.Abs(),
+			Currency:   "EUR",
+			DateIssued: date,
+			Status:     "posted",
+			PostedAt:   &date,
+		},
+		SignedAmount: amount,
+		BookedAt:     &date,
+		Reversal:     reversal,
+	}
+
+	if counterparty != "" {
+		counterparty_id := uuid.MustParse(counterparty)
+		if amount.IsPositive() {
+			movement.FromAccountId = &counterparty_id
+		} else {
+			movement.ToAccountId = &counterparty_id
+		}
+	}
+
+	return movement
+}
+
+func assertGolden(t *testing.T, name string, output []byte) {
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		err := os.WriteFile(path, output, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(output, expected) {
+		t.Errorf("output differs from %s, run the tests with -update if the change is intended\n--- got ---\n%s\n--- expected ---\n%s", path, output, expected)
+	}
+}
+
+// goldenMovements covers every kind of movement and a reversal, shared by the golden tests of each format
+func goldenMovements() []model.AccountTransaction {
+	counterparty := "0192a3b4-c5d6-7e8f-9a0b-00000000c0de"
+
+	return []model.AccountTransaction{
+		goldenMovement("0192a3b4-0000-7000-8000-000000000001", "deposit", "1000.00", "2026-10-17T08:15:00Z", "", false),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000002", "transfer", "-250.50", "2026-10-17T09:00:00Z", counterparty, false),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000003", "transfer", "40.25", "2026-10-17T10:30:00Z", counterparty, false),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000004", "refund", "50.00", "2026-10-17T11:00:00Z", counterparty, false),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000005", "refund", "-10.00", "2026-10-17T11:30:00Z", counterparty, false),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000006", "capture", "-12.99", "2026-10-17T12:00:00Z", "", false),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000007", "withdrawal", "-100.00", "2026-10-17T13:00:00Z", "", false),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000007", "withdrawal", "100.00", "2026-10-17T13:05:00Z", "", true),
+		goldenMovement("0192a3b4-0000-7000-8000-000000000008", "exchange", "-300.00", "2026-10-17T14:00:00Z", "", false),
+	}
+}
+
+func TestRenderMT940(t *testing.T) {
+	cases := []struct {
+		name      string
+		statement *model.Statement
+	}{
+		{
+			name:      "mt940_movements",
+			statement: goldenStatement("1250.00", goldenMovements()...),
+		},
+		{
+			name:      "mt940_overdrawn_without_movements",
+			statement: goldenStatement("-20.50"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := RenderMT940(&output, c.statement, "WB261017")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, c.name, output.Bytes())
+		})
+	}
+}
+
+func TestMT940Narrative(t *testing.T) {
+	lines := mt940Narrative("-leading dash, ümlaut and a very long narrative " + string(bytes.Repeat([]byte("x"), 500)))
+
+	if len(lines) != mt940NarrativeLines {
+		t.Fatalf("expected %d lines, got %d", mt940NarrativeLines, len(lines))
+	}
+
+	for _, line := range lines {
+		if len(line) > mt940NarrativeLength {
+			t.Errorf("line is longer than %d characters: %q", mt940NarrativeLength, line)
+		}
+	}
+
+	if lines[0][0] == '-' || bytes.ContainsRune([]byte(lines[0]), 'ü') {
+		t.Errorf("unexpected first line %q", lines[0])
+	}
+}
@@ -0,0 +1,215 @@
+package statement
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"time"
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OFXOrganization = "Welloff Bank"
+	OFXFinancialId  = "1001"
+	// bank identifier Quicken uses to recognize QFX downloads
+	QFXIntuitBankId = "1001"
+)
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n" +
+	`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n"
+
+type ofxDocument struct {
+	XMLName xml.Name       `xml:"OFX"`
+	SignOn  ofxSignOn      `xml:"SIGNONMSGSRSV1>SONRS"`
+	Bank    ofxTransaction `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxSignOn struct {
+	Status      ofxStatus `xml:"STATUS"`
+	ServerDate  string    `xml:"DTSERVER"`
+	Language    string    `xml:"LANGUAGE"`
+	Org         string    `xml:"FI>ORG"`
+	FinancialId string    `xml:"FI>FID"`
+	IntuitBid   string    `xml:"INTU.BID,omitempty"`
+}
+
+type ofxTransaction struct {
+	TransactionUid string       `xml:"TRNUID"`
+	Status         ofxStatus    `xml:"STATUS"`
+	Statement      ofxStatement `xml:"STMTRS"`
+}
+
+type ofxStatement struct {
+	Currency         string        `xml:"CURDEF"`
+	BankId           string        `xml:"BANKACCTFROM>BANKID"`
+	AccountId        string        `xml:"BANKACCTFROM>ACCTID"`
+	AccountType      string        `xml:"BANKACCTFROM>ACCTTYPE"`
+	DateStart        string        `xml:"BANKTRANLIST>DTSTART"`
+	DateEnd          string        `xml:"BANKTRANLIST>DTEND"`
+	Transactions     []ofxMovement `xml:"BANKTRANLIST>STMTTRN"`
+	LedgerBalance    ofxBalance    `xml:"LEDGERBAL"`
+	AvailableBalance ofxBalance    `xml:"AVAILBAL"`
+}
+
+type ofxMovement struct {
+	Type       string `xml:"TRNTYPE"`
+	DatePosted string `xml:"DTPOSTED"`
+	Amount     string `xml:"TRNAMT"`
+	FitId      string `xml:"FITID"`
+	Name       string `xml:"NAME"`
+	Memo       string `xml:"MEMO"`
+}
+
+type ofxBalance struct {
+	Amount string `xml:"BALAMT"`
+	AsOf   string `xml:"DTASOF"`
+}
+
+// OFXDate formats the instant as an OFX datetime in UTC
+func OFXDate(date time.Time) string {
+	return date.UTC().Format("20060102150405.000") + "[0:UTC]"
+}
+
+// OFXAccountId shortens the account UUID to the 22 characters OFX allows for ACCTID,
+// keeping the random tail of the UUID so it stays unique in practice
+func OFXAccountId(account_id uuid.UUID) string {
+	id := hex.EncodeToString(account_id[:])
+	return id[len(id)-22:]
+}
+
+// OFXAccountType maps the type of the account to an OFX ACCTTYPE
+func OFXAccountType(account_type string) string {
+	if account_type == "savings" {
+		return "SAVINGS"
+	}
+
+	return "CHECKING"
+}
+
+// FITID is the stable OFX identifier of a movement, a reversal is a movement of its own so it gets a suffix
+func FITID(movement *model.AccountTransaction) string {
+	if movement.Reversal {
+		return movement.Id.String() + "-R"
+	}
+
+	return movement.Id.String()
+}
+
+// OFXTransactionType maps the kind of the movement to an OFX TRNTYPE, using the sign when the kind alone is not enough
+func OFXTransactionType(movement *model.AccountTransaction) string {
+	credit := movement.SignedAmount.IsPositive()
+
+	if movement.Reversal {
+		if credit {
+			return "CREDIT"
+		}
+		return "DEBIT"
+	}
+
+	switch movement.Kind {
+	case "deposit":
+		return "DEP"
+	case "withdrawal":
+		return "CASH"
+	case "capture":
+		return "POS"
+	case "transfer", "exchange":
+		return "XFER"
+	case "fee":
+		return "SRVCHG"
+	case "interest", "overdraft_interest":
+		return "INT"
+	case "loan_payment":
+		return "PAYMENT"
+	}
+
+	if credit {
+		return "CREDIT"
+	}
+	return "DEBIT"
+}
+
+// RenderOFX writes the statement movements as an OFX 2.2 bank statement, quicken adds the fields QFX needs
+func RenderOFX(w io.Writer, statement *model.Statement, balance *model.AccountBalance, quicken bool) error {
+	currency := statement.Currency
+
+	movements := []ofxMovement{}
+	for _, movement := range statement.Movements {
+		booked_at := movement.DateIssued
+		if movement.BookedAt != nil {
+			booked_at = *movement.BookedAt
+		}
+
+		description := Description(&movement, statement.AccountId)
+		name := description
+		if len(name) > 32 {
+			name = name[:32]
+		}
+
+		movements = append(movements, ofxMovement{
+			Type:       OFXTransactionType(&movement),
+			DatePosted: OFXDate(booked_at),
+			Amount:     FormatAmount(movement.SignedAmount, currency),
+			FitId:      FITID(&movement),
+			Name:       name,
+			Memo:       description,
+		})
+	}
+
+	document := ofxDocument{
+		SignOn: ofxSignOn{
+			Status:      ofxStatus{Code: 0, Severity: "INFO"},
+			ServerDate:  OFXDate(statement.GeneratedAt),
+			Language:    "ENG",
+			Org:         OFXOrganization,
+			FinancialId: OFXFinancialId,
+		},
+		Bank: ofxTransaction{
+			TransactionUid: "0",
+			Status:         ofxStatus{Code: 0, Severity: "INFO"},
+			Statement: ofxStatement{
+				Currency:     currency,
+				BankId:       OFXFinancialId,
+				AccountId:    OFXAccountId(statement.AccountId),
+				AccountType:  OFXAccountType(statement.AccountType),
+				DateStart:    OFXDate(statement.DateFrom),
+				DateEnd:      OFXDate(statement.DateTo),
+				Transactions: movements,
+				LedgerBalance: ofxBalance{
+					Amount: FormatAmount(balance.Balance, currency),
+					AsOf:   OFXDate(balance.Date),
+				},
+				AvailableBalance: ofxBalance{
+					Amount: FormatAmount(balance.AvailableBalance, currency),
+					AsOf:   OFXDate(balance.Date),
+				},
+			},
+		},
+	}
+
+	if quicken {
+		document.SignOn.IntuitBid = QFXIntuitBankId
+	}
+
+	_, err := io.WriteString(w, ofxHeader)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(document)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,153 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"welloff-bank/model"
+
+	"github.com/shopspring/decimal"
+)
+
+func goldenBalance(statement *model.Statement) *model.AccountBalance {
+	return &model.AccountBalance{
+		AccountId:        statement.AccountId,
+		Currency:         statement.Currency,
+		Balance:          statement.ClosingBalance,
+		AvailableBalance: statement.ClosingBalance.Sub(decimal.NewFromInt(50)),
+		Date:             statement.GeneratedAt,
+	}
+}
+
+func TestRenderOFX(t *testing.T) {
+	cases := []struct {
+		name    string
+		quicken bool
+	}{
+		{"ofx_movements", false},
+		{"qfx_movements", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			statement := goldenStatement("1250.00", goldenMovements()...)
+
+			var output bytes.Buffer
+			err := RenderOFX(&output, statement, goldenBalance(statement), c.quicken)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertGolden(t, c.name, output.Bytes())
+		})
+	}
+}
+
+func TestRenderOFXSavingsAccount(t *testing.T) {
+	statement := goldenStatement("1250.00", goldenMovements()...)
+	statement.AccountType = "savings"
+
+	var output bytes.Buffer
+	err := RenderOFX(&output, statement, goldenBalance(statement), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document ofxDocument
+	err = xml.Unmarshal(bytes.TrimPrefix(output.Bytes(), []byte(ofxHeader)), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if document.Bank.Statement.AccountType != "SAVINGS" {
+		t.Errorf("Unexpected ACCTTYPE of a savings account. Expected: SAVINGS, Actual: %s", document.Bank.Statement.AccountType)
+	}
+}
+
+// renderOFXTransactions renders the statement and reads its transactions back
+func renderOFXTransactions(t *testing.T, statement *model.Statement) []ofxMovement {
+	t.Helper()
+
+	var output bytes.Buffer
+	err := RenderOFX(&output, statement, goldenBalance(statement), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document ofxDocument
+	err = xml.Unmarshal(bytes.TrimPrefix(output.Bytes(), []byte(ofxHeader)), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return document.Bank.Statement.Transactions
+}
+
+func TestRenderOFXSignsAndFITIDs(t *testing.T) {
+	statement := goldenStatement("1250.00", goldenMovements()...)
+	transactions := renderOFXTransactions(t, statement)
+	if len(transactions) != len(statement.Movements) {
+		t.Fatalf("expected %d transactions, got %d", len(statement.Movements), len(transactions))
+	}
+
+	fitids := map[string]bool{}
+	for i, transaction := range transactions {
+		movement := statement.Movements[i]
+
+		// debits are negative and credits positive, from the point of view of the account
+		if !decimal.RequireFromString(transaction.Amount).Equal(movement.SignedAmount) {
+			t.Errorf("%s: expected amount %s, got %s", transaction.FitId, movement.SignedAmount, transaction.Amount)
+		}
+
+		if fitids[transaction.FitId] {
+			t.Errorf("FITID %s is not unique", transaction.FitId)
+		}
+		fitids[transaction.FitId] = true
+	}
+
+	// the withdrawal and its reversal share the transaction id but not the FITID
+	if transactions[6].FitId != "0192a3b4-0000-7000-8000-000000000007" || transactions[7].FitId != "0192a3b4-0000-7000-8000-000000000007-R" {
+		t.Errorf("unexpected FITIDs for the reversed withdrawal: %s, %s", transactions[6].FitId, transactions[7].FitId)
+	}
+
+	// a movement keeps its FITID when it shows in another statement, so importers don't duplicate it
+	other := goldenStatement("0", statement.Movements[7], statement.Movements[1])
+	other_transactions := renderOFXTransactions(t, other)
+	if other_transactions[0].FitId != transactions[7].FitId || other_transactions[1].FitId != transactions[1].FitId {
+		t.Errorf("FITIDs changed between statements: %s, %s", other_transactions[0].FitId, other_transactions[1].FitId)
+	}
+}
+
+func TestOFXTransactionType(t *testing.T) {
+	cases := []struct {
+		kind          string
+		signed_amount string
+		reversal      bool
+		expected      string
+	}{
+		{"deposit", "10", false, "DEP"},
+		{"withdrawal", "-10", false, "CASH"},
+		{"withdrawal", "10", true, "CREDIT"},
+		{"transfer", "-10", false, "XFER"},
+		{"transfer", "10", false, "XFER"},
+		{"transfer", "-10", true, "DEBIT"},
+		{"capture", "-10", false, "POS"},
+		{"fee", "-1", false, "SRVCHG"},
+		{"overdraft_interest", "-1", false, "INT"},
+		{"refund", "10", false, "CREDIT"},
+		{"refund", "-10", false, "DEBIT"},
+		{"loan_disbursement", "1000", false, "CREDIT"},
+	}
+
+	for _, c := range cases {
+		movement := model.AccountTransaction{
+			Transaction:  model.Transaction{Kind: c.kind},
+			SignedAmount: decimal.RequireFromString(c.signed_amount),
+			Reversal:     c.reversal,
+		}
+
+		if got := OFXTransactionType(&movement); got != c.expected {
+			t.Errorf("%s %s reversal=%t: expected %s, got %s", c.kind, c.signed_amount, c.reversal, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"welloff-bank/model"
+)
+
+const (
+	pdfPageWidth    = 595 // A4 in points
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 8
+	pdfLineHeight   = 11
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+)
+
+// pdfEscape keeps the text printable in a PDF literal string, characters outside of ASCII are replaced
+func pdfEscape(text string) string {
+	var builder strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		case r < 32 || r > 126:
+			builder.WriteRune('?')
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	return builder.String()
+}
+
+// writePDF lays the lines out in a monospaced font over as many pages as needed
+func writePDF(w io.Writer, lines []string) error {
+	pages := [][]string{}
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	// 1: catalog, 2: page tree, 3: font, then a page object and its content stream per page
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	}
+
+	kids := []string{}
+	for i, page := range pages {
+		page_object := len(objects) + 1
+		content_object := page_object + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", page_object))
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		fmt.Fprintf(&content, "ET\nBT\n/F1 %d Tf\n%d %d Td\n(Page %d of %d) Tj\nET\n", pdfFontSize, pdfPageWidth-pdfMargin-60, pdfMargin/2, i+1, len(pages))
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, content_object),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var document bytes.Buffer
+	document.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = document.Len()
+		fmt.Fprintf(&document, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := document.Len()
+	fmt.Fprintf(&document, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&document, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&document, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(document.Bytes())
+	return err
+}
+
+// RenderPDF writes a printable statement without relying on external services
+func RenderPDF(w io.Writer, statement *model.Statement) error {
+	currency := statement.Currency
+	row := "%-16s %-14s %-34s %14s %14s"
+
+	lines := []string{
+		"WELLOFF BANK - ACCOUNT STATEMENT",
+		"",
+		fmt.Sprintf("Account:   %s (%s)", statement.AccountName, statement.AccountId),
+		fmt.Sprintf("Currency:  %s", currency),
+		fmt.Sprintf("Period:    %s to %s", statement.DateFrom.UTC().Format(time.DateOnly), statement.DateTo.UTC().Format(time.DateOnly)),
+		fmt.Sprintf("Generated: %s", statement.GeneratedAt.UTC().Format(time.RFC3339)),
+		"",
+		fmt.Sprintf(row, "Date", "Kind", "Description", "Amount", "Balance"),
+		strings.Repeat("-", 96),
+		fmt.Sprintf(row, statement.DateFrom.UTC().Format(time.DateOnly), "", "Opening balance", "", FormatAmount(statement.OpeningBalance, currency)),
+	}
+
+	for _, movement := range statement.Movements {
+		booked_at := movement.DateIssued
+		if movement.BookedAt != nil {
+			booked_at = *movement.BookedAt
+		}
+
+		description := Description(&movement, statement.AccountId)
+		if len(description) > 34 {
+			description = description[:34]
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			row,
+			booked_at.UTC().Format("2006-01-02 15:04"),
+			movement.Kind,
+			description,
+			FormatAmount(movement.SignedAmount, currency),
+			FormatAmount(*movement.RunningBalance, currency),
+		))
+	}
+
+	lines = append(lines,
+		fmt.Sprintf(row, statement.DateTo.UTC().Format(time.DateOnly), "", "Closing balance", "", FormatAmount(statement.ClosingBalance, currency)),
+		strings.Repeat("-", 96),
+		"",
+		"Totals by kind",
+	)
+
+	kinds := []string{}
+	for kind := range statement.TotalsByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		lines = append(lines, fmt.Sprintf("  %-24s %14s", kind, FormatAmount(statement.TotalsByKind[kind], currency)))
+	}
+
+	lines = append(lines,
+		"",
+		fmt.Sprintf("  %-24s %14s", "Total credits", FormatAmount(statement.TotalCredits, currency)),
+		fmt.Sprintf("  %-24s %14s", "Total debits", FormatAmount(statement.TotalDebits, currency)),
+	)
+
+	return writePDF(w, lines)
+}
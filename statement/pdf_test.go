@@ -0,0 +1,88 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+	"welloff-bank/model"
+)
+
+func TestRenderPDF(t *testing.T) {
+	var output bytes.Buffer
+	err := RenderPDF(&output, goldenStatement("1250.00", goldenMovements()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertPDFStructure(t, output.Bytes())
+	assertGolden(t, "pdf_movements", output.Bytes())
+}
+
+// assertPDFStructure checks that every xref entry points at its object and that startxref points at the xref table
+func assertPDFStructure(t *testing.T, document []byte) {
+	t.Helper()
+
+	matches := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(document)
+	if matches == nil {
+		t.Fatal("missing startxref trailer")
+	}
+
+	xref, _ := strconv.Atoi(string(matches[1]))
+	if !bytes.HasPrefix(document[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(document[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("xref table has no objects")
+	}
+
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		object := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !bytes.HasPrefix(document[offset:], []byte(object)) {
+			t.Errorf("xref entry %d does not point at %q", i+1, object)
+		}
+	}
+}
+
+func TestRenderPDFPaginates(t *testing.T) {
+	movements := []model.AccountTransaction{}
+	for i := 0; i < pdfLinesPerPage; i++ {
+		booked_at := time.Date(2026, 10, 17, 8, i, 0, 0, time.UTC).Format(time.RFC3339)
+		movements = append(movements, goldenMovement(fmt.Sprintf("0192a3b4-0000-7000-8000-%012d", i+1), "deposit", "1.00", booked_at, "", false))
+	}
+
+	var output bytes.Buffer
+	err := RenderPDF(&output, goldenStatement("0", movements...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertPDFStructure(t, output.Bytes())
+
+	for _, expected := range []string{"/Count 2", "(Page 1 of 2) Tj", "(Page 2 of 2) Tj", "Closing balance"} {
+		if !bytes.Contains(output.Bytes(), []byte(expected)) {
+			t.Errorf("expected the statement to contain %s", expected)
+		}
+	}
+}
+
+func TestPDFEscape(t *testing.T) {
+	cases := map[string]string{
+		"Deposit":           "Deposit",
+		"Fee (monthly)":     `Fee \(monthly\)`,
+		`C:\statements`:     `C:\\statements`,
+		"Café\tcrème":       "Caf??cr?me",
+		"Operating account": "Operating account",
+	}
+
+	for text, expected := range cases {
+		if got := pdfEscape(text); got != expected {
+			t.Errorf("%q: expected %q, got %q", text, expected, got)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package statement
+
+import (
+	"welloff-bank/model"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// FormatAmount renders the amount with the number of decimal places of the currency's minor unit
+func FormatAmount(amount decimal.Decimal, currency string) string {
+	minor_units, ok := model.CurrencyMinorUnits[currency]
+	if !ok {
+		minor_units = 2
+	}
+
+	return amount.StringFixed(minor_units)
+}
+
+// Description is a short human readable narrative of the movement from the point of view of the account
+func Description(transaction *model.AccountTransaction, account_id uuid.UUID) string {
+	description := ""
+
+	switch transaction.Kind {
+	case "deposit":
+		description = "Deposit"
+	case "withdrawal":
+		description = "Withdrawal"
+	case "capture":
+		description = "Card capture"
+	case "exchange":
+		description = "Currency exchange"
+	case "fee":
+		description = "Fee"
+	case "interest":
+		description = "Interest"
+	case "overdraft_interest":
+		description = "Overdraft interest"
+	case "loan_disbursement":
+		description = "Loan disbursement"
+	case "loan_payment":
+		description = "Loan payment"
+	case "transfer", "refund":
+		prefix := "Transfer"
+		if transaction.Kind == "refund" {
+			prefix = "Refund"
+		}
+
+		if transaction.FromAccountId != nil && *transaction.FromAccountId == account_id && transaction.ToAccountId != nil {
+			description = prefix + " to " + transaction.ToAccountId.String()
+		} else if transaction.FromAccountId != nil {
+			description = prefix + " from " + transaction.FromAccountId.String()
+		} else {
+			description = prefix
+		}
+	default:
+		description = transaction.Kind
+	}
+
+	if transaction.Reversal {
+		description = "Reversal of " + description
+	}
+
+	return description
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"errors"
+	"slices"
+	"time"
+	"welloff-bank/fraud"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+var ErrTransactionBlocked = errors.New("transaction blocked by fraud rules")
+
+// ScreenTransaction evaluates the fraud rules against an outbound transaction of the account about to be made,
+// to_account_ids holding the accounts it pays, and records the decision. Blocked decisions are recorded
+// without a transaction, since none is made.
+func ScreenTransaction(rules *fraud.Config, user *model.User, account *model.Account, transaction_kind string, transaction_id uuid.UUID, amount decimal.Decimal, to_account_ids []uuid.UUID, repostiories repository.Repositories) (*model.FraudDecision, error) {
+	now := time.Now().UTC()
+
+	transactions, err := repostiories.LimitRepository.GetOutgoingTransactions(account.Id.String(), fraud.OutboundKinds, now.Add(-fraud.HistoryWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	history := []fraud.Movement{}
+	for _, transaction := range *transactions {
+		history = append(history, fraud.Movement{Amount: transaction.Amount, At: transaction.DateIssued})
+	}
+
+	payees := []string{}
+	for _, to_account_id := range to_account_ids {
+		if !slices.Contains(payees, to_account_id.String()) {
+			payees = append(payees, to_account_id.String())
+		}
+	}
+
+	var known_payee *bool
+	if len(payees) > 0 {
+		paid, err := repostiories.FraudRepository.HasPaidAll(account.Id.String(), payees)
+		if err != nil {
+			return nil, err
+		}
+		known_payee = &paid
+	}
+
+	security_events, err := repostiories.UserRepository.GetLastSecurityEvents(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := rules.Evaluate(&fraud.Facts{
+		Kind:           transaction_kind,
+		Currency:       account.Currency,
+		Amount:         amount,
+		History:        history,
+		KnownPayee:     known_payee,
+		SecurityEvents: security_events,
+		Now:            now,
+	})
+
+	decision := model.FraudDecision{
+		UserId:          user.Id,
+		AccountId:       account.Id,
+		TransactionKind: transaction_kind,
+		Amount:          amount,
+		Currency:        account.Currency,
+		Outcome:         result.Outcome,
+		MatchedRules:    result.MatchedRules,
+	}
+	if result.Outcome != fraud.Block {
+		decision.TransactionId = &transaction_id
+	}
+
+	err = repostiories.FraudRepository.CreateFraudDecision(&decision)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decision, nil
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"welloff-bank/limit"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/valkey-io/valkey-go"
+)
+
+// the rolling window counters are rebuilt from Postgres at least this often
+const LimitCounterTTL = time.Hour
+
+// member of a counter loaded from Postgres, telling an empty window apart from a missing counter
+const limitCounterLoaded = "loaded"
+
+func limitCounterKey(account_id uuid.UUID, kind string) string {
+	return "limit:" + account_id.String() + ":" + kind
+}
+
+func limitCounterMember(id string, amount decimal.Decimal) string {
+	return id + ":" + amount.String()
+}
+
+// GetLimitMovements reads from Postgres what left the account within the monthly window and counts against the limit kind
+func GetLimitMovements(account_id uuid.UUID, kind string, now time.Time, repostiories repository.Repositories) ([]limit.Movement, error) {
+	transactions, err := repostiories.LimitRepository.GetOutgoingTransactions(account_id.String(), limit.TransactionKinds(kind), now.Add(-limit.MonthlyWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	movements := []limit.Movement{}
+	for _, transaction := range *transactions {
+		movements = append(movements, limit.Movement{Id: transaction.Id.String(), Amount: transaction.Amount, At: transaction.DateIssued})
+	}
+
+	return movements, nil
+}
+
+// countLimitMovementScript adds the movement ARGV[2], scored ARGV[1], to a counter loaded from Postgres, drops the
+// movements older than ARGV[3], keeps the counter ARGV[4] more seconds and returns the monthly window. A counter
+// without the loaded member ARGV[5] answers nil untouched, so an expired counter is never recreated partially.
+var countLimitMovementScript = valkey.NewLuaScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[5]) then
+	return false
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+return redis.call('ZRANGEBYSCORE', KEYS[1], '(' .. ARGV[3], '+inf', 'WITHSCORES')
+`)
+
+// loadLimitCounterScript replaces a counter without the loaded member ARGV[2] with the movements read from Postgres,
+// the score and member pairs from ARGV[3] on, marks it loaded and keeps it ARGV[1] seconds
+var loadLimitCounterScript = valkey.NewLuaScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('ZADD', KEYS[1], '+inf', ARGV[2])
+for i = 3, #ARGV, 2 do
+	redis.call('ZADD', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call('EXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+var errLimitCounterNotLoaded = errors.New("limit counter expired while it was loaded")
+
+// countLimitMovement adds the movement to the Valkey counter of the limit kind of the account, loading the counter
+// from Postgres first when it is not loaded, and returns the other movements of the monthly window
+func countLimitMovement(account_id uuid.UUID, kind string, movement limit.Movement, repostiories repository.Repositories) ([]limit.Movement, error) {
+	ctx := context.Background()
+	valkey_client := repostiories.Valkey
+	key := limitCounterKey(account_id, kind)
+	since := strconv.FormatInt(movement.At.Add(-limit.MonthlyWindow).UnixMilli(), 10)
+	ttl := strconv.FormatInt(int64(LimitCounterTTL.Seconds()), 10)
+	member := limitCounterMember(movement.Id, movement.Amount)
+	count_args := []string{strconv.FormatInt(movement.At.UnixMilli(), 10), member, since, ttl, limitCounterLoaded}
+
+	scores, err := countLimitMovementScript.Exec(ctx, valkey_client, []string{key}, count_args).AsZScores()
+	if valkey.IsValkeyNil(err) {
+		movements, err := GetLimitMovements(account_id, kind, movement.At, repostiories)
+		if err != nil {
+			return nil, err
+		}
+
+		load_args := []string{ttl, limitCounterLoaded}
+		for _, m := range movements {
+			load_args = append(load_args, strconv.FormatInt(m.At.UnixMilli(), 10), limitCounterMember(m.Id, m.Amount))
+		}
+
+		err = loadLimitCounterScript.Exec(ctx, valkey_client, []string{key}, load_args).Error()
+		if err != nil {
+			return nil, err
+		}
+
+		scores, err = countLimitMovementScript.Exec(ctx, valkey_client, []string{key}, count_args).AsZScores()
+		if valkey.IsValkeyNil(err) {
+			return nil, errLimitCounterNotLoaded
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	movements := []limit.Movement{}
+	for _, score := range scores {
+		if score.Member == limitCounterLoaded || score.Member == member {
+			continue
+		}
+
+		id, amount, ok := strings.Cut(score.Member, ":")
+		if !ok {
+			continue
+		}
+
+		parsed_amount, err := decimal.NewFromString(amount)
+		if err != nil {
+			continue
+		}
+
+		movements = append(movements, limit.Movement{Id: id, Amount: parsed_amount, At: time.UnixMilli(int64(score.Score)).UTC()})
+	}
+
+	return movements, nil
+}
+
+// ReserveLimits checks the amount leaving the account in a transaction of the kind against the limits of the account,
+// counting it under id, the id of the transaction or of the batch, in the rolling windows of its daily and monthly limits.
+// The windows are Valkey counters rebuilt from Postgres, the source of truth, and are read from Postgres when Valkey fails.
+// Fails with a *limit.ExceededError, ReleaseLimits must be called when the transaction is not made after all.
+func ReserveLimits(account *model.Account, transaction_kind string, id uuid.UUID, amount decimal.Decimal, repostiories repository.Repositories) error {
+	kinds := limit.Kinds(transaction_kind)
+	if len(kinds) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	limits, err := repostiories.LimitRepository.GetAccountLimits(account.Id.String(), now)
+	if err != nil {
+		return err
+	}
+
+	// kinds with a daily or monthly limit, the ones counted in rolling windows
+	windowed := []string{}
+	for _, account_limit := range *limits {
+		if account_limit.Period != limit.Single && slices.Contains(kinds, account_limit.Kind) && !slices.Contains(windowed, account_limit.Kind) {
+			windowed = append(windowed, account_limit.Kind)
+		}
+	}
+
+	movements := map[string][]limit.Movement{}
+	movement := limit.Movement{Id: id.String(), Amount: amount, At: now}
+	for _, kind := range windowed {
+		movements[kind], err = countLimitMovement(account.Id, kind, movement, repostiories)
+		if err != nil {
+			log.Printf("[ERROR] [ReserveLimits] failed to count %s movement of account %s on valkey, reading it from postgres: %s\n", kind, account.Id, err)
+
+			movements[kind], err = GetLimitMovements(account.Id, kind, now, repostiories)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = limit.Check(*limits, kinds, amount, movements, now)
+	if err != nil {
+		ReleaseLimits(account.Id, transaction_kind, id, amount, repostiories)
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseLimits uncounts a movement reserved by ReserveLimits for a transaction that was not made
+func ReleaseLimits(account_id uuid.UUID, transaction_kind string, id uuid.UUID, amount decimal.Decimal, repostiories repository.Repositories) {
+	valkey := repostiories.Valkey
+	member := limitCounterMember(id.String(), amount)
+	for _, kind := range limit.Kinds(transaction_kind) {
+		valkey.Do(context.Background(), valkey.B().Zrem().Key(limitCounterKey(account_id, kind)).Member(member).Build())
+	}
+}
+
+// ResetLimitCounters drops the counters of the account so they are rebuilt from Postgres on the next transaction
+func ResetLimitCounters(account_id uuid.UUID, repostiories repository.Repositories) error {
+	valkey := repostiories.Valkey
+	keys := []string{}
+	for _, kind := range []string{limit.Withdrawal, limit.Transfer, limit.Outbound} {
+		keys = append(keys, limitCounterKey(account_id, kind))
+	}
+
+	return valkey.Do(context.Background(), valkey.B().Del().Key(keys...).Build()).Error()
+}
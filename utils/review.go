@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"welloff-bank/fraud"
+	"welloff-bank/limit"
+	"welloff-bank/model"
+	"welloff-bank/repository"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// OutboundCheck is what the limits and the fraud rules made of an outbound transaction about to be made
+type OutboundCheck struct {
+	User    *model.User
+	Account *model.Account
+	Kind    string
+	Amount  decimal.Decimal
+	// 'posted', or 'pending' when the transaction is held for review
+	Status string
+	// why it is held
+	Reasons []string
+	// the limit it goes over, nil when it is within the limits of the account
+	Exceeded *limit.ExceededError
+}
+
+// CheckOutbound reserves the amount leaving the account against its limits, under id, and screens it with the fraud rules.
+// Going over a limit or matching a hold rule holds the transaction for review instead of rejecting it, it must then be
+// made pending and put in the queue with HoldForReview. Matching a block rule fails with ErrTransactionBlocked.
+// ReleaseLimits must be called when the transaction is not made after all.
+func CheckOutbound(rules *fraud.Config, user *model.User, account *model.Account, transaction_kind string, id uuid.UUID, amount decimal.Decimal, to_account_ids []uuid.UUID, repostiories repository.Repositories) (*OutboundCheck, error) {
+	check := OutboundCheck{User: user, Account: account, Kind: transaction_kind, Amount: amount, Status: "posted", Reasons: []string{}}
+
+	err := ReserveLimits(account, transaction_kind, id, amount, repostiories)
+	if errors.As(err, &check.Exceeded) {
+		check.Reasons = append(check.Reasons, check.Exceeded.Error())
+	} else if err != nil {
+		return nil, err
+	}
+
+	decision, err := ScreenTransaction(rules, user, account, transaction_kind, id, amount, to_account_ids, repostiories)
+	if err != nil {
+		ReleaseLimits(account.Id, transaction_kind, id, amount, repostiories)
+		return nil, err
+	}
+
+	if decision.Outcome == fraud.Block {
+		ReleaseLimits(account.Id, transaction_kind, id, amount, repostiories)
+		return nil, ErrTransactionBlocked
+	}
+
+	if decision.Outcome == fraud.Hold {
+		check.Reasons = append(check.Reasons, "fraud rules matched: "+strings.Join(decision.MatchedRules, ", "))
+	}
+
+	if len(check.Reasons) > 0 {
+		check.Status = "pending"
+	}
+
+	return &check, nil
+}
+
+// HoldForReview puts a transaction, or the legs of a batch, made pending after CheckOutbound in the review queue.
+// The transactions are failed when they cannot be queued, so none is left pending without a review.
+func HoldForReview(check *OutboundCheck, transaction_id *uuid.UUID, batch_id *uuid.UUID, repostiories repository.Repositories) (*model.TransactionReview, error) {
+	review := model.TransactionReview{
+		TransactionId:   transaction_id,
+		BatchId:         batch_id,
+		UserId:          check.User.Id,
+		AccountId:       check.Account.Id,
+		TransactionKind: check.Kind,
+		Amount:          check.Amount,
+		Currency:        check.Account.Currency,
+		Reasons:         check.Reasons,
+	}
+
+	err := repostiories.ReviewRepository.CreateTransactionReview(&review)
+	if err != nil {
+		fail_err := repostiories.ReviewRepository.FailHeldTransactions(transaction_id, batch_id)
+		if fail_err != nil {
+			return nil, errors.Join(err, fail_err)
+		}
+
+		id := transaction_id
+		if id == nil {
+			id = batch_id
+		}
+		ReleaseLimits(check.Account.Id, check.Kind, *id, check.Amount, repostiories)
+
+		return nil, err
+	}
+
+	// the reservation was dropped when a limit was exceeded, the counters are rebuilt so they count the pending transaction
+	if check.Exceeded != nil {
+		err = ResetLimitCounters(check.Account.Id, repostiories)
+		if err != nil {
+			log.Println("[ERROR] [HoldForReview] failed to reset limit counters: ", err)
+		}
+	}
+
+	return &review, nil
+}
@@ -2,9 +2,12 @@ package utils
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"time"
+	"welloff-bank/fee"
+	"welloff-bank/fraud"
 	"welloff-bank/model"
 	"welloff-bank/repository"
 
@@ -41,53 +44,36 @@ func GetAccountBalance(ctx context.Context, account_id uuid.UUID, repostiories r
 			cache_time = cached_balance.Date
 		}
 	} else {
-		balance_snapshot, err := repostiories.AccountRepository.GetBalanceSnapshot(account.Id.String())
+		balance_snapshot, err := repostiories.AccountRepository.GetBalanceSnapshot(account.Id.String(), account.Currency)
 		if err == nil && balance_snapshot != nil {
 			balance = balance_snapshot.Balance
 			cache_time = balance_snapshot.Date
 		}
 	}
 
-	var transactions *[]model.Transaction
-	if balance.GreaterThan(decimal.Zero) {
-		transactions, err = repostiories.TransactionRepository.GetTransactionsByDate(account.Id.String(), cache_time.UTC(), now)
-	} else {
-		transactions, err = repostiories.TransactionRepository.GetAllTransactionsByAccount(account.Id.String())
-	}
-
-	if err == nil && transactions != nil {
-		for _, transaction := range *transactions {
-			switch transaction.Kind {
-			case "deposit":
-				balance = balance.Add(transaction.Amount)
-			case "withdrawal":
-				balance = balance.Sub(transaction.Amount)
-			case "transfer":
-				if transaction.FromAccountId != nil && *transaction.FromAccountId == account.Id {
-					balance = balance.Sub(transaction.Amount)
-				}
-
-				if transaction.ToAccountId != nil && *transaction.ToAccountId == account.Id {
-					balance = balance.Add(transaction.Amount)
-				}
-			case "refund":
-				if transaction.FromAccountId != nil && *transaction.FromAccountId == account.Id {
-					balance = balance.Add(transaction.Amount)
-				}
-
-				if transaction.ToAccountId != nil && *transaction.ToAccountId == account.Id {
-					balance = balance.Sub(transaction.Amount)
-				}
-			default:
-				return nil, errors.New("unknown transaction kind")
-			}
-		}
+	entries_balance, err := repostiories.TransactionRepository.GetEntriesBalance(account.Id.String(), account.Currency, cache_time.UTC(), now)
+	if err != nil {
+		return nil, errors.New("failed to get account entries")
+	}
+
+	balance = balance.Add(entries_balance)
+
+	pending_debits, err := repostiories.TransactionRepository.GetPendingDebits(account.Id.String(), account.Currency)
+	if err != nil {
+		return nil, errors.New("failed to get account pending debits")
+	}
+
+	held_amount, err := repostiories.HoldRepository.GetActiveHoldsAmount(account.Id.String())
+	if err != nil {
+		return nil, errors.New("failed to get account holds")
 	}
 
 	account_balance := model.AccountBalance{
-		AccountId: account.Id,
-		Balance:   balance,
-		Date:      now,
+		AccountId:        account.Id,
+		Currency:         account.Currency,
+		Balance:          balance,
+		AvailableBalance: balance.Sub(pending_debits).Sub(held_amount),
+		Date:             now,
 	}
 
 	if set_cache {
@@ -112,3 +98,156 @@ func FilterTransactionsByKind(transactions []model.Transaction, kind string) []m
 
 	return filtered_transactions
 }
+
+// GetAccountBalanceAt returns the ledger balance of the account at the given instant,
+// starting from the balance snapshot when it was taken before that instant
+func GetAccountBalanceAt(account *model.Account, at time.Time, repostiories repository.Repositories) (decimal.Decimal, error) {
+	balance := decimal.Zero
+	var since time.Time
+
+	balance_snapshot, err := repostiories.AccountRepository.GetBalanceSnapshot(account.Id.String(), account.Currency)
+	if err == nil && balance_snapshot != nil && !balance_snapshot.Date.After(at) {
+		balance = balance_snapshot.Balance
+		since = balance_snapshot.Date
+	}
+
+	entries_balance, err := repostiories.TransactionRepository.GetEntriesBalance(account.Id.String(), account.Currency, since.UTC(), at.UTC())
+	if err != nil {
+		return decimal.Zero, errors.New("failed to get account entries")
+	}
+
+	return balance.Add(entries_balance), nil
+}
+
+// BuildStatement gathers the movements booked on the account between the dates, inclusive,
+// with the balances before and after them
+func BuildStatement(account *model.Account, date_from time.Time, date_to time.Time, repostiories repository.Repositories) (*model.Statement, error) {
+	opening_balance, err := GetAccountBalanceAt(account, date_from.Add(-time.Microsecond), repostiories)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := repostiories.TransactionRepository.GetTransactionsByDate(account.Id.String(), date_from.UTC(), date_to.UTC())
+	if err != nil {
+		return nil, errors.New("failed to get account transactions")
+	}
+
+	statement := model.Statement{
+		AccountId:      account.Id,
+		AccountName:    account.Name,
+		AccountType:    account.Type,
+		Currency:       account.Currency,
+		DateFrom:       date_from,
+		DateTo:         date_to,
+		OpeningBalance: opening_balance,
+		Movements:      []model.AccountTransaction{},
+		TotalsByKind:   map[string]decimal.Decimal{},
+		TotalCredits:   decimal.Zero,
+		TotalDebits:    decimal.Zero,
+		GeneratedAt:    time.Now().UTC(),
+	}
+
+	balance := opening_balance
+	for _, transaction := range *transactions {
+		balance = balance.Add(transaction.SignedAmount)
+		running_balance := balance
+		transaction.RunningBalance = &running_balance
+
+		statement.TotalsByKind[transaction.Kind] = statement.TotalsByKind[transaction.Kind].Add(transaction.SignedAmount)
+		if transaction.SignedAmount.IsPositive() {
+			statement.TotalCredits = statement.TotalCredits.Add(transaction.SignedAmount)
+		} else {
+			statement.TotalDebits = statement.TotalDebits.Add(transaction.SignedAmount.Neg())
+		}
+
+		statement.Movements = append(statement.Movements, transaction)
+	}
+
+	statement.ClosingBalance = balance
+
+	return &statement, nil
+}
+
+// TransactionFee is the fee the account pays for a transaction of the kind, nil when its fee schedule has none
+func TransactionFee(account *model.Account, kind string, amount decimal.Decimal, repostiories repository.Repositories) (*model.Fee, error) {
+	rule, err := repostiories.FeeRepository.GetFeeRule(account.Type, account.Currency, kind)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	amount = fee.TransactionFee(rule, amount)
+	if !amount.IsPositive() {
+		return nil, nil
+	}
+
+	transaction_id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Fee{TransactionId: transaction_id, Amount: amount}, nil
+}
+
+var ErrSourceAccountNotFound = errors.New("source account not found")
+var ErrDestinationAccountNotFound = errors.New("destination account not found")
+var ErrNotAccountOwner = errors.New("user is not the owner of the account")
+
+// Transfer moves the amount from an account of the user to another account of the same currency, charging its
+// transfer fee, once checked against the limits of the source account and the fraud rules. Returns the id of the
+// transaction and what the checks made of it, its status being 'pending' when it is held for review.
+func Transfer(user *model.User, from_account_id string, to_account_id string, amount decimal.Decimal, rules *fraud.Config, repostiories repository.Repositories) (uuid.UUID, *OutboundCheck, error) {
+	account, err := repostiories.AccountRepository.GetAccount(from_account_id)
+	if err != nil {
+		return uuid.Nil, nil, ErrSourceAccountNotFound
+	}
+
+	if account.UserId.String() != user.Id.String() {
+		return uuid.Nil, nil, ErrNotAccountOwner
+	}
+
+	if !model.IsValidAmount(amount, account.Currency) {
+		return uuid.Nil, nil, repository.ErrInvalidAmount
+	}
+
+	to_account, err := repostiories.AccountRepository.GetAccount(to_account_id)
+	if err != nil {
+		return uuid.Nil, nil, ErrDestinationAccountNotFound
+	}
+
+	if to_account.Currency != account.Currency {
+		return uuid.Nil, nil, repository.ErrCurrencyMismatch
+	}
+
+	transaction_id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	transfer_fee, err := TransactionFee(account, fee.Transfer, amount, repostiories)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	check, err := CheckOutbound(rules, user, account, "transfer", transaction_id, amount, []uuid.UUID{to_account.Id}, repostiories)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	err = repostiories.TransactionRepository.CreateTransactionWithFee(transaction_id, "transfer", &from_account_id, &to_account_id, amount, check.Status, transfer_fee)
+	if err != nil {
+		ReleaseLimits(account.Id, "transfer", transaction_id, amount, repostiories)
+		return uuid.Nil, nil, err
+	}
+
+	if check.Status == "pending" {
+		_, err = HoldForReview(check, &transaction_id, nil, repostiories)
+		if err != nil {
+			return uuid.Nil, nil, err
+		}
+	}
+
+	return transaction_id, check, nil
+}